@@ -63,8 +63,8 @@ func New(
 }
 
 // GetRay is a function for generating a ray for a certain u/v for the raytraced image
-func (c Camera) GetRay(u float64, v float64) geo.Ray {
-	rd := geo.RandomInUnitDisc().MulS(c.lensRadius)
+func (c Camera) GetRay(u float64, v float64, rng *random.Rng) geo.Ray {
+	rd := geo.RandomInUnitDisc(rng).MulS(c.lensRadius)
 	offset := c.u.MulS(rd.X).Add(c.v.MulS(rd.Y))
 
 	rDir := c.lowerLeftCorner.Add(c.horizontal.MulS(u))
@@ -73,6 +73,6 @@ func (c Camera) GetRay(u float64, v float64) geo.Ray {
 	return geo.NewRay(
 		c.origin.Add(offset),
 		rDir,
-		random.RandomNormalFloat(),
+		rng.NormalFloat(),
 	)
 }
@@ -0,0 +1,477 @@
+// Command solstrale renders a scene description file to an image file.
+//
+// Usage:
+//
+//	solstrale -scene scene.yaml -width 800 -height 600 -o out.png
+//
+// Settings given as flags override the render config of the scene file.
+// Progress is reported on stderr. Interrupting with ctrl-c aborts the render
+// and writes the image rendered so far. Interrupting again quits at once.
+//
+// Output to .exr, .pfm or .hdr writes the linear scene values without clamping or
+// gamma correction. The .exr output also contains albedo and normal layers.
+// As these are only available when the render completes, an aborted render
+// does not write any hdr output. With adaptive sampling the .exr output also
+// contains a layer with the number of samples taken for each pixel.
+//
+// With -checkpoint the render state is saved periodically, and when the render
+// is aborted or done. Running the same command with -resume continues from the
+// checkpoint, where -samples can be increased to add samples to a finished render.
+//
+// Rendering can be distributed over several machines by starting workers with
+// -worker host:port, and giving their addresses with -workers to the command
+// rendering the scene. Files referenced by the scene file must be available to
+// the workers at the same paths relative to the -workerRoot directory of the worker,
+// as relative to the scene file. Workers only read files inside that directory.
+// Workers render jobs from anyone that can reach them, so they must only listen
+// on trusted networks.
+//
+// When rendering in tiles, the tiles are composed into the output image as they
+// complete, so an aborted render writes all tiles finished so far.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DanielPettersson/solstrale"
+	"github.com/DanielPettersson/solstrale/distributed"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hdrimage"
+	"github.com/DanielPettersson/solstrale/post"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+	"github.com/DanielPettersson/solstrale/tonemap"
+)
+
+type options struct {
+	scenePath          string
+	width              int
+	height             int
+	samples            int
+	seed               int64
+	shader             string
+	maxDepth           int
+	rouletteDepth      int
+	lightSampling      string
+	postProcessor      string
+	oidnPath           string
+	bloomRadius        float64
+	bloomMultiplier    float64
+	toneMapper         string
+	exposure           float64
+	noiseThreshold     float64
+	minSamples         int
+	tileSize           int
+	tileOrder          string
+	checkpointPath     string
+	checkpointInterval time.Duration
+	resume             bool
+	workerAddr         string
+	workerRoot         string
+	workers            string
+	outputPath         string
+	// explicit are the names of the flags that were given, as some flags have defaults that
+	// should only override the scene file when given
+	explicit map[string]bool
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func parseOptions(args []string) (options, error) {
+	var o options
+	fs := flag.NewFlagSet("solstrale", flag.ContinueOnError)
+	fs.StringVar(&o.scenePath, "scene", "", "path to scene description file (.json, .yaml or .yml)")
+	fs.IntVar(&o.width, "width", 800, "width of rendered image in pixels")
+	fs.IntVar(&o.height, "height", 600, "height of rendered image in pixels")
+	fs.IntVar(&o.samples, "samples", 0, "samples per pixel, overrides scene file if > 0")
+	fs.Int64Var(&o.seed, "seed", -1, "seed for random numbers, overrides scene file if >= 0")
+	fs.StringVar(&o.shader, "shader", "", "shader to use: pathTracing, misPathTracing, simple, albedo or normal. Overrides scene file if given")
+	fs.IntVar(&o.maxDepth, "maxDepth", 50, "max ray bounces for the pathTracing and misPathTracing shaders, overrides scene file if given")
+	fs.IntVar(&o.rouletteDepth, "russianRouletteDepth", 0, "ray bounce from where paths are randomly terminated by the pathTracing and misPathTracing shaders. 0 disables it. Overrides scene file if given")
+	fs.StringVar(&o.lightSampling, "lightSampling", "", "how lights are chosen for sampling: power, uniform or tree. Overrides scene file if given")
+	fs.StringVar(&o.postProcessor, "post", "", "post processor to use: none, bloom or oidn. Overrides scene file if given")
+	fs.StringVar(&o.oidnPath, "oidn", "oidnDenoise", "path to the Open Image Denoise executable, used by the oidn post processor")
+	fs.Float64Var(&o.bloomRadius, "bloomRadius", .5, "blur radius used by the bloom post processor")
+	fs.Float64Var(&o.bloomMultiplier, "bloomMultiplier", .15, "bloom multiplier used by the bloom post processor")
+	fs.StringVar(&o.toneMapper, "toneMap", "", "tone mapper to use: none, clamp, reinhard or acesFilmic. Overrides scene file if given")
+	fs.Float64Var(&o.exposure, "exposure", 0, "exposure in stops used by the tone mapper given with -toneMap")
+	fs.Float64Var(&o.noiseThreshold, "noiseThreshold", 0, "enables adaptive sampling with this noise threshold if > 0, where -samples is the max samples per pixel")
+	fs.IntVar(&o.minSamples, "minSamples", 16, "min samples per pixel for adaptive sampling")
+	fs.IntVar(&o.tileSize, "tileSize", 0, "render in tiles of this size in pixels, overrides scene file if > 0")
+	fs.StringVar(&o.tileOrder, "tileOrder", "", "order of tiles: scanline, spiral or hilbert. Enables tile rendering if given")
+	fs.StringVar(&o.checkpointPath, "checkpoint", "", "path of checkpoint file, enables saving of checkpoints if given")
+	fs.DurationVar(&o.checkpointInterval, "checkpointInterval", 5*time.Minute, "min time between saving checkpoints")
+	fs.BoolVar(&o.resume, "resume", false, "resume the render from the checkpoint file, if it exists")
+	fs.StringVar(&o.workerAddr, "worker", "", "run as a worker serving render jobs on this address, e.g. :8080")
+	fs.StringVar(&o.workerRoot, "workerRoot", ".", "directory of the files referenced by scene files rendered by the worker")
+	fs.StringVar(&o.workers, "workers", "", "comma separated addresses of workers to distribute the render on")
+	fs.StringVar(&o.outputPath, "o", "out.png", "path of output image (.png, .jpg, .exr, .pfm or .hdr)")
+
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	o.explicit = map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { o.explicit[f.Name] = true })
+	if o.workerAddr != "" {
+		return o, nil
+	}
+	if o.scenePath == "" {
+		return o, errors.New("a scene file must be given with -scene")
+	}
+	if o.width < 1 || o.height < 1 {
+		return o, fmt.Errorf("invalid image size %vx%v", o.width, o.height)
+	}
+	if o.resume && o.checkpointPath == "" {
+		return o, errors.New("a checkpoint file must be given with -checkpoint to resume")
+	}
+	if o.workers != "" {
+		// Workers render the scene as given in the scene file
+		if o.shader != "" || o.depthGiven() || o.lightSampling != "" || o.noiseThreshold > 0 || o.checkpointPath != "" {
+			return o, errors.New("-shader, -maxDepth, -russianRouletteDepth, -lightSampling, -noiseThreshold and -checkpoint can not be combined with -workers")
+		}
+	}
+	return o, nil
+}
+
+// depthGiven returns if any of the flags for the depth of path tracing shaders were given
+func (o options) depthGiven() bool {
+	return o.explicit["maxDepth"] || o.explicit["russianRouletteDepth"]
+}
+
+func run(args []string) error {
+	o, err := parseOptions(args)
+	if err != nil {
+		return err
+	}
+
+	if o.workerAddr != "" {
+		fmt.Fprintf(os.Stderr, "Worker listening on %v\n", o.workerAddr)
+		return http.ListenAndServe(o.workerAddr, distributed.NewWorker(o.workerRoot))
+	}
+
+	// Fail early on unsupported output, rather than after a long render
+	hdrOutput, err := isHdrOutput(o.outputPath)
+	if err != nil {
+		return err
+	}
+
+	s, err := scene.Load(o.scenePath)
+	if err != nil {
+		return err
+	}
+	if err := applyOverrides(&s.RenderConfig, o); err != nil {
+		return err
+	}
+	if o.checkpointPath != "" {
+		hash, err := sceneHash(o)
+		if err != nil {
+			return err
+		}
+		s.RenderConfig.Checkpoint = &renderer.CheckpointConfig{
+			Path:      o.checkpointPath,
+			Interval:  o.checkpointInterval,
+			Resume:    o.resume,
+			SceneHash: hash,
+		}
+	}
+
+	abort := make(chan bool, 1)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		// Later interrupts get the default behaviour, so that they quit if the abort is slow
+		signal.Stop(interrupt)
+		fmt.Fprintln(os.Stderr, "\nAborting render, interrupt again to quit")
+		select {
+		case abort <- true:
+		default:
+		}
+	}()
+
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	if o.workers != "" {
+		description, err := sceneDescription(o.scenePath)
+		if err != nil {
+			return err
+		}
+		go distributed.RayTrace(strings.Split(o.workers, ","), description, o.width, o.height, s, renderProgress, abort)
+	} else {
+		go solstrale.RayTrace(o.width, o.height, s, renderProgress, abort)
+	}
+
+	var img image.Image
+	var canvas *image.RGBA
+	var buffers *renderer.RenderBuffers
+	for p := range renderProgress {
+		if p.Error != nil {
+			fmt.Fprintln(os.Stderr)
+			return p.Error
+		}
+		if p.RenderImage != nil {
+			img = p.RenderImage
+		}
+		if p.Tile != nil {
+			if canvas == nil {
+				canvas = image.NewRGBA(image.Rect(0, 0, o.width, o.height))
+				img = canvas
+			}
+			draw.Draw(canvas, p.Tile.Image.Bounds().Add(image.Pt(p.Tile.X, p.Tile.Y)), p.Tile.Image, image.Point{}, draw.Src)
+		}
+		if p.Buffers != nil {
+			buffers = p.Buffers
+		}
+		fmt.Fprintf(os.Stderr, "\rRendering %5.1f%%", p.Progress*100)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if hdrOutput {
+		if buffers == nil {
+			return errors.New("render did not complete, no hdr output is written")
+		}
+		layers := []hdrimage.Layer{
+			{Pixels: buffers.Color},
+			{Name: "albedo", Pixels: buffers.Albedo},
+			{Name: "normal", Pixels: buffers.Normal},
+		}
+		if s.RenderConfig.Adaptive != nil {
+			layers = append(layers, hdrimage.Layer{Name: "samples", Pixels: sampleCountPixels(buffers.SampleCounts)})
+		}
+		return hdrimage.Save(o.outputPath, buffers.Width, buffers.Height, layers...)
+	}
+	if img == nil {
+		return errors.New("render produced no image")
+	}
+	return writeImage(o.outputPath, img)
+}
+
+// applyOverrides changes the render config given by the scene file with the options given as flags
+func applyOverrides(rc *renderer.RenderConfig, o options) error {
+	if o.samples > 0 {
+		rc.SamplesPerPixel = o.samples
+	}
+	if o.seed >= 0 {
+		rc.Seed = uint64(o.seed)
+	}
+
+	switch o.shader {
+	case "":
+	case "pathTracing":
+		rc.Shader = renderer.PathTracingShader{MaxDepth: o.maxDepth, RussianRouletteDepth: o.rouletteDepth}
+	case "misPathTracing":
+		rc.Shader = renderer.MisPathTracingShader{MaxDepth: o.maxDepth, RussianRouletteDepth: o.rouletteDepth}
+	case "simple":
+		rc.Shader = renderer.SimpleShader{}
+	case "albedo":
+		rc.Shader = renderer.AlbedoShader{}
+	case "normal":
+		rc.Shader = renderer.NormalShader{}
+	default:
+		return fmt.Errorf("unknown shader: %v", o.shader)
+	}
+
+	// The depth flags also change the path tracing shader of the scene file
+	if o.depthGiven() {
+		switch shader := rc.Shader.(type) {
+		case renderer.PathTracingShader:
+			shader.MaxDepth, shader.RussianRouletteDepth = o.depth(shader.MaxDepth, shader.RussianRouletteDepth)
+			rc.Shader = shader
+		case renderer.MisPathTracingShader:
+			shader.MaxDepth, shader.RussianRouletteDepth = o.depth(shader.MaxDepth, shader.RussianRouletteDepth)
+			rc.Shader = shader
+		default:
+			return errors.New("-maxDepth and -russianRouletteDepth need the pathTracing or misPathTracing shader")
+		}
+	}
+
+	switch o.postProcessor {
+	case "":
+	case "none":
+		rc.PostProcessor = nil
+	case "bloom":
+		rc.PostProcessor = post.NewBloom(o.bloomRadius, o.bloomMultiplier)
+	case "oidn":
+		p, err := post.NewOidn(o.oidnPath)
+		if err != nil {
+			return err
+		}
+		rc.PostProcessor = p
+	default:
+		return fmt.Errorf("unknown post processor: %v", o.postProcessor)
+	}
+
+	switch o.lightSampling {
+	case "":
+	case "power":
+		rc.LightSampling = renderer.LightSamplingPower
+	case "uniform":
+		rc.LightSampling = renderer.LightSamplingUniform
+	case "tree":
+		rc.LightSampling = renderer.LightSamplingTree
+	default:
+		return fmt.Errorf("unknown light sampling: %v", o.lightSampling)
+	}
+
+	switch o.toneMapper {
+	case "":
+	case "none":
+		rc.ToneMapper = nil
+	case "clamp":
+		rc.ToneMapper = tonemap.NewClamp(o.exposure)
+	case "reinhard":
+		rc.ToneMapper = tonemap.NewReinhard(o.exposure, 0)
+	case "acesFilmic":
+		rc.ToneMapper = tonemap.NewAcesFilmic(o.exposure)
+	default:
+		return fmt.Errorf("unknown tone mapper: %v", o.toneMapper)
+	}
+	if o.explicit["exposure"] && (o.toneMapper == "" || o.toneMapper == "none") {
+		return errors.New("-exposure needs a tone mapper given with -toneMap")
+	}
+
+	if o.noiseThreshold > 0 {
+		rc.Adaptive = &renderer.AdaptiveConfig{
+			MinSamples:     o.minSamples,
+			NoiseThreshold: o.noiseThreshold,
+		}
+	}
+
+	if o.tileSize > 0 || o.tileOrder != "" {
+		if rc.Tiles == nil {
+			rc.Tiles = &renderer.TileConfig{}
+		}
+		if o.tileSize > 0 {
+			rc.Tiles.Size = o.tileSize
+		}
+		switch o.tileOrder {
+		case "":
+		case "scanline":
+			rc.Tiles.Order = renderer.TileOrderScanline
+		case "spiral":
+			rc.Tiles.Order = renderer.TileOrderSpiral
+		case "hilbert":
+			rc.Tiles.Order = renderer.TileOrderHilbert
+		default:
+			return fmt.Errorf("unknown tile order: %v", o.tileOrder)
+		}
+	}
+
+	return nil
+}
+
+// depth returns the max depth and russian roulette depth of a shader, with those given as flags
+func (o options) depth(maxDepth, rouletteDepth int) (int, int) {
+	if o.explicit["maxDepth"] {
+		maxDepth = o.maxDepth
+	}
+	if o.explicit["russianRouletteDepth"] {
+		rouletteDepth = o.rouletteDepth
+	}
+	return maxDepth, rouletteDepth
+}
+
+// sceneDescription reads the scene file to be sent to workers
+func sceneDescription(path string) (distributed.SceneDescription, error) {
+	format, err := scene.FormatFromPath(path)
+	if err != nil {
+		return distributed.SceneDescription{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return distributed.SceneDescription{}, fmt.Errorf("failed to read scene file: %v", err.Error())
+	}
+
+	return distributed.SceneDescription{
+		Data:   data,
+		Format: format,
+	}, nil
+}
+
+// sceneHash identifies the scene for checkpoints. It is a hash of the scene file and the
+// options that change the sample values. Files referenced by the scene file are not included.
+func sceneHash(o options) (string, error) {
+	data, err := os.ReadFile(o.scenePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read scene file: %v", err.Error())
+	}
+
+	h := sha256.New()
+	h.Write(data)
+	fmt.Fprintf(h, "\x00%v\x00%v", o.shader, o.lightSampling)
+	if o.shader == "pathTracing" || o.shader == "misPathTracing" || o.depthGiven() {
+		fmt.Fprintf(h, "\x00%v\x00%v", o.maxDepth, o.rouletteDepth)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sampleCountPixels converts sample counts to gray pixels, so that they can be saved as an image layer
+func sampleCountPixels(sampleCounts []int) []geo.Vec3 {
+	ret := make([]geo.Vec3, len(sampleCounts))
+	for i, n := range sampleCounts {
+		ret[i] = geo.NewVec3(float64(n), float64(n), float64(n))
+	}
+	return ret
+}
+
+// isHdrOutput returns if the output path is of an hdr image format, or an error if the format is not supported
+func isHdrOutput(path string) (bool, error) {
+	if hdrimage.IsSupported(path) {
+		return true, nil
+	}
+	if _, err := imageEncoder(path); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+func imageEncoder(path string) (func(f *os.File, img image.Image) error, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return func(f *os.File, img image.Image) error {
+			return png.Encode(f, img)
+		}, nil
+	case ".jpg", ".jpeg":
+		return func(f *os.File, img image.Image) error {
+			return jpeg.Encode(f, img, &jpeg.Options{Quality: 95})
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output image extension: %v", path)
+	}
+}
+
+func writeImage(path string, img image.Image) error {
+	encode, err := imageEncoder(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output image: %v", err.Error())
+	}
+	if err := encode(f, img); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to encode output image: %v", err.Error())
+	}
+	return f.Close()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/post"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/tonemap"
+	"github.com/stretchr/testify/assert"
+)
+
+// sceneRenderConfig is a render config as given by a scene file
+func sceneRenderConfig() renderer.RenderConfig {
+	return renderer.RenderConfig{
+		SamplesPerPixel: 4,
+		Seed:            7,
+		Shader:          renderer.SimpleShader{},
+		PostProcessor:   post.NewBloom(.5, .15),
+		Tiles:           &renderer.TileConfig{Size: 16, Order: renderer.TileOrderSpiral},
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected func(rc *renderer.RenderConfig)
+	}{
+		{nil, func(rc *renderer.RenderConfig) {}},
+		{[]string{"-samples", "16", "-seed", "3"}, func(rc *renderer.RenderConfig) {
+			rc.SamplesPerPixel = 16
+			rc.Seed = 3
+		}},
+		{[]string{"-seed", "0"}, func(rc *renderer.RenderConfig) { rc.Seed = 0 }},
+		{[]string{"-shader", "pathTracing", "-maxDepth", "10", "-russianRouletteDepth", "3"}, func(rc *renderer.RenderConfig) {
+			rc.Shader = renderer.PathTracingShader{MaxDepth: 10, RussianRouletteDepth: 3}
+		}},
+		{[]string{"-shader", "misPathTracing"}, func(rc *renderer.RenderConfig) {
+			rc.Shader = renderer.MisPathTracingShader{MaxDepth: 50}
+		}},
+		{[]string{"-shader", "normal"}, func(rc *renderer.RenderConfig) { rc.Shader = renderer.NormalShader{} }},
+		{[]string{"-post", "none"}, func(rc *renderer.RenderConfig) { rc.PostProcessor = nil }},
+		{[]string{"-post", "bloom", "-bloomRadius", "1"}, func(rc *renderer.RenderConfig) { rc.PostProcessor = post.NewBloom(1, .15) }},
+		{[]string{"-lightSampling", "tree"}, func(rc *renderer.RenderConfig) { rc.LightSampling = renderer.LightSamplingTree }},
+		{[]string{"-toneMap", "reinhard", "-exposure", "1"}, func(rc *renderer.RenderConfig) { rc.ToneMapper = tonemap.NewReinhard(1, 0) }},
+		{[]string{"-noiseThreshold", ".05", "-minSamples", "8"}, func(rc *renderer.RenderConfig) {
+			rc.Adaptive = &renderer.AdaptiveConfig{MinSamples: 8, NoiseThreshold: .05}
+		}},
+		{[]string{"-tileSize", "64"}, func(rc *renderer.RenderConfig) {
+			rc.Tiles = &renderer.TileConfig{Size: 64, Order: renderer.TileOrderSpiral}
+		}},
+		{[]string{"-tileOrder", "hilbert"}, func(rc *renderer.RenderConfig) {
+			rc.Tiles = &renderer.TileConfig{Size: 16, Order: renderer.TileOrderHilbert}
+		}},
+	}
+
+	for _, test := range tests {
+		o, err := parseOptions(append([]string{"-scene", "scene.json"}, test.args...))
+		assert.Nil(t, err)
+
+		rc := sceneRenderConfig()
+		assert.Nil(t, applyOverrides(&rc, o), test.args)
+
+		expected := sceneRenderConfig()
+		test.expected(&expected)
+		assert.Equal(t, expected, rc, test.args)
+	}
+
+	// Tiles are enabled by the tile flags, when the scene file renders without tiles
+	o, err := parseOptions([]string{"-scene", "scene.json", "-tileOrder", "scanline"})
+	assert.Nil(t, err)
+	rc := renderer.RenderConfig{}
+	assert.Nil(t, applyOverrides(&rc, o))
+	assert.Equal(t, &renderer.TileConfig{Order: renderer.TileOrderScanline}, rc.Tiles)
+}
+
+func TestApplyOverridesToSceneShader(t *testing.T) {
+	tests := []struct {
+		args     []string
+		shader   renderer.Shader
+		expected renderer.Shader
+	}{
+		{
+			[]string{"-maxDepth", "8"},
+			renderer.PathTracingShader{MaxDepth: 20, RussianRouletteDepth: 5},
+			renderer.PathTracingShader{MaxDepth: 8, RussianRouletteDepth: 5},
+		},
+		{
+			[]string{"-russianRouletteDepth", "3"},
+			renderer.MisPathTracingShader{MaxDepth: 20, RussianRouletteDepth: 5, MaxSampleValue: 10},
+			renderer.MisPathTracingShader{MaxDepth: 20, RussianRouletteDepth: 3, MaxSampleValue: 10},
+		},
+		{
+			[]string{"-maxDepth", "50"},
+			renderer.PathTracingShader{MaxDepth: 20},
+			renderer.PathTracingShader{MaxDepth: 50},
+		},
+		{
+			nil,
+			renderer.PathTracingShader{MaxDepth: 20, RussianRouletteDepth: 5},
+			renderer.PathTracingShader{MaxDepth: 20, RussianRouletteDepth: 5},
+		},
+	}
+
+	for _, test := range tests {
+		o, err := parseOptions(append([]string{"-scene", "scene.json"}, test.args...))
+		assert.Nil(t, err)
+
+		rc := sceneRenderConfig()
+		rc.Shader = test.shader
+		assert.Nil(t, applyOverrides(&rc, o), test.args)
+		assert.Equal(t, test.expected, rc.Shader, test.args)
+	}
+}
+
+func TestApplyOverridesErrors(t *testing.T) {
+	tests := []struct {
+		args          []string
+		expectedError string
+	}{
+		{[]string{"-shader", "whitted"}, "unknown shader: whitted"},
+		{[]string{"-post", "sharpen"}, "unknown post processor: sharpen"},
+		{[]string{"-lightSampling", "random"}, "unknown light sampling: random"},
+		{[]string{"-toneMap", "filmic"}, "unknown tone mapper: filmic"},
+		{[]string{"-tileOrder", "random"}, "unknown tile order: random"},
+		{[]string{"-maxDepth", "8"}, "-maxDepth and -russianRouletteDepth need the pathTracing or misPathTracing shader"},
+		{[]string{"-shader", "normal", "-russianRouletteDepth", "3"}, "-maxDepth and -russianRouletteDepth need the pathTracing or misPathTracing shader"},
+		{[]string{"-exposure", "1"}, "-exposure needs a tone mapper given with -toneMap"},
+		{[]string{"-toneMap", "none", "-exposure", "1"}, "-exposure needs a tone mapper given with -toneMap"},
+	}
+
+	for _, test := range tests {
+		o, err := parseOptions(append([]string{"-scene", "scene.json"}, test.args...))
+		assert.Nil(t, err)
+
+		rc := sceneRenderConfig()
+		assert.EqualError(t, applyOverrides(&rc, o), test.expectedError)
+	}
+}
+
+func TestParseOptionsErrors(t *testing.T) {
+	tests := []struct {
+		args          []string
+		expectedError string
+	}{
+		{nil, "a scene file must be given with -scene"},
+		{[]string{"-scene", "scene.json", "-width", "0"}, "invalid image size 0x600"},
+		{[]string{"-scene", "scene.json", "-resume"}, "a checkpoint file must be given with -checkpoint to resume"},
+		{
+			[]string{"-scene", "scene.json", "-workers", "a:1", "-shader", "simple"},
+			"-shader, -maxDepth, -russianRouletteDepth, -lightSampling, -noiseThreshold and -checkpoint can not be combined with -workers",
+		},
+		{
+			[]string{"-scene", "scene.json", "-workers", "a:1", "-maxDepth", "8"},
+			"-shader, -maxDepth, -russianRouletteDepth, -lightSampling, -noiseThreshold and -checkpoint can not be combined with -workers",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := parseOptions(test.args)
+		assert.EqualError(t, err, test.expectedError)
+	}
+}
+
+func TestIsHdrOutput(t *testing.T) {
+	tests := []struct {
+		path          string
+		hdr           bool
+		expectedError string
+	}{
+		{"out.png", false, ""},
+		{"out.JPG", false, ""},
+		{"out.jpeg", false, ""},
+		{"out.exr", true, ""},
+		{"out.pfm", true, ""},
+		{"out.HDR", true, ""},
+		{"out.gif", false, "unsupported output image extension: out.gif"},
+		{"out", false, "unsupported output image extension: out"},
+	}
+
+	for _, test := range tests {
+		hdr, err := isHdrOutput(test.path)
+		assert.Equal(t, test.hdr, hdr, test.path)
+		if test.expectedError == "" {
+			assert.Nil(t, err, test.path)
+		} else {
+			assert.EqualError(t, err, test.expectedError)
+		}
+	}
+}
+
+func TestSceneHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scene.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"world": []}`), 0644))
+
+	hash := func(args ...string) string {
+		o, err := parseOptions(append([]string{"-scene", path}, args...))
+		assert.Nil(t, err)
+		h, err := sceneHash(o)
+		assert.Nil(t, err)
+		return h
+	}
+
+	assert.Equal(t, hash(), hash("-samples", "100", "-width", "10"))
+	assert.NotEqual(t, hash(), hash("-shader", "simple"))
+	assert.NotEqual(t, hash("-shader", "pathTracing"), hash("-shader", "pathTracing", "-maxDepth", "10"))
+	// The depth flags also change the shader of the scene file
+	assert.NotEqual(t, hash(), hash("-maxDepth", "10"))
+	assert.NotEqual(t, hash("-maxDepth", "10"), hash("-maxDepth", "10", "-russianRouletteDepth", "3"))
+	assert.Equal(t, hash(), hash("-toneMap", "reinhard", "-exposure", "1"))
+
+	before := hash()
+	assert.Nil(t, os.WriteFile(path, []byte(`{"world": [{}]}`), 0644))
+	assert.NotEqual(t, before, hash())
+}
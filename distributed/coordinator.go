@@ -0,0 +1,302 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/tonemap"
+)
+
+// Number of jobs per worker the samples are split into. More jobs than workers
+// evens out the load when workers are of different speed
+const jobsPerWorker = 4
+
+// jobResult is the outcome of sending a job to a worker
+type jobResult struct {
+	worker  string
+	job     Job
+	buffers *renderer.RenderBuffers
+	err     error
+}
+
+// sampleSums contains the merged samples of all finished jobs
+type sampleSums struct {
+	width        int
+	height       int
+	colors       []geo.Vec3
+	albedos      []geo.Vec3
+	normals      []geo.Vec3
+	sampleCounts []int
+}
+
+// RayTrace renders the scene on the workers and reports progress on the output channel, like solstrale.RayTrace.
+// Workers are given as host:port or as a http url. The scene description is sent to the workers, while
+// the number of samples, the seed, the post processor and the tone mapper are taken from the render
+// config of the given scene. A worker that fails a job is not used again, and the job is retried
+// on another worker. Listens to abort channel for aborting a started ray trace operation.
+func RayTrace(
+	workers []string,
+	description SceneDescription,
+	width, height int,
+	scene *renderer.Scene,
+	output chan<- renderer.RenderProgress,
+	abort <-chan bool,
+) {
+	defer close(output)
+
+	if len(workers) == 0 {
+		output <- renderer.RenderProgress{
+			Error: errors.New("No workers to render on"),
+		}
+		return
+	}
+
+	rc := scene.RenderConfig
+	pending := splitSamples(rc.SamplesPerPixel, len(workers)*jobsPerWorker)
+	for i := range pending {
+		pending[i].Scene = description
+		pending[i].Width = width
+		pending[i].Height = height
+		pending[i].Seed = rc.Seed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idle := make([]string, len(workers))
+	for i, w := range workers {
+		idle[i] = workerUrl(w)
+	}
+	results := make(chan jobResult)
+	running := 0
+
+	sums := newSampleSums(width, height)
+	totalSamples := float64(rc.SamplesPerPixel)
+	renderedSamples := 0
+	var lastErr error
+
+	for len(pending) > 0 || running > 0 {
+		for len(idle) > 0 && len(pending) > 0 {
+			go sendJob(ctx, idle[0], pending[0], results)
+			idle = idle[1:]
+			pending = pending[1:]
+			running++
+		}
+		if running == 0 {
+			output <- renderer.RenderProgress{
+				Error: errors.New(fmt.Sprintf("All workers failed. Last error: %v", lastErr.Error())),
+			}
+			return
+		}
+
+		select {
+		case res := <-results:
+			running--
+			if res.err != nil {
+				lastErr = res.err
+				pending = append(pending, res.job)
+				continue
+			}
+			if err := sums.add(res.buffers); err != nil {
+				lastErr = errors.New(fmt.Sprintf("Invalid response from worker %v: %v", res.worker, err.Error()))
+				pending = append(pending, res.job)
+				continue
+			}
+			idle = append(idle, res.worker)
+
+			renderedSamples += res.job.SampleEnd - res.job.SampleStart
+			if len(pending) > 0 || running > 0 {
+				output <- renderer.RenderProgress{
+					Progress:    float64(renderedSamples) / totalSamples,
+					RenderImage: sums.renderImage(rc.ToneMapper),
+				}
+			}
+		case <-abort:
+			// Wait for the cancelled jobs to return before closing the output
+			cancel()
+			for ; running > 0; running-- {
+				<-results
+			}
+			return
+		}
+	}
+
+	buffers := sums.buffers()
+	if rc.PostProcessor == nil {
+		output <- renderer.RenderProgress{
+			Progress:    1,
+			RenderImage: sums.renderImage(rc.ToneMapper),
+			Buffers:     buffers,
+		}
+		return
+	}
+	output <- renderer.RenderProgress{
+		Progress:    1,
+		RenderImage: sums.renderImage(rc.ToneMapper),
+	}
+
+	img, err := rc.PostProcessor.PostProcess(buffers.Color, buffers.Albedo, buffers.Normal, width, height, 1, rc.ToneMapper)
+	if err != nil {
+		output <- renderer.RenderProgress{
+			Error: err,
+		}
+		return
+	}
+	output <- renderer.RenderProgress{
+		Progress:    1,
+		RenderImage: img,
+		Buffers:     buffers,
+	}
+}
+
+// splitSamples splits the samples into at most numJobs jobs of about equal size
+func splitSamples(samplesPerPixel, numJobs int) []Job {
+	if numJobs > samplesPerPixel {
+		numJobs = samplesPerPixel
+	}
+
+	jobs := make([]Job, numJobs)
+	start := 1
+	for i := range jobs {
+		end := 1 + samplesPerPixel*(i+1)/numJobs
+		jobs[i].SampleStart = start
+		jobs[i].SampleEnd = end
+		start = end
+	}
+	return jobs
+}
+
+func workerUrl(worker string) string {
+	if strings.Contains(worker, "://") {
+		return strings.TrimSuffix(worker, "/")
+	}
+	return "http://" + worker
+}
+
+// sendJob sends the job to the worker and reports the result
+func sendJob(ctx context.Context, worker string, job Job, results chan<- jobResult) {
+	buffers, err := postJob(ctx, worker, job)
+	if err != nil {
+		err = errors.New(fmt.Sprintf("Worker %v failed: %v", worker, err.Error()))
+	}
+	results <- jobResult{
+		worker:  worker,
+		job:     job,
+		buffers: buffers,
+		err:     err,
+	}
+}
+
+func postJob(ctx context.Context, worker string, job Job) (*renderer.RenderBuffers, error) {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(job); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, worker+renderPath, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(strings.TrimSpace(string(msg)))
+	}
+
+	var buffers renderer.RenderBuffers
+	if err := gob.NewDecoder(resp.Body).Decode(&buffers); err != nil {
+		return nil, err
+	}
+	return &buffers, nil
+}
+
+func newSampleSums(width, height int) *sampleSums {
+	pixelCount := width * height
+	return &sampleSums{
+		width:        width,
+		height:       height,
+		colors:       make([]geo.Vec3, pixelCount),
+		albedos:      make([]geo.Vec3, pixelCount),
+		normals:      make([]geo.Vec3, pixelCount),
+		sampleCounts: make([]int, pixelCount),
+	}
+}
+
+// add merges the averaged samples of the buffers, weighted by their number of samples
+func (s *sampleSums) add(b *renderer.RenderBuffers) error {
+	pixelCount := s.width * s.height
+	if b.Width != s.width || b.Height != s.height {
+		return errors.New(fmt.Sprintf("Expected image size %vx%v, got %vx%v", s.width, s.height, b.Width, b.Height))
+	}
+	for _, n := range []int{len(b.Color), len(b.Albedo), len(b.Normal), len(b.SampleCounts)} {
+		if n != pixelCount {
+			return errors.New(fmt.Sprintf("Expected %v pixels, got %v", pixelCount, n))
+		}
+	}
+
+	for i, n := range b.SampleCounts {
+		samples := float64(n)
+		s.colors[i] = s.colors[i].Add(b.Color[i].MulS(samples))
+		s.albedos[i] = s.albedos[i].Add(b.Albedo[i].MulS(samples))
+		s.normals[i] = s.normals[i].Add(b.Normal[i].MulS(samples))
+		s.sampleCounts[i] += n
+	}
+	return nil
+}
+
+// renderImage creates the image of the samples merged so far
+func (s *sampleSums) renderImage(toneMapper tonemap.ToneMapper) im.RenderImage {
+	ret := make([]color.RGBA, len(s.colors))
+	for i, col := range s.colors {
+		samples := s.sampleCounts[i]
+		if samples == 0 {
+			samples = 1
+		}
+		ret[i] = im.ToDisplayRgba(col, samples, toneMapper)
+	}
+	return im.RenderImage{
+		ImageWidth:  s.width,
+		ImageHeight: s.height,
+		Data:        ret,
+	}
+}
+
+// buffers averages the merged samples into render buffers
+func (s *sampleSums) buffers() *renderer.RenderBuffers {
+	average := func(sums []geo.Vec3) []geo.Vec3 {
+		ret := make([]geo.Vec3, len(sums))
+		for i, sum := range sums {
+			ret[i] = sum.DivS(float64(s.sampleCounts[i]))
+		}
+		return ret
+	}
+
+	sampleCounts := make([]int, len(s.sampleCounts))
+	copy(sampleCounts, s.sampleCounts)
+
+	return &renderer.RenderBuffers{
+		Width:        s.width,
+		Height:       s.height,
+		Color:        average(s.colors),
+		Albedo:       average(s.albedos),
+		Normal:       average(s.normals),
+		SampleCounts: sampleCounts,
+	}
+}
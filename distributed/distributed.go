@@ -0,0 +1,71 @@
+// Package distributed provides rendering of a scene on several worker processes.
+//
+// A coordinator splits the samples per pixel of the image into ranges, that are sent as jobs
+// to workers over HTTP. The workers render their sample ranges of the whole image and
+// return the averaged float buffers, which the coordinator merges into the final image.
+// As samples are seeded by their number, the merged image is the same as when
+// rendering all samples in one process, except for rounding.
+//
+// The scene is sent to the workers as a scene description, as read by the scene package.
+// Files referenced by the scene description, like textures and models, are not sent,
+// so they must be available to the workers at the same paths relative to the root directory
+// of the worker, as relative to the scene description for the coordinator. Workers only
+// read files inside their root directory.
+//
+// Workers render any job sent to them, and there is no authentication or encryption,
+// so workers must only listen on trusted networks.
+package distributed
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DanielPettersson/solstrale/scene"
+)
+
+// renderPath is the path of the worker endpoint that renders jobs
+const renderPath = "/render"
+
+// Limits of the jobs that workers render, so that a job can not make a worker use unbounded memory or time
+const (
+	// maxJobBytes is the max size of an encoded job, that is mostly the scene description
+	maxJobBytes = 16 << 20
+	// maxJobPixels is the max number of pixels in the image of a job, like 8192x8192
+	maxJobPixels = 1 << 26
+	// maxJobSamples is the max number of samples per pixel in a job
+	maxJobSamples = 1 << 20
+)
+
+// SceneDescription is a scene description document sent to the workers
+type SceneDescription struct {
+	Data   []byte
+	Format scene.Format
+}
+
+// Job is a request for a worker to render a range of samples for all pixels of the image
+type Job struct {
+	Scene  SceneDescription
+	Width  int
+	Height int
+	Seed   uint64
+	// SampleStart and SampleEnd is the range of samples to render, where the end is excluded.
+	// Samples are numbered from 1
+	SampleStart int
+	SampleEnd   int
+}
+
+func (j Job) validate() error {
+	if j.Width < 1 || j.Height < 1 {
+		return errors.New(fmt.Sprintf("Invalid image size %vx%v", j.Width, j.Height))
+	}
+	if j.Width > maxJobPixels/j.Height {
+		return errors.New(fmt.Sprintf("Image size %vx%v is more than %v pixels", j.Width, j.Height, maxJobPixels))
+	}
+	if j.SampleStart < 1 || j.SampleEnd <= j.SampleStart {
+		return errors.New(fmt.Sprintf("Invalid sample range %v to %v", j.SampleStart, j.SampleEnd))
+	}
+	if j.SampleEnd-j.SampleStart > maxJobSamples {
+		return errors.New(fmt.Sprintf("Sample range %v to %v is more than %v samples", j.SampleStart, j.SampleEnd, maxJobSamples))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package distributed
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+)
+
+type worker struct {
+	rootDir string
+	// Only one job is rendered at a time, as each render uses all cpus
+	mutex sync.Mutex
+}
+
+// NewWorker creates a http handler that renders jobs sent by a coordinator.
+// The response to a job is the render buffers of the rendered samples.
+// Paths in the scene descriptions of jobs are resolved from the root directory,
+// and files outside of it can not be read.
+func NewWorker(rootDir string) http.Handler {
+	return &worker{rootDir: rootDir}
+}
+
+func (w *worker) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != renderPath {
+		http.NotFound(rw, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var job Job
+	body := http.MaxBytesReader(rw, req.Body, maxJobBytes)
+	if err := gob.NewDecoder(body).Decode(&job); err != nil {
+		http.Error(rw, "Failed to decode job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := job.validate(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	buffers, err := renderJob(req.Context(), job, w.rootDir)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	gob.NewEncoder(rw).Encode(buffers)
+}
+
+// renderJob renders the samples of the job, with the files of the scene in the root directory.
+// Aborts the render if the context is cancelled
+func renderJob(ctx context.Context, job Job, rootDir string) (*renderer.RenderBuffers, error) {
+	s, err := scene.ParseInRoot(job.Scene.Data, job.Scene.Format, rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Post processing, tone mapping and checkpoints are done by the coordinator
+	rc := &s.RenderConfig
+	rc.Seed = job.Seed
+	rc.SampleOffset = job.SampleStart - 1
+	rc.SamplesPerPixel = job.SampleEnd - job.SampleStart
+	rc.PostProcessor = nil
+	rc.Tiles = nil
+	rc.Checkpoint = nil
+
+	output := make(chan renderer.RenderProgress, 1)
+	abort := make(chan bool, 1)
+	r, err := renderer.NewRenderer(s, output, abort)
+	if err != nil {
+		return nil, err
+	}
+	go r.Render(job.Width, job.Height)
+
+	var buffers *renderer.RenderBuffers
+	done := ctx.Done()
+	for {
+		select {
+		case p, ok := <-output:
+			if !ok {
+				if buffers == nil {
+					return nil, errors.New("Render was aborted")
+				}
+				return buffers, nil
+			}
+			if p.Error != nil {
+				return nil, p.Error
+			}
+			if p.Buffers != nil {
+				buffers = p.Buffers
+			}
+		case <-done:
+			abort <- true
+			done = nil
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package environment provides the light coming from far away in all directions, like a sky.
+// Rays that do not hit anything in the scene get the color of the environment.
+package environment
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/pdf"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// Environment is the light coming from far away in all directions.
+// As a pdf it samples directions towards the brighter parts of the environment,
+// so that it can be used as a light
+type Environment interface {
+	pdf.Pdf
+	// Color returns the light coming from the direction
+	Color(direction geo.Vec3) geo.Vec3
+}
+
+// constant is an environment with the same color in all directions
+type constant struct {
+	color geo.Vec3
+}
+
+// NewConstant creates an environment with the same color in all directions
+func NewConstant(color geo.Vec3) Environment {
+	return constant{color: color}
+}
+
+// Color returns the color of the environment
+func (c constant) Color(direction geo.Vec3) geo.Vec3 {
+	return c.color
+}
+
+// Value returns the pdf value of uniformly sampled directions
+func (c constant) Value(direction geo.Vec3) float64 {
+	return pdf.SpherePdfValue
+}
+
+// Generate returns a uniformly sampled direction
+func (c constant) Generate(rng *random.Rng) geo.Vec3 {
+	return geo.RandomUnitVector(rng)
+}
+
+// gradient is a simple sky, that blends from the horizon color to the zenith color
+// above the horizon, and has the ground color below the horizon
+type gradient struct {
+	zenith  geo.Vec3
+	horizon geo.Vec3
+	ground  geo.Vec3
+}
+
+// NewGradient creates a sky that blends from the horizon color to the zenith color above the horizon.
+// Below the horizon the color is the ground color.
+func NewGradient(zenith, horizon, ground geo.Vec3) Environment {
+	return gradient{
+		zenith:  zenith,
+		horizon: horizon,
+		ground:  ground,
+	}
+}
+
+// Color returns the color of the sky in the direction
+func (g gradient) Color(direction geo.Vec3) geo.Vec3 {
+	y := direction.Unit().Y
+	if y < 0 {
+		return g.ground
+	}
+	return g.horizon.MulS(1 - y).Add(g.zenith.MulS(y))
+}
+
+// Value returns the pdf value of the direction, where directions above the horizon are
+// sampled in proportion to how bright the sky is compared to the ground
+func (g gradient) Value(direction geo.Vec3) float64 {
+	sky, ground := g.hemisphereProbabilities()
+	if direction.Y < 0 {
+		return ground / (2 * math.Pi)
+	}
+	return sky / (2 * math.Pi)
+}
+
+// Generate returns a direction uniformly sampled in either the sky or the ground hemisphere
+func (g gradient) Generate(rng *random.Rng) geo.Vec3 {
+	sky, _ := g.hemisphereProbabilities()
+	direction := geo.RandomUnitVector(rng)
+	if (rng.NormalFloat() < sky) != (direction.Y >= 0) {
+		direction = geo.NewVec3(direction.X, -direction.Y, direction.Z)
+	}
+	return direction
+}
+
+// hemisphereProbabilities returns the probabilities of sampling the sky and the ground,
+// from their average luminances. Both are sampled to some extent, so that no direction gets zero pdf
+func (g gradient) hemisphereProbabilities() (float64, float64) {
+	sky := g.horizon.Add(g.zenith).MulS(.5).Luminance()
+	ground := g.ground.Luminance()
+	if sky+ground <= 0 {
+		return .5, .5
+	}
+	p := math.Max(.1, math.Min(sky/(sky+ground), .9))
+	return p, 1 - p
+}
@@ -0,0 +1,173 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hdrimage"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// image is an environment from an equirectangular image, where the horizontal axis is the angle around
+// the y axis and the vertical axis the angle from straight up to straight down.
+// The center of the image is in the negative z direction.
+type image struct {
+	img       hdrimage.Image
+	intensity float64
+	// sine and cosine of the rotation around the y axis
+	sinRotation float64
+	cosRotation float64
+	// Cumulative distribution of the rows, and of the pixels within each row.
+	// Pixels are sampled in proportion to their luminance times the solid angle they cover
+	rowCdf    []float64
+	pixelCdfs [][]float64
+	// Probability of sampling each pixel
+	pixelProbabilities []float64
+}
+
+// LoadImage creates an environment from an equirectangular hdr image file.
+// The color of the image is multiplied with the intensity, and the image is rotated around the y axis.
+func LoadImage(path string, intensity, rotationDegrees float64) (Environment, error) {
+	img, err := hdrimage.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewImage(img, intensity, rotationDegrees)
+}
+
+// NewImage creates an environment from an equirectangular hdr image.
+// The color of the image is multiplied with the intensity, and the image is rotated around the y axis.
+func NewImage(img hdrimage.Image, intensity, rotationDegrees float64) (Environment, error) {
+	if img.Width < 1 || img.Height < 1 || len(img.Pixels) != img.Width*img.Height {
+		return nil, errors.New(fmt.Sprintf("Invalid environment image size %vx%v", img.Width, img.Height))
+	}
+
+	rotation := util.DegreesToRadians(rotationDegrees)
+	e := &image{
+		img:                img,
+		intensity:          intensity,
+		sinRotation:        math.Sin(rotation),
+		cosRotation:        math.Cos(rotation),
+		rowCdf:             make([]float64, img.Height),
+		pixelCdfs:          make([][]float64, img.Height),
+		pixelProbabilities: make([]float64, len(img.Pixels)),
+	}
+
+	weights := make([]float64, len(img.Pixels))
+	total := 0.
+	for y := 0; y < img.Height; y++ {
+		sinTheta := math.Sin(math.Pi * (float64(y) + .5) / float64(img.Height))
+		for x := 0; x < img.Width; x++ {
+			i := y*img.Width + x
+			weights[i] = math.Max(0, img.Pixels[i].Luminance()) * sinTheta
+			total += weights[i]
+		}
+	}
+	// An image without light is sampled uniformly over the image area
+	if !(total > 0) || math.IsInf(total, 0) {
+		total = 0
+		for y := 0; y < img.Height; y++ {
+			sinTheta := math.Sin(math.Pi * (float64(y) + .5) / float64(img.Height))
+			for x := 0; x < img.Width; x++ {
+				weights[y*img.Width+x] = sinTheta
+				total += sinTheta
+			}
+		}
+	}
+
+	rowSum := 0.
+	for y := 0; y < img.Height; y++ {
+		cdf := make([]float64, img.Width)
+		sum := 0.
+		for x := 0; x < img.Width; x++ {
+			i := y*img.Width + x
+			sum += weights[i]
+			cdf[x] = sum
+			e.pixelProbabilities[i] = weights[i] / total
+		}
+		e.pixelCdfs[y] = cdf
+		rowSum += sum
+		e.rowCdf[y] = rowSum
+	}
+
+	return e, nil
+}
+
+// Color returns the color of the pixel in the direction
+func (e *image) Color(direction geo.Vec3) geo.Vec3 {
+	x, y, _ := e.pixel(direction)
+	return e.img.Pixels[y*e.img.Width+x].MulS(e.intensity)
+}
+
+// Value returns the pdf value of sampling the direction
+func (e *image) Value(direction geo.Vec3) float64 {
+	x, y, sinTheta := e.pixel(direction)
+	if sinTheta <= 0 {
+		return 0
+	}
+	// Each pixel is sampled uniformly in the image, so the density is converted from image area to solid angle
+	pixelArea := 1 / float64(e.img.Width*e.img.Height)
+	return e.pixelProbabilities[y*e.img.Width+x] / pixelArea / (2 * math.Pi * math.Pi * sinTheta)
+}
+
+// Generate samples a direction towards a pixel, chosen in proportion to the light coming from it
+func (e *image) Generate(rng *random.Rng) geo.Vec3 {
+	y := sampleCdf(e.rowCdf, rng.NormalFloat())
+	x := sampleCdf(e.pixelCdfs[y], rng.NormalFloat())
+
+	u := (float64(x) + rng.NormalFloat()) / float64(e.img.Width)
+	v := (float64(y) + rng.NormalFloat()) / float64(e.img.Height)
+
+	phi := 2 * math.Pi * (u - .5)
+	theta := math.Pi * v
+	sinTheta := math.Sin(theta)
+	local := geo.NewVec3(sinTheta*math.Sin(phi), math.Cos(theta), -sinTheta*math.Cos(phi))
+	return e.rotate(local, e.sinRotation)
+}
+
+// pixel returns the coordinates of the pixel in the direction, and the sine of the angle from straight up
+func (e *image) pixel(direction geo.Vec3) (int, int, float64) {
+	d := e.rotate(direction.Unit(), -e.sinRotation)
+	cosTheta := math.Max(-1, math.Min(d.Y, 1))
+	theta := math.Acos(cosTheta)
+	phi := math.Atan2(d.X, -d.Z)
+
+	u := .5 + phi/(2*math.Pi)
+	v := theta / math.Pi
+	x := clampIndex(int(u*float64(e.img.Width)), e.img.Width)
+	y := clampIndex(int(v*float64(e.img.Height)), e.img.Height)
+	return x, y, math.Sin(theta)
+}
+
+// rotate rotates the direction around the y axis, where sin is the sine of
+// the rotation angle, or the negative sine for the inverse rotation
+func (e *image) rotate(d geo.Vec3, sin float64) geo.Vec3 {
+	return geo.NewVec3(
+		e.cosRotation*d.X+sin*d.Z,
+		d.Y,
+		-sin*d.X+e.cosRotation*d.Z,
+	)
+}
+
+// sampleCdf returns the index of the first value in the cumulative distribution that is above u times the total
+func sampleCdf(cdf []float64, u float64) int {
+	target := u * cdf[len(cdf)-1]
+	i := sort.Search(len(cdf), func(i int) bool {
+		return cdf[i] > target
+	})
+	return clampIndex(i, len(cdf))
+}
+
+func clampIndex(i, size int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= size {
+		return size - 1
+	}
+	return i
+}
@@ -0,0 +1,174 @@
+package environment
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/pdf"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+const (
+	// Angle from the center of the sun to its edge, as seen from the earth
+	sunAngularRadius = .00465
+	// Radiance of the sun before it passes through the atmosphere
+	sunRadiance = 30000
+	// Converts the luminance of the sky model in kcd/m2, to the radiance of the environment
+	skyLuminanceScale = .05
+)
+
+// sky is the physically based daylight model by Preetham, Shirley and Smits, with the sun
+type sky struct {
+	sunDirection geo.Vec3
+	intensity    float64
+	// Color of the sky straight up, in the xyY color space
+	zenith [3]float64
+	// Perez distribution coefficients for each of Y, x and y
+	coefficients [3][5]float64
+	// The Perez distribution at the zenith, that the sky is relative to
+	zenithDistribution [3]float64
+	// Color of the sun after it has passed through the atmosphere
+	sunColor geo.Vec3
+	cosSun   float64
+	// Probability of sampling the sun instead of the sky
+	sunProbability float64
+}
+
+// NewSky creates a clear sky with the sun in the given direction. The turbidity is the haziness of the sky,
+// where 2 is a very clear sky and 10 a hazy one. The sun is redder and the sky less blue when the sun is
+// low and when the turbidity is high. The sky and the sun are multiplied with the intensity, where 1 gives
+// a radiance of about 1 for a clear sky at midday. Below the horizon the sky is black.
+func NewSky(sunDirection geo.Vec3, turbidity, intensity float64) Environment {
+	s := sky{
+		sunDirection: sunDirection.Unit(),
+		intensity:    intensity,
+		cosSun:       math.Cos(sunAngularRadius),
+	}
+
+	t := turbidity
+	s.coefficients = [3][5]float64{
+		{0.1787*t - 1.4630, -0.3554*t + 0.4275, -0.0227*t + 5.3251, 0.1206*t - 2.5771, -0.0670*t + 0.3703},
+		{-0.0193*t - 0.2592, -0.0665*t + 0.0008, -0.0004*t + 0.2125, -0.0641*t - 0.8989, -0.0033*t + 0.0452},
+		{-0.0167*t - 0.2608, -0.0950*t + 0.0092, -0.0079*t + 0.2102, -0.0441*t - 1.6537, -0.0109*t + 0.0529},
+	}
+
+	// The model is not defined for the sun below the horizon, where the sky is as with the sun at the horizon
+	thetaSun := math.Acos(math.Max(0, math.Min(s.sunDirection.Y, 1)))
+	chi := (4./9 - t/120) * (math.Pi - 2*thetaSun)
+	theta := [4]float64{thetaSun * thetaSun * thetaSun, thetaSun * thetaSun, thetaSun, 1}
+	zenithChromaticity := func(m [3][4]float64) float64 {
+		ret := 0.
+		for i, tf := range [3]float64{t * t, t, 1} {
+			for j := range theta {
+				ret += tf * m[i][j] * theta[j]
+			}
+		}
+		return ret
+	}
+	s.zenith = [3]float64{
+		(4.0453*t-4.9710)*math.Tan(chi) - 0.2155*t + 2.4192,
+		zenithChromaticity([3][4]float64{
+			{0.00166, -0.00375, 0.00209, 0},
+			{-0.02903, 0.06377, -0.03202, 0.00394},
+			{0.11693, -0.21196, 0.06052, 0.25886},
+		}),
+		zenithChromaticity([3][4]float64{
+			{0.00275, -0.00610, 0.00317, 0},
+			{-0.04214, 0.08970, -0.04153, 0.00516},
+			{0.15346, -0.26756, 0.06670, 0.26688},
+		}),
+	}
+	for i := range s.zenithDistribution {
+		s.zenithDistribution[i] = perez(s.coefficients[i], 1, math.Cos(thetaSun), thetaSun)
+	}
+
+	if s.sunDirection.Y > 0 && intensity > 0 {
+		s.sunColor = sunTransmittance(s.sunDirection.Y, t).MulS(sunRadiance * intensity)
+		s.sunProbability = .5
+	}
+
+	return s
+}
+
+// Color returns the color of the sky in the direction, with the sun
+func (s sky) Color(direction geo.Vec3) geo.Vec3 {
+	d := direction.Unit()
+	if d.Y < 0 {
+		return geo.ZeroVector
+	}
+
+	cosGamma := math.Max(-1, math.Min(d.Dot(s.sunDirection), 1))
+	gamma := math.Acos(cosGamma)
+	// The distribution is not defined at the horizon
+	cosTheta := math.Max(d.Y, .01)
+	var xyY [3]float64
+	for i := range xyY {
+		xyY[i] = s.zenith[i] * perez(s.coefficients[i], cosTheta, cosGamma, gamma) / s.zenithDistribution[i]
+	}
+	color := xyYToRgb(xyY[1], xyY[2], xyY[0]*skyLuminanceScale*s.intensity)
+
+	if cosGamma >= s.cosSun {
+		color = color.Add(s.sunColor)
+	}
+	return color
+}
+
+// Value returns the pdf value of the direction, that is sampled either towards the sun or
+// cosine weighted in the sky
+func (s sky) Value(direction geo.Vec3) float64 {
+	d := direction.Unit()
+	value := (1 - s.sunProbability) * math.Max(0, d.Y) / math.Pi
+	if d.Dot(s.sunDirection) >= s.cosSun {
+		value += s.sunProbability / (2 * math.Pi * (1 - s.cosSun))
+	}
+	return value
+}
+
+// Generate returns a direction towards the sun or in the sky
+func (s sky) Generate(rng *random.Rng) geo.Vec3 {
+	if rng.NormalFloat() < s.sunProbability {
+		// Uniform in the cone of directions towards the sun
+		cosTheta := 1 - rng.NormalFloat()*(1-s.cosSun)
+		sinTheta := math.Sqrt(1 - cosTheta*cosTheta)
+		phi := 2 * math.Pi * rng.NormalFloat()
+		return geo.BuildOnbFromVec3(s.sunDirection).Local(geo.NewVec3(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta))
+	}
+	return pdf.NewCosinePdf(geo.NewVec3(0, 1, 0)).Generate(rng)
+}
+
+// perez is the distribution of light in the sky, given the cosine of the angle from straight up
+// and the angle from the sun
+func perez(c [5]float64, cosTheta, cosGamma, gamma float64) float64 {
+	return (1 + c[0]*math.Exp(c[1]/cosTheta)) * (1 + c[2]*math.Exp(c[3]*gamma) + c[4]*cosGamma*cosGamma)
+}
+
+// sunTransmittance returns the fraction of the sunlight that passes through the atmosphere, for red, green and
+// blue light, from the scattering by air molecules and by particles in the air
+func sunTransmittance(cosTheta, turbidity float64) geo.Vec3 {
+	thetaDegrees := math.Acos(cosTheta) * 180 / math.Pi
+	// Relative amount of air that the light passes through
+	airMass := 1 / (cosTheta + 0.15*math.Pow(93.885-thetaDegrees, -1.253))
+	beta := 0.04608*turbidity - 0.04586
+
+	transmittance := func(wavelength float64) float64 {
+		rayleigh := math.Exp(-0.008735 * math.Pow(wavelength, -4.08) * airMass)
+		aerosol := math.Exp(-beta * math.Pow(wavelength, -1.3) * airMass)
+		return rayleigh * aerosol
+	}
+	// Wavelengths in micrometers
+	return geo.NewVec3(transmittance(.68), transmittance(.55), transmittance(.44))
+}
+
+// xyYToRgb converts a color from the xyY color space to linear rgb, with negative values clamped to zero
+func xyYToRgb(x, y, luminance float64) geo.Vec3 {
+	if y <= 0 {
+		return geo.ZeroVector
+	}
+	cx := x / y * luminance
+	cz := (1 - x - y) / y * luminance
+	return geo.NewVec3(
+		math.Max(0, 3.2406*cx-1.5372*luminance-0.4986*cz),
+		math.Max(0, -0.9689*cx+1.8758*luminance+0.0415*cz),
+		math.Max(0, 0.0557*cx-0.2040*luminance+1.0570*cz),
+	)
+}
@@ -0,0 +1,165 @@
+package geo
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/internal/util"
+)
+
+// Matrix4 is a 4x4 matrix used for affine transformations of points and vectors.
+// Elements are indexed by row and column, and vectors are treated as columns.
+// So m.Mul(n) is the transformation that first applies n and then m.
+type Matrix4 [4][4]float64
+
+// IdentityMatrix creates a matrix that does not transform anything
+func IdentityMatrix() Matrix4 {
+	return Matrix4{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// TranslationMatrix creates a matrix that moves points by the given offset
+func TranslationMatrix(offset Vec3) Matrix4 {
+	return Matrix4{
+		{1, 0, 0, offset.X},
+		{0, 1, 0, offset.Y},
+		{0, 0, 1, offset.Z},
+		{0, 0, 0, 1},
+	}
+}
+
+// ScaleMatrix creates a matrix that scales by the given factor along each axis
+func ScaleMatrix(scale Vec3) Matrix4 {
+	return Matrix4{
+		{scale.X, 0, 0, 0},
+		{0, scale.Y, 0, 0},
+		{0, 0, scale.Z, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// RotationMatrix creates a matrix that rotates the given angle in degrees around an axis.
+// Rotation is counter clockwise when looking from the direction that the axis points to.
+func RotationMatrix(axis Vec3, angle float64) Matrix4 {
+	a := axis.Unit()
+	radians := util.DegreesToRadians(angle)
+	s := math.Sin(radians)
+	c := math.Cos(radians)
+	t := 1 - c
+
+	return Matrix4{
+		{t*a.X*a.X + c, t*a.X*a.Y - s*a.Z, t*a.X*a.Z + s*a.Y, 0},
+		{t*a.X*a.Y + s*a.Z, t*a.Y*a.Y + c, t*a.Y*a.Z - s*a.X, 0},
+		{t*a.X*a.Z - s*a.Y, t*a.Y*a.Z + s*a.X, t*a.Z*a.Z + c, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// LookAtMatrix creates a matrix that places an object at the position from, turned so that
+// its negative Z axis points towards the position to and its Y axis is as close to up as possible.
+// This is the same orientation as used by cameras.
+func LookAtMatrix(from, to, up Vec3) Matrix4 {
+	w := from.Sub(to).Unit()
+	u := up.Cross(w).Unit()
+	v := w.Cross(u)
+
+	return Matrix4{
+		{u.X, v.X, w.X, from.X},
+		{u.Y, v.Y, w.Y, from.Y},
+		{u.Z, v.Z, w.Z, from.Z},
+		{0, 0, 0, 1},
+	}
+}
+
+// Mul returns the matrix product m*n, which is the transformation of first n and then m
+func (m Matrix4) Mul(n Matrix4) Matrix4 {
+	var ret Matrix4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				ret[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return ret
+}
+
+// Transpose returns the matrix with rows and columns swapped
+func (m Matrix4) Transpose() Matrix4 {
+	var ret Matrix4
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			ret[i][j] = m[j][i]
+		}
+	}
+	return ret
+}
+
+// Inverse returns the inverse of the matrix, and false if the matrix can not be inverted
+func (m Matrix4) Inverse() (Matrix4, bool) {
+	// Gauss-Jordan elimination with partial pivoting
+	a := m
+	inv := IdentityMatrix()
+
+	for col := 0; col < 4; col++ {
+		pivot := col
+		for row := col + 1; row < 4; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Matrix4{}, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		scale := 1 / a[col][col]
+		for j := 0; j < 4; j++ {
+			a[col][j] *= scale
+			inv[col][j] *= scale
+		}
+
+		for row := 0; row < 4; row++ {
+			if row == col {
+				continue
+			}
+			f := a[row][col]
+			for j := 0; j < 4; j++ {
+				a[row][j] -= f * a[col][j]
+				inv[row][j] -= f * inv[col][j]
+			}
+		}
+	}
+
+	return inv, true
+}
+
+// Determinant3 returns the determinant of the upper left 3x3 part of the matrix,
+// which is how much the transformation scales volumes
+func (m Matrix4) Determinant3() float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// TransformPoint applies the transformation to a position
+func (m Matrix4) TransformPoint(p Vec3) Vec3 {
+	return Vec3{
+		X: m[0][0]*p.X + m[0][1]*p.Y + m[0][2]*p.Z + m[0][3],
+		Y: m[1][0]*p.X + m[1][1]*p.Y + m[1][2]*p.Z + m[1][3],
+		Z: m[2][0]*p.X + m[2][1]*p.Y + m[2][2]*p.Z + m[2][3],
+	}
+}
+
+// TransformVector applies the transformation to a direction, which is not affected by translation
+func (m Matrix4) TransformVector(v Vec3) Vec3 {
+	return Vec3{
+		X: m[0][0]*v.X + m[0][1]*v.Y + m[0][2]*v.Z,
+		Y: m[1][0]*v.X + m[1][1]*v.Y + m[1][2]*v.Z,
+		Z: m[2][0]*v.X + m[2][1]*v.Y + m[2][2]*v.Z,
+	}
+}
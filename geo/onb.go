@@ -33,3 +33,9 @@ func BuildOnbFromVec3(w Vec3) Onb {
 func (o Onb) Local(a Vec3) Vec3 {
 	return o.U.MulS(a.X).Add(o.V.MulS(a.Y)).Add(o.W.MulS(a.Z))
 }
+
+// Coordinates returns the coordinates of the given vector in the Orthonormal Basis.
+// It is the inverse of Local
+func (o Onb) Coordinates(a Vec3) Vec3 {
+	return NewVec3(a.Dot(o.U), a.Dot(o.V), a.Dot(o.W))
+}
@@ -29,22 +29,22 @@ func NewVec3(x, y, z float64) Vec3 {
 }
 
 // RandomVec3 creates a random Vec3 within the given interval
-func RandomVec3(min float64, max float64) Vec3 {
+func RandomVec3(rng *random.Rng, min float64, max float64) Vec3 {
 	return Vec3{
-		random.RandomFloat(min, max),
-		random.RandomFloat(min, max),
-		random.RandomFloat(min, max),
+		rng.Float(min, max),
+		rng.Float(min, max),
+		rng.Float(min, max),
 	}
 }
 
 // RandomInUnitSphere creates a random Vec3 that is shorter than 1
-func RandomInUnitSphere() Vec3 {
+func RandomInUnitSphere(rng *random.Rng) Vec3 {
 
 	var p Vec3
 	for {
-		p.X = random.RandomFloat(-1, 1)
-		p.Y = random.RandomFloat(-1, 1)
-		p.Z = random.RandomFloat(-1, 1)
+		p.X = rng.Float(-1, 1)
+		p.Y = rng.Float(-1, 1)
+		p.Z = rng.Float(-1, 1)
 
 		if p.LengthSquared() < 1 {
 			return p
@@ -53,14 +53,14 @@ func RandomInUnitSphere() Vec3 {
 }
 
 // RandomUnitVector creates a random Vec3 that has the length of 1
-func RandomUnitVector() Vec3 {
-	return RandomInUnitSphere().Unit()
+func RandomUnitVector(rng *random.Rng) Vec3 {
+	return RandomInUnitSphere(rng).Unit()
 }
 
 // RandomInHemisphere creates a random Vec3 that is shorter than 1.
 // And in the same general direction as given normal.
-func RandomInHemisphere(normal Vec3) Vec3 {
-	inUnitSphere := RandomInUnitSphere()
+func RandomInHemisphere(rng *random.Rng, normal Vec3) Vec3 {
+	inUnitSphere := RandomInUnitSphere(rng)
 	if inUnitSphere.Dot(normal) > 0 {
 		return inUnitSphere
 	}
@@ -69,12 +69,12 @@ func RandomInHemisphere(normal Vec3) Vec3 {
 
 // RandomInUnitDisc creates a random Vec3 that is shorter than 1
 // And that has a Z value of 0
-func RandomInUnitDisc() Vec3 {
+func RandomInUnitDisc(rng *random.Rng) Vec3 {
 
 	var p Vec3
 	for {
-		p.X = random.RandomFloat(-1, 1)
-		p.Y = random.RandomFloat(-1, 1)
+		p.X = rng.Float(-1, 1)
+		p.Y = rng.Float(-1, 1)
 		if p.LengthSquared() < 1 {
 			return p
 		}
@@ -84,9 +84,9 @@ func RandomInUnitDisc() Vec3 {
 // RandomCosineDirection generates a random vector similar to RandomUnitVector
 // in that the length is always 1. But with a different distribution
 // as it is generated by two random angles.
-func RandomCosineDirection() Vec3 {
-	r1 := random.RandomNormalFloat()
-	r2 := random.RandomNormalFloat()
+func RandomCosineDirection(rng *random.Rng) Vec3 {
+	r1 := rng.NormalFloat()
+	r2 := rng.NormalFloat()
 
 	phi := 2 * math.Pi * r1
 	x := math.Cos(phi) * math.Sqrt(r2)
@@ -165,6 +165,16 @@ func (v Vec3) Length() float64 {
 	return math.Sqrt(v.LengthSquared())
 }
 
+// Luminance returns the perceived brightness of the vector as a linear rgb color
+func (v Vec3) Luminance() float64 {
+	return .2126*v.X + .7152*v.Y + .0722*v.Z
+}
+
+// MaxComponent returns the largest of the x, y and z components
+func (v Vec3) MaxComponent() float64 {
+	return math.Max(v.X, math.Max(v.Y, v.Z))
+}
+
 // Unit returns the vector but sized to a length of 1
 func (v Vec3) Unit() Vec3 {
 	return v.DivS(v.Length())
@@ -0,0 +1,271 @@
+package gltf
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Component types of accessors
+const (
+	componentByte          = 5120
+	componentUnsignedByte  = 5121
+	componentShort         = 5122
+	componentUnsignedShort = 5123
+	componentUnsignedInt   = 5125
+	componentFloat         = 5126
+)
+
+// componentSizes are the sizes in bytes of the component types
+var componentSizes = map[int]int{
+	componentByte:          1,
+	componentUnsignedByte:  1,
+	componentShort:         2,
+	componentUnsignedShort: 2,
+	componentUnsignedInt:   4,
+	componentFloat:         4,
+}
+
+// typeComponents are the number of components of the accessor types that are used for meshes
+var typeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+}
+
+type buffer struct {
+	Uri        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type bufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type accessor struct {
+	BufferView    *int    `json:"bufferView"`
+	ByteOffset    int     `json:"byteOffset"`
+	ComponentType int     `json:"componentType"`
+	Normalized    bool    `json:"normalized"`
+	Count         int     `json:"count"`
+	Type          string  `json:"type"`
+	Sparse        *sparse `json:"sparse"`
+}
+
+// sparse are values of an accessor that replace the values of its buffer view
+type sparse struct {
+	Count   int `json:"count"`
+	Indices struct {
+		BufferView    int `json:"bufferView"`
+		ByteOffset    int `json:"byteOffset"`
+		ComponentType int `json:"componentType"`
+	} `json:"indices"`
+	Values struct {
+		BufferView int `json:"bufferView"`
+		ByteOffset int `json:"byteOffset"`
+	} `json:"values"`
+}
+
+// readUri reads the data of a base64 data uri, or of a file relative to the glTF file
+func (l *loader) readUri(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		comma := strings.Index(uri, ",")
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, errors.New("Only base64 data uris are supported")
+		}
+		data, err := base64.StdEncoding.DecodeString(uri[comma+1:])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid data uri: %v", err.Error()))
+		}
+		return data, nil
+	}
+
+	file, err := url.PathUnescape(uri)
+	if err != nil {
+		file = uri
+	}
+	data, err := os.ReadFile(filepath.Join(l.dir, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read glTF file: %v", err.Error()))
+	}
+	return data, nil
+}
+
+// buffer returns the data of a buffer. A buffer without uri is the binary chunk of a .glb file.
+func (l *loader) buffer(index int) ([]byte, error) {
+	if index < 0 || index >= len(l.doc.Buffers) {
+		return nil, errors.New(fmt.Sprintf("Invalid buffer index: %v", index))
+	}
+	if data, found := l.buffers[index]; found {
+		return data, nil
+	}
+
+	b := l.doc.Buffers[index]
+	data := l.bin
+	if b.Uri != "" {
+		var err error
+		if data, err = l.readUri(b.Uri); err != nil {
+			return nil, err
+		}
+	}
+	if b.ByteLength < 0 || len(data) < b.ByteLength {
+		return nil, errors.New(fmt.Sprintf("Buffer %v is shorter than its byte length", index))
+	}
+
+	l.buffers[index] = data[:b.ByteLength]
+	return l.buffers[index], nil
+}
+
+// bufferView returns the data of a buffer view, and the stride between its elements where zero is tightly packed
+func (l *loader) bufferView(index int) ([]byte, int, error) {
+	if index < 0 || index >= len(l.doc.BufferViews) {
+		return nil, 0, errors.New(fmt.Sprintf("Invalid buffer view index: %v", index))
+	}
+
+	view := l.doc.BufferViews[index]
+	data, err := l.buffer(view.Buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteLength > len(data)-view.ByteOffset {
+		return nil, 0, errors.New(fmt.Sprintf("Buffer view %v is outside of its buffer", index))
+	}
+	return data[view.ByteOffset : view.ByteOffset+view.ByteLength], view.ByteStride, nil
+}
+
+// accessor returns the values of an accessor as floats, where each element has the given number of components
+func (l *loader) accessor(index, components int) ([]float64, error) {
+	if index < 0 || index >= len(l.doc.Accessors) {
+		return nil, errors.New(fmt.Sprintf("Invalid accessor index: %v", index))
+	}
+
+	a := l.doc.Accessors[index]
+	if n, found := typeComponents[a.Type]; !found || n != components {
+		return nil, errors.New(fmt.Sprintf("Accessor %v has type %v, expected %v components", index, a.Type, components))
+	}
+	if a.Count < 0 {
+		return nil, errors.New(fmt.Sprintf("Accessor %v has a negative count", index))
+	}
+
+	// Accessors without buffer view are all zeros, unless replaced by sparse values
+	values := make([]float64, a.Count*components)
+	if a.BufferView != nil {
+		data, stride, err := l.bufferView(*a.BufferView)
+		if err != nil {
+			return nil, err
+		}
+		if err := readElements(data, a.ByteOffset, stride, a.ComponentType, a.Normalized, components, values); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read accessor %v: %v", index, err.Error()))
+		}
+	}
+
+	if a.Sparse != nil {
+		if err := l.readSparse(*a.Sparse, a, components, values); err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read accessor %v: %v", index, err.Error()))
+		}
+	}
+	return values, nil
+}
+
+// readSparse replaces the values of an accessor with its sparse values
+func (l *loader) readSparse(s sparse, a accessor, components int, values []float64) error {
+	if s.Count < 0 {
+		return errors.New("Negative sparse count")
+	}
+
+	indexData, _, err := l.bufferView(s.Indices.BufferView)
+	if err != nil {
+		return err
+	}
+	indices := make([]float64, s.Count)
+	if err := readElements(indexData, s.Indices.ByteOffset, 0, s.Indices.ComponentType, false, 1, indices); err != nil {
+		return err
+	}
+
+	valueData, _, err := l.bufferView(s.Values.BufferView)
+	if err != nil {
+		return err
+	}
+	sparseValues := make([]float64, s.Count*components)
+	if err := readElements(valueData, s.Values.ByteOffset, 0, a.ComponentType, a.Normalized, components, sparseValues); err != nil {
+		return err
+	}
+
+	for i, index := range indices {
+		if index < 0 || index >= float64(a.Count) {
+			return errors.New(fmt.Sprintf("Invalid sparse index: %v", index))
+		}
+		copy(values[int(index)*components:], sparseValues[i*components:(i+1)*components])
+	}
+	return nil
+}
+
+// readElements reads elements of the given number of components from the data into values,
+// until values is filled. Normalized integer components are converted to the range 0 to 1, or -1 to 1.
+func readElements(data []byte, offset, stride, componentType int, normalized bool, components int, values []float64) error {
+	size, found := componentSizes[componentType]
+	if !found {
+		return errors.New(fmt.Sprintf("Unsupported component type: %v", componentType))
+	}
+
+	elementSize := size * components
+	if stride == 0 {
+		stride = elementSize
+	}
+	count := len(values) / components
+	if offset < 0 || stride < elementSize || (count > 0 && (count-1)*stride+elementSize > len(data)-offset) {
+		return errors.New("Elements are outside of the buffer view")
+	}
+
+	for i := 0; i < count; i++ {
+		element := data[offset+i*stride:]
+		for j := 0; j < components; j++ {
+			values[i*components+j] = readComponent(element[j*size:], componentType, normalized)
+		}
+	}
+	return nil
+}
+
+// readComponent reads a single little endian component
+func readComponent(b []byte, componentType int, normalized bool) float64 {
+	switch componentType {
+	case componentByte:
+		v := float64(int8(b[0]))
+		if normalized {
+			return math.Max(v/127, -1)
+		}
+		return v
+	case componentUnsignedByte:
+		v := float64(b[0])
+		if normalized {
+			return v / 255
+		}
+		return v
+	case componentShort:
+		v := float64(int16(binary.LittleEndian.Uint16(b)))
+		if normalized {
+			return math.Max(v/32767, -1)
+		}
+		return v
+	case componentUnsignedShort:
+		v := float64(binary.LittleEndian.Uint16(b))
+		if normalized {
+			return v / 65535
+		}
+		return v
+	case componentUnsignedInt:
+		return float64(binary.LittleEndian.Uint32(b))
+	default:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+}
@@ -0,0 +1,203 @@
+// Package gltf provides loading of glTF 2.0 files, both as .gltf files with JSON and as binary .glb files.
+// The meshes of the nodes become bounding volume hierarchies of triangles, placed in the world by the
+// transforms of the node hierarchy. A mesh used by many nodes is shared by the instances of it.
+// The metallic roughness materials are mapped to principled materials, with textures, emission and
+// alpha cutouts, and the KHR_materials_transmission, KHR_materials_ior, KHR_materials_clearcoat and
+// KHR_materials_emissive_strength extensions. Base color and emissive textures are decoded from sRGB.
+// Perspective cameras and the punctual lights of the KHR_lights_punctual extension are also read.
+// Animations, skins, morph targets, normal and occlusion textures, and compressed meshes and textures
+// are not supported.
+package gltf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+)
+
+const (
+	glbMagic     = 0x46546c67
+	glbChunkJson = 0x4e4f534a
+	glbChunkBin  = 0x004e4942
+)
+
+// supportedExtensions are the extensions that files can require and still be loaded
+var supportedExtensions = map[string]bool{
+	"KHR_lights_punctual":             true,
+	"KHR_materials_clearcoat":         true,
+	"KHR_materials_emissive_strength": true,
+	"KHR_materials_ior":               true,
+	"KHR_materials_transmission":      true,
+	"KHR_mesh_quantization":           true,
+}
+
+// document is the JSON part of a glTF file
+type document struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+	Scene              *int     `json:"scene"`
+	Scenes             []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes       []node         `json:"nodes"`
+	Meshes      []mesh         `json:"meshes"`
+	Accessors   []accessor     `json:"accessors"`
+	BufferViews []bufferView   `json:"bufferViews"`
+	Buffers     []buffer       `json:"buffers"`
+	Materials   []gltfMaterial `json:"materials"`
+	Textures    []gltfTexture  `json:"textures"`
+	Images      []gltfImage    `json:"images"`
+	Cameras     []gltfCamera   `json:"cameras"`
+	Extensions  struct {
+		LightsPunctual struct {
+			Lights []gltfLight `json:"lights"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+// loader holds the glTF file while it is turned into hittables, and the parts that have been created
+type loader struct {
+	doc           document
+	dir           string
+	bin           []byte
+	buffers       map[int][]byte
+	images        map[int]image.Image
+	textures      map[int]material.Texture
+	alphaTextures map[int]material.Texture
+	materials     map[int]material.Material
+	meshes        map[int]hittable.Hittable
+}
+
+// Load reads a glTF file and creates a scene of the default scene in the file.
+// The camera is the first perspective camera in the node hierarchy, focused at the center of the world,
+// or if there is none, a camera looking at the whole world from the front. Cameras are kept upright.
+// The punctual lights are the lights of the scene, with the intensities of the file.
+// The background is black and the render config has one sample per pixel with a path tracing shader,
+// which can be changed in the returned scene.
+func Load(path string) (*renderer.Scene, error) {
+	l, err := newLoader(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := l.scene()
+	if err != nil {
+		return nil, err
+	}
+	world, err := c.world(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &renderer.Scene{
+		World:  world,
+		Camera: c.cameraConfig(world),
+		Lights: c.lights,
+		RenderConfig: renderer.RenderConfig{
+			SamplesPerPixel: 1,
+			Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		},
+	}, nil
+}
+
+// LoadHittable reads a glTF file and creates a hittable of the meshes in the default scene of the file.
+// Cameras and lights of the file are ignored.
+func LoadHittable(path string) (hittable.Hittable, error) {
+	l, err := newLoader(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := l.scene()
+	if err != nil {
+		return nil, err
+	}
+	return c.world(path)
+}
+
+// newLoader reads the glTF file at the path. Binary .glb files are recognized by their content.
+func newLoader(path string) (*loader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read glTF file: %v", err.Error()))
+	}
+
+	jsonData := data
+	var bin []byte
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if jsonData, bin, err = readGlb(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc document
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse glTF file %v: %v", path, err.Error()))
+	}
+	if !strings.HasPrefix(doc.Asset.Version, "2.") {
+		return nil, errors.New(fmt.Sprintf("Unsupported glTF version: %v", doc.Asset.Version))
+	}
+	for _, extension := range doc.ExtensionsRequired {
+		if !supportedExtensions[extension] {
+			return nil, errors.New(fmt.Sprintf("Unsupported glTF extension: %v", extension))
+		}
+	}
+
+	return &loader{
+		doc:           doc,
+		dir:           filepath.Dir(path),
+		bin:           bin,
+		buffers:       map[int][]byte{},
+		images:        map[int]image.Image{},
+		textures:      map[int]material.Texture{},
+		alphaTextures: map[int]material.Texture{},
+		materials:     map[int]material.Material{},
+		meshes:        map[int]hittable.Hittable{},
+	}, nil
+}
+
+// readGlb returns the JSON and binary chunks of a .glb file
+func readGlb(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 {
+		return nil, nil, errors.New("Invalid glb header")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, nil, errors.New(fmt.Sprintf("Unsupported glb version: %v", version))
+	}
+	if length := binary.LittleEndian.Uint32(data[8:]); uint64(length) <= uint64(len(data)) {
+		data = data[:length]
+	}
+
+	var jsonData, bin []byte
+	for offset := 12; offset+8 <= len(data); {
+		chunkLength := uint64(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if chunkLength > uint64(len(data)-offset) {
+			return nil, nil, errors.New("Invalid glb chunk length")
+		}
+		chunk := data[offset : offset+int(chunkLength)]
+		offset += int(chunkLength)
+
+		// Only the first chunk of each type is used, and unknown chunks are skipped
+		switch {
+		case chunkType == glbChunkJson && jsonData == nil:
+			jsonData = chunk
+		case chunkType == glbChunkBin && bin == nil:
+			bin = chunk
+		}
+	}
+	if jsonData == nil {
+		return nil, nil, errors.New("Missing glb JSON chunk")
+	}
+	return jsonData, bin, nil
+}
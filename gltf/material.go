@@ -0,0 +1,307 @@
+package gltf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	// Decoders of the image formats of glTF
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/DanielPettersson/solstrale/material"
+)
+
+type textureInfo struct {
+	Index int `json:"index"`
+}
+
+type gltfMaterial struct {
+	PbrMetallicRoughness struct {
+		BaseColorFactor          []float64    `json:"baseColorFactor"`
+		BaseColorTexture         *textureInfo `json:"baseColorTexture"`
+		MetallicFactor           *float64     `json:"metallicFactor"`
+		RoughnessFactor          *float64     `json:"roughnessFactor"`
+		MetallicRoughnessTexture *textureInfo `json:"metallicRoughnessTexture"`
+	} `json:"pbrMetallicRoughness"`
+	EmissiveFactor  []float64    `json:"emissiveFactor"`
+	EmissiveTexture *textureInfo `json:"emissiveTexture"`
+	AlphaMode       string       `json:"alphaMode"`
+	AlphaCutoff     *float64     `json:"alphaCutoff"`
+	Extensions      struct {
+		EmissiveStrength *struct {
+			EmissiveStrength float64 `json:"emissiveStrength"`
+		} `json:"KHR_materials_emissive_strength"`
+		Ior *struct {
+			Ior *float64 `json:"ior"`
+		} `json:"KHR_materials_ior"`
+		Transmission *struct {
+			TransmissionFactor  float64      `json:"transmissionFactor"`
+			TransmissionTexture *textureInfo `json:"transmissionTexture"`
+		} `json:"KHR_materials_transmission"`
+		Clearcoat *struct {
+			ClearcoatFactor          float64      `json:"clearcoatFactor"`
+			ClearcoatTexture         *textureInfo `json:"clearcoatTexture"`
+			ClearcoatRoughnessFactor float64      `json:"clearcoatRoughnessFactor"`
+		} `json:"KHR_materials_clearcoat"`
+	} `json:"extensions"`
+}
+
+type gltfTexture struct {
+	Source *int `json:"source"`
+}
+
+type gltfImage struct {
+	Uri        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+}
+
+// factorTexture is a texture where the color is multiplied by a factor
+type factorTexture struct {
+	tex    material.Texture
+	factor geo.Vec3
+}
+
+// Color returns the color of the texture times the factor
+func (t factorTexture) Color(rec *material.HitRecord) geo.Vec3 {
+	return t.tex.Color(rec).Mul(t.factor)
+}
+
+// srgbTexture is a texture of sRGB encoded colors, like the color textures of glTF, that returns linear colors
+type srgbTexture struct {
+	tex material.Texture
+}
+
+// Color returns the color of the texture decoded from sRGB
+func (t srgbTexture) Color(rec *material.HitRecord) geo.Vec3 {
+	c := t.tex.Color(rec)
+	return geo.NewVec3(im.SrgbToLinear(c.X), im.SrgbToLinear(c.Y), im.SrgbToLinear(c.Z))
+}
+
+// alphaImage is the alpha channel of an image as a gray image, where images without alpha channel are opaque
+type alphaImage struct {
+	image.Image
+}
+
+func (a alphaImage) ColorModel() color.Model {
+	return color.Gray16Model
+}
+
+func (a alphaImage) At(x, y int) color.Color {
+	_, _, _, alpha := a.Image.At(x, y).RGBA()
+	return color.Gray16{Y: uint16(alpha)}
+}
+
+// channelTexture is a gray texture of one of the color channels of a texture
+type channelTexture struct {
+	tex     material.Texture
+	channel int
+}
+
+// Color returns the value of the channel as a gray color
+func (t channelTexture) Color(rec *material.HitRecord) geo.Vec3 {
+	v := t.tex.Color(rec).Axis(t.channel)
+	return geo.NewVec3(v, v, v)
+}
+
+// material returns the material with the index, or the default material if the index is nil
+func (l *loader) material(index *int) (material.Material, error) {
+	key := -1
+	var m gltfMaterial
+	if index != nil {
+		key = *index
+		if key < 0 || key >= len(l.doc.Materials) {
+			return nil, errors.New(fmt.Sprintf("Invalid material index: %v", key))
+		}
+		m = l.doc.Materials[key]
+	}
+	if mat, found := l.materials[key]; found {
+		return mat, nil
+	}
+
+	mat, err := l.newMaterial(m)
+	if err != nil {
+		return nil, err
+	}
+	l.materials[key] = mat
+	return mat, nil
+}
+
+// newMaterial maps a metallic roughness material to a principled material. The base color and emissive textures
+// are decoded from sRGB, while the metallic and roughness are the linear blue and green channels of the
+// metallic roughness texture. Emission gives an emissive material.
+// Alpha modes mask and blend give alpha cutouts, where blend is cut at an alpha of 0.5.
+func (l *loader) newMaterial(m gltfMaterial) (material.Material, error) {
+	pbr := m.PbrMetallicRoughness
+	baseColorFactor := []float64{1, 1, 1, 1}
+	if len(pbr.BaseColorFactor) == 4 {
+		baseColorFactor = pbr.BaseColorFactor
+	}
+	baseColor := geo.NewVec3(baseColorFactor[0], baseColorFactor[1], baseColorFactor[2])
+
+	config := material.PrincipledConfig{
+		BaseColor: material.SolidColor{ColorValue: baseColor},
+		Metallic:  1,
+		Roughness: 1,
+		// The reflectance of dielectrics in glTF is that of an index of refraction of 1.5
+		Specular: .5,
+	}
+	if pbr.BaseColorTexture != nil {
+		tex, err := l.texture(pbr.BaseColorTexture.Index)
+		if err != nil {
+			return nil, err
+		}
+		config.BaseColor = factorTexture{tex: srgbTexture{tex}, factor: baseColor}
+	}
+	if pbr.MetallicFactor != nil {
+		config.Metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		config.Roughness = *pbr.RoughnessFactor
+	}
+	if pbr.MetallicRoughnessTexture != nil {
+		tex, err := l.texture(pbr.MetallicRoughnessTexture.Index)
+		if err != nil {
+			return nil, err
+		}
+		config.RoughnessTexture = channelTexture{tex: tex, channel: 1}
+		config.MetallicTexture = channelTexture{tex: tex, channel: 2}
+	}
+
+	extensions := m.Extensions
+	if extensions.Ior != nil && extensions.Ior.Ior != nil && *extensions.Ior.Ior >= 1 {
+		ior := *extensions.Ior.Ior
+		r0 := (ior - 1) / (ior + 1)
+		config.IndexOfRefraction = ior
+		config.Specular = math.Min(r0*r0/.08, 1)
+	}
+	if t := extensions.Transmission; t != nil {
+		config.Transmission = t.TransmissionFactor
+		if t.TransmissionTexture != nil {
+			tex, err := l.texture(t.TransmissionTexture.Index)
+			if err != nil {
+				return nil, err
+			}
+			config.TransmissionTexture = channelTexture{tex: tex, channel: 0}
+		}
+	}
+	if c := extensions.Clearcoat; c != nil {
+		config.Clearcoat = c.ClearcoatFactor
+		config.ClearcoatRoughness = c.ClearcoatRoughnessFactor
+		if c.ClearcoatTexture != nil {
+			tex, err := l.texture(c.ClearcoatTexture.Index)
+			if err != nil {
+				return nil, err
+			}
+			config.ClearcoatTexture = channelTexture{tex: tex, channel: 0}
+		}
+	}
+	mat := material.NewPrincipled(config)
+
+	emission := geo.ZeroVector
+	if len(m.EmissiveFactor) == 3 {
+		emission = geo.NewVec3(m.EmissiveFactor[0], m.EmissiveFactor[1], m.EmissiveFactor[2])
+	}
+	if extensions.EmissiveStrength != nil {
+		emission = emission.MulS(extensions.EmissiveStrength.EmissiveStrength)
+	}
+	if emission != geo.ZeroVector {
+		var emit material.Texture = material.SolidColor{ColorValue: emission}
+		if m.EmissiveTexture != nil {
+			tex, err := l.texture(m.EmissiveTexture.Index)
+			if err != nil {
+				return nil, err
+			}
+			emit = factorTexture{tex: srgbTexture{tex}, factor: emission}
+		}
+		mat = material.NewEmissive(mat, emit)
+	}
+
+	if m.AlphaMode == "MASK" || m.AlphaMode == "BLEND" {
+		cutoff := .5
+		if m.AlphaMode == "MASK" && m.AlphaCutoff != nil {
+			cutoff = *m.AlphaCutoff
+		}
+		if cutoff > 0 {
+			// Alpha cutouts cut at 0.5, so the alpha is scaled to have the cutoff at 0.5
+			a := baseColorFactor[3] * .5 / cutoff
+			var alpha material.Texture = material.NewSolidColor(a, a, a)
+			if pbr.BaseColorTexture != nil {
+				tex, err := l.alphaTexture(pbr.BaseColorTexture.Index)
+				if err != nil {
+					return nil, err
+				}
+				alpha = factorTexture{tex: tex, factor: geo.NewVec3(a, a, a)}
+			}
+			mat = material.NewAlphaCutout(mat, alpha)
+		}
+	}
+
+	return mat, nil
+}
+
+// texture returns the image texture with the index, with the colors of the image as they are.
+// Color textures are sRGB encoded and decoded with srgbTexture
+func (l *loader) texture(index int) (material.Texture, error) {
+	if tex, found := l.textures[index]; found {
+		return tex, nil
+	}
+	img, err := l.textureImage(index)
+	if err != nil {
+		return nil, err
+	}
+	l.textures[index] = material.NewImageTexture(img, false)
+	return l.textures[index], nil
+}
+
+// alphaTexture returns the texture of the alpha channel of the image texture with the index.
+// The alpha of images without alpha channel is 1
+func (l *loader) alphaTexture(index int) (material.Texture, error) {
+	if tex, found := l.alphaTextures[index]; found {
+		return tex, nil
+	}
+	img, err := l.textureImage(index)
+	if err != nil {
+		return nil, err
+	}
+	l.alphaTextures[index] = material.NewImageTexture(alphaImage{img}, false)
+	return l.alphaTextures[index], nil
+}
+
+// textureImage returns the decoded image of the texture with the index
+func (l *loader) textureImage(index int) (image.Image, error) {
+	if index < 0 || index >= len(l.doc.Textures) {
+		return nil, errors.New(fmt.Sprintf("Invalid texture index: %v", index))
+	}
+	source := l.doc.Textures[index].Source
+	if source == nil || *source < 0 || *source >= len(l.doc.Images) {
+		return nil, errors.New(fmt.Sprintf("Texture %v has no supported image", index))
+	}
+	if img, found := l.images[*source]; found {
+		return img, nil
+	}
+
+	i := l.doc.Images[*source]
+	var data []byte
+	var err error
+	if i.BufferView != nil {
+		data, _, err = l.bufferView(*i.BufferView)
+	} else {
+		data, err = l.readUri(i.Uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decode image %v: %v", *source, err.Error()))
+	}
+	l.images[*source] = img
+	return img, nil
+}
@@ -0,0 +1,424 @@
+package gltf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/DanielPettersson/solstrale/camera"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/light"
+)
+
+// Primitive modes that have triangles
+const (
+	modeTriangles     = 4
+	modeTriangleStrip = 5
+	modeTriangleFan   = 6
+)
+
+// Vertical field of view of the camera used when the file has no camera
+const defaultFovDegrees = 40
+
+type node struct {
+	Camera      *int      `json:"camera"`
+	Children    []int     `json:"children"`
+	Mesh        *int      `json:"mesh"`
+	Matrix      []float64 `json:"matrix"`
+	Translation []float64 `json:"translation"`
+	Rotation    []float64 `json:"rotation"`
+	Scale       []float64 `json:"scale"`
+	Extensions  struct {
+		LightsPunctual *struct {
+			Light int `json:"light"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type mesh struct {
+	Primitives []primitive `json:"primitives"`
+}
+
+type primitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+type gltfCamera struct {
+	Type        string `json:"type"`
+	Perspective *struct {
+		Yfov float64 `json:"yfov"`
+	} `json:"perspective"`
+}
+
+type gltfLight struct {
+	Type      string    `json:"type"`
+	Color     []float64 `json:"color"`
+	Intensity *float64  `json:"intensity"`
+	Spot      struct {
+		InnerConeAngle float64  `json:"innerConeAngle"`
+		OuterConeAngle *float64 `json:"outerConeAngle"`
+	} `json:"spot"`
+}
+
+// placedCamera is a perspective camera placed in the world
+type placedCamera struct {
+	yfov   float64
+	matrix geo.Matrix4
+}
+
+// content is what a scene of a glTF file places in the world
+type content struct {
+	instances []hittable.Hittable
+	camera    *placedCamera
+	lights    []light.Light
+}
+
+// scene finds the content of the default scene of the file. Files without scenes use all nodes
+// that are not children of other nodes.
+func (l *loader) scene() (content, error) {
+	var roots []int
+	switch {
+	case l.doc.Scene != nil:
+		if *l.doc.Scene < 0 || *l.doc.Scene >= len(l.doc.Scenes) {
+			return content{}, errors.New(fmt.Sprintf("Invalid scene index: %v", *l.doc.Scene))
+		}
+		roots = l.doc.Scenes[*l.doc.Scene].Nodes
+	case len(l.doc.Scenes) > 0:
+		roots = l.doc.Scenes[0].Nodes
+	default:
+		isChild := map[int]bool{}
+		for _, n := range l.doc.Nodes {
+			for _, child := range n.Children {
+				isChild[child] = true
+			}
+		}
+		for i := range l.doc.Nodes {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+
+	var c content
+	for _, root := range roots {
+		if err := l.node(root, geo.IdentityMatrix(), map[int]bool{}, &c); err != nil {
+			return content{}, err
+		}
+	}
+	return c, nil
+}
+
+// node adds the content of a node and its children, where parent is the transform of the parent node
+func (l *loader) node(index int, parent geo.Matrix4, ancestors map[int]bool, c *content) error {
+	if index < 0 || index >= len(l.doc.Nodes) {
+		return errors.New(fmt.Sprintf("Invalid node index: %v", index))
+	}
+	if ancestors[index] {
+		return errors.New(fmt.Sprintf("Node %v is its own ancestor", index))
+	}
+
+	n := l.doc.Nodes[index]
+	matrix := parent.Mul(n.localMatrix())
+
+	if n.Mesh != nil {
+		m, err := l.mesh(*n.Mesh)
+		if err != nil {
+			return err
+		}
+		switch {
+		case m == nil:
+		case matrix == geo.IdentityMatrix():
+			c.instances = append(c.instances, m)
+		default:
+			// The transform fails for nodes that are scaled to nothing, which can not be seen and are left out
+			if instance, err := hittable.NewTransform(m, matrix); err == nil {
+				c.instances = append(c.instances, instance)
+			}
+		}
+	}
+
+	if n.Camera != nil && c.camera == nil {
+		if *n.Camera < 0 || *n.Camera >= len(l.doc.Cameras) {
+			return errors.New(fmt.Sprintf("Invalid camera index: %v", *n.Camera))
+		}
+		if cam := l.doc.Cameras[*n.Camera]; cam.Type == "perspective" && cam.Perspective != nil {
+			c.camera = &placedCamera{yfov: cam.Perspective.Yfov, matrix: matrix}
+		}
+	}
+
+	if lp := n.Extensions.LightsPunctual; lp != nil {
+		li, err := l.light(lp.Light, matrix)
+		if err != nil {
+			return err
+		}
+		c.lights = append(c.lights, li)
+	}
+
+	ancestors[index] = true
+	for _, child := range n.Children {
+		if err := l.node(child, matrix, ancestors, c); err != nil {
+			return err
+		}
+	}
+	delete(ancestors, index)
+	return nil
+}
+
+// localMatrix returns the transform of the node relative to its parent
+func (n node) localMatrix() geo.Matrix4 {
+	if len(n.Matrix) == 16 {
+		// The matrix is stored column by column
+		var m geo.Matrix4
+		for col := 0; col < 4; col++ {
+			for row := 0; row < 4; row++ {
+				m[row][col] = n.Matrix[col*4+row]
+			}
+		}
+		return m
+	}
+
+	m := geo.IdentityMatrix()
+	if len(n.Translation) == 3 {
+		m = geo.TranslationMatrix(geo.NewVec3(n.Translation[0], n.Translation[1], n.Translation[2]))
+	}
+	if len(n.Rotation) == 4 {
+		m = m.Mul(quaternionMatrix(n.Rotation[0], n.Rotation[1], n.Rotation[2], n.Rotation[3]))
+	}
+	if len(n.Scale) == 3 {
+		m = m.Mul(geo.ScaleMatrix(geo.NewVec3(n.Scale[0], n.Scale[1], n.Scale[2])))
+	}
+	return m
+}
+
+// quaternionMatrix creates the rotation matrix of a quaternion
+func quaternionMatrix(x, y, z, w float64) geo.Matrix4 {
+	if length := math.Sqrt(x*x + y*y + z*z + w*w); length > 0 {
+		x, y, z, w = x/length, y/length, z/length, w/length
+	}
+
+	return geo.Matrix4{
+		{1 - 2*(y*y+z*z), 2 * (x*y - z*w), 2 * (x*z + y*w), 0},
+		{2 * (x*y + z*w), 1 - 2*(x*x+z*z), 2 * (y*z - x*w), 0},
+		{2 * (x*z - y*w), 2 * (y*z + x*w), 1 - 2*(x*x+y*y), 0},
+		{0, 0, 0, 1},
+	}
+}
+
+// mesh returns a bounding volume hierarchy of the triangles of the mesh, or nil if the mesh has no triangles
+func (l *loader) mesh(index int) (hittable.Hittable, error) {
+	if index < 0 || index >= len(l.doc.Meshes) {
+		return nil, errors.New(fmt.Sprintf("Invalid mesh index: %v", index))
+	}
+	if m, found := l.meshes[index]; found {
+		return m, nil
+	}
+
+	var triangles []hittable.Hittable
+	for _, p := range l.doc.Meshes[index].Primitives {
+		t, err := l.primitive(p)
+		if err != nil {
+			return nil, err
+		}
+		triangles = append(triangles, t...)
+	}
+
+	var m hittable.Hittable
+	if len(triangles) > 0 {
+		m = hittable.NewBoundingVolumeHierarchyWithOptions(triangles, hittable.BvhOptions{SplitMethod: hittable.SplitSah})
+	}
+	l.meshes[index] = m
+	return m, nil
+}
+
+// primitive returns the triangles of a primitive. Points and lines have no surface, and give no triangles.
+// Primitives without normals are flat shaded.
+func (l *loader) primitive(p primitive) ([]hittable.Hittable, error) {
+	mode := modeTriangles
+	if p.Mode != nil {
+		mode = *p.Mode
+	}
+	if mode > modeTriangleFan {
+		return nil, errors.New(fmt.Sprintf("Unsupported primitive mode: %v", mode))
+	}
+	positionIndex, found := p.Attributes["POSITION"]
+	if mode < modeTriangles || !found {
+		return nil, nil
+	}
+
+	positions, err := l.accessor(positionIndex, 3)
+	if err != nil {
+		return nil, err
+	}
+	vertexCount := len(positions) / 3
+	normals := make([]float64, len(positions))
+	if i, found := p.Attributes["NORMAL"]; found {
+		if normals, err = l.accessor(i, 3); err != nil {
+			return nil, err
+		}
+	}
+	texCoords := make([]float64, vertexCount*2)
+	if i, found := p.Attributes["TEXCOORD_0"]; found {
+		if texCoords, err = l.accessor(i, 2); err != nil {
+			return nil, err
+		}
+	}
+	if len(normals) != len(positions) || len(texCoords) != vertexCount*2 {
+		return nil, errors.New("Vertex attributes have different counts")
+	}
+
+	var indices []float64
+	if p.Indices != nil {
+		if indices, err = l.accessor(*p.Indices, 1); err != nil {
+			return nil, err
+		}
+	} else {
+		indices = make([]float64, vertexCount)
+		for i := range indices {
+			indices[i] = float64(i)
+		}
+	}
+	for _, index := range indices {
+		if index < 0 || index >= float64(vertexCount) {
+			return nil, errors.New(fmt.Sprintf("Invalid vertex index: %v", index))
+		}
+	}
+
+	mat, err := l.material(p.Material)
+	if err != nil {
+		return nil, err
+	}
+
+	var triangles []hittable.Hittable
+	for _, corners := range triangleCorners(mode, len(indices)) {
+		var v, n [3]geo.Vec3
+		var tu, tv [3]float64
+		for j, corner := range corners {
+			i := int(indices[corner])
+			v[j] = geo.NewVec3(positions[i*3], positions[i*3+1], positions[i*3+2])
+			n[j] = geo.NewVec3(normals[i*3], normals[i*3+1], normals[i*3+2])
+			// Texture coordinates in glTF start at the top of the image
+			tu[j], tv[j] = texCoords[i*2], 1-texCoords[i*2+1]
+		}
+		if v[1].Sub(v[0]).Cross(v[2].Sub(v[0])).LengthSquared() == 0 {
+			continue
+		}
+
+		triangles = append(triangles, hittable.NewTriangleWithNormals(
+			v[0], v[1], v[2],
+			n[0], n[1], n[2],
+			tu[0], tv[0], tu[1], tv[1], tu[2], tv[2],
+			mat,
+		))
+	}
+	return triangles, nil
+}
+
+// triangleCorners returns the positions in the index list of the corners of the triangles of a primitive mode
+func triangleCorners(mode, indexCount int) [][3]int {
+	var corners [][3]int
+	switch mode {
+	case modeTriangleStrip:
+		for i := 0; i+2 < indexCount; i++ {
+			// Every other triangle of a strip is flipped, to keep the winding
+			if i%2 == 0 {
+				corners = append(corners, [3]int{i, i + 1, i + 2})
+			} else {
+				corners = append(corners, [3]int{i + 1, i, i + 2})
+			}
+		}
+	case modeTriangleFan:
+		for i := 1; i+1 < indexCount; i++ {
+			corners = append(corners, [3]int{0, i, i + 1})
+		}
+	default:
+		for i := 0; i+2 < indexCount; i += 3 {
+			corners = append(corners, [3]int{i, i + 1, i + 2})
+		}
+	}
+	return corners
+}
+
+// light creates a punctual light placed by the matrix. Lights shine along their negative Z axis.
+func (l *loader) light(index int, matrix geo.Matrix4) (light.Light, error) {
+	lights := l.doc.Extensions.LightsPunctual.Lights
+	if index < 0 || index >= len(lights) {
+		return nil, errors.New(fmt.Sprintf("Invalid light index: %v", index))
+	}
+
+	gl := lights[index]
+	color := geo.NewVec3(1, 1, 1)
+	if len(gl.Color) == 3 {
+		color = geo.NewVec3(gl.Color[0], gl.Color[1], gl.Color[2])
+	}
+	intensity := color
+	if gl.Intensity != nil {
+		intensity = color.MulS(*gl.Intensity)
+	}
+	position := matrix.TransformPoint(geo.ZeroVector)
+	direction := matrix.TransformVector(geo.NewVec3(0, 0, -1))
+
+	switch gl.Type {
+	case "point":
+		return light.NewPoint(position, intensity), nil
+	case "spot":
+		outer := math.Pi / 4
+		if gl.Spot.OuterConeAngle != nil {
+			outer = *gl.Spot.OuterConeAngle
+		}
+		coneAngle := 2 * outer * 180 / math.Pi
+		falloff := (outer - gl.Spot.InnerConeAngle) * 180 / math.Pi
+		return light.NewSpot(position, direction, intensity, coneAngle, falloff), nil
+	case "directional":
+		return light.NewDirectional(direction, intensity), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown light type: %v", gl.Type))
+	}
+}
+
+// world returns a hittable of all the meshes
+func (c content) world(path string) (hittable.Hittable, error) {
+	switch len(c.instances) {
+	case 0:
+		return nil, errors.New(fmt.Sprintf("No meshes in glTF file %v", path))
+	case 1:
+		return c.instances[0], nil
+	default:
+		return hittable.NewBoundingVolumeHierarchy(c.instances), nil
+	}
+}
+
+// cameraConfig returns the config of the camera of the content, focused at the center of the world.
+// Without a camera the world is seen from the front, at a distance where all of it is visible.
+func (c content) cameraConfig(world hittable.Hittable) camera.CameraConfig {
+	box := world.BoundingBox()
+	center := box.Center()
+
+	if c.camera != nil {
+		from := c.camera.matrix.TransformPoint(geo.ZeroVector)
+		direction := c.camera.matrix.TransformVector(geo.NewVec3(0, 0, -1)).Unit()
+		focusDistance := center.Sub(from).Dot(direction)
+		if !(focusDistance > 0) {
+			focusDistance = 1
+		}
+		return camera.CameraConfig{
+			VerticalFovDegrees: c.camera.yfov * 180 / math.Pi,
+			FocusDistance:      focusDistance,
+			LookFrom:           from,
+			LookAt:             from.Add(direction.MulS(focusDistance)),
+		}
+	}
+
+	radius := geo.NewVec3(box.X.Size(), box.Y.Size(), box.Z.Size()).Length() / 2
+	distance := radius / math.Sin(util.DegreesToRadians(defaultFovDegrees/2))
+	return camera.CameraConfig{
+		VerticalFovDegrees: defaultFovDegrees,
+		FocusDistance:      distance,
+		LookFrom:           center.Add(geo.NewVec3(0, 0, distance)),
+		LookAt:             center,
+	}
+}
@@ -9,6 +9,7 @@ require (
 	github.com/udhos/gwob v0.0.0-20200524213453-619810f75817
 	github.com/valyala/fastrand v1.1.0
 	github.com/vitali-fedulov/images3 v1.0.12
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -16,5 +17,4 @@ require (
 	github.com/lucasb-eyer/go-colorful v1.0.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/vitali-fedulov/hyper v1.0.1 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
@@ -0,0 +1,159 @@
+package hdrimage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+const (
+	exrMagic        = 20000630
+	exrVersion      = 2
+	exrPixelTypeFlt = 2
+)
+
+// exrChannel is a single channel of a layer, e.g. the red component of the albedo layer
+type exrChannel struct {
+	name      string
+	pixels    []geo.Vec3
+	component int
+}
+
+// WriteExr writes the layers as a single part, uncompressed, scanline OpenEXR image with 32 bit float channels.
+// The layer with an empty name gets the channels R, G and B, other layers get channels prefixed
+// with the layer name, e.g. albedo.R, albedo.G and albedo.B
+func WriteExr(w io.Writer, width, height int, layers ...Layer) error {
+	var channels []exrChannel
+	names := make(map[string]bool)
+	for _, layer := range layers {
+		if err := checkSize(width, height, layer.Pixels); err != nil {
+			return err
+		}
+		if names[layer.Name] {
+			return errors.New(fmt.Sprintf("Duplicate layer name: '%v'", layer.Name))
+		}
+		names[layer.Name] = true
+
+		prefix := ""
+		if layer.Name != "" {
+			prefix = layer.Name + "."
+		}
+		for component, c := range []string{"R", "G", "B"} {
+			channels = append(channels, exrChannel{name: prefix + c, pixels: layer.Pixels, component: component})
+		}
+	}
+
+	// Channels must be stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].name < channels[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	header := exrHeader(width, height, channels)
+	bw.Write(header)
+
+	// Offset table with the position in the file for each scanline,
+	// followed by the scanlines consisting of y, data size and the pixel values channel by channel
+	lineDataSize := len(channels) * width * 4
+	lineSize := 8 + lineDataSize
+	firstLineOffset := len(header) + height*8
+
+	var offsets exrBuffer
+	for y := 0; y < height; y++ {
+		offsets.data = binary.LittleEndian.AppendUint64(offsets.data, uint64(firstLineOffset+y*lineSize))
+	}
+	bw.Write(offsets.data)
+
+	line := exrBuffer{data: make([]byte, 0, lineSize)}
+	for y := 0; y < height; y++ {
+		line.data = line.data[:0]
+		line.int32(int32(y))
+		line.int32(int32(lineDataSize))
+		for _, c := range channels {
+			for x := 0; x < width; x++ {
+				line.float32(float32(c.pixels[y*width+x].Axis(c.component)))
+			}
+		}
+		bw.Write(line.data)
+	}
+
+	return bw.Flush()
+}
+
+// exrHeader creates the header attributes, prefixed by magic number and version
+func exrHeader(width, height int, channels []exrChannel) []byte {
+	var h exrBuffer
+	h.int32(exrMagic)
+	h.int32(exrVersion)
+
+	var chlist exrBuffer
+	for _, c := range channels {
+		chlist.string(c.name)
+		chlist.int32(exrPixelTypeFlt)
+		chlist.bytes(0, 0, 0, 0) // pLinear and reserved
+		chlist.int32(1)          // x sampling
+		chlist.int32(1)          // y sampling
+	}
+	chlist.bytes(0)
+	h.attribute("channels", "chlist", chlist.data)
+
+	h.attribute("compression", "compression", []byte{0})
+
+	var window exrBuffer
+	window.int32(0)
+	window.int32(0)
+	window.int32(int32(width - 1))
+	window.int32(int32(height - 1))
+	h.attribute("dataWindow", "box2i", window.data)
+	h.attribute("displayWindow", "box2i", window.data)
+
+	h.attribute("lineOrder", "lineOrder", []byte{0})
+
+	var one exrBuffer
+	one.float32(1)
+	h.attribute("pixelAspectRatio", "float", one.data)
+
+	var center exrBuffer
+	center.float32(0)
+	center.float32(0)
+	h.attribute("screenWindowCenter", "v2f", center.data)
+	h.attribute("screenWindowWidth", "float", one.data)
+
+	h.bytes(0)
+	return h.data
+}
+
+// exrBuffer is a helper for building the little endian binary header of an OpenEXR image
+type exrBuffer struct {
+	data []byte
+}
+
+func (b *exrBuffer) bytes(v ...byte) {
+	b.data = append(b.data, v...)
+}
+
+func (b *exrBuffer) string(s string) {
+	b.data = append(b.data, s...)
+	b.data = append(b.data, 0)
+}
+
+func (b *exrBuffer) int32(v int32) {
+	b.data = binary.LittleEndian.AppendUint32(b.data, uint32(v))
+}
+
+func (b *exrBuffer) float32(v float32) {
+	b.data = binary.LittleEndian.AppendUint32(b.data, math.Float32bits(v))
+}
+
+func (b *exrBuffer) attribute(name, attributeType string, value []byte) {
+	b.string(name)
+	b.string(attributeType)
+	b.int32(int32(len(value)))
+	b.bytes(value...)
+}
@@ -0,0 +1,305 @@
+package hdrimage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+const (
+	exrPixelTypeUint = 0
+	exrPixelTypeHalf = 1
+
+	exrCompressionNone = 0
+	exrCompressionZips = 2
+	exrCompressionZip  = 3
+
+	// Flag in the version field that is set for tiled images
+	exrTiledFlag = 0x200
+	// Flags in the version field for deep data and multi part images
+	exrDeepOrMultiPartFlags = 0x800 | 0x1000
+)
+
+// exrChannelInfo is a channel as described in the header of an OpenEXR image
+type exrChannelInfo struct {
+	name      string
+	pixelType int32
+}
+
+func (c exrChannelInfo) size() int {
+	if c.pixelType == exrPixelTypeHalf {
+		return 2
+	}
+	return 4
+}
+
+// ReadExr reads the R, G and B channels of a scanline OpenEXR image. Images with only
+// a Y channel are read as gray. Supports no compression and ZIP compression.
+func ReadExr(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Image{}, err
+	}
+	reader := exrReader{data: data}
+
+	if reader.int32() != exrMagic {
+		return Image{}, errors.New("Not an OpenEXR image")
+	}
+	version := reader.int32()
+	if version&exrTiledFlag != 0 || version&exrDeepOrMultiPartFlags != 0 {
+		return Image{}, errors.New("Only scanline OpenEXR images are supported")
+	}
+
+	var channels []exrChannelInfo
+	compression := -1
+	var xMin, yMin, xMax, yMax int32
+	for {
+		name := reader.string()
+		if name == "" {
+			break
+		}
+		reader.string() // attribute type
+		size := int(reader.int32())
+		value := exrReader{data: reader.bytes(size)}
+
+		switch name {
+		case "channels":
+			for {
+				channelName := value.string()
+				if channelName == "" {
+					break
+				}
+				pixelType := value.int32()
+				value.bytes(4) // pLinear and reserved
+				xSampling := value.int32()
+				ySampling := value.int32()
+				if xSampling != 1 || ySampling != 1 {
+					return Image{}, errors.New("Subsampled OpenEXR channels are not supported")
+				}
+				channels = append(channels, exrChannelInfo{name: channelName, pixelType: pixelType})
+			}
+		case "compression":
+			compression = int(value.bytes(1)[0])
+		case "dataWindow":
+			xMin, yMin, xMax, yMax = value.int32(), value.int32(), value.int32(), value.int32()
+		}
+		if reader.err != nil || value.err != nil {
+			return Image{}, errors.New("Invalid OpenEXR header")
+		}
+	}
+
+	linesPerChunk := 1
+	switch compression {
+	case exrCompressionNone, exrCompressionZips:
+	case exrCompressionZip:
+		linesPerChunk = 16
+	default:
+		return Image{}, errors.New(fmt.Sprintf("Unsupported OpenEXR compression: %v", compression))
+	}
+
+	width := int(xMax-xMin) + 1
+	height := int(yMax-yMin) + 1
+	if width < 1 || height < 1 {
+		return Image{}, errors.New(fmt.Sprintf("Invalid image size %vx%v", width, height))
+	}
+
+	// Index of the channel giving each color component, with Y as fallback for gray images
+	components := [3]int{-1, -1, -1}
+	for i, c := range channels {
+		switch c.name {
+		case "R":
+			components[0] = i
+		case "G":
+			components[1] = i
+		case "B":
+			components[2] = i
+		}
+	}
+	for i, c := range channels {
+		if c.name == "Y" {
+			for j := range components {
+				if components[j] == -1 {
+					components[j] = i
+				}
+			}
+		}
+	}
+	for _, c := range components {
+		if c == -1 {
+			return Image{}, errors.New("OpenEXR image has no R, G and B or Y channels")
+		}
+	}
+
+	// Channels are stored one after another for each scanline
+	channelOffsets := make([]int, len(channels))
+	lineSize := 0
+	for i, c := range channels {
+		channelOffsets[i] = lineSize
+		lineSize += c.size() * width
+	}
+
+	img := Image{Width: width, Height: height, Pixels: make([]geo.Vec3, width*height)}
+	numChunks := (height + linesPerChunk - 1) / linesPerChunk
+	offsets := make([]uint64, numChunks)
+	for i := range offsets {
+		offsets[i] = reader.uint64()
+	}
+	if reader.err != nil {
+		return Image{}, errors.New("Invalid OpenEXR offset table")
+	}
+
+	for _, offset := range offsets {
+		if offset >= uint64(len(data)) {
+			return Image{}, errors.New("Invalid OpenEXR offset table")
+		}
+		chunk := exrReader{data: data[offset:]}
+		y0 := int(chunk.int32() - yMin)
+		size := int(chunk.int32())
+		packed := chunk.bytes(size)
+		if chunk.err != nil || y0 < 0 || y0 >= height {
+			return Image{}, errors.New("Invalid OpenEXR scanline")
+		}
+
+		lines := linesPerChunk
+		if y0+lines > height {
+			lines = height - y0
+		}
+		unpacked := packed
+		if compression != exrCompressionNone && size < lines*lineSize {
+			if unpacked, err = exrUnzip(packed, lines*lineSize); err != nil {
+				return Image{}, err
+			}
+		}
+		if len(unpacked) != lines*lineSize {
+			return Image{}, errors.New("Invalid OpenEXR scanline size")
+		}
+
+		for line := 0; line < lines; line++ {
+			lineData := unpacked[line*lineSize:]
+			y := y0 + line
+			for x := 0; x < width; x++ {
+				var rgb [3]float64
+				for i, c := range components {
+					rgb[i] = exrValue(lineData[channelOffsets[c]:], channels[c].pixelType, x)
+				}
+				img.Pixels[y*width+x] = geo.NewVec3(rgb[0], rgb[1], rgb[2])
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// exrValue returns value number x of a channel
+func exrValue(data []byte, pixelType int32, x int) float64 {
+	switch pixelType {
+	case exrPixelTypeHalf:
+		return halfToFloat(binary.LittleEndian.Uint16(data[x*2:]))
+	case exrPixelTypeUint:
+		return float64(binary.LittleEndian.Uint32(data[x*4:]))
+	default:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[x*4:])))
+	}
+}
+
+// exrUnzip decompresses ZIP compressed pixel data, that has been reordered and delta encoded before compression
+func exrUnzip(packed []byte, size int) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(packed))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decompress OpenEXR scanline: %v", err.Error()))
+	}
+	tmp, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to decompress OpenEXR scanline: %v", err.Error()))
+	}
+	if len(tmp) != size {
+		return nil, errors.New("Invalid OpenEXR scanline size")
+	}
+
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = tmp[i-1] + tmp[i] - 128
+	}
+
+	// The first half of the bytes are the even bytes of the data, the second half the odd bytes
+	ret := make([]byte, size)
+	half := (size + 1) / 2
+	for i := range ret {
+		if i%2 == 0 {
+			ret[i] = tmp[i/2]
+		} else {
+			ret[i] = tmp[half+i/2]
+		}
+	}
+	return ret, nil
+}
+
+// halfToFloat converts a 16 bit floating point value
+func halfToFloat(h uint16) float64 {
+	sign := 1.
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exponent := int(h>>10) & 0x1f
+	mantissa := float64(h & 0x3ff)
+
+	switch exponent {
+	case 0:
+		return sign * math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	default:
+		return sign * math.Ldexp(1+mantissa/1024, exponent-15)
+	}
+}
+
+// exrReader is a helper for reading the little endian binary data of an OpenEXR image.
+// Reading past the end sets err and returns zero values
+type exrReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *exrReader) bytes(n int) []byte {
+	if n < 0 {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	if r.pos+n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		r.pos = len(r.data)
+		return make([]byte, n)
+	}
+	ret := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return ret
+}
+
+func (r *exrReader) string() string {
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end == -1 {
+		r.err = io.ErrUnexpectedEOF
+		r.pos = len(r.data)
+		return ""
+	}
+	ret := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+	return ret
+}
+
+func (r *exrReader) int32() int32 {
+	return int32(binary.LittleEndian.Uint32(r.bytes(4)))
+}
+
+func (r *exrReader) uint64() uint64 {
+	return binary.LittleEndian.Uint64(r.bytes(8))
+}
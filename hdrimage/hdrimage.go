@@ -0,0 +1,159 @@
+// Package hdrimage reads and writes linear color values as high dynamic range image files.
+// Supported formats are OpenEXR, Portable Float Map and Radiance HDR.
+package hdrimage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/mdouchement/hdr"
+	"github.com/mdouchement/hdr/codec/pfm"
+	"github.com/mdouchement/hdr/codec/rgbe"
+)
+
+// Layer is a named set of rgb pixel values, stored row by row starting with the top left pixel.
+// The layer with an empty name is the main color of the image.
+type Layer struct {
+	Name   string
+	Pixels []geo.Vec3
+}
+
+// Image is the linear rgb pixel values of an hdr image, stored row by row starting with the top left pixel
+type Image struct {
+	Width  int
+	Height int
+	Pixels []geo.Vec3
+}
+
+// IsSupported checks if the extension of the path is a supported hdr image format
+func IsSupported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exr", ".pfm", ".hdr":
+		return true
+	default:
+		return false
+	}
+}
+
+// Save writes the layers to an image file with format given by the extension of the path.
+// Only OpenEXR can store more than one layer, for the other formats only the first layer is written.
+func Save(path string, width, height int, layers ...Layer) error {
+	if len(layers) == 0 {
+		return errors.New("No layers to save")
+	}
+
+	var encode func(w io.Writer) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exr":
+		encode = func(w io.Writer) error { return WriteExr(w, width, height, layers...) }
+	case ".pfm":
+		encode = func(w io.Writer) error { return WritePfm(w, width, height, layers[0].Pixels) }
+	case ".hdr":
+		encode = func(w io.Writer) error { return WriteHdr(w, width, height, layers[0].Pixels) }
+	default:
+		return errors.New(fmt.Sprintf("Unsupported hdr image extension: %v", path))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to create hdr image: %v", err.Error()))
+	}
+	if err := encode(f); err != nil {
+		f.Close()
+		return errors.New(fmt.Sprintf("Failed to write hdr image: %v", err.Error()))
+	}
+	return f.Close()
+}
+
+// WritePfm writes pixel values as a Portable Float Map
+func WritePfm(w io.Writer, width, height int, pixels []geo.Vec3) error {
+	if err := checkSize(width, height, pixels); err != nil {
+		return err
+	}
+	return pfm.Encode(w, im.ToHdrImage(pixels, width, height))
+}
+
+// WriteHdr writes pixel values as a Radiance HDR image, also known as RGBE
+func WriteHdr(w io.Writer, width, height int, pixels []geo.Vec3) error {
+	if err := checkSize(width, height, pixels); err != nil {
+		return err
+	}
+	return rgbe.Encode(w, im.ToHdrImage(pixels, width, height))
+}
+
+func checkSize(width, height int, pixels []geo.Vec3) error {
+	if width < 1 || height < 1 {
+		return errors.New(fmt.Sprintf("Invalid image size %vx%v", width, height))
+	}
+	if len(pixels) != width*height {
+		return errors.New(fmt.Sprintf("Expected %v pixels for image size %vx%v, got %v", width*height, width, height, len(pixels)))
+	}
+	return nil
+}
+
+// Load reads an image file with format given by the extension of the path
+func Load(path string) (Image, error) {
+	var decode func(r io.Reader) (Image, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exr":
+		decode = ReadExr
+	case ".pfm":
+		decode = ReadPfm
+	case ".hdr":
+		decode = ReadHdr
+	default:
+		return Image{}, errors.New(fmt.Sprintf("Unsupported hdr image extension: %v", path))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Image{}, errors.New(fmt.Sprintf("Failed to open hdr image: %v", err.Error()))
+	}
+	defer f.Close()
+
+	img, err := decode(f)
+	if err != nil {
+		return Image{}, errors.New(fmt.Sprintf("Failed to read hdr image %v: %v", path, err.Error()))
+	}
+	return img, nil
+}
+
+// ReadPfm reads a Portable Float Map image
+func ReadPfm(r io.Reader) (Image, error) {
+	img, err := pfm.Decode(r)
+	if err != nil {
+		return Image{}, err
+	}
+	return fromHdrImage(img.(hdr.Image)), nil
+}
+
+// ReadHdr reads a Radiance HDR image, also known as RGBE
+func ReadHdr(r io.Reader) (Image, error) {
+	img, err := rgbe.Decode(r)
+	if err != nil {
+		return Image{}, err
+	}
+	return fromHdrImage(img.(hdr.Image)), nil
+}
+
+func fromHdrImage(img hdr.Image) Image {
+	bounds := img.Bounds()
+	ret := Image{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Pixels: make([]geo.Vec3, bounds.Dx()*bounds.Dy()),
+	}
+	for y := 0; y < ret.Height; y++ {
+		for x := 0; x < ret.Width; x++ {
+			r, g, b, _ := img.HDRAt(bounds.Min.X+x, bounds.Min.Y+y).HDRRGBA()
+			ret.Pixels[y*ret.Width+x] = geo.NewVec3(r, g, b)
+		}
+	}
+	return ret
+}
@@ -4,97 +4,143 @@ import (
 	"math"
 
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/internal/util"
 )
 
-// Axis Aligned Bounding Box
-type aabb struct {
-	x, y, z util.Interval
+// EmptyAabb is a bounding box that contains nothing
+var EmptyAabb = Aabb{geo.EmptyInterval, geo.EmptyInterval, geo.EmptyInterval}
+
+// Aabb is an Axis Aligned Bounding Box, with an interval along each of the axes
+type Aabb struct {
+	X, Y, Z geo.Interval
+}
+
+// NewAabb creates a bounding box from the intervals along each of the axes
+func NewAabb(x, y, z geo.Interval) Aabb {
+	return Aabb{x, y, z}
 }
 
-func createAabbFromPoints(a, b geo.Vec3) aabb {
-	return aabb{
-		util.Interval{Min: math.Min(a.X, b.X), Max: math.Max(a.X, b.X)},
-		util.Interval{Min: math.Min(a.Y, b.Y), Max: math.Max(a.Y, b.Y)},
-		util.Interval{Min: math.Min(a.Z, b.Z), Max: math.Max(a.Z, b.Z)},
+// NewAabbFromPoints creates the smallest bounding box that contains all the given points
+func NewAabbFromPoints(points ...geo.Vec3) Aabb {
+	b := EmptyAabb
+	for _, p := range points {
+		b = Aabb{
+			geo.Interval{Min: math.Min(b.X.Min, p.X), Max: math.Max(b.X.Max, p.X)},
+			geo.Interval{Min: math.Min(b.Y.Min, p.Y), Max: math.Max(b.Y.Max, p.Y)},
+			geo.Interval{Min: math.Min(b.Z.Min, p.Z), Max: math.Max(b.Z.Max, p.Z)},
+		}
 	}
+	return b
 }
 
-func createAabbFrom3Points(a, b, c geo.Vec3) aabb {
-	return aabb{
-		util.Interval{Min: math.Min(math.Min(a.X, b.X), c.X), Max: math.Max(math.Max(a.X, b.X), c.X)},
-		util.Interval{Min: math.Min(math.Min(a.Y, b.Y), c.Y), Max: math.Max(math.Max(a.Y, b.Y), c.Y)},
-		util.Interval{Min: math.Min(math.Min(a.Z, b.Z), c.Z), Max: math.Max(math.Max(a.Z, b.Z), c.Z)},
+// CombineAabbs creates a new bounding box that is the union of the two given.
+// If there is a gap between the boxes, that is included in the returned box.
+func CombineAabbs(a Aabb, b Aabb) Aabb {
+	return Aabb{
+		geo.CombineIntervals(a.X, b.X),
+		geo.CombineIntervals(a.Y, b.Y),
+		geo.CombineIntervals(a.Z, b.Z),
 	}
 }
 
-func combineAabbs(a aabb, b aabb) aabb {
-	return aabb{
-		util.CombineIntervals(a.x, b.x),
-		util.CombineIntervals(a.y, b.y),
-		util.CombineIntervals(a.z, b.z),
+// IsEmpty checks if the bounding box contains nothing
+func (b Aabb) IsEmpty() bool {
+	return b.X.Min > b.X.Max || b.Y.Min > b.Y.Max || b.Z.Min > b.Z.Max
+}
+
+// Add returns a new bounding box that is moved by the given offset
+func (b Aabb) Add(offset geo.Vec3) Aabb {
+	return Aabb{
+		b.X.Add(offset.X),
+		b.Y.Add(offset.Y),
+		b.Z.Add(offset.Z),
 	}
 }
 
-func (b aabb) add(offset geo.Vec3) aabb {
-	return aabb{
-		b.x.Add(offset.X),
-		b.y.Add(offset.Y),
-		b.z.Add(offset.Z),
+// Expand returns a new bounding box that is larger by given value delta along each axis.
+// Delta is added equally to both sides of the box
+func (b Aabb) Expand(delta float64) Aabb {
+	return Aabb{
+		b.X.Expand(delta),
+		b.Y.Expand(delta),
+		b.Z.Expand(delta),
 	}
 }
 
-func (b aabb) padIfNeeded() aabb {
+// PadIfNeeded returns a new bounding box where no side is too thin to be hit by rays,
+// which is needed for flat hittables like quads and triangles
+func (b Aabb) PadIfNeeded() Aabb {
 	delta := 0.0001
-	var newX util.Interval
-	if b.x.Size() >= delta {
-		newX = b.x
-	} else {
-		newX = b.x.Expand(delta)
+	pad := func(i geo.Interval) geo.Interval {
+		if i.Size() >= delta {
+			return i
+		}
+		return i.Expand(delta)
 	}
-	var newY util.Interval
-	if b.y.Size() >= delta {
-		newY = b.y
-	} else {
-		newY = b.y.Expand(delta)
+	return Aabb{pad(b.X), pad(b.Y), pad(b.Z)}
+}
+
+// Transform returns the smallest bounding box that contains the transformed corners of the box
+func (b Aabb) Transform(matrix geo.Matrix4) Aabb {
+	if b.IsEmpty() {
+		return b
 	}
-	var newZ util.Interval
-	if b.z.Size() >= delta {
-		newZ = b.z
-	} else {
-		newZ = b.z.Expand(delta)
+
+	var corners [8]geo.Vec3
+	for i := range corners {
+		corners[i] = matrix.TransformPoint(geo.Vec3{
+			X: intervalEnd(i&1 != 0, b.X),
+			Y: intervalEnd(i&2 != 0, b.Y),
+			Z: intervalEnd(i&4 != 0, b.Z),
+		})
 	}
+	return NewAabbFromPoints(corners[:]...)
+}
 
-	return aabb{newX, newY, newZ}
+// intervalEnd returns the max of the interval if max is true, else the min
+func intervalEnd(max bool, i geo.Interval) float64 {
+	if max {
+		return i.Max
+	}
+	return i.Min
 }
 
-func (b aabb) hit(r geo.Ray, rayLength util.Interval) bool {
+// Hit checks if the ray passes through the bounding box, within the given ray length
+func (b Aabb) Hit(r geo.Ray, rayLength geo.Interval) bool {
 
-	t1 := (b.x.Min - r.Origin.X) * r.DirectionInverted.X
-	t2 := (b.x.Max - r.Origin.X) * r.DirectionInverted.X
+	t1 := (b.X.Min - r.Origin.X) * r.DirectionInverted.X
+	t2 := (b.X.Max - r.Origin.X) * r.DirectionInverted.X
 
 	tmin := math.Min(t1, t2)
 	tmax := math.Max(t1, t2)
 
-	t1 = (b.y.Min - r.Origin.Y) * r.DirectionInverted.Y
-	t2 = (b.y.Max - r.Origin.Y) * r.DirectionInverted.Y
+	t1 = (b.Y.Min - r.Origin.Y) * r.DirectionInverted.Y
+	t2 = (b.Y.Max - r.Origin.Y) * r.DirectionInverted.Y
 
 	tmin = math.Max(tmin, math.Min(t1, t2))
 	tmax = math.Min(tmax, math.Max(t1, t2))
 
-	t1 = (b.z.Min - r.Origin.Z) * r.DirectionInverted.Z
-	t2 = (b.z.Max - r.Origin.Z) * r.DirectionInverted.Z
+	t1 = (b.Z.Min - r.Origin.Z) * r.DirectionInverted.Z
+	t2 = (b.Z.Max - r.Origin.Z) * r.DirectionInverted.Z
 
 	tmin = math.Max(tmin, math.Min(t1, t2))
 	tmax = math.Min(tmax, math.Max(t1, t2))
 
-	return tmax > math.Max(tmin, 0)
+	return math.Min(tmax, rayLength.Max) > math.Max(tmin, rayLength.Min)
 }
 
-func (b aabb) center() geo.Vec3 {
+// Center returns the point in the middle of the bounding box
+func (b Aabb) Center() geo.Vec3 {
 	return geo.NewVec3(
-		b.x.Min+b.x.Max*.5,
-		b.y.Min+b.y.Max*.5,
-		b.z.Min+b.z.Max*.5,
+		(b.X.Min+b.X.Max)*.5,
+		(b.Y.Min+b.Y.Max)*.5,
+		(b.Z.Min+b.Z.Max)*.5,
 	)
 }
+
+// SurfaceArea returns the total area of the sides of the bounding box
+func (b Aabb) SurfaceArea() float64 {
+	x := b.X.Size()
+	y := b.Y.Size()
+	z := b.Z.Size()
+	return 2 * (x*y + y*z + z*x)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/DanielPettersson/solstrale/geo"
 	"github.com/DanielPettersson/solstrale/internal/util"
 	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 const (
@@ -15,57 +16,89 @@ const (
 // Bounding Volume Hierarchy
 type bvh struct {
 	NonPdfLightHittable
-	left          *bvh
-	right         *bvh
-	leftTriangle  Triangle
-	rightTriangle Triangle
-	bBox          aabb
+	left  Hittable
+	right Hittable
+	bBox  Aabb
+}
+
+// bvhItem is a hittable with its bounding box center, which is used for splitting the hierarchy
+type bvhItem struct {
+	hittable Hittable
+	center   geo.Vec3
+}
+
+// SplitMethod decides how the hittables of a bounding volume hierarchy are divided into child nodes
+type SplitMethod int
+
+const (
+	// SplitMidpoint splits at the middle of the hittable centers along the axis where they are most spread.
+	// Fast to build, but can give slow ray hits for unevenly distributed hittables.
+	SplitMidpoint SplitMethod = iota
+	// SplitSah splits where the surface area heuristic estimates the lowest cost for hitting rays,
+	// and stores the nodes in a flat array. Slower to build, but gives faster ray hits.
+	SplitSah
+)
+
+// BvhOptions are options for building a bounding volume hierarchy
+type BvhOptions struct {
+	SplitMethod SplitMethod
 }
 
 // NewBoundingVolumeHierarchy creates a new hittable object from the given hittable list
 // The bounding Volume Hierarchy sorts the hittables in a binary tree
 // where each node has a bounding box.
 // This is to optimize the ray intersection search when having many hittable objects.
-func NewBoundingVolumeHierarchy(list []Triangle) Hittable {
+// Any hittables can be used, also other hierarchies or transformed instances of them.
+// Lights in the hierarchy are found by FindLights, so that they are sampled.
+func NewBoundingVolumeHierarchy(list []Hittable) Hittable {
+	return NewBoundingVolumeHierarchyWithOptions(list, BvhOptions{})
+}
+
+// NewBoundingVolumeHierarchyWithOptions creates a new bounding volume hierarchy
+// like NewBoundingVolumeHierarchy, with options for how it is built
+func NewBoundingVolumeHierarchyWithOptions(list []Hittable, options BvhOptions) Hittable {
 
 	if len(list) == 0 {
 		panic("Cannot create a Bvh with empty list of objects")
 	}
 
-	bvhChan := make(chan *bvh)
-	go createBvhAsync(list, 0, len(list), bvhChan)
+	items := make([]bvhItem, len(list))
+	for i, h := range list {
+		items[i] = bvhItem{hittable: h, center: h.BoundingBox().Center()}
+	}
+
+	if options.SplitMethod == SplitSah {
+		return newSahBvh(items)
+	}
+
+	bvhChan := make(chan Hittable)
+	go createBvhAsync(items, 0, len(items), bvhChan)
 	return <-bvhChan
 }
 
-func createBvh(list []Triangle, start, end int) *bvh {
+func createBvh(list []bvhItem, start, end int) Hittable {
 	numObjects := end - start
-	var left *bvh
-	var right *bvh
-	var leftTriangle Triangle
-	var rightTriangle Triangle
-	var bBox aabb
 
 	if numObjects == 1 {
-		leftTriangle = list[start]
-		rightTriangle = list[start]
-		bBox = leftTriangle.BoundingBox()
+		return list[start].hittable
+	}
 
-	} else if numObjects == 2 {
-		leftTriangle = list[start]
-		rightTriangle = list[start+1]
-		bBox = combineAabbs(leftTriangle.BoundingBox(), rightTriangle.BoundingBox())
+	var left Hittable
+	var right Hittable
 
+	if numObjects == 2 {
+		left = list[start].hittable
+		right = list[start+1].hittable
 	} else {
 		mid := sortHittablesSliceByMostSpreadAxis(list, start, end)
 		left = createBvh(list, start, mid)
 		right = createBvh(list, mid, end)
-		bBox = combineAabbs(left.BoundingBox(), right.BoundingBox())
 	}
 
-	return &bvh{left: left, right: right, leftTriangle: leftTriangle, rightTriangle: rightTriangle, bBox: bBox}
+	return &bvh{left: left, right: right, bBox: CombineAabbs(left.BoundingBox(), right.BoundingBox())}
 }
 
-func createBvhAsync(list []Triangle, start, end int, bvhChan chan<- *bvh) {
+func createBvhAsync(list []bvhItem, start, end int, bvhChan chan<- Hittable) {
 	numObjects := end - start
 
 	if numObjects < asyncCountThreshold {
@@ -73,20 +106,20 @@ func createBvhAsync(list []Triangle, start, end int, bvhChan chan<- *bvh) {
 	} else {
 		mid := sortHittablesSliceByMostSpreadAxis(list, start, end)
 
-		leftChan := make(chan *bvh)
-		rightChan := make(chan *bvh)
+		leftChan := make(chan Hittable)
+		rightChan := make(chan Hittable)
 		go createBvhAsync(list, start, mid, leftChan)
 		go createBvhAsync(list, mid, end, rightChan)
 
 		left := <-leftChan
 		right := <-rightChan
-		bBox := combineAabbs(left.BoundingBox(), right.BoundingBox())
+		bBox := CombineAabbs(left.BoundingBox(), right.BoundingBox())
 		bvhChan <- &bvh{left: left, right: right, bBox: bBox}
 	}
 
 }
 
-func sortHittablesSliceByMostSpreadAxis(list []Triangle, start, end int) int {
+func sortHittablesSliceByMostSpreadAxis(list []bvhItem, start, end int) int {
 	slice := list[start:end]
 
 	xSpread, xCenter := boundingBoxSpread(slice, 0)
@@ -95,11 +128,11 @@ func sortHittablesSliceByMostSpreadAxis(list []Triangle, start, end int) int {
 
 	var center int
 	if xSpread >= ySpread && xSpread >= zSpread {
-		center = SortTrianglesByCenter(slice, xCenter, 0)
+		center = sortHittablesByCenter(slice, xCenter, 0)
 	} else if ySpread >= xSpread && ySpread >= zSpread {
-		center = SortTrianglesByCenter(slice, yCenter, 1)
+		center = sortHittablesByCenter(slice, yCenter, 1)
 	} else {
-		center = SortTrianglesByCenter(slice, zCenter, 2)
+		center = sortHittablesByCenter(slice, zCenter, 2)
 	}
 
 	center += start
@@ -111,31 +144,28 @@ func sortHittablesSliceByMostSpreadAxis(list []Triangle, start, end int) int {
 	return center
 }
 
-func boundingBoxSpread(list []Triangle, axis int) (float64, float64) {
+func boundingBoxSpread(list []bvhItem, axis int) (float64, float64) {
 	min := util.Infinity
 	max := -util.Infinity
 	listLen := len(list)
 	for i := 0; i < listLen; i++ {
-		c := list[i].Center(axis)
+		c := list[i].center.Axis(axis)
 		min = math.Min(min, c)
 		max = math.Max(max, c)
 	}
 	return max - min, (min + max) * .5
 }
 
-func SortTrianglesByCenter(list []Triangle, center float64, axis int) int {
+func sortHittablesByCenter(list []bvhItem, center float64, axis int) int {
 
 	i := 0
 	j := len(list) - 1
 
 	for i <= j {
-		if list[i].Center(axis) < center {
+		if list[i].center.Axis(axis) < center {
 			i++
 		} else {
-			tmpI := list[i]
-			tmpJ := list[j]
-			list[i] = tmpJ
-			list[j] = tmpI
+			list[i], list[j] = list[j], list[i]
 			j--
 		}
 	}
@@ -143,33 +173,17 @@ func SortTrianglesByCenter(list []Triangle, center float64, axis int) int {
 	return i
 }
 
-func (b *bvh) HitLeft(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
-	if b.left != nil {
-		return (*b.left).Hit(r, rayLength)
-	} else {
-		return b.leftTriangle.Hit(r, rayLength)
-	}
-}
-
-func (b *bvh) HitRight(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
-	if b.right != nil {
-		return (*b.right).Hit(r, rayLength)
-	} else {
-		return b.rightTriangle.Hit(r, rayLength)
-	}
-}
-
-func (b *bvh) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
-	if !b.bBox.hit(r, rayLength) {
+func (b *bvh) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
+	if !b.bBox.Hit(r, rayLength) {
 		return false, nil
 	}
 
-	hitLeft, rec := b.HitLeft(r, rayLength)
+	hitLeft, rec := b.left.Hit(r, rayLength, rng)
 	if hitLeft {
-		rayLength = util.Interval{Min: rayLength.Min, Max: rec.RayLength}
+		rayLength = geo.Interval{Min: rayLength.Min, Max: rec.RayLength}
 	}
 
-	hitRight, recRight := b.HitRight(r, rayLength)
+	hitRight, recRight := b.right.Hit(r, rayLength, rng)
 	if hitRight {
 		rec = recRight
 	}
@@ -177,10 +191,15 @@ func (b *bvh) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord
 	return hitLeft || hitRight, rec
 }
 
-func (b *bvh) BoundingBox() aabb {
+func (b *bvh) BoundingBox() Aabb {
 	return b.bBox
 }
 
+// Lights returns the lights in the hierarchy
+func (b *bvh) Lights() []Hittable {
+	return append(FindLights(b.left), FindLights(b.right)...)
+}
+
 func (b *bvh) IsLight() bool {
 	return false
 }
@@ -0,0 +1,323 @@
+package hittable
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+const (
+	// Number of bins that the hittable centers are divided into when searching for the best split
+	sahBinCount = 16
+	// Max number of hittables in a leaf, unless they can not be split
+	sahMaxLeafSize = 4
+	// Estimated cost of testing a node relative to hitting a hittable
+	sahTraversalCost = .125
+	sahIntersectCost = 1.
+	// Max depth of the hierarchy, which is the size of the stack used when traversing it
+	sahMaxStackDepth = 64
+	// Number of hittables for which building of child nodes is done in parallel
+	sahAsyncThreshold = 10000
+	sahLeafFlag       = -1
+)
+
+// linearBvh is a bounding volume hierarchy stored as a flat array of nodes in depth first order.
+// Compared to a tree of pointers this keeps nodes that are visited together close in memory.
+type linearBvh struct {
+	NonPdfLightHittable
+	nodes     []linearBvhNode
+	hittables []Hittable
+}
+
+// linearBvhNode is a node in a linearBvh. The first child of an interior node
+// directly follows the node in the array, so only the index of the second child is stored.
+type linearBvhNode struct {
+	bBox Aabb
+	// index of first hittable for leaves, index of second child for interior nodes
+	offset int32
+	// number of hittables for leaves, or sahLeafFlag for interior nodes
+	count int32
+	// axis the interior node was split along, used for visiting the closest child first
+	axis int32
+}
+
+// sahNode is a node of the temporary tree built before it is flattened into a linearBvh
+type sahNode struct {
+	bBox        Aabb
+	left, right *sahNode
+	start       int
+	count       int
+	axis        int
+	numNodes    int
+}
+
+func newSahBvh(items []bvhItem) Hittable {
+	rootChan := make(chan *sahNode)
+	go buildSahNodeAsync(items, 0, len(items), 0, rootChan)
+	root := <-rootChan
+
+	b := &linearBvh{
+		nodes:     make([]linearBvhNode, 0, root.numNodes),
+		hittables: make([]Hittable, len(items)),
+	}
+	for i, item := range items {
+		b.hittables[i] = item.hittable
+	}
+	b.flatten(root)
+	return b
+}
+
+func (b *linearBvh) flatten(n *sahNode) {
+	index := len(b.nodes)
+	b.nodes = append(b.nodes, linearBvhNode{bBox: n.bBox})
+
+	if n.left == nil {
+		b.nodes[index].offset = int32(n.start)
+		b.nodes[index].count = int32(n.count)
+		return
+	}
+
+	b.flatten(n.left)
+	b.nodes[index].offset = int32(len(b.nodes))
+	b.nodes[index].count = sahLeafFlag
+	b.nodes[index].axis = int32(n.axis)
+	b.flatten(n.right)
+}
+
+func buildSahNodeAsync(items []bvhItem, start, end, depth int, nodeChan chan<- *sahNode) {
+	if end-start < sahAsyncThreshold {
+		nodeChan <- buildSahNode(items, start, end, depth)
+		return
+	}
+
+	n, mid := splitSahNode(items, start, end, depth)
+	if mid == start {
+		nodeChan <- n
+		return
+	}
+
+	leftChan := make(chan *sahNode)
+	rightChan := make(chan *sahNode)
+	go buildSahNodeAsync(items, start, mid, depth+1, leftChan)
+	go buildSahNodeAsync(items, mid, end, depth+1, rightChan)
+	n.left = <-leftChan
+	n.right = <-rightChan
+	n.numNodes = 1 + n.left.numNodes + n.right.numNodes
+	nodeChan <- n
+}
+
+func buildSahNode(items []bvhItem, start, end, depth int) *sahNode {
+	n, mid := splitSahNode(items, start, end, depth)
+	if mid == start {
+		return n
+	}
+
+	n.left = buildSahNode(items, start, mid, depth+1)
+	n.right = buildSahNode(items, mid, end, depth+1)
+	n.numNodes = 1 + n.left.numNodes + n.right.numNodes
+	return n
+}
+
+// splitSahNode creates a node for the items and partitions them where the surface area heuristic
+// gives the lowest cost. Returns the index of the split, or start if the node should be a leaf.
+func splitSahNode(items []bvhItem, start, end, depth int) (*sahNode, int) {
+	count := end - start
+	slice := items[start:end]
+
+	bBox := slice[0].hittable.BoundingBox()
+	centerMin := slice[0].center
+	centerMax := slice[0].center
+	for _, item := range slice[1:] {
+		bBox = CombineAabbs(bBox, item.hittable.BoundingBox())
+		centerMin = geo.NewVec3(math.Min(centerMin.X, item.center.X), math.Min(centerMin.Y, item.center.Y), math.Min(centerMin.Z, item.center.Z))
+		centerMax = geo.NewVec3(math.Max(centerMax.X, item.center.X), math.Max(centerMax.Y, item.center.Y), math.Max(centerMax.Z, item.center.Z))
+	}
+
+	n := &sahNode{bBox: bBox, start: start, count: count, numNodes: 1}
+	if count == 1 {
+		return n, start
+	}
+
+	// Keep the depth within what fits in the traversal stack, by making a larger leaf.
+	// Only happens for extremely uneven distributions of hittables.
+	if depth >= sahMaxStackDepth-1 {
+		return n, start
+	}
+
+	// Find the cheapest split over bins of the hittable centers along each axis
+
+	type bin struct {
+		bBox  Aabb
+		count int
+	}
+
+	bestCost := util.Infinity
+	bestAxis := -1
+	bestBin := 0
+	for axis := 0; axis < 3; axis++ {
+		min := centerMin.Axis(axis)
+		extent := centerMax.Axis(axis) - min
+		if extent <= 0 {
+			continue
+		}
+
+		var bins [sahBinCount]bin
+		for _, item := range slice {
+			bi := binIndex(item.center.Axis(axis), min, extent)
+			if bins[bi].count == 0 {
+				bins[bi].bBox = item.hittable.BoundingBox()
+			} else {
+				bins[bi].bBox = CombineAabbs(bins[bi].bBox, item.hittable.BoundingBox())
+			}
+			bins[bi].count++
+		}
+
+		// Sweep from the right to get the area and count for all right sides,
+		// then from the left to get the cost of each split
+
+		var rightAreas [sahBinCount - 1]float64
+		var rightCounts [sahBinCount - 1]int
+		var rightBox Aabb
+		rightCount := 0
+		for i := sahBinCount - 1; i > 0; i-- {
+			rightBox, rightCount = addBin(rightBox, rightCount, bins[i].bBox, bins[i].count)
+			rightAreas[i-1] = surfaceAreaOrZero(rightBox, rightCount)
+			rightCounts[i-1] = rightCount
+		}
+
+		var leftBox Aabb
+		leftCount := 0
+		for i := 0; i < sahBinCount-1; i++ {
+			leftBox, leftCount = addBin(leftBox, leftCount, bins[i].bBox, bins[i].count)
+			if leftCount == 0 || rightCounts[i] == 0 {
+				continue
+			}
+			cost := surfaceAreaOrZero(leftBox, leftCount)*float64(leftCount) + rightAreas[i]*float64(rightCounts[i])
+			if cost < bestCost {
+				bestCost = cost
+				bestAxis = axis
+				bestBin = i
+			}
+		}
+	}
+
+	if bestAxis == -1 {
+		// All centers are at the same position, so the hittables can not be separated
+		if count <= sahMaxLeafSize {
+			return n, start
+		}
+		n.axis = 0
+		return n, start + count/2
+	}
+
+	leafCost := sahIntersectCost * float64(count)
+	splitCost := sahTraversalCost + sahIntersectCost*bestCost/bBox.SurfaceArea()
+	if count <= sahMaxLeafSize && leafCost <= splitCost {
+		return n, start
+	}
+
+	min := centerMin.Axis(bestAxis)
+	extent := centerMax.Axis(bestAxis) - min
+
+	i := 0
+	j := len(slice) - 1
+	for i <= j {
+		if binIndex(slice[i].center.Axis(bestAxis), min, extent) <= bestBin {
+			i++
+		} else {
+			slice[i], slice[j] = slice[j], slice[i]
+			j--
+		}
+	}
+
+	n.axis = bestAxis
+	return n, start + i
+}
+
+func binIndex(value, min, extent float64) int {
+	bi := int(sahBinCount * (value - min) / extent)
+	if bi >= sahBinCount {
+		bi = sahBinCount - 1
+	}
+	return bi
+}
+
+func addBin(bBox Aabb, count int, binBox Aabb, binCount int) (Aabb, int) {
+	if binCount == 0 {
+		return bBox, count
+	}
+	if count == 0 {
+		return binBox, binCount
+	}
+	return CombineAabbs(bBox, binBox), count + binCount
+}
+
+func surfaceAreaOrZero(bBox Aabb, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return bBox.SurfaceArea()
+}
+
+func (b *linearBvh) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
+	var stack [sahMaxStackDepth]int32
+	stackSize := 0
+	current := int32(0)
+
+	dirIsNeg := [3]bool{r.Direction.X < 0, r.Direction.Y < 0, r.Direction.Z < 0}
+
+	var rec *material.HitRecord
+	for {
+		node := &b.nodes[current]
+		if node.bBox.Hit(r, rayLength) {
+			if node.count != sahLeafFlag {
+				for i := node.offset; i < node.offset+node.count; i++ {
+					if hit, hitRec := b.hittables[i].Hit(r, rayLength, rng); hit {
+						rec = hitRec
+						rayLength = geo.Interval{Min: rayLength.Min, Max: hitRec.RayLength}
+					}
+				}
+			} else {
+				// Visit the child closest to the ray origin first, as a hit in it
+				// can make it possible to skip the other child
+				if dirIsNeg[node.axis] {
+					stack[stackSize] = current + 1
+					current = node.offset
+				} else {
+					stack[stackSize] = node.offset
+					current = current + 1
+				}
+				stackSize++
+				continue
+			}
+		}
+
+		if stackSize == 0 {
+			break
+		}
+		stackSize--
+		current = stack[stackSize]
+	}
+
+	return rec != nil, rec
+}
+
+func (b *linearBvh) BoundingBox() Aabb {
+	return b.nodes[0].bBox
+}
+
+// Lights returns the lights in the hierarchy
+func (b *linearBvh) Lights() []Hittable {
+	var lights []Hittable
+	for _, h := range b.hittables {
+		lights = append(lights, FindLights(h)...)
+	}
+	return lights
+}
+
+func (b *linearBvh) IsLight() bool {
+	return false
+}
@@ -30,16 +30,17 @@ func NewConstantMedium(boundary Hittable, density float64, color geo.Vec3) Hitta
 	}
 }
 
-func (cm constantMedium) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (cm constantMedium) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 
-	hit1, rec1 := cm.Boundary.Hit(r, util.UniverseInterval)
+	hit1, rec1 := cm.Boundary.Hit(r, geo.UniverseInterval, rng)
 	if !hit1 {
 		return false, nil
 	}
 
 	hit2, rec2 := cm.Boundary.Hit(
 		r,
-		util.Interval{Min: rec1.RayLength + 0.0001, Max: util.Infinity},
+		geo.Interval{Min: rec1.RayLength + 0.0001, Max: util.Infinity},
+		rng,
 	)
 	if !hit2 {
 		return false, nil
@@ -56,7 +57,7 @@ func (cm constantMedium) Hit(r geo.Ray, rayLength util.Interval) (bool, *materia
 
 	rLength := r.Direction.Length()
 	distanceInsideBoundary := (rec2.RayLength - rec1.RayLength) * rLength
-	hitDistance := cm.NegativeInverseDensity * math.Log(random.RandomNormalFloat())
+	hitDistance := cm.NegativeInverseDensity * math.Log(rng.NormalFloat())
 
 	if hitDistance > distanceInsideBoundary {
 		return false, nil
@@ -65,7 +66,7 @@ func (cm constantMedium) Hit(r geo.Ray, rayLength util.Interval) (bool, *materia
 	t := rec1.RayLength + hitDistance/rLength
 
 	hitRecord := material.HitRecord{
-		Normal:    geo.RandomUnitVector(),
+		Normal:    geo.RandomUnitVector(rng),
 		HitPoint:  r.At(t),
 		Material:  cm.PhaseFunction,
 		RayLength: t,
@@ -74,7 +75,7 @@ func (cm constantMedium) Hit(r geo.Ray, rayLength util.Interval) (bool, *materia
 	return true, &hitRecord
 }
 
-func (cm constantMedium) BoundingBox() aabb {
+func (cm constantMedium) BoundingBox() Aabb {
 	return cm.Boundary.BoundingBox()
 }
 
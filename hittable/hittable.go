@@ -2,24 +2,43 @@ package hittable
 
 import (
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/internal/util"
 	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 // Hittable is the common interface for all objects in the ray tracing scene
 // that can be hit by rays
 type Hittable interface {
 	PdfLightHittable
-	Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord)
-	BoundingBox() aabb
+	Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord)
+	BoundingBox() Aabb
 	IsLight() bool
 }
 
+// LightContainer is implemented by hittables that contain other hittables, like lists,
+// bounding volume hierarchies and transforms, so that the lights within them can be found
+type LightContainer interface {
+	// Lights returns the lights within the container, transformed as they are in the container
+	Lights() []Hittable
+}
+
+// FindLights returns the lights of the hittable, including the lights within containers, as
+// they are placed in the world. Lights within transforms are returned wrapped in the transforms
+func FindLights(h Hittable) []Hittable {
+	if c, ok := h.(LightContainer); ok {
+		return c.Lights()
+	}
+	if h.IsLight() {
+		return []Hittable{h}
+	}
+	return nil
+}
+
 // PdfLightHittable has methods used when other hittables have pdf scattering materials.
 // This should be implemented by hittables that can have light materials.
 type PdfLightHittable interface {
 	PdfValue(origin, direction geo.Vec3) float64
-	RandomDirection(origin geo.Vec3) geo.Vec3
+	RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3
 }
 
 // NonPdfLightHittable is used by hittables that never uses pdfs directly
@@ -32,6 +51,6 @@ func (h NonPdfLightHittable) PdfValue(origin, direction geo.Vec3) float64 {
 }
 
 // RandomDirection panics if invoked
-func (h NonPdfLightHittable) RandomDirection(origin geo.Vec3) geo.Vec3 {
+func (h NonPdfLightHittable) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
 	panic("Should not be used")
 }
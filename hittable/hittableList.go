@@ -2,7 +2,6 @@ package hittable
 
 import (
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/internal/util"
 	"github.com/DanielPettersson/solstrale/material"
 	"github.com/DanielPettersson/solstrale/random"
 )
@@ -12,21 +11,21 @@ import (
 // objects in a scene
 type HittableList struct {
 	list []Hittable
-	bBox aabb
+	bBox Aabb
 }
 
 // NewHittableList creates new empty HittableList
 func NewHittableList() HittableList {
 	return HittableList{
 		[]Hittable{},
-		aabb{util.EmptyInterval, util.EmptyInterval, util.EmptyInterval},
+		EmptyAabb,
 	}
 }
 
 // Add adds a new hittable object to this HittableList
 func (hl *HittableList) Add(h Hittable) {
 	hl.list = append(hl.list, h)
-	hl.bBox = combineAabbs(hl.bBox, h.BoundingBox())
+	hl.bBox = CombineAabbs(hl.bBox, h.BoundingBox())
 }
 
 // List returns the current slice of hittables
@@ -36,19 +35,19 @@ func (hl *HittableList) List() []Hittable {
 
 // Hit Checks if the given ray hits any object in this list.
 // And if so, returns the properties of that ray hit
-func (hl *HittableList) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (hl *HittableList) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 	var closestHitRecord *material.HitRecord
 	hitAnything := false
 	closestSoFar := rayLength.Max
-	closestInterval := util.Interval{Min: rayLength.Min, Max: closestSoFar}
+	closestInterval := geo.Interval{Min: rayLength.Min, Max: closestSoFar}
 
 	for _, h := range hl.list {
-		hit, hitRecord := h.Hit(r, closestInterval)
+		hit, hitRecord := h.Hit(r, closestInterval, rng)
 		if hit {
 			hitAnything = true
 			closestSoFar = hitRecord.RayLength
 			closestHitRecord = hitRecord
-			closestInterval = util.Interval{Min: rayLength.Min, Max: closestSoFar}
+			closestInterval = geo.Interval{Min: rayLength.Min, Max: closestSoFar}
 		}
 	}
 
@@ -56,7 +55,7 @@ func (hl *HittableList) Hit(r geo.Ray, rayLength util.Interval) (bool, *material
 }
 
 // BoundingBox returns the bounding box that encapsulates all hittables in the list
-func (hl *HittableList) BoundingBox() aabb {
+func (hl *HittableList) BoundingBox() Aabb {
 	return hl.bBox
 }
 
@@ -73,9 +72,18 @@ func (hl *HittableList) PdfValue(origin, direction geo.Vec3) float64 {
 }
 
 // RandomDirection generates a random direction for a random hittable in the list
-func (hl *HittableList) RandomDirection(origin geo.Vec3) geo.Vec3 {
-	idx := random.RandomUint32(uint32(len(hl.list)))
-	return hl.list[idx].RandomDirection(origin)
+func (hl *HittableList) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	idx := rng.Uint32n(uint32(len(hl.list)))
+	return hl.list[idx].RandomDirection(origin, rng)
+}
+
+// Lights returns the lights in the list
+func (hl *HittableList) Lights() []Hittable {
+	var lights []Hittable
+	for _, h := range hl.list {
+		lights = append(lights, FindLights(h)...)
+	}
+	return lights
 }
 
 // IsLight returns if a hittable list itself is a light, which it is not
@@ -3,6 +3,7 @@ package hittable
 import (
 	"github.com/DanielPettersson/solstrale/geo"
 	"github.com/DanielPettersson/solstrale/pdf"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 // HittablePdf is a wrapper for generating pdfs for a list of hittables
@@ -25,6 +26,6 @@ func (p HittablePdf) Value(direction geo.Vec3) float64 {
 }
 
 // Generate implements pdf.Pdf
-func (p HittablePdf) Generate() geo.Vec3 {
-	return p.objects.RandomDirection(p.origin)
+func (p HittablePdf) Generate(rng *random.Rng) geo.Vec3 {
+	return p.objects.RandomDirection(p.origin, rng)
 }
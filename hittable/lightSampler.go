@@ -0,0 +1,273 @@
+package hittable
+
+import (
+	"math"
+	"sort"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/pdf"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// Share of the light samples that are spread evenly over the lights, so that lights
+// where the power is underestimated, like lights with textures, still get samples
+const uniformLightShare = .1
+
+// LightSampler chooses which of the lights in the world to sample directions towards
+type LightSampler interface {
+	// Pdf returns the pdf that samples directions from the origin towards the lights
+	Pdf(origin geo.Vec3) pdf.Pdf
+}
+
+// emitter is implemented by light hittables that can estimate how much light they emit
+type emitter interface {
+	// power returns the luminance of the emitted light times the area of the hittable,
+	// and if it could be estimated. Hittables that wrap other hittables can only estimate
+	// the power when the wrapped hittable can
+	power() (float64, bool)
+}
+
+// lightPower returns the power of a light hittable, and if it could be estimated
+func lightPower(h Hittable) (float64, bool) {
+	if e, ok := h.(emitter); ok {
+		return e.power()
+	}
+	return 0, false
+}
+
+// emittedLuminance returns the luminance of the light emitted by the material at a point
+func emittedLuminance(mat material.Material, point geo.Vec3) float64 {
+	rec := material.HitRecord{
+		HitPoint:  point,
+		Material:  mat,
+		U:         .5,
+		V:         .5,
+		FrontFace: true,
+	}
+	return math.Max(0, mat.Emitted(&rec).Luminance())
+}
+
+// lightWeights returns the probabilities of choosing each of the lights, in proportion to their power.
+// Lights where the power can not be estimated get the average power of the other lights
+func lightWeights(lights []Hittable) []float64 {
+	powers := make([]float64, len(lights))
+	known := make([]bool, len(lights))
+	total := 0.
+	numKnown := 0
+	for i, l := range lights {
+		powers[i], known[i] = lightPower(l)
+		if known[i] {
+			total += powers[i]
+			numKnown++
+		}
+	}
+	average := 1.
+	if numKnown > 0 && total > 0 {
+		average = total / float64(numKnown)
+	}
+
+	total = 0
+	for i := range powers {
+		if !known[i] {
+			powers[i] = average
+		}
+		total += powers[i]
+	}
+
+	weights := make([]float64, len(lights))
+	n := float64(len(lights))
+	for i, p := range powers {
+		if total > 0 {
+			weights[i] = (1-uniformLightShare)*p/total + uniformLightShare/n
+		} else {
+			weights[i] = 1 / n
+		}
+	}
+	return weights
+}
+
+// NewUniformLightSampler creates a light sampler that chooses all lights with the same probability
+func NewUniformLightSampler(lights *HittableList) LightSampler {
+	return uniformLightSampler{lights: lights}
+}
+
+type uniformLightSampler struct {
+	lights *HittableList
+}
+
+// Pdf returns a pdf that samples a uniformly chosen light
+func (s uniformLightSampler) Pdf(origin geo.Vec3) pdf.Pdf {
+	return NewHittablePdf(s.lights, origin)
+}
+
+// NewPowerLightSampler creates a light sampler that chooses lights in proportion
+// to how much light they emit, estimated from their emitted color and their area
+func NewPowerLightSampler(lights []Hittable) LightSampler {
+	weights := lightWeights(lights)
+	cdf := make([]float64, len(weights))
+	sum := 0.
+	for i, w := range weights {
+		sum += w
+		cdf[i] = sum
+	}
+	return &powerLightSampler{
+		lights:  lights,
+		weights: weights,
+		cdf:     cdf,
+	}
+}
+
+type powerLightSampler struct {
+	lights  []Hittable
+	weights []float64
+	cdf     []float64
+}
+
+// Pdf returns a pdf that samples lights chosen in proportion to their power
+func (s *powerLightSampler) Pdf(origin geo.Vec3) pdf.Pdf {
+	return powerLightPdf{sampler: s, origin: origin}
+}
+
+type powerLightPdf struct {
+	sampler *powerLightSampler
+	origin  geo.Vec3
+}
+
+// Value returns the pdf value of the direction, summed over the lights weighted by their probabilities
+func (p powerLightPdf) Value(direction geo.Vec3) float64 {
+	sum := 0.
+	for i, l := range p.sampler.lights {
+		sum += p.sampler.weights[i] * l.PdfValue(p.origin, direction)
+	}
+	return sum
+}
+
+// Generate returns a direction towards a light chosen in proportion to its power
+func (p powerLightPdf) Generate(rng *random.Rng) geo.Vec3 {
+	cdf := p.sampler.cdf
+	target := rng.NormalFloat() * cdf[len(cdf)-1]
+	i := sort.Search(len(cdf), func(i int) bool {
+		return cdf[i] > target
+	})
+	if i >= len(cdf) {
+		i = len(cdf) - 1
+	}
+	return p.sampler.lights[i].RandomDirection(p.origin, rng)
+}
+
+// lightTreeNode is a node in a tree of lights, that is either a leaf with a light, or has two children
+type lightTreeNode struct {
+	bBox  Aabb
+	power float64
+	light Hittable
+	left  *lightTreeNode
+	right *lightTreeNode
+}
+
+// NewLightTree creates a light sampler that chooses lights by traversing a tree of the lights.
+// At each node the child that is estimated to give the most light to the origin, from its power
+// and its distance to the origin, is chosen more often. Suited for scenes with many lights.
+func NewLightTree(lights []Hittable) LightSampler {
+	weights := lightWeights(lights)
+	leaves := make([]*lightTreeNode, len(lights))
+	for i, l := range lights {
+		leaves[i] = &lightTreeNode{
+			bBox:  l.BoundingBox(),
+			power: weights[i],
+			light: l,
+		}
+	}
+	return buildLightTree(leaves)
+}
+
+// buildLightTree builds the tree by splitting the lights in half along the longest axis of their centers
+func buildLightTree(nodes []*lightTreeNode) *lightTreeNode {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+
+	centers := NewAabbFromPoints(nodes[0].bBox.Center(), nodes[0].bBox.Center())
+	for _, n := range nodes[1:] {
+		centers = CombineAabbs(centers, NewAabbFromPoints(n.bBox.Center(), n.bBox.Center()))
+	}
+	axis := 0
+	if centers.Y.Size() > centers.X.Size() && centers.Y.Size() >= centers.Z.Size() {
+		axis = 1
+	} else if centers.Z.Size() > centers.X.Size() && centers.Z.Size() > centers.Y.Size() {
+		axis = 2
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].bBox.Center().Axis(axis) < nodes[j].bBox.Center().Axis(axis)
+	})
+
+	mid := len(nodes) / 2
+	left := buildLightTree(nodes[:mid])
+	right := buildLightTree(nodes[mid:])
+	return &lightTreeNode{
+		bBox:  CombineAabbs(left.bBox, right.bBox),
+		power: left.power + right.power,
+		left:  left,
+		right: right,
+	}
+}
+
+// Pdf returns a pdf that samples lights chosen by traversing the tree
+func (n *lightTreeNode) Pdf(origin geo.Vec3) pdf.Pdf {
+	return lightTreePdf{root: n, origin: origin}
+}
+
+// importance estimates how much light the lights of the node give to the origin
+func (n *lightTreeNode) importance(origin geo.Vec3) float64 {
+	distanceSquared := n.bBox.Center().Sub(origin).LengthSquared()
+	// Close to the node, the distance says little about how much light reaches the origin
+	halfDiagonal := geo.NewVec3(n.bBox.X.Size(), n.bBox.Y.Size(), n.bBox.Z.Size()).MulS(.5)
+	return n.power / math.Max(distanceSquared, halfDiagonal.LengthSquared())
+}
+
+// leftProbability returns the probability of choosing the left child at the node
+func (n *lightTreeNode) leftProbability(origin geo.Vec3) float64 {
+	left := n.left.importance(origin)
+	right := n.right.importance(origin)
+	if !(left+right > 0) {
+		return .5
+	}
+	return left / (left + right)
+}
+
+type lightTreePdf struct {
+	root   *lightTreeNode
+	origin geo.Vec3
+}
+
+// Value returns the pdf value of the direction, summed over the lights weighted by their probabilities.
+// Only nodes with bounding boxes in the direction can contain lights with pdf values
+func (p lightTreePdf) Value(direction geo.Vec3) float64 {
+	ray := geo.NewRay(p.origin, direction, 0)
+	return p.value(p.root, ray, 1)
+}
+
+func (p lightTreePdf) value(n *lightTreeNode, ray geo.Ray, probability float64) float64 {
+	if probability <= 0 || !n.bBox.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}) {
+		return 0
+	}
+	if n.light != nil {
+		return probability * n.light.PdfValue(p.origin, ray.Direction)
+	}
+	left := n.leftProbability(p.origin)
+	return p.value(n.left, ray, probability*left) + p.value(n.right, ray, probability*(1-left))
+}
+
+// Generate returns a direction towards a light chosen by traversing the tree
+func (p lightTreePdf) Generate(rng *random.Rng) geo.Vec3 {
+	n := p.root
+	for n.light == nil {
+		if rng.NormalFloat() < n.leftProbability(p.origin) {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return n.light.RandomDirection(p.origin, rng)
+}
@@ -0,0 +1,107 @@
+package hittable
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+)
+
+// Triangles with normals that differ by more than this angle in degrees do not share vertex
+// normals, so that sharp edges stay sharp in models where the normals are computed
+const creaseAngle = 60
+
+// MeshModelOptions are options for reading .ply and .stl files
+type MeshModelOptions struct {
+	// Scale of the model, where zero gives the scale 1
+	Scale float64
+	// DefaultMaterial is the material of the model. Defaults to a lambertian with the vertex colors
+	// for models with vertex colors, and otherwise to a white lambertian
+	DefaultMaterial material.Material
+}
+
+// scale returns the scale of the options, where zero is 1
+func (o MeshModelOptions) scale() float64 {
+	if o.Scale == 0 {
+		return 1
+	}
+	return o.Scale
+}
+
+// material returns the material of the options, or the default material of a model with or without vertex colors
+func (o MeshModelOptions) material(colored bool) material.Material {
+	if o.DefaultMaterial != nil {
+		return o.DefaultMaterial
+	}
+	if colored {
+		return material.NewLambertian(material.NewVertexColorTexture())
+	}
+	return material.NewLambertian(material.NewSolidColor(1, 1, 1))
+}
+
+// meshFace is a triangle read from a model file
+type meshFace struct {
+	vertices [3]geo.Vec3
+	normals  [3]geo.Vec3
+	colors   [3]geo.Vec3
+	tu       [3]float64
+	tv       [3]float64
+	mat      material.Material
+}
+
+// newMeshModel creates a bvh of smooth shaded triangles of the faces, with the colors of the faces if colored
+func newMeshModel(faces []meshFace, colored bool) Hittable {
+	triangles := make([]Hittable, len(faces))
+	for i, f := range faces {
+		t := NewTriangleWithNormals(
+			f.vertices[0], f.vertices[1], f.vertices[2],
+			f.normals[0], f.normals[1], f.normals[2],
+			f.tu[0], f.tv[0], f.tu[1], f.tv[1], f.tu[2], f.tv[2],
+			f.mat,
+		)
+		if colored {
+			t = t.WithVertexColors(f.colors[0], f.colors[1], f.colors[2])
+		}
+		triangles[i] = t
+	}
+
+	return NewBoundingVolumeHierarchyWithOptions(triangles, BvhOptions{SplitMethod: SplitSah})
+}
+
+// computeVertexNormals sets the normals at the vertices of the faces, to the average of the normals
+// of the faces that share the vertex, weighted by the angles of the faces at the vertex.
+// Faces with normals more than the crease angle apart from the face are not included in the average.
+func computeVertexNormals(faces []meshFace) {
+	faceNormals := make([]geo.Vec3, len(faces))
+	angles := make([][3]float64, len(faces))
+	facesAtVertex := map[geo.Vec3][]int{}
+	for i, f := range faces {
+		faceNormals[i] = f.vertices[1].Sub(f.vertices[0]).Cross(f.vertices[2].Sub(f.vertices[0])).Unit()
+		for j, v := range f.vertices {
+			a := f.vertices[(j+1)%3].Sub(v).Unit()
+			b := f.vertices[(j+2)%3].Sub(v).Unit()
+			angles[i][j] = math.Acos(math.Max(-1, math.Min(a.Dot(b), 1)))
+			facesAtVertex[v] = append(facesAtVertex[v], i)
+		}
+	}
+
+	minCos := math.Cos(util.DegreesToRadians(creaseAngle))
+	for i := range faces {
+		for j, v := range faces[i].vertices {
+			normal := geo.ZeroVector
+			for _, k := range facesAtVertex[v] {
+				if !(faceNormals[k].Dot(faceNormals[i]) >= minCos) {
+					continue
+				}
+				for l, w := range faces[k].vertices {
+					if w == v {
+						normal = normal.Add(faceNormals[k].MulS(angles[k][l]))
+						break
+					}
+				}
+			}
+			faces[i].normals[j] = normal
+		}
+	}
+}
@@ -2,15 +2,14 @@ package hittable
 
 import (
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/internal/util"
 	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 type motionBlur struct {
-	NonPdfLightHittable
 	blurredHittable Hittable
 	blurDirection   geo.Vec3
-	bBox            aabb
+	bBox            Aabb
 }
 
 // NewMotionBlur creates a new hittable object that adds linear interpolated translation to
@@ -21,8 +20,8 @@ func NewMotionBlur(
 ) Hittable {
 
 	boundingBox1 := blurredHittable.BoundingBox()
-	boundingBox2 := blurredHittable.BoundingBox().add(blurDirection)
-	boundingBox := combineAabbs(boundingBox1, boundingBox2)
+	boundingBox2 := blurredHittable.BoundingBox().Add(blurDirection)
+	boundingBox := CombineAabbs(boundingBox1, boundingBox2)
 
 	return motionBlur{
 		blurredHittable: blurredHittable,
@@ -31,7 +30,7 @@ func NewMotionBlur(
 	}
 }
 
-func (m motionBlur) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (m motionBlur) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 
 	offset := m.blurDirection.MulS(r.Time)
 
@@ -41,7 +40,7 @@ func (m motionBlur) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.Hit
 		r.Time,
 	)
 
-	hit, record := m.blurredHittable.Hit(offsetRay, rayLength)
+	hit, record := m.blurredHittable.Hit(offsetRay, rayLength, rng)
 	if record != nil {
 		record.HitPoint = record.HitPoint.Add(offset)
 	}
@@ -49,10 +48,34 @@ func (m motionBlur) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.Hit
 	return hit, record
 }
 
-func (m motionBlur) BoundingBox() aabb {
+func (m motionBlur) BoundingBox() Aabb {
 	return m.bBox
 }
 
+// PdfValue returns the pdf value of the object at the middle of its motion, as the time of the ray is not known
+func (m motionBlur) PdfValue(origin, direction geo.Vec3) float64 {
+	return m.blurredHittable.PdfValue(origin.Sub(m.blurDirection.MulS(.5)), direction)
+}
+
+// RandomDirection returns a direction towards the object at the middle of its motion
+func (m motionBlur) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	return m.blurredHittable.RandomDirection(origin.Sub(m.blurDirection.MulS(.5)), rng)
+}
+
+// Lights returns the lights of the object, each with the same motion
+func (m motionBlur) Lights() []Hittable {
+	lights := FindLights(m.blurredHittable)
+	for i, l := range lights {
+		lights[i] = NewMotionBlur(l, m.blurDirection)
+	}
+	return lights
+}
+
 func (m motionBlur) IsLight() bool {
 	return m.blurredHittable.IsLight()
 }
+
+// power returns the light emitted by the blurred object
+func (m motionBlur) power() (float64, bool) {
+	return lightPower(m.blurredHittable)
+}
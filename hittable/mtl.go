@@ -0,0 +1,262 @@
+package hittable
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/material"
+)
+
+// Roughness below which transparent materials are smooth dielectrics
+const smoothDielectricRoughness = .05
+
+// mtlMaterial is a material read from a Wavefront .mtl file
+type mtlMaterial struct {
+	kd, ks, ke, tf geo.Vec3
+	ns, ni, d      float64
+	illum          int
+	hasTf, hasNi   bool
+	mapKd, mapD    string
+	mapBump        string
+	bumpStrength   float64
+}
+
+// readMtl reads the materials of a Wavefront .mtl file, by their names
+func readMtl(path string) (map[string]*mtlMaterial, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read material file: %v", err.Error()))
+	}
+	defer f.Close()
+
+	materials := map[string]*mtlMaterial{}
+	var m *mtlMaterial
+	hasD := false
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			m = &mtlMaterial{d: 1, bumpStrength: 1}
+			materials[strings.Join(fields[1:], " ")] = m
+			hasD = false
+			continue
+		}
+		if m == nil {
+			continue
+		}
+
+		args := fields[1:]
+		switch fields[0] {
+		case "Kd":
+			m.kd, err = parseMtlColor(args)
+		case "Ks":
+			m.ks, err = parseMtlColor(args)
+		case "Ke":
+			m.ke, err = parseMtlColor(args)
+		case "Tf":
+			m.tf, err = parseMtlColor(args)
+			m.hasTf = true
+		case "Ns":
+			m.ns, err = parseMtlFloat(args)
+		case "Ni":
+			m.ni, err = parseMtlFloat(args)
+			m.hasNi = true
+		case "d":
+			m.d, err = parseMtlFloat(args)
+			hasD = true
+		case "Tr":
+			// Dissolve takes precedence over transparency, when both are given
+			if !hasD {
+				var tr float64
+				tr, err = parseMtlFloat(args)
+				m.d = 1 - tr
+			}
+		case "illum":
+			var illum float64
+			illum, err = parseMtlFloat(args)
+			m.illum = int(illum)
+		case "map_Kd":
+			m.mapKd, _ = parseMtlTexture(args)
+		case "map_d":
+			m.mapD, _ = parseMtlTexture(args)
+		case "map_Bump", "map_bump", "bump":
+			m.mapBump, m.bumpStrength = parseMtlTexture(args)
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read material file %v on line %v: %v", path, lineNumber, err.Error()))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read material file: %v", err.Error()))
+	}
+
+	return materials, nil
+}
+
+// parseMtlFloat parses a single number
+func parseMtlFloat(args []string) (float64, error) {
+	if len(args) == 0 {
+		return 0, errors.New("Missing value")
+	}
+	return strconv.ParseFloat(args[0], 64)
+}
+
+// parseMtlColor parses a color given as either a single value or rgb values.
+// Colors given as xyz or spectral curves are not supported and give white.
+func parseMtlColor(args []string) (geo.Vec3, error) {
+	if len(args) > 0 && (args[0] == "xyz" || args[0] == "spectral") {
+		return geo.NewVec3(1, 1, 1), nil
+	}
+	if len(args) == 0 {
+		return geo.ZeroVector, errors.New("Missing value")
+	}
+
+	var rgb [3]float64
+	for i := range rgb {
+		arg := args[0]
+		if i < len(args) {
+			arg = args[i]
+		}
+		var err error
+		if rgb[i], err = strconv.ParseFloat(arg, 64); err != nil {
+			return geo.ZeroVector, err
+		}
+	}
+	return geo.NewVec3(rgb[0], rgb[1], rgb[2]), nil
+}
+
+// parseMtlTexture parses a texture statement, and returns the file name and the bump multiplier.
+// The file name is the last argument, after any options.
+func parseMtlTexture(args []string) (string, float64) {
+	if len(args) == 0 {
+		return "", 1
+	}
+
+	bumpStrength := 1.
+	for i := 0; i < len(args)-2; i++ {
+		if args[i] == "-bm" {
+			if v, err := strconv.ParseFloat(args[i+1], 64); err == nil {
+				bumpStrength = v
+			}
+		}
+	}
+	file := filepath.FromSlash(strings.ReplaceAll(args[len(args)-1], "\\", "/"))
+	return file, bumpStrength
+}
+
+// mtlMapper maps materials of .mtl files to materials, and loads each texture once
+type mtlMapper struct {
+	path     string
+	textures map[string]material.Texture
+	alphas   map[string]material.Texture
+}
+
+func newMtlMapper(path string) *mtlMapper {
+	return &mtlMapper{
+		path:     path,
+		textures: map[string]material.Texture{},
+		alphas:   map[string]material.Texture{},
+	}
+}
+
+// texture loads the image texture of the file, relative to the path of the model
+func (mm *mtlMapper) texture(file string, cache map[string]material.Texture, load func(string) (material.Texture, error)) (material.Texture, error) {
+	if tex, found := cache[file]; found {
+		return tex, nil
+	}
+	tex, err := load(mm.path + file)
+	if err != nil {
+		return nil, err
+	}
+	cache[file] = tex
+	return tex, nil
+}
+
+// material maps a material of a .mtl file to the material that looks most like it:
+//   - An emission color Ke gives a light
+//   - Illumination models with refraction, 4, 6, 7 and 9, or dissolve d or Tr below 1 with an index of
+//     refraction Ni above 1, give a dielectric with the index of refraction Ni tinted by the filter Tf
+//   - Illumination models with reflection, 3, 5 and 8, give a metal tinted by the specular color Ks
+//   - A specular color Ks gives a principled material with the diffuse color Kd and the specular from Ks
+//   - Otherwise a lambertian with the diffuse color Kd
+//
+// The diffuse color is taken from the texture map_Kd if there is one. The roughness is from the specular
+// exponent Ns, where 1000 is a mirror and 0 is fully rough. A bump texture map_Bump tilts the normals, and
+// the dissolve texture map_d gives an alpha cutout. Dissolve d or Tr below 1 for non refracting materials
+// makes the surface partially transparent, with a stochastic cutout that keeps that fraction of the hits.
+func (mm *mtlMapper) material(m *mtlMaterial) (material.Material, error) {
+	var diffuse material.Texture = material.SolidColor{ColorValue: m.kd}
+	if m.mapKd != "" {
+		var err error
+		if diffuse, err = mm.texture(m.mapKd, mm.textures, material.LoadImageTexture); err != nil {
+			return nil, err
+		}
+	}
+	roughness := 1 - math.Sqrt(math.Max(0, math.Min(m.ns/1000, 1)))
+
+	var mat material.Material
+	refracts := m.illum == 4 || m.illum == 6 || m.illum == 7 || m.illum == 9 || (m.d < 1 && m.hasNi && m.ni > 1)
+	switch {
+	case m.ke != geo.ZeroVector:
+		mat = material.NewLight(m.ke.X, m.ke.Y, m.ke.Z)
+	case refracts:
+		ior := 1.5
+		if m.hasNi && m.ni > 0 {
+			ior = m.ni
+		}
+		tint := material.NewSolidColor(1, 1, 1)
+		if m.hasTf {
+			tint = material.SolidColor{ColorValue: m.tf}
+		}
+		if roughness < smoothDielectricRoughness {
+			mat = material.NewDielectric(tint, ior)
+		} else {
+			mat = material.NewRoughDielectric(tint, ior, roughness, material.Ggx)
+		}
+	case m.illum == 3 || m.illum == 5 || m.illum == 8:
+		var tint material.Texture = material.SolidColor{ColorValue: m.ks}
+		if m.ks == geo.ZeroVector {
+			tint = diffuse
+		}
+		mat = material.NewRoughConductor(tint, material.IorSilver, roughness, material.Ggx)
+	case m.ks != geo.ZeroVector && m.illum != 0 && m.illum != 1:
+		mat = material.NewPrincipled(material.PrincipledConfig{
+			BaseColor: diffuse,
+			Specular:  math.Min(m.ks.Luminance(), 1),
+			Roughness: roughness,
+		})
+	default:
+		mat = material.NewLambertian(diffuse)
+	}
+
+	if m.mapBump != "" {
+		height, err := mm.texture(m.mapBump, mm.textures, material.LoadImageTexture)
+		if err != nil {
+			return nil, err
+		}
+		mat = material.NewBumpMap(mat, height, m.bumpStrength)
+	}
+
+	if m.mapD != "" {
+		alpha, err := mm.texture(m.mapD, mm.alphas, material.LoadImageAlphaTexture)
+		if err != nil {
+			return nil, err
+		}
+		mat = material.NewAlphaCutout(mat, alpha)
+	} else if m.d < 1 && !refracts {
+		mat = material.NewStochasticCutout(mat, material.NewSolidColor(m.d, m.d, m.d))
+	}
+
+	return mat, nil
+}
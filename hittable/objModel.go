@@ -9,64 +9,77 @@ import (
 	"github.com/udhos/gwob"
 )
 
+// ObjModelOptions are options for reading a Wavefront .obj file
+type ObjModelOptions struct {
+	// Scale of the model, where zero gives the scale 1
+	Scale float64
+	// DefaultMaterial is used for triangles without a material, defaults to a white lambertian
+	DefaultMaterial material.Material
+	// Materials are used instead of the materials in the .mtl file with the same names
+	Materials map[string]material.Material
+}
+
 // NewObjModel reads a Wavefront .obj file and creates a bvh containing
-// all triangles. It also read materials from the referred .mat file.
-// Support for colored and textured lambertian materials.
+// all triangles. It also read materials from the referred .mtl file.
+// The triangles are smooth shaded with the vertex normals of the file, or if
+// there are none, with normals computed from the triangles that share vertices.
 func NewObjModel(path, filename string, scale float64) (Hittable, error) {
-	return NewObjModelWithDefaultMaterial(
-		path, filename,
-		scale,
-		material.NewLambertian(material.NewSolidColor(1, 1, 1)),
-	)
+	return NewObjModelWithOptions(path, filename, ObjModelOptions{Scale: scale})
 }
 
 // NewObjModelWithDefaultMaterial reads a Wavefront .obj file and creates a bvh containing
-// all triangles. It also read materials from the referred .mat file.
-// Support for colored and textured lambertian materials.
+// all triangles. It also read materials from the referred .mtl file.
 // Applies supplied default material if none in model
 func NewObjModelWithDefaultMaterial(path, filename string, scale float64, defaultMaterial material.Material) (Hittable, error) {
+	return NewObjModelWithOptions(path, filename, ObjModelOptions{Scale: scale, DefaultMaterial: defaultMaterial})
+}
+
+// NewObjModelWithOptions reads a Wavefront .obj file and creates a bvh containing
+// all triangles. The materials of the referred .mtl file are mapped to the materials that look
+// most like them, with textures, transparency, emission, bump maps and alpha cutouts. Materials
+// can be replaced by name with the options.
+// The triangles are smooth shaded with the vertex normals of the file, or if
+// there are none, with normals computed from the triangles that share vertices.
+func NewObjModelWithOptions(path, filename string, options ObjModelOptions) (Hittable, error) {
+	scale := options.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	defaultMaterial := options.DefaultMaterial
+	if defaultMaterial == nil {
+		defaultMaterial = material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	}
 
-	options := &gwob.ObjParserOptions{IgnoreNormals: true}
-	object, err := gwob.NewObjFromFile(path+filename, options)
+	object, err := gwob.NewObjFromFile(path+filename, &gwob.ObjParserOptions{})
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("Failed to read obj file: %v", err.Error()))
 	}
 
-	mats := map[string]material.Material{
-		"_": defaultMaterial,
-	}
+	mats := map[string]material.Material{}
 
 	// Read all materials if a library is defined
 
 	if object.Mtllib != "" {
-		materialLib, err := gwob.ReadMaterialLibFromFile(path+object.Mtllib, options)
+		materialLib, err := readMtl(path + object.Mtllib)
 		if err != nil {
-			return nil, errors.New(fmt.Sprintf("Failed to read material file: %v", err.Error()))
+			return nil, err
 		}
 
-		for name, m := range materialLib.Lib {
-
-			// If a texture
-			if m.MapKd != "" {
-				tex, err := material.LoadImageTexture(path + m.MapKd)
-				if err != nil {
-					return nil, err
-				}
-				mats[name] = material.NewLambertian(tex)
-
-				// Otherwise use the diffuse color for a lambertian
-			} else {
-
-				mats[name] = material.NewLambertian(material.NewSolidColor(
-					float64(m.Kd[0]),
-					float64(m.Kd[1]),
-					float64(m.Kd[2]),
-				))
+		mapper := newMtlMapper(path)
+		for name, m := range materialLib {
+			if _, found := options.Materials[name]; found {
+				continue
+			}
+			if mats[name], err = mapper.material(m); err != nil {
+				return nil, err
 			}
 		}
 	}
+	for name, m := range options.Materials {
+		mats[name] = m
+	}
 
-	triangles := make([]Triangle, 0, object.NumberOfElements())
+	faces := make([]meshFace, 0, object.NumberOfElements()/3)
 
 	for _, group := range object.Groups {
 
@@ -76,32 +89,34 @@ func NewObjModelWithDefaultMaterial(path, filename string, scale float64, defaul
 
 			mat, found := mats[group.Usemtl]
 			if !found {
-				mat = mats["_"]
+				mat = defaultMaterial
 			}
 
-			x, y, z := object.VertexCoordinates(object.Indices[i])
-			v0 := geo.NewVec3(float64(x), float64(y), float64(z)).MulS(scale)
-			x, y, z = object.VertexCoordinates(object.Indices[i+1])
-			v1 := geo.NewVec3(float64(x), float64(y), float64(z)).MulS(scale)
-			x, y, z = object.VertexCoordinates(object.Indices[i+2])
-			v2 := geo.NewVec3(float64(x), float64(y), float64(z)).MulS(scale)
-
-			var tu0, tv0, tu1, tv1, tu2, tv2 float64
+			var face meshFace
+			face.mat = mat
+			for j := 0; j < 3; j++ {
+				stride := object.Indices[i+j]
+				x, y, z := object.VertexCoordinates(stride)
+				face.vertices[j] = geo.NewVec3(float64(x), float64(y), float64(z)).MulS(scale)
 
-			// Read texture coordinates if any
+				// Read texture coordinates and normals if any
 
-			if object.TextCoordFound {
-				tu0, tv0 = textureCoordinates(*object, object.Indices[i])
-				tu1, tv1 = textureCoordinates(*object, object.Indices[i+1])
-				tu2, tv2 = textureCoordinates(*object, object.Indices[i+2])
+				if object.TextCoordFound {
+					face.tu[j], face.tv[j] = textureCoordinates(*object, stride)
+				}
+				if object.NormCoordFound {
+					face.normals[j] = normalCoordinates(*object, stride)
+				}
 			}
-
-			t := NewTriangleWithTexCoords(v0, v1, v2, tu0, tv0, tu1, tv1, tu2, tv2, mat)
-			triangles = append(triangles, t)
+			faces = append(faces, face)
 		}
 	}
 
-	return NewBoundingVolumeHierarchy(triangles), nil
+	if !object.NormCoordFound {
+		computeVertexNormals(faces)
+	}
+
+	return newMeshModel(faces, false), nil
 }
 
 func textureCoordinates(o gwob.Obj, stride int) (float64, float64) {
@@ -110,3 +125,10 @@ func textureCoordinates(o gwob.Obj, stride int) (float64, float64) {
 	f := offset + stride*floatsPerStride
 	return float64(o.Coord[f]), float64(o.Coord[f+1])
 }
+
+func normalCoordinates(o gwob.Obj, stride int) geo.Vec3 {
+	offset := o.StrideOffsetNormal / 4
+	floatsPerStride := o.StrideSize / 4
+	f := offset + stride*floatsPerStride
+	return geo.NewVec3(float64(o.Coord[f]), float64(o.Coord[f+1]), float64(o.Coord[f+2]))
+}
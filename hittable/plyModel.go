@@ -0,0 +1,360 @@
+package hittable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+// plyTypeSizes are the sizes in bytes of the value types of .ply files, by both their old and new names
+var plyTypeSizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+// plyColorScales are what integer colors are divided by to be in the range 0 to 1
+var plyColorScales = map[string]float64{
+	"uchar": 255, "uint8": 255,
+	"ushort": 65535, "uint16": 65535,
+}
+
+// plyProperty is a property of the elements in a .ply file. Lists have the type of their count.
+type plyProperty struct {
+	name      string
+	valueType string
+	countType string
+}
+
+// plyElement is a kind of element in a .ply file, like vertices and faces
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// property returns the index of the first property with one of the names, or -1 if there is none
+func (e plyElement) property(names ...string) int {
+	for _, name := range names {
+		for i, p := range e.properties {
+			if p.name == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// plyReader reads the values of the elements in a .ply file
+type plyReader interface {
+	value(valueType string) (float64, error)
+}
+
+// plyAsciiReader reads values that are separated by whitespace
+type plyAsciiReader struct {
+	r *bufio.Reader
+}
+
+func (p plyAsciiReader) value(valueType string) (float64, error) {
+	var word []byte
+	for {
+		b, err := p.r.ReadByte()
+		if err == io.EOF && len(word) > 0 {
+			break
+		}
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
+			if len(word) > 0 {
+				break
+			}
+			continue
+		}
+		word = append(word, b)
+	}
+	v, err := strconv.ParseFloat(string(word), 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("Invalid value: %v", string(word)))
+	}
+	return v, nil
+}
+
+// plyBinaryReader reads values in binary with a byte order
+type plyBinaryReader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+}
+
+func (p plyBinaryReader) value(valueType string) (float64, error) {
+	var buf [8]byte
+	b := buf[:plyTypeSizes[valueType]]
+	if _, err := io.ReadFull(p.r, b); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	switch valueType {
+	case "char", "int8":
+		return float64(int8(b[0])), nil
+	case "uchar", "uint8":
+		return float64(b[0]), nil
+	case "short", "int16":
+		return float64(int16(p.order.Uint16(b))), nil
+	case "ushort", "uint16":
+		return float64(p.order.Uint16(b)), nil
+	case "int", "int32":
+		return float64(int32(p.order.Uint32(b))), nil
+	case "uint", "uint32":
+		return float64(p.order.Uint32(b)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(p.order.Uint32(b))), nil
+	default:
+		return math.Float64frombits(p.order.Uint64(b)), nil
+	}
+}
+
+// NewPlyModel reads a .ply file, in ascii or binary format, and creates a bvh containing all triangles
+// of its faces. The triangles get the vertex colors, normals and texture coordinates of the file.
+// They are smooth shaded with the vertex normals of the file, or if there are none,
+// with normals computed from the triangles that share vertices.
+// Faces with more than three vertices are split into triangles. Other elements than vertices and faces are ignored.
+func NewPlyModel(path string, options MeshModelOptions) (Hittable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read ply file: %v", err.Error()))
+	}
+	defer file.Close()
+
+	faces, colored, hasNormals, err := readPly(bufio.NewReader(file), options)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse ply file %v: %v", path, err.Error()))
+	}
+	if len(faces) == 0 {
+		return nil, errors.New(fmt.Sprintf("No faces in ply file %v", path))
+	}
+
+	if !hasNormals {
+		computeVertexNormals(faces)
+	}
+	return newMeshModel(faces, colored), nil
+}
+
+// plyVertex is a vertex of a .ply file
+type plyVertex struct {
+	position geo.Vec3
+	normal   geo.Vec3
+	color    geo.Vec3
+	u        float64
+	v        float64
+}
+
+// readPly reads the faces of a .ply file, and if the vertices have colors and normals
+func readPly(r *bufio.Reader, options MeshModelOptions) ([]meshFace, bool, bool, error) {
+	elements, reader, err := readPlyHeader(r)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	var vertices []plyVertex
+	var faces []meshFace
+	colored, hasNormals := false, false
+	for _, e := range elements {
+		values := make([]float64, len(e.properties))
+		lists := make([][]float64, len(e.properties))
+
+		switch e.name {
+		case "vertex":
+			x, y, z := e.property("x"), e.property("y"), e.property("z")
+			if x < 0 || y < 0 || z < 0 {
+				return nil, false, false, errors.New("Vertices without position")
+			}
+			nx, ny, nz := e.property("nx"), e.property("ny"), e.property("nz")
+			red, green, blue := e.property("red", "diffuse_red"), e.property("green", "diffuse_green"), e.property("blue", "diffuse_blue")
+			u, v := e.property("u", "s", "texture_u", "texture_s"), e.property("v", "t", "texture_v", "texture_t")
+			hasNormals = nx >= 0 && ny >= 0 && nz >= 0
+			colored = red >= 0 && green >= 0 && blue >= 0
+
+			for i := 0; i < e.count; i++ {
+				if err := e.readItem(reader, values, lists); err != nil {
+					return nil, false, false, err
+				}
+				vertex := plyVertex{position: geo.NewVec3(values[x], values[y], values[z]).MulS(options.scale())}
+				if hasNormals {
+					vertex.normal = geo.NewVec3(values[nx], values[ny], values[nz])
+				}
+				if colored {
+					vertex.color = geo.NewVec3(
+						e.color(red, values), e.color(green, values), e.color(blue, values),
+					)
+				}
+				if u >= 0 && v >= 0 {
+					vertex.u, vertex.v = values[u], values[v]
+				}
+				vertices = append(vertices, vertex)
+			}
+		case "face":
+			indices := e.property("vertex_indices", "vertex_index")
+			if indices < 0 || e.properties[indices].countType == "" {
+				return nil, false, false, errors.New("Faces without vertex indices")
+			}
+			mat := options.material(colored)
+
+			for i := 0; i < e.count; i++ {
+				if err := e.readItem(reader, values, lists); err != nil {
+					return nil, false, false, err
+				}
+				polygon := lists[indices]
+				for _, index := range polygon {
+					if index < 0 || index >= float64(len(vertices)) {
+						return nil, false, false, errors.New(fmt.Sprintf("Invalid vertex index: %v", index))
+					}
+				}
+
+				// Polygons are split into a fan of triangles
+				for j := 1; j+1 < len(polygon); j++ {
+					face := meshFace{mat: mat}
+					for k, index := range []float64{polygon[0], polygon[j], polygon[j+1]} {
+						vertex := vertices[int(index)]
+						face.vertices[k] = vertex.position
+						face.normals[k] = vertex.normal
+						face.colors[k] = vertex.color
+						face.tu[k], face.tv[k] = vertex.u, vertex.v
+					}
+					faces = append(faces, face)
+				}
+			}
+		default:
+			for i := 0; i < e.count; i++ {
+				if err := e.readItem(reader, values, lists); err != nil {
+					return nil, false, false, err
+				}
+			}
+		}
+	}
+
+	return faces, colored, hasNormals, nil
+}
+
+// color returns the color channel of the property with the index, in the range 0 to 1 for integer colors
+func (e plyElement) color(index int, values []float64) float64 {
+	if scale, found := plyColorScales[e.properties[index].valueType]; found {
+		return values[index] / scale
+	}
+	return values[index]
+}
+
+// readItem reads the values of the properties of one element. The values of lists are read into lists,
+// at the index of their property
+func (e plyElement) readItem(r plyReader, values []float64, lists [][]float64) error {
+	for i, p := range e.properties {
+		if p.countType == "" {
+			v, err := r.value(p.valueType)
+			if err != nil {
+				return err
+			}
+			values[i] = v
+			continue
+		}
+
+		count, err := r.value(p.countType)
+		if err != nil {
+			return err
+		}
+		if count < 0 {
+			return errors.New(fmt.Sprintf("Negative list count: %v", count))
+		}
+		lists[i] = lists[i][:0]
+		for j := 0; j < int(count); j++ {
+			v, err := r.value(p.valueType)
+			if err != nil {
+				return err
+			}
+			lists[i] = append(lists[i], v)
+		}
+	}
+	return nil
+}
+
+// readPlyHeader reads the elements in the header of a .ply file, and returns them with a reader of the format of the file
+func readPlyHeader(r *bufio.Reader) ([]plyElement, plyReader, error) {
+	var elements []plyElement
+	var reader plyReader
+
+	for lineNumber := 0; ; lineNumber++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, nil, errors.New("Missing end of header")
+		}
+		fields := strings.Fields(line)
+
+		if lineNumber == 0 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return nil, nil, errors.New("Missing ply header")
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 {
+				return nil, nil, errors.New(fmt.Sprintf("Invalid format: %v", strings.TrimSpace(line)))
+			}
+			switch fields[1] {
+			case "ascii":
+				reader = plyAsciiReader{r: r}
+			case "binary_little_endian":
+				reader = plyBinaryReader{r: r, order: binary.LittleEndian}
+			case "binary_big_endian":
+				reader = plyBinaryReader{r: r, order: binary.BigEndian}
+			default:
+				return nil, nil, errors.New(fmt.Sprintf("Unsupported format: %v", fields[1]))
+			}
+		case "element":
+			if len(fields) != 3 {
+				return nil, nil, errors.New(fmt.Sprintf("Invalid element: %v", strings.TrimSpace(line)))
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, nil, errors.New(fmt.Sprintf("Invalid element count: %v", fields[2]))
+			}
+			elements = append(elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, nil, errors.New("Property before element")
+			}
+			var p plyProperty
+			switch {
+			case len(fields) == 3:
+				p = plyProperty{valueType: fields[1], name: fields[2]}
+			case len(fields) == 5 && fields[1] == "list":
+				p = plyProperty{countType: fields[2], valueType: fields[3], name: fields[4]}
+			default:
+				return nil, nil, errors.New(fmt.Sprintf("Invalid property: %v", strings.TrimSpace(line)))
+			}
+			for _, t := range []string{p.valueType, p.countType} {
+				if _, found := plyTypeSizes[t]; !found && t != "" {
+					return nil, nil, errors.New(fmt.Sprintf("Unknown property type: %v", t))
+				}
+			}
+			e := &elements[len(elements)-1]
+			e.properties = append(e.properties, p)
+		case "end_header":
+			if reader == nil {
+				return nil, nil, errors.New("Missing format")
+			}
+			return elements, reader, nil
+		}
+	}
+}
@@ -17,13 +17,13 @@ type quad struct {
 	d      float64
 	w      geo.Vec3
 	mat    material.Material
-	bBox   aabb
+	bBox   Aabb
 	area   float64
 }
 
 // NewQuad creates a new rectangular flat hittable object
 func NewQuad(Q geo.Vec3, u geo.Vec3, v geo.Vec3, mat material.Material) Hittable {
-	bBox := createAabbFromPoints(Q, Q.Add(u).Add(v)).padIfNeeded()
+	bBox := NewAabbFromPoints(Q, Q.Add(u).Add(v)).PadIfNeeded()
 	n := u.Cross(v)
 	normal := n.Unit()
 	D := normal.Dot(Q)
@@ -65,7 +65,7 @@ func NewBox(a geo.Vec3, b geo.Vec3, mat material.Material) Hittable {
 	return &sides
 }
 
-func (q quad) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (q quad) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 	denom := q.normal.Dot(r.Direction)
 
 	// No hit if the ray is parallell to the plane
@@ -102,13 +102,18 @@ func (q quad) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord
 		RayLength: t,
 		U:         alpha,
 		V:         beta,
+		Dpdu:      q.u,
+		Dpdv:      q.v,
 		FrontFace: frontFace,
 	}
+	if material.IsCutAway(&rec) {
+		return false, nil
+	}
 
 	return true, &rec
 }
 
-func (q quad) BoundingBox() aabb {
+func (q quad) BoundingBox() Aabb {
 	return q.bBox
 }
 
@@ -119,7 +124,8 @@ func (q quad) PdfValue(origin, direction geo.Vec3) float64 {
 		0,
 	)
 
-	hit, rec := q.Hit(ray, util.Interval{Min: 0.001, Max: util.Infinity})
+	// Hitting primitives does not use random numbers, so no rng is needed
+	hit, rec := q.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
 
 	if !hit {
 		return 0
@@ -131,11 +137,16 @@ func (q quad) PdfValue(origin, direction geo.Vec3) float64 {
 	return distanceSquared / (cosine * q.area)
 }
 
-func (q quad) RandomDirection(origin geo.Vec3) geo.Vec3 {
-	p := q.q.Add(q.u.MulS(random.RandomNormalFloat())).Add(q.v.MulS(random.RandomNormalFloat()))
+func (q quad) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	p := q.q.Add(q.u.MulS(rng.NormalFloat())).Add(q.v.MulS(rng.NormalFloat()))
 	return p.Sub(origin)
 }
 
 func (q quad) IsLight() bool {
 	return q.mat.IsLight()
 }
+
+// power returns the light emitted by the quad
+func (q quad) power() (float64, bool) {
+	return emittedLuminance(q.mat, q.q.Add(q.u.MulS(.5)).Add(q.v.MulS(.5))) * q.area, true
+}
@@ -6,13 +6,14 @@ import (
 	"github.com/DanielPettersson/solstrale/geo"
 	"github.com/DanielPettersson/solstrale/internal/util"
 	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 type rotationY struct {
 	object   Hittable
 	sinTheta float64
 	cosTheta float64
-	bBox     aabb
+	bBox     Aabb
 }
 
 // NewRotationY creates a hittable object that rotates the given hittable around the Y axis
@@ -21,47 +22,27 @@ func NewRotationY(
 	angle float64,
 ) Hittable {
 	radians := util.DegreesToRadians(angle)
-	sinTheta := math.Sin(radians)
-	cosTheta := math.Cos(radians)
-	bBox := object.BoundingBox()
-
-	min := geo.Vec3{X: util.Infinity, Y: util.Infinity, Z: util.Infinity}
-	max := geo.Vec3{X: -util.Infinity, Y: -util.Infinity, Z: -util.Infinity}
-
-	for i := 0.; i < 2; i++ {
-		for j := 0.; j < 2; j++ {
-			for k := 0.; k < 2; k++ {
-				x := i*bBox.x.Max + (1-i)*bBox.x.Min
-				y := j*bBox.y.Max + (1-j)*bBox.y.Min
-				z := k*bBox.z.Max + (1-k)*bBox.z.Min
-
-				newx := cosTheta*x + sinTheta*z
-				newz := -sinTheta*x + cosTheta*z
-
-				tester := geo.Vec3{X: newx, Y: y, Z: newz}
-
-				min.X = math.Min(min.X, tester.X)
-				min.Y = math.Min(min.Y, tester.Y)
-				min.Z = math.Min(min.Z, tester.Z)
-
-				max.X = math.Max(max.X, tester.X)
-				max.Y = math.Max(max.Y, tester.Y)
-				max.Z = math.Max(max.Z, tester.Z)
-			}
-		}
-	}
+	return newRotationY(object, math.Sin(radians), math.Cos(radians))
+}
 
-	boundingBox := createAabbFromPoints(min, max)
+// newRotationY creates a rotation given the sine and cosine of the angle
+func newRotationY(object Hittable, sinTheta, cosTheta float64) Hittable {
+	bBox := object.BoundingBox().Transform(geo.Matrix4{
+		{cosTheta, 0, sinTheta, 0},
+		{0, 1, 0, 0},
+		{-sinTheta, 0, cosTheta, 0},
+		{0, 0, 0, 1},
+	})
 
 	return rotationY{
 		object:   object,
 		sinTheta: sinTheta,
 		cosTheta: cosTheta,
-		bBox:     boundingBox,
+		bBox:     bBox,
 	}
 }
 
-func (ry rotationY) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (ry rotationY) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 
 	origin := r.Origin
 	direction := r.Direction
@@ -74,7 +55,7 @@ func (ry rotationY) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.Hit
 
 	rotatedR := geo.NewRay(origin, direction, r.Time)
 
-	hit, rec := ry.object.Hit(rotatedR, rayLength)
+	hit, rec := ry.object.Hit(rotatedR, rayLength, rng)
 	if !hit {
 		return hit, rec
 	}
@@ -89,22 +70,51 @@ func (ry rotationY) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.Hit
 
 	rec.HitPoint = hitPoint
 	rec.Normal = normal
+	rec.GeometricNormal = ry.fromObject(rec.GeometricNormal)
+	rec.Dpdu = ry.fromObject(rec.Dpdu)
+	rec.Dpdv = ry.fromObject(rec.Dpdv)
 
 	return hit, rec
 }
 
-func (ry rotationY) BoundingBox() aabb {
+func (ry rotationY) BoundingBox() Aabb {
 	return ry.bBox
 }
 
+// PdfValue returns the pdf value of the object, with the origin and direction rotated to the space of the object
 func (ry rotationY) PdfValue(origin, direction geo.Vec3) float64 {
-	return ry.object.PdfValue(origin, direction)
+	return ry.object.PdfValue(ry.toObject(origin), ry.toObject(direction))
+}
+
+// RandomDirection returns a direction towards the object, rotated from the space of the object
+func (ry rotationY) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	return ry.fromObject(ry.object.RandomDirection(ry.toObject(origin), rng))
 }
 
-func (ry rotationY) RandomDirection(origin geo.Vec3) geo.Vec3 {
-	return ry.object.RandomDirection(origin)
+// Lights returns the lights of the object, each with the same rotation
+func (ry rotationY) Lights() []Hittable {
+	lights := FindLights(ry.object)
+	for i, l := range lights {
+		lights[i] = newRotationY(l, ry.sinTheta, ry.cosTheta)
+	}
+	return lights
+}
+
+// toObject rotates a vector from world space to the space of the object
+func (ry rotationY) toObject(v geo.Vec3) geo.Vec3 {
+	return geo.NewVec3(ry.cosTheta*v.X-ry.sinTheta*v.Z, v.Y, ry.sinTheta*v.X+ry.cosTheta*v.Z)
+}
+
+// fromObject rotates a vector from the space of the object to world space
+func (ry rotationY) fromObject(v geo.Vec3) geo.Vec3 {
+	return geo.NewVec3(ry.cosTheta*v.X+ry.sinTheta*v.Z, v.Y, -ry.sinTheta*v.X+ry.cosTheta*v.Z)
 }
 
 func (ry rotationY) IsLight() bool {
 	return ry.object.IsLight()
 }
+
+// power returns the light emitted by the rotated object
+func (ry rotationY) power() (float64, bool) {
+	return lightPower(ry.object)
+}
@@ -13,7 +13,7 @@ type sphere struct {
 	center geo.Vec3
 	radius float64
 	mat    material.Material
-	bBox   aabb
+	bBox   Aabb
 }
 
 // NewSphere creates a new sphere shaped hittable object
@@ -24,7 +24,7 @@ func NewSphere(
 ) Hittable {
 
 	rVec := geo.Vec3{X: radius, Y: radius, Z: radius}
-	boundingBox := createAabbFromPoints(center.Sub(rVec), center.Add(rVec))
+	boundingBox := NewAabbFromPoints(center.Sub(rVec), center.Add(rVec))
 
 	return sphere{
 		center,
@@ -34,7 +34,7 @@ func NewSphere(
 	}
 }
 
-func (s sphere) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (s sphere) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 
 	oc := r.Origin.Sub(s.center)
 	a := r.Direction.LengthSquared()
@@ -85,9 +85,9 @@ func calculateSphereUv(pointOnSphere geo.Vec3) (float64, float64) {
 	return u, v
 }
 
-func randomToSphere(radius, distanceSquared float64) geo.Vec3 {
-	r1 := random.RandomNormalFloat()
-	r2 := random.RandomNormalFloat()
+func randomToSphere(radius, distanceSquared float64, rng *random.Rng) geo.Vec3 {
+	r1 := rng.NormalFloat()
+	r2 := rng.NormalFloat()
 	z := 1 + r2*(math.Sqrt(1-radius*radius/distanceSquared)-1)
 
 	phi := 2 * math.Pi * r1
@@ -98,7 +98,7 @@ func randomToSphere(radius, distanceSquared float64) geo.Vec3 {
 	return geo.NewVec3(x, y, z)
 }
 
-func (s sphere) BoundingBox() aabb {
+func (s sphere) BoundingBox() Aabb {
 	return s.bBox
 }
 
@@ -109,7 +109,8 @@ func (s sphere) PdfValue(origin, direction geo.Vec3) float64 {
 		0,
 	)
 
-	hit, _ := s.Hit(ray, util.Interval{Min: 0.001, Max: util.Infinity})
+	// Hitting primitives does not use random numbers, so no rng is needed
+	hit, _ := s.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
 
 	if !hit {
 		return 0
@@ -121,12 +122,17 @@ func (s sphere) PdfValue(origin, direction geo.Vec3) float64 {
 	return 1 / solidAngle
 }
 
-func (s sphere) RandomDirection(origin geo.Vec3) geo.Vec3 {
+func (s sphere) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
 	direction := s.center.Sub(origin)
 	uvw := geo.BuildOnbFromVec3(direction)
-	return uvw.Local(randomToSphere(s.radius, direction.LengthSquared()))
+	return uvw.Local(randomToSphere(s.radius, direction.LengthSquared(), rng))
 }
 
 func (s sphere) IsLight() bool {
 	return s.mat.IsLight()
 }
+
+// power returns the light emitted by the sphere
+func (s sphere) power() (float64, bool) {
+	return emittedLuminance(s.mat, s.center) * 4 * math.Pi * s.radius * s.radius, true
+}
@@ -0,0 +1,123 @@
+package hittable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+const (
+	stlHeaderSize   = 84
+	stlTriangleSize = 50
+)
+
+// NewStlModel reads a .stl file, in ascii or binary format, and creates a bvh containing all its triangles.
+// The triangles are smooth shaded with normals computed from the triangles that share vertices,
+// where edges sharper than the crease angle stay sharp. The facet normals of the file are ignored,
+// the triangles face the side that their vertices wind counter clockwise around.
+func NewStlModel(path string, options MeshModelOptions) (Hittable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read stl file: %v", err.Error()))
+	}
+
+	var vertices []geo.Vec3
+	if isBinaryStl(data) {
+		vertices, err = readBinaryStl(data)
+	} else {
+		vertices, err = readAsciiStl(data)
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse stl file %v: %v", path, err.Error()))
+	}
+	if len(vertices) == 0 {
+		return nil, errors.New(fmt.Sprintf("No facets in stl file %v", path))
+	}
+
+	mat := options.material(false)
+	faces := make([]meshFace, len(vertices)/3)
+	for i := range faces {
+		faces[i].mat = mat
+		for j := 0; j < 3; j++ {
+			faces[i].vertices[j] = vertices[i*3+j].MulS(options.scale())
+		}
+	}
+
+	computeVertexNormals(faces)
+	return newMeshModel(faces, false), nil
+}
+
+// isBinaryStl returns if the data is a binary .stl file. Ascii files start with "solid", but so do
+// some binary files, which are then recognized by their size matching the number of triangles.
+func isBinaryStl(data []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		return true
+	}
+	if len(data) < stlHeaderSize {
+		return false
+	}
+	count := uint64(binary.LittleEndian.Uint32(data[80:]))
+	return uint64(len(data)) == stlHeaderSize+count*stlTriangleSize
+}
+
+// readBinaryStl returns the vertices of the triangles in a binary .stl file
+func readBinaryStl(data []byte) ([]geo.Vec3, error) {
+	if len(data) < stlHeaderSize {
+		return nil, errors.New("Missing header")
+	}
+	count := uint64(binary.LittleEndian.Uint32(data[80:]))
+	if uint64(len(data)) < stlHeaderSize+count*stlTriangleSize {
+		return nil, errors.New(fmt.Sprintf("File is too short for %v triangles", count))
+	}
+
+	vertices := make([]geo.Vec3, 0, count*3)
+	for i := 0; i < int(count); i++ {
+		// Each triangle is a normal, three vertices and an attribute byte count
+		triangle := data[stlHeaderSize+i*stlTriangleSize:]
+		for j := 1; j <= 3; j++ {
+			vertices = append(vertices, geo.NewVec3(
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(triangle[j*12:]))),
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(triangle[j*12+4:]))),
+				float64(math.Float32frombits(binary.LittleEndian.Uint32(triangle[j*12+8:]))),
+			))
+		}
+	}
+	return vertices, nil
+}
+
+// readAsciiStl returns the vertices of the triangles in an ascii .stl file.
+// Loops of more than three vertices are split into triangles.
+func readAsciiStl(data []byte) ([]geo.Vec3, error) {
+	var vertices, loop []geo.Vec3
+	words := bytes.Fields(data)
+	for i := 0; i < len(words); i++ {
+		switch string(words[i]) {
+		case "vertex":
+			if i+3 >= len(words) {
+				return nil, errors.New("Missing vertex coordinates")
+			}
+			var coordinates [3]float64
+			for j := range coordinates {
+				v, err := strconv.ParseFloat(string(words[i+1+j]), 64)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("Invalid vertex coordinate: %v", string(words[i+1+j])))
+				}
+				coordinates[j] = v
+			}
+			loop = append(loop, geo.NewVec3(coordinates[0], coordinates[1], coordinates[2]))
+			i += 3
+		case "endloop":
+			for j := 1; j+1 < len(loop); j++ {
+				vertices = append(vertices, loop[0], loop[j], loop[j+1])
+			}
+			loop = loop[:0]
+		}
+	}
+	return vertices, nil
+}
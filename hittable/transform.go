@@ -0,0 +1,120 @@
+package hittable
+
+import (
+	"errors"
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+type transform struct {
+	object       Hittable
+	matrix       geo.Matrix4
+	inverse      geo.Matrix4
+	normalMatrix geo.Matrix4
+	invDet       float64
+	bBox         Aabb
+}
+
+// NewTransform creates a hittable object that transforms the given hittable with a matrix.
+// The matrix can be any combination of translation, rotation and scaling, but must be invertible.
+// The same hittable, e.g. a bounding volume hierarchy of a model, can be used by many transforms
+// to create instances of it.
+func NewTransform(
+	object Hittable,
+	matrix geo.Matrix4,
+) (Hittable, error) {
+
+	inverse, ok := matrix.Inverse()
+	if !ok {
+		return nil, errors.New("Transform matrix is not invertible")
+	}
+
+	return transform{
+		object:       object,
+		matrix:       matrix,
+		inverse:      inverse,
+		normalMatrix: inverse.Transpose(),
+		invDet:       math.Abs(inverse.Determinant3()),
+		bBox:         object.BoundingBox().Transform(matrix).PadIfNeeded(),
+	}, nil
+}
+
+func (t transform) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
+
+	// The direction of the transformed ray is normalized, so ray lengths
+	// must be scaled between world and object space
+	direction := t.inverse.TransformVector(r.Direction)
+	scale := direction.Length()
+
+	objectRay := geo.NewRay(
+		t.inverse.TransformPoint(r.Origin),
+		direction,
+		r.Time,
+	)
+
+	hit, rec := t.object.Hit(objectRay, geo.Interval{Min: rayLength.Min * scale, Max: rayLength.Max * scale}, rng)
+	if !hit {
+		return hit, rec
+	}
+
+	rec.HitPoint = t.matrix.TransformPoint(rec.HitPoint)
+	rec.Normal = t.normalMatrix.TransformVector(rec.Normal).Unit()
+	if rec.GeometricNormal != geo.ZeroVector {
+		rec.GeometricNormal = t.normalMatrix.TransformVector(rec.GeometricNormal).Unit()
+	}
+	rec.Dpdu = t.matrix.TransformVector(rec.Dpdu)
+	rec.Dpdv = t.matrix.TransformVector(rec.Dpdv)
+	rec.RayLength = rec.RayLength / scale
+
+	return hit, rec
+}
+
+func (t transform) BoundingBox() Aabb {
+	return t.bBox
+}
+
+// PdfValue converts the pdf of the object from the directions in object space.
+// The change of solid angle is given by the determinant of the inverse
+// divided by the cubed length of the transformed direction.
+func (t transform) PdfValue(origin, direction geo.Vec3) float64 {
+	objectDirection := t.inverse.TransformVector(direction.Unit())
+	length := objectDirection.Length()
+
+	objectPdf := t.object.PdfValue(t.inverse.TransformPoint(origin), objectDirection.DivS(length))
+	return objectPdf * t.invDet / (length * length * length)
+}
+
+func (t transform) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	objectDirection := t.object.RandomDirection(t.inverse.TransformPoint(origin), rng)
+	return t.matrix.TransformVector(objectDirection).Unit()
+}
+
+// Lights returns the lights of the object, each with the same transform
+func (t transform) Lights() []Hittable {
+	lights := FindLights(t.object)
+	for i, l := range lights {
+		lights[i] = t.withObject(l)
+	}
+	return lights
+}
+
+// withObject returns the transform applied to another object
+func (t transform) withObject(object Hittable) Hittable {
+	// The matrix is already known to be invertible
+	h, _ := NewTransform(object, t.matrix)
+	return h
+}
+
+func (t transform) IsLight() bool {
+	return t.object.IsLight()
+}
+
+// power returns the light emitted by the transformed object, where
+// the area is scaled by the average scaling of the transform
+func (t transform) power() (float64, bool) {
+	p, ok := lightPower(t.object)
+	return p * math.Pow(t.invDet, -2./3), ok
+}
@@ -2,14 +2,14 @@ package hittable
 
 import (
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/internal/util"
 	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 type translation struct {
 	object Hittable
 	offset geo.Vec3
-	bBox   aabb
+	bBox   Aabb
 }
 
 // NewTranslation creates a hittable object that translates the given hittable by the givn offset vector
@@ -18,7 +18,7 @@ func NewTranslation(
 	offset geo.Vec3,
 ) Hittable {
 
-	boundingBox := object.BoundingBox().add(offset)
+	boundingBox := object.BoundingBox().Add(offset)
 
 	return translation{
 		object: object,
@@ -27,7 +27,7 @@ func NewTranslation(
 	}
 }
 
-func (t translation) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (t translation) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 
 	offsetRay := geo.NewRay(
 		r.Origin.Sub(t.offset),
@@ -35,7 +35,7 @@ func (t translation) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.Hi
 		r.Time,
 	)
 
-	hit, record := t.object.Hit(offsetRay, rayLength)
+	hit, record := t.object.Hit(offsetRay, rayLength, rng)
 	if record != nil {
 		record.HitPoint = record.HitPoint.Add(t.offset)
 	}
@@ -43,18 +43,34 @@ func (t translation) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.Hi
 	return hit, record
 }
 
-func (t translation) BoundingBox() aabb {
+func (t translation) BoundingBox() Aabb {
 	return t.bBox
 }
 
+// PdfValue returns the pdf value of the object, from the origin moved to the space of the object
 func (t translation) PdfValue(origin, direction geo.Vec3) float64 {
-	return t.object.PdfValue(origin, direction)
+	return t.object.PdfValue(origin.Sub(t.offset), direction)
 }
 
-func (t translation) RandomDirection(origin geo.Vec3) geo.Vec3 {
-	return t.object.RandomDirection(origin)
+// RandomDirection returns a direction towards the object, from the origin moved to the space of the object
+func (t translation) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	return t.object.RandomDirection(origin.Sub(t.offset), rng)
+}
+
+// Lights returns the lights of the object, each with the same translation
+func (t translation) Lights() []Hittable {
+	lights := FindLights(t.object)
+	for i, l := range lights {
+		lights[i] = NewTranslation(l, t.offset)
+	}
+	return lights
 }
 
 func (t translation) IsLight() bool {
 	return t.object.IsLight()
 }
+
+// power returns the light emitted by the translated object
+func (t translation) power() (float64, bool) {
+	return lightPower(t.object)
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/DanielPettersson/solstrale/random"
 )
 
+// Triangle is a flat hittable with three vertices, that can have texture coordinates
+// and normals at each vertex
 type Triangle struct {
 	v0     geo.Vec3
 	v0v1   geo.Vec3
@@ -20,20 +22,35 @@ type Triangle struct {
 	tu2    float64
 	tv2    float64
 	normal geo.Vec3
+	// Normals at the vertices, that are interpolated over the triangle if smooth is set
+	n0     geo.Vec3
+	n1     geo.Vec3
+	n2     geo.Vec3
+	smooth bool
+	// Colors at the vertices, that are interpolated over the triangle if colored is set
+	c0      geo.Vec3
+	c1      geo.Vec3
+	c2      geo.Vec3
+	colored bool
+	// How points on the triangle move with the texture coordinates
+	dpdu   geo.Vec3
+	dpdv   geo.Vec3
 	mat    material.Material
-	bBox   aabb
+	bBox   Aabb
 	area   float64
 	center geo.Vec3
 }
 
+// NewTriangle creates a new triangle flat hittable object
+// A counter clockwise winding is expected
 func NewTriangle(v0, v1, v2 geo.Vec3, mat material.Material) Triangle {
 	return NewTriangleWithTexCoords(v0, v1, v2, 0, 0, 0, 0, 0, 0, mat)
 }
 
-// NewTriangle creates a new triangle flat hittable object
+// NewTriangleWithTexCoords creates a new triangle flat hittable object, with texture coordinates at each vertex
 // A counter clockwise winding is expected
 func NewTriangleWithTexCoords(v0, v1, v2 geo.Vec3, tu0, tv0, tu1, tv1, tu2, tv2 float64, mat material.Material) Triangle {
-	bBox := createAabbFrom3Points(v0, v1, v2).padIfNeeded()
+	bBox := NewAabbFromPoints(v0, v1, v2).PadIfNeeded()
 	v0v1 := v1.Sub(v0)
 	v0v2 := v2.Sub(v0)
 	n := v0v1.Cross(v0v2)
@@ -42,25 +59,70 @@ func NewTriangleWithTexCoords(v0, v1, v2 geo.Vec3, tu0, tv0, tu1, tv1, tu2, tv2
 
 	center := v0.Add(v1).Add(v2).MulS(0.33333)
 
+	// Solve v0 - v2 = du02 * dpdu + dv02 * dpdv and v1 - v2 = du12 * dpdu + dv12 * dpdv
+	var dpdu, dpdv geo.Vec3
+	du02, dv02 := tu0-tu2, tv0-tv2
+	du12, dv12 := tu1-tu2, tv1-tv2
+	if det := du02*dv12 - dv02*du12; math.Abs(det) > util.AlmostZero {
+		dp02 := v0.Sub(v2)
+		dp12 := v1.Sub(v2)
+		dpdu = dp02.MulS(dv12).Sub(dp12.MulS(dv02)).DivS(det)
+		dpdv = dp12.MulS(du02).Sub(dp02.MulS(du12)).DivS(det)
+	}
+
 	return Triangle{
-		v0,
-		v0v1,
-		v0v2,
-		tu0,
-		tv0,
-		tu1,
-		tv1,
-		tu2,
-		tv2,
-		normal,
-		mat,
-		bBox,
-		area,
-		center,
+		v0:     v0,
+		v0v1:   v0v1,
+		v0v2:   v0v2,
+		tu0:    tu0,
+		tv0:    tv0,
+		tu1:    tu1,
+		tv1:    tv1,
+		tu2:    tu2,
+		tv2:    tv2,
+		normal: normal,
+		dpdu:   dpdu,
+		dpdv:   dpdv,
+		mat:    mat,
+		bBox:   bBox,
+		area:   area,
+		center: center,
+	}
+}
+
+// NewTriangleWithNormals creates a new triangle with texture coordinates and a normal at each vertex.
+// The normals are interpolated over the triangle, so that meshes of triangles look smooth. The vertex
+// normals decide which side of the triangle is the outside. Zero vertex normals are replaced by the
+// normal of the triangle.
+func NewTriangleWithNormals(v0, v1, v2, n0, n1, n2 geo.Vec3, tu0, tv0, tu1, tv1, tu2, tv2 float64, mat material.Material) Triangle {
+	t := NewTriangleWithTexCoords(v0, v1, v2, tu0, tv0, tu1, tv1, tu2, tv2, mat)
+	t.n0 = vertexNormal(n0, t.normal)
+	t.n1 = vertexNormal(n1, t.normal)
+	t.n2 = vertexNormal(n2, t.normal)
+	t.smooth = true
+	return t
+}
+
+// WithVertexColors returns a copy of the triangle with a color at each vertex. The colors are
+// interpolated over the triangle and set as the vertex color of the hit record, for use with
+// the vertex color texture.
+func (t Triangle) WithVertexColors(c0, c1, c2 geo.Vec3) Triangle {
+	t.c0 = c0
+	t.c1 = c1
+	t.c2 = c2
+	t.colored = true
+	return t
+}
+
+// vertexNormal returns the normal as unit vector, or the face normal if the normal has no direction
+func vertexNormal(normal, faceNormal geo.Vec3) geo.Vec3 {
+	if !(normal.Length() > util.AlmostZero) {
+		return faceNormal
 	}
+	return normal.Unit()
 }
 
-func (t Triangle) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRecord) {
+func (t Triangle) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
 
 	pVec := r.Direction.Cross(t.v0v2)
 	det := t.v0v1.Dot(pVec)
@@ -96,25 +158,49 @@ func (t Triangle) Hit(r geo.Ray, rayLength util.Interval) (bool, *material.HitRe
 	uu := uv0*t.tu0 + u*t.tu1 + v*t.tu2
 	vv := uv0*t.tv0 + u*t.tv1 + v*t.tv2
 
-	normal := t.normal
-	frontFace := r.Direction.Dot(normal) < 0
+	geometricNormal := t.normal
+	normal := geometricNormal
+	if t.smooth {
+		interpolated := t.n0.MulS(uv0).Add(t.n1.MulS(u)).Add(t.n2.MulS(v))
+		if interpolated.Length() > util.AlmostZero {
+			normal = interpolated.Unit()
+		}
+		if geometricNormal.Dot(normal) < 0 {
+			geometricNormal = geometricNormal.Neg()
+		}
+	}
+
+	vertexColor := geo.ZeroVector
+	if t.colored {
+		vertexColor = t.c0.MulS(uv0).Add(t.c1.MulS(u)).Add(t.c2.MulS(v))
+	}
+
+	frontFace := r.Direction.Dot(geometricNormal) < 0
 	if !frontFace {
 		normal = normal.Neg()
+		geometricNormal = geometricNormal.Neg()
 	}
 	rec := material.HitRecord{
-		HitPoint:  intersection,
-		Normal:    normal,
-		Material:  t.mat,
-		RayLength: tt,
-		U:         uu,
-		V:         vv,
-		FrontFace: frontFace,
+		HitPoint:        intersection,
+		Normal:          normal,
+		GeometricNormal: geometricNormal,
+		Material:        t.mat,
+		RayLength:       tt,
+		U:               uu,
+		V:               vv,
+		Dpdu:            t.dpdu,
+		Dpdv:            t.dpdv,
+		VertexColor:     vertexColor,
+		FrontFace:       frontFace,
+	}
+	if material.IsCutAway(&rec) {
+		return false, nil
 	}
 
 	return true, &rec
 }
 
-func (t Triangle) BoundingBox() aabb {
+func (t Triangle) BoundingBox() Aabb {
 	return t.bBox
 }
 
@@ -130,23 +216,29 @@ func (t Triangle) PdfValue(origin, direction geo.Vec3) float64 {
 		0,
 	)
 
-	hit, rec := t.Hit(ray, util.Interval{Min: 0.001, Max: util.Infinity})
+	// Hitting primitives does not use random numbers, so no rng is needed
+	hit, rec := t.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
 
 	if !hit {
 		return 0
 	}
 
 	distanceSquared := rec.RayLength * rec.RayLength * direction.LengthSquared()
-	cosine := math.Abs(direction.Dot(rec.Normal) / direction.Length())
+	cosine := math.Abs(direction.Dot(t.normal) / direction.Length())
 
 	return distanceSquared / (cosine * t.area)
 }
 
-func (t Triangle) RandomDirection(origin geo.Vec3) geo.Vec3 {
-	p := t.v0.Add(t.v0v1.MulS(random.RandomNormalFloat())).Add(t.v0v2.MulS(random.RandomNormalFloat()))
+func (t Triangle) RandomDirection(origin geo.Vec3, rng *random.Rng) geo.Vec3 {
+	p := t.v0.Add(t.v0v1.MulS(rng.NormalFloat())).Add(t.v0v2.MulS(rng.NormalFloat()))
 	return p.Sub(origin)
 }
 
 func (t Triangle) IsLight() bool {
 	return t.mat.IsLight()
 }
+
+// power returns the light emitted by the triangle
+func (t Triangle) power() (float64, bool) {
+	return emittedLuminance(t.mat, t.center) * t.area, true
+}
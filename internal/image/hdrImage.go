@@ -0,0 +1,28 @@
+package image
+
+import (
+	"image"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/mdouchement/hdr"
+)
+
+// ToHdrImage converts pixel values to an image with float precision.
+// The pixel values are stored as is, without any conversion.
+func ToHdrImage(pixels []geo.Vec3, width, height int) hdr.Image {
+	pixelData := make([]float64, len(pixels)*3)
+	for i := 0; i < len(pixels); i++ {
+		pixelData[i*3] = pixels[i].X
+		pixelData[i*3+1] = pixels[i].Y
+		pixelData[i*3+2] = pixels[i].Z
+	}
+
+	return &hdr.RGB64{
+		Pix:    pixelData,
+		Stride: 3 * width,
+		Rect: image.Rectangle{
+			Min: image.Point{X: 0, Y: 0},
+			Max: image.Point{X: width, Y: height},
+		},
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"math"
 
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/tonemap"
 )
 
 var (
@@ -39,7 +39,7 @@ func ToFloat(col geo.Vec3, samplesPerPixel int) geo.Vec3 {
 	g = math.Sqrt(scale * g)
 	b = math.Sqrt(scale * b)
 
-	intensity := util.Interval{Min: -0.999, Max: 0.999}
+	intensity := geo.Interval{Min: -0.999, Max: 0.999}
 
 	return geo.NewVec3(intensity.Clamp(r), intensity.Clamp(g), intensity.Clamp(b))
 }
@@ -52,3 +52,60 @@ func RgbToVec3(r, g, b uint32) geo.Vec3 {
 		Z: float64(b>>8) * colorScale,
 	}
 }
+
+// ToDisplayRgba converts a color in a Vec3 that is the sum of a given amount of samples
+// to a RGBA color, using the tone mapper and the sRGB transfer function.
+// Without a tone mapper the conversion of ToRgba is used.
+func ToDisplayRgba(col geo.Vec3, samplesPerPixel int, toneMapper tonemap.ToneMapper) color.RGBA {
+	if toneMapper == nil {
+		return ToRgba(col, samplesPerPixel)
+	}
+
+	c := ToDisplayFloat(col, samplesPerPixel, toneMapper)
+	return color.RGBA{
+		byte(math.Round(255 * c.X)),
+		byte(math.Round(255 * c.Y)),
+		byte(math.Round(255 * c.Z)),
+		255,
+	}
+}
+
+// ToDisplayFloat converts a color in a Vec3 that is the sum of a given amount of samples
+// to a float color in the range 0 to 1, using the tone mapper and the sRGB transfer function.
+// Without a tone mapper the conversion of ToFloat is used.
+func ToDisplayFloat(col geo.Vec3, samplesPerPixel int, toneMapper tonemap.ToneMapper) geo.Vec3 {
+	if toneMapper == nil {
+		return ToFloat(col, samplesPerPixel)
+	}
+
+	c := toneMapper.ToneMap(col.DivS(float64(samplesPerPixel)))
+	return geo.NewVec3(LinearToSrgb(c.X), LinearToSrgb(c.Y), LinearToSrgb(c.Z))
+}
+
+// LinearToSrgb applies the sRGB transfer function to a linear value in the range 0 to 1
+func LinearToSrgb(v float64) float64 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 1
+	}
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// SrgbToLinear applies the inverse of the sRGB transfer function to a value in the range 0 to 1
+func SrgbToLinear(v float64) float64 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 1
+	}
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
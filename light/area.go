@@ -0,0 +1,63 @@
+package light
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// area is a rectangular light, that shines from one side within a spread angle
+type area struct {
+	corner   geo.Vec3
+	u        geo.Vec3
+	v        geo.Vec3
+	normal   geo.Vec3
+	size     float64
+	radiance geo.Vec3
+	// Cosine of half the spread angle
+	cosSpread float64
+}
+
+// NewArea creates a rectangular light given a corner and two vectors along its sides. The light shines
+// from the side that the cross product of u and v points towards. The spread angle is the full angle
+// around the normal that the light shines within, where 180 degrees is a diffuse light and smaller
+// angles give a more focused light, like a softbox
+func NewArea(corner, u, v, radiance geo.Vec3, spreadDegrees float64) Light {
+	n := u.Cross(v)
+	spread := math.Max(0, math.Min(spreadDegrees, 180))
+	return area{
+		corner:    corner,
+		u:         u,
+		v:         v,
+		normal:    n.Unit(),
+		size:      n.Length(),
+		radiance:  radiance,
+		cosSpread: math.Cos(util.DegreesToRadians(spread / 2)),
+	}
+}
+
+// Sample returns the light from a uniformly sampled point on the light
+func (a area) Sample(point geo.Vec3, rng *random.Rng) Sample {
+	onLight := a.corner.Add(a.u.MulS(rng.NormalFloat())).Add(a.v.MulS(rng.NormalFloat()))
+	toLight := onLight.Sub(point)
+	distanceSquared := toLight.LengthSquared()
+	if distanceSquared == 0 {
+		return noLight
+	}
+	distance := math.Sqrt(distanceSquared)
+	direction := toLight.DivS(distance)
+
+	cosine := -direction.Dot(a.normal)
+	if cosine <= 0 || cosine < a.cosSpread {
+		return noLight
+	}
+
+	// The pdf of the direction is the distance squared divided by the cosine times the size of the light
+	return Sample{
+		Direction: direction,
+		Distance:  distance,
+		Color:     a.radiance.MulS(cosine * a.size / distanceSquared),
+	}
+}
@@ -0,0 +1,235 @@
+package light
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// IesProfile is the distribution of light from a lamp, as measured in an IES photometric file.
+// The intensities are relative to the brightest direction of the lamp
+type IesProfile struct {
+	// VerticalAngles are the angles in degrees from straight down, in increasing order
+	VerticalAngles []float64
+	// HorizontalAngles are the angles in degrees around the lamp, in increasing order
+	HorizontalAngles []float64
+	// Intensities has the intensities for all the vertical angles, for each horizontal angle
+	Intensities [][]float64
+}
+
+// LoadIes reads an IES photometric file in the LM-63 format
+func LoadIes(path string) (IesProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return IesProfile{}, errors.New(fmt.Sprintf("Failed to open ies profile: %v", err.Error()))
+	}
+	defer f.Close()
+
+	profile, err := ParseIes(f)
+	if err != nil {
+		return IesProfile{}, errors.New(fmt.Sprintf("Failed to read ies profile %v: %v", path, err.Error()))
+	}
+	return profile, nil
+}
+
+// ParseIes parses IES photometric data in the LM-63 format
+func ParseIes(r io.Reader) (IesProfile, error) {
+	scanner := bufio.NewScanner(r)
+
+	// The keywords of the header are skipped until the tilt line
+	tilt := ""
+	for tilt == "" && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "TILT=") {
+			tilt = strings.TrimPrefix(line, "TILT=")
+		}
+	}
+	if tilt == "" {
+		return IesProfile{}, errors.New("Missing TILT line")
+	}
+	if tilt != "NONE" && tilt != "INCLUDE" {
+		return IesProfile{}, errors.New(fmt.Sprintf("Unsupported TILT: %v", tilt))
+	}
+
+	var numbers []float64
+	for scanner.Scan() {
+		for _, field := range strings.FieldsFunc(scanner.Text(), func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		}) {
+			n, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return IesProfile{}, errors.New(fmt.Sprintf("Invalid number: %v", field))
+			}
+			numbers = append(numbers, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return IesProfile{}, err
+	}
+
+	next := func(n int) ([]float64, error) {
+		if n < 0 || n > len(numbers) {
+			return nil, errors.New("Unexpected end of data")
+		}
+		ret := numbers[:n]
+		numbers = numbers[n:]
+		return ret, nil
+	}
+
+	// The lamp to luminaire geometry and the tilt angles and factors are not used
+	if tilt == "INCLUDE" {
+		tiltHeader, err := next(2)
+		if err != nil {
+			return IesProfile{}, err
+		}
+		if _, err := next(2 * int(tiltHeader[1])); err != nil {
+			return IesProfile{}, err
+		}
+	}
+
+	header, err := next(13)
+	if err != nil {
+		return IesProfile{}, err
+	}
+	multiplier := header[2]
+	numVertical := int(header[3])
+	numHorizontal := int(header[4])
+	if numVertical < 1 || numHorizontal < 1 {
+		return IesProfile{}, errors.New(fmt.Sprintf("Invalid number of angles %v and %v", numVertical, numHorizontal))
+	}
+
+	verticalAngles, err := next(numVertical)
+	if err != nil {
+		return IesProfile{}, err
+	}
+	horizontalAngles, err := next(numHorizontal)
+	if err != nil {
+		return IesProfile{}, err
+	}
+	if !sort.Float64sAreSorted(verticalAngles) || !sort.Float64sAreSorted(horizontalAngles) {
+		return IesProfile{}, errors.New("Angles are not in increasing order")
+	}
+
+	profile := IesProfile{
+		VerticalAngles:   verticalAngles,
+		HorizontalAngles: horizontalAngles,
+		Intensities:      make([][]float64, numHorizontal),
+	}
+	maxIntensity := 0.
+	for i := range profile.Intensities {
+		candelas, err := next(numVertical)
+		if err != nil {
+			return IesProfile{}, err
+		}
+		profile.Intensities[i] = make([]float64, numVertical)
+		for j, c := range candelas {
+			profile.Intensities[i][j] = c * multiplier
+			maxIntensity = math.Max(maxIntensity, c*multiplier)
+		}
+	}
+	if maxIntensity <= 0 {
+		return IesProfile{}, errors.New("Lamp gives no light")
+	}
+	for _, intensities := range profile.Intensities {
+		for j := range intensities {
+			intensities[j] /= maxIntensity
+		}
+	}
+
+	return profile, nil
+}
+
+// Intensity returns the relative intensity of the lamp at the vertical angle from straight down,
+// and the horizontal angle around the lamp, both in degrees
+func (p IesProfile) Intensity(verticalDegrees, horizontalDegrees float64) float64 {
+	// The horizontal angles only cover the part of the lamp needed given its symmetry
+	horizontal := math.Mod(horizontalDegrees, 360)
+	if horizontal < 0 {
+		horizontal += 360
+	}
+	switch last := p.HorizontalAngles[len(p.HorizontalAngles)-1]; {
+	case last <= 90:
+		horizontal = math.Mod(horizontal, 180)
+		if horizontal > 90 {
+			horizontal = 180 - horizontal
+		}
+	case last <= 180:
+		if horizontal > 180 {
+			horizontal = 360 - horizontal
+		}
+	}
+
+	i, ti := interpolationIndex(p.HorizontalAngles, horizontal)
+	j, tj := interpolationIndex(p.VerticalAngles, verticalDegrees)
+	if j < 0 {
+		return 0
+	}
+	if i < 0 {
+		// Lamps with a single horizontal angle are the same all around
+		i, ti = 0, 0
+	}
+
+	i1 := i
+	if i+1 < len(p.HorizontalAngles) {
+		i1 = i + 1
+	}
+	j1 := j
+	if j+1 < len(p.VerticalAngles) {
+		j1 = j + 1
+	}
+	v := p.Intensities
+	return (1-ti)*((1-tj)*v[i][j]+tj*v[i][j1]) + ti*((1-tj)*v[i1][j]+tj*v[i1][j1])
+}
+
+// interpolationIndex returns the index of the angle before the given angle, and how far it
+// is towards the next angle. The index is negative if the angle is outside the angles
+func interpolationIndex(angles []float64, angle float64) (int, float64) {
+	if angle < angles[0] || angle > angles[len(angles)-1] {
+		return -1, 0
+	}
+	i := sort.SearchFloat64s(angles, angle)
+	if i < len(angles) && angles[i] == angle {
+		return i, 0
+	}
+	i--
+	return i, (angle - angles[i]) / (angles[i+1] - angles[i])
+}
+
+// ies is a point light where the intensity in each direction is given by an IES profile
+type ies struct {
+	position  geo.Vec3
+	intensity geo.Vec3
+	profile   IesProfile
+	// Straight down in the profile is along W, and horizontal angle zero along U
+	uvw geo.Onb
+}
+
+// NewIes creates a point light where the intensity in each direction is given by the profile, times the intensity.
+// The direction is where the profile points straight down.
+func NewIes(position, direction, intensity geo.Vec3, profile IesProfile) Light {
+	return ies{
+		position:  position,
+		intensity: intensity,
+		profile:   profile,
+		uvw:       geo.BuildOnbFromVec3(direction),
+	}
+}
+
+// Sample returns the light arriving at the point, with the intensity of the profile in the direction of the point
+func (l ies) Sample(point geo.Vec3, rng *random.Rng) Sample {
+	return sampleFromPosition(point, l.position, func(fromLight geo.Vec3) geo.Vec3 {
+		local := l.uvw.Coordinates(fromLight)
+		vertical := math.Acos(math.Max(-1, math.Min(local.Z, 1))) * 180 / math.Pi
+		horizontal := math.Atan2(local.Y, local.X) * 180 / math.Pi
+		return l.intensity.MulS(l.profile.Intensity(vertical, horizontal))
+	})
+}
@@ -0,0 +1,144 @@
+// Package light provides light sources that are not surfaces in the scene, like point lights and spot lights.
+// They are not seen by the camera or found by scattered rays, but are sampled with shadow rays from every
+// surface the rays hit.
+package light
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// Light is a light source that is only found by sampling it from the points it lights
+type Light interface {
+	// Sample returns a sample of the light arriving at the point
+	Sample(point geo.Vec3, rng *random.Rng) Sample
+}
+
+// Sample is the light arriving at a point from a light source
+type Sample struct {
+	// Direction is the unit vector from the point towards the light
+	Direction geo.Vec3
+	// Distance from the point to the light, that is infinite for lights far away
+	Distance float64
+	// Color is the light arriving at the point, divided by the pdf of sampling the direction.
+	// Lights from a single point or direction have no pdf, and the color is the irradiance at the point
+	Color geo.Vec3
+}
+
+// noLight is the sample for points that the light does not reach
+var noLight = Sample{Distance: util.Infinity}
+
+// point is a light that shines equally in all directions from a single point
+type point struct {
+	position  geo.Vec3
+	intensity geo.Vec3
+}
+
+// NewPoint creates a light that shines equally in all directions from the position.
+// The light arriving at a distance d from the light is the intensity divided by d squared
+func NewPoint(position, intensity geo.Vec3) Light {
+	return point{
+		position:  position,
+		intensity: intensity,
+	}
+}
+
+// Sample returns the light arriving at the point, that falls off with the square of the distance
+func (p point) Sample(point geo.Vec3, rng *random.Rng) Sample {
+	return sampleFromPosition(point, p.position, func(geo.Vec3) geo.Vec3 {
+		return p.intensity
+	})
+}
+
+// spot is a point light that only shines within a cone
+type spot struct {
+	position  geo.Vec3
+	direction geo.Vec3
+	intensity geo.Vec3
+	// Cosines of the angles from the direction where the light starts to fall off, and where it ends
+	cosFalloffStart float64
+	cosFalloffEnd   float64
+}
+
+// NewSpot creates a light that shines from the position in a cone around the direction.
+// The cone angle is the full angle of the cone. Towards the edge of the cone the light falls off smoothly
+// over the falloff angle, where zero gives a sharp edge.
+func NewSpot(position, direction, intensity geo.Vec3, coneAngleDegrees, falloffDegrees float64) Light {
+	halfAngle := util.DegreesToRadians(coneAngleDegrees / 2)
+	falloffStart := math.Max(0, halfAngle-util.DegreesToRadians(falloffDegrees))
+	return spot{
+		position:        position,
+		direction:       direction.Unit(),
+		intensity:       intensity,
+		cosFalloffStart: math.Cos(falloffStart),
+		cosFalloffEnd:   math.Cos(halfAngle),
+	}
+}
+
+// Sample returns the light arriving at the point, that is zero outside the cone
+func (s spot) Sample(point geo.Vec3, rng *random.Rng) Sample {
+	return sampleFromPosition(point, s.position, func(fromLight geo.Vec3) geo.Vec3 {
+		cos := fromLight.Dot(s.direction)
+		if cos >= s.cosFalloffStart {
+			return s.intensity
+		}
+		if cos <= s.cosFalloffEnd {
+			return geo.ZeroVector
+		}
+		return s.intensity.MulS(smoothstep((cos - s.cosFalloffEnd) / (s.cosFalloffStart - s.cosFalloffEnd)))
+	})
+}
+
+// directional is a light that shines from far away in a single direction, like the sun
+type directional struct {
+	direction  geo.Vec3
+	irradiance geo.Vec3
+}
+
+// NewDirectional creates a light that shines in the direction from far away, so that the light
+// arriving at all points is the same irradiance
+func NewDirectional(direction, irradiance geo.Vec3) Light {
+	return directional{
+		direction:  direction.Unit(),
+		irradiance: irradiance,
+	}
+}
+
+// Sample returns the light arriving at the point from the opposite of the light direction
+func (d directional) Sample(point geo.Vec3, rng *random.Rng) Sample {
+	return Sample{
+		Direction: d.direction.Neg(),
+		Distance:  util.Infinity,
+		Color:     d.irradiance,
+	}
+}
+
+// sampleFromPosition returns the sample for a light at a single position, where
+// intensity gives the intensity in the direction from the light to the point
+func sampleFromPosition(point, position geo.Vec3, intensity func(fromLight geo.Vec3) geo.Vec3) Sample {
+	toLight := position.Sub(point)
+	distanceSquared := toLight.LengthSquared()
+	if distanceSquared == 0 {
+		return noLight
+	}
+	distance := math.Sqrt(distanceSquared)
+	direction := toLight.DivS(distance)
+
+	color := intensity(direction.Neg())
+	if color == geo.ZeroVector {
+		return noLight
+	}
+	return Sample{
+		Direction: direction,
+		Distance:  distance,
+		Color:     color.DivS(distanceSquared),
+	}
+}
+
+// smoothstep smoothly goes from zero to one as x goes from zero to one
+func smoothstep(x float64) float64 {
+	return x * x * (3 - 2*x)
+}
@@ -0,0 +1,87 @@
+package material
+
+import (
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// Step in texture coordinates used to find the slope of height textures that are not images
+const bumpStep = .0005
+
+// texelSizer is implemented by textures with pixels
+type texelSizer interface {
+	// texelSize returns the size of a pixel in texture coordinates
+	texelSize() (float64, float64)
+}
+
+// bumpMap is a material where the shading normal is tilted by the slopes of a height texture
+type bumpMap struct {
+	mat      Material
+	height   Texture
+	strength float64
+}
+
+// NewBumpMap creates a material that looks like the surface is displaced by the height texture times the
+// strength, without changing the geometry. The height texture uses the red channel. Hittables that do not
+// have texture coordinates, and so no Dpdu and Dpdv in the hit record, are not bumped.
+func NewBumpMap(mat Material, height Texture, strength float64) Material {
+	return bumpMap{mat: mat, height: height, strength: strength}
+}
+
+// bumped returns the hit record with the normal tilted by the slopes of the height texture
+func (m bumpMap) bumped(rec *HitRecord) *HitRecord {
+	if rec.Dpdu == geo.ZeroVector || rec.Dpdv == geo.ZeroVector {
+		return rec
+	}
+
+	// Image textures have the same height within each pixel, so the slope is taken over a pixel
+	du, dv := bumpStep, bumpStep
+	if it, ok := m.height.(texelSizer); ok {
+		du, dv = it.texelSize()
+	}
+	height := func(u, v float64) float64 {
+		shifted := *rec
+		shifted.U = u
+		shifted.V = v
+		return m.height.Color(&shifted).X
+	}
+	dhdu := (height(rec.U+du, rec.V) - height(rec.U-du, rec.V)) / (2 * du) * m.strength
+	dhdv := (height(rec.U, rec.V+dv) - height(rec.U, rec.V-dv)) / (2 * dv) * m.strength
+
+	dpdu := rec.Dpdu.Add(rec.Normal.MulS(dhdu))
+	dpdv := rec.Dpdv.Add(rec.Normal.MulS(dhdv))
+	normal := dpdu.Cross(dpdv).Unit()
+	if !(normal.Dot(rec.Normal) > 0) {
+		normal = normal.Neg()
+	}
+	if !(normal.Dot(rec.Normal) > 0) {
+		return rec
+	}
+
+	ret := *rec
+	ret.Normal = normal
+	if ret.GeometricNormal == geo.ZeroVector {
+		ret.GeometricNormal = rec.Normal
+	}
+	return &ret
+}
+
+// Scatter scatters the ray with the underlying material, around the bumped normal
+func (m bumpMap) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
+	return m.mat.Scatter(rayIn, m.bumped(rec), rng)
+}
+
+// ScatteringPdf returns the scattering pdf of the underlying material, around the bumped normal
+func (m bumpMap) ScatteringPdf(rec *HitRecord, scattered geo.Ray) float64 {
+	return m.mat.ScatteringPdf(m.bumped(rec), scattered)
+}
+
+// Emitted returns the light emitted by the underlying material
+func (m bumpMap) Emitted(rec *HitRecord) geo.Vec3 {
+	return m.mat.Emitted(rec)
+}
+
+// IsLight checks if the underlying material is a light
+func (m bumpMap) IsLight() bool {
+	return m.mat.IsLight()
+}
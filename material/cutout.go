@@ -0,0 +1,84 @@
+package material
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// Cutout is implemented by materials that cut holes in surfaces. Hittables that support cutouts
+// ignore hits where the surface is cut away, so that rays pass through as if there was no surface.
+type Cutout interface {
+	// Opaque checks if the surface is there at the hit
+	Opaque(rec *HitRecord) bool
+}
+
+// IsCutAway checks if the material of the hit cuts away the surface at the hit
+func IsCutAway(rec *HitRecord) bool {
+	c, ok := rec.Material.(Cutout)
+	return ok && !c.Opaque(rec)
+}
+
+// alphaCutout is a material where surfaces are cut away by an alpha texture
+type alphaCutout struct {
+	mat   Material
+	alpha Texture
+}
+
+// NewAlphaCutout creates a material that cuts away surfaces where the alpha texture is below 0.5,
+// like for the leaves of a tree. Elsewhere the surface has the given material.
+// The alpha texture uses the red channel.
+func NewAlphaCutout(mat Material, alpha Texture) Material {
+	return alphaCutout{mat: mat, alpha: alpha}
+}
+
+// Opaque checks if the alpha is at least 0.5 at the hit
+func (m alphaCutout) Opaque(rec *HitRecord) bool {
+	return m.alpha.Color(rec).X >= .5
+}
+
+// stochasticCutout is a material where surfaces are randomly cut away, so that they are partially transparent
+type stochasticCutout struct {
+	alphaCutout
+}
+
+// NewStochasticCutout creates a material that is partially transparent, like a thin veil. Each hit is
+// cut away at random with the probability one minus the alpha texture, so that averaged over the samples
+// of a pixel the surface covers as much as the alpha. Elsewhere the surface has the given material.
+// The alpha texture uses the red channel.
+func NewStochasticCutout(mat Material, alpha Texture) Material {
+	return stochasticCutout{alphaCutout{mat: mat, alpha: alpha}}
+}
+
+// Opaque checks if the alpha is above a random value for the hit. The value is hashed from the hit point
+// and ray length, so that it is the same each time the hit is checked.
+func (m stochasticCutout) Opaque(rec *HitRecord) bool {
+	h := random.MixSeed(
+		math.Float64bits(rec.RayLength),
+		math.Float64bits(rec.HitPoint.X),
+		math.Float64bits(rec.HitPoint.Y),
+		math.Float64bits(rec.HitPoint.Z),
+	)
+	return m.alpha.Color(rec).X > float64(h>>11)/(1<<53)
+}
+
+// Scatter scatters the ray with the material of the opaque part
+func (m alphaCutout) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
+	return m.mat.Scatter(rayIn, rec, rng)
+}
+
+// ScatteringPdf returns the scattering pdf of the material of the opaque part
+func (m alphaCutout) ScatteringPdf(rec *HitRecord, scattered geo.Ray) float64 {
+	return m.mat.ScatteringPdf(rec, scattered)
+}
+
+// Emitted returns the light emitted by the material of the opaque part
+func (m alphaCutout) Emitted(rec *HitRecord) geo.Vec3 {
+	return m.mat.Emitted(rec)
+}
+
+// IsLight checks if the material of the opaque part is a light
+func (m alphaCutout) IsLight() bool {
+	return m.mat.IsLight()
+}
@@ -0,0 +1,42 @@
+package material
+
+import (
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// emissive is a material that emits light and also scatters light like another material
+type emissive struct {
+	mat  Material
+	emit Texture
+}
+
+// NewEmissive creates a material that emits the color of the emit texture from the front face, like a
+// glowing display, and otherwise scatters like the given material. It is a light, so it is sampled.
+func NewEmissive(mat Material, emit Texture) Material {
+	return emissive{mat: mat, emit: emit}
+}
+
+// Scatter scatters the ray with the underlying material
+func (m emissive) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
+	return m.mat.Scatter(rayIn, rec, rng)
+}
+
+// ScatteringPdf returns the scattering pdf of the underlying material
+func (m emissive) ScatteringPdf(rec *HitRecord, scattered geo.Ray) float64 {
+	return m.mat.ScatteringPdf(rec, scattered)
+}
+
+// Emitted returns the color of the emit texture on the front face, added to the light emitted by the underlying material
+func (m emissive) Emitted(rec *HitRecord) geo.Vec3 {
+	emitted := m.mat.Emitted(rec)
+	if !rec.FrontFace {
+		return emitted
+	}
+	return emitted.Add(m.emit.Color(rec))
+}
+
+// IsLight an emissive material is a light
+func (m emissive) IsLight() bool {
+	return true
+}
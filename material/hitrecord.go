@@ -8,11 +8,23 @@ import (
 // HitRecord is a collection of all interesting properties from
 // when a ray hits a hittable object
 type HitRecord struct {
-	HitPoint  geo.Vec3
-	Normal    geo.Vec3
-	Material  Material
-	RayLength float64
-	U         float64
-	V         float64
-	FrontFace bool
+	HitPoint geo.Vec3
+	// Normal is the shading normal, that faces the side of the surface that was hit.
+	// It can differ from the normal of the surface, like when vertex normals are interpolated
+	Normal geo.Vec3
+	// GeometricNormal is the normal of the actual surface, on the same side as Normal.
+	// Zero if it is the same as Normal
+	GeometricNormal geo.Vec3
+	Material        Material
+	RayLength       float64
+	U               float64
+	V               float64
+	// Dpdu and Dpdv are how the hit point moves along the surface with the U and V
+	// texture coordinates. Zero if the hittable does not have them
+	Dpdu geo.Vec3
+	Dpdv geo.Vec3
+	// VertexColor is the color interpolated from the vertices of the hittable.
+	// Zero if the hittable does not have vertex colors
+	VertexColor geo.Vec3
+	FrontFace   bool
 }
@@ -14,6 +14,20 @@ type ScatterRecord struct {
 	Pdf         pdf.Pdf
 	SkipPdf     bool
 	SkipPdfRay  geo.Ray
+	// Bsdf is set by materials where the scattered color depends on both the incoming and
+	// scattered direction. It is then used instead of Pdf, Attenuation and ScatteringPdf
+	Bsdf Bsdf
+}
+
+// Bsdf is the scattering function of a material for a given incoming ray.
+// As a pdf it samples directions proportional to the scattering function.
+// Generate returns the zero vector for samples that are absorbed, e.g. when
+// a rough surface reflects the ray into itself.
+type Bsdf interface {
+	pdf.Pdf
+	// Eval returns the bsdf times the cosine of the angle between
+	// the scattered direction and the normal, for the given scattered direction
+	Eval(direction geo.Vec3) geo.Vec3
 }
 
 // Material is the interface for types that describe how
@@ -22,7 +36,7 @@ type Material interface {
 	PdfGeneratingMaterial
 	LightEmittingMaterial
 	IsLight() bool
-	Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord)
+	Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord)
 }
 
 // PdfGeneratingMaterial is a material that can use pdfs for scattering of rays
@@ -71,7 +85,7 @@ func NewLambertian(tex Texture) Material {
 }
 
 // Scatter returns a randomish scatter of the ray for the matte material
-func (m lambertian) Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord) {
+func (m lambertian) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
 	attenuation := m.Tex.Color(rec)
 	pdf := pdf.NewCosinePdf(rec.Normal)
 
@@ -106,11 +120,11 @@ func NewMetal(tex Texture, fuzz float64) Material {
 
 // Scatter returns a reflected scattered ray for the metal material
 // The Fuzz property of the metal defines the randomness applied to the reflection
-func (m metal) Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord) {
+func (m metal) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
 	reflected := rayIn.Direction.Unit().Reflect(rec.Normal)
 	scatterRay := geo.NewRay(
 		rec.HitPoint,
-		reflected.Add(geo.RandomInUnitSphere().MulS(m.Fuzz)),
+		reflected.Add(geo.RandomInUnitSphere(rng).MulS(m.Fuzz)),
 		rayIn.Time,
 	)
 
@@ -138,7 +152,7 @@ func NewDielectric(tex Texture, indexOfRefraction float64) Material {
 }
 
 // Scatter returns a refracted ray for the dielectric material
-func (m dielectric) Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord) {
+func (m dielectric) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
 	var refractionRatio float64
 	if rec.FrontFace {
 		refractionRatio = 1 / m.IndexOfRefraction
@@ -152,7 +166,7 @@ func (m dielectric) Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord)
 	cannotRefract := refractionRatio*sinTheta > 1
 
 	var direction geo.Vec3
-	if cannotRefract || reflectance(cosTheta, refractionRatio) > random.RandomNormalFloat() {
+	if cannotRefract || reflectance(cosTheta, refractionRatio) > rng.NormalFloat() {
 		direction = unitDirection.Reflect(rec.Normal)
 	} else {
 		direction = unitDirection.Refract(rec.Normal, refractionRatio)
@@ -197,7 +211,7 @@ func (m diffuseLight) IsLight() bool {
 }
 
 // Scatter a light never scatters a ray
-func (m diffuseLight) Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord) {
+func (m diffuseLight) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
 	return false, ScatterRecord{}
 }
 
@@ -217,7 +231,7 @@ type Isotropic struct {
 }
 
 // Scatter returns a randomly scattered ray in any direction
-func (m Isotropic) Scatter(rayIn geo.Ray, rec *HitRecord) (bool, ScatterRecord) {
+func (m Isotropic) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
 	attenuation := m.Albedo.Color(rec)
 	pdf := pdf.NewSpherePdf()
 
@@ -0,0 +1,353 @@
+package material
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+// The functions in this file work with directions in a local shading frame, where the normal is
+// the Z axis and both directions point away from the surface.
+
+// Lowest alpha of a microfacet distribution. Smoother surfaces give too narrow peaks in the distribution
+const minMicrofacetAlpha = 1e-3
+
+// MicrofacetDistribution selects the statistical distribution of microfacet normals of a rough surface
+type MicrofacetDistribution int
+
+const (
+	// Ggx has long tails, that give a glow around highlights
+	Ggx MicrofacetDistribution = iota
+	// Beckmann has a sharper falloff of highlights than Ggx
+	Beckmann
+)
+
+// microfacetDistribution is a distribution of microfacet normals, with a Smith masking function
+type microfacetDistribution interface {
+	// d is the density of microfacets with normal h
+	d(h geo.Vec3) float64
+	// lambda is the auxiliary function of the Smith masking function
+	lambda(w geo.Vec3) float64
+	// sampleNormal samples a microfacet normal seen from wo
+	sampleNormal(wo geo.Vec3, u1, u2 float64) geo.Vec3
+	// normalPdf is the density of sampling the microfacet normal h with sampleNormal
+	normalPdf(wo, h geo.Vec3) float64
+}
+
+// newMicrofacetDistribution creates a distribution, where the perceptually linear roughness is squared to get alpha
+func newMicrofacetDistribution(distribution MicrofacetDistribution, roughness float64) microfacetDistribution {
+	alpha := math.Max(roughness*roughness, minMicrofacetAlpha)
+	if distribution == Beckmann {
+		return beckmann{alpha: alpha}
+	}
+	return ggx{alpha: alpha}
+}
+
+// g1 is the fraction of microfacets visible from the direction w
+func g1(dist microfacetDistribution, w geo.Vec3) float64 {
+	return 1 / (1 + dist.lambda(w))
+}
+
+// g is the fraction of microfacets visible from both directions, using the height correlated Smith function
+func g(dist microfacetDistribution, wo, wi geo.Vec3) float64 {
+	return 1 / (1 + dist.lambda(wo) + dist.lambda(wi))
+}
+
+// tan2Theta is the squared tangent of the angle between w and the normal
+func tan2Theta(w geo.Vec3) float64 {
+	cos2 := w.Z * w.Z
+	if cos2 == 0 {
+		return math.Inf(1)
+	}
+	return math.Max(0, 1-cos2) / cos2
+}
+
+// ggx is the GGX, also known as Trowbridge-Reitz, distribution of microfacet normals
+type ggx struct {
+	alpha float64
+}
+
+// newGgx creates a GGX distribution, where the perceptually linear roughness is squared to get alpha
+func newGgx(roughness float64) ggx {
+	return ggx{alpha: math.Max(roughness*roughness, minMicrofacetAlpha)}
+}
+
+func (g ggx) d(h geo.Vec3) float64 {
+	if h.Z <= 0 {
+		return 0
+	}
+	a2 := g.alpha * g.alpha
+	t := h.Z*h.Z*(a2-1) + 1
+	return a2 / (math.Pi * t * t)
+}
+
+func (g ggx) lambda(w geo.Vec3) float64 {
+	return (math.Sqrt(1+g.alpha*g.alpha*tan2Theta(w)) - 1) / 2
+}
+
+// sampleNormal samples a microfacet normal from the distribution of normals visible from wo.
+// Uses the method from "Sampling the GGX Distribution of Visible Normals" by Heitz 2018.
+func (g ggx) sampleNormal(wo geo.Vec3, u1, u2 float64) geo.Vec3 {
+	// Stretch the view direction so that the distribution becomes a hemisphere
+	vh := geo.NewVec3(g.alpha*wo.X, g.alpha*wo.Y, wo.Z).Unit()
+
+	lenSq := vh.X*vh.X + vh.Y*vh.Y
+	t1 := geo.NewVec3(1, 0, 0)
+	if lenSq > 0 {
+		t1 = geo.NewVec3(-vh.Y, vh.X, 0).DivS(math.Sqrt(lenSq))
+	}
+	t2 := vh.Cross(t1)
+
+	// Sample the projected area of the hemisphere, as seen from the view direction
+	r := math.Sqrt(u1)
+	phi := 2 * math.Pi * u2
+	p1 := r * math.Cos(phi)
+	p2 := r * math.Sin(phi)
+	s := .5 * (1 + vh.Z)
+	p2 = (1-s)*math.Sqrt(1-p1*p1) + s*p2
+
+	nh := t1.MulS(p1).Add(t2.MulS(p2)).Add(vh.MulS(math.Sqrt(math.Max(0, 1-p1*p1-p2*p2))))
+
+	// Unstretch back to the microfacet normal
+	return geo.NewVec3(g.alpha*nh.X, g.alpha*nh.Y, math.Max(1e-6, nh.Z)).Unit()
+}
+
+func (g ggx) normalPdf(wo, h geo.Vec3) float64 {
+	if wo.Z <= 0 {
+		return 0
+	}
+	return g1(g, wo) * math.Max(0, wo.Dot(h)) * g.d(h) / wo.Z
+}
+
+// beckmann is the Beckmann distribution of microfacet normals, which has gaussian distributed slopes
+type beckmann struct {
+	alpha float64
+}
+
+func (b beckmann) d(h geo.Vec3) float64 {
+	if h.Z <= 0 {
+		return 0
+	}
+	a2 := b.alpha * b.alpha
+	cos2 := h.Z * h.Z
+	return math.Exp(-tan2Theta(h)/a2) / (math.Pi * a2 * cos2 * cos2)
+}
+
+// lambda uses the rational approximation by Walter et al. 2007
+func (b beckmann) lambda(w geo.Vec3) float64 {
+	tan2 := tan2Theta(w)
+	if tan2 == 0 {
+		return 0
+	}
+	a := 1 / (b.alpha * math.Sqrt(tan2))
+	if a >= 1.6 {
+		return 0
+	}
+	return (1 - 1.259*a + .396*a*a) / (3.535*a + 2.181*a*a)
+}
+
+// sampleNormal samples a normal proportional to the density times the cosine of the normal,
+// which unlike sampling of visible normals can give normals facing away from wo
+func (b beckmann) sampleNormal(wo geo.Vec3, u1, u2 float64) geo.Vec3 {
+	tan2 := -b.alpha * b.alpha * math.Log(1-u1)
+	cosTheta := 1 / math.Sqrt(1+tan2)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u2
+	return geo.NewVec3(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta)
+}
+
+func (b beckmann) normalPdf(wo, h geo.Vec3) float64 {
+	return b.d(h) * math.Max(0, h.Z)
+}
+
+// shadingFrame returns the local frame of the normal at the hit point, and
+// the direction towards the origin of the incoming ray in that frame
+func shadingFrame(rayIn geo.Ray, rec *HitRecord) (geo.Onb, geo.Vec3) {
+	frame := geo.BuildOnbFromVec3(rec.Normal)
+	wo := frame.Coordinates(rayIn.Direction.Unit().Neg())
+	// The normal faces the incoming ray, but shading normals can still give a grazing view direction
+	if wo.Z < 1e-6 {
+		wo = geo.NewVec3(wo.X, wo.Y, 1e-6).Unit()
+	}
+	return frame, wo
+}
+
+// reflect returns wo mirrored around the normal h
+func reflect(wo, h geo.Vec3) geo.Vec3 {
+	return h.MulS(2 * wo.Dot(h)).Sub(wo)
+}
+
+// refract returns wo refracted through a surface with the normal h on the same side as wo, where
+// eta is the index of refraction on the other side relative to the side of wo.
+// Returns false on total internal reflection
+func refract(wo, h geo.Vec3, eta float64) (geo.Vec3, bool) {
+	cosI := wo.Dot(h)
+	sin2T := math.Max(0, 1-cosI*cosI) / (eta * eta)
+	if sin2T >= 1 {
+		return geo.Vec3{}, false
+	}
+	cosT := math.Sqrt(1 - sin2T)
+	return wo.Neg().DivS(eta).Add(h.MulS(cosI/eta - cosT)), true
+}
+
+// schlickWeight is the fresnel term of Schlick's approximation
+func schlickWeight(cosTheta float64) float64 {
+	m := math.Max(0, math.Min(1-cosTheta, 1))
+	return m * m * m * m * m
+}
+
+// schlickFresnel is the fraction of light reflected using Schlick's approximation,
+// with a colored reflectance f0 at normal incidence
+func schlickFresnel(f0 geo.Vec3, cosTheta float64) geo.Vec3 {
+	w := schlickWeight(cosTheta)
+	return f0.Add(geo.NewVec3(1, 1, 1).Sub(f0).MulS(w))
+}
+
+// conductorFresnel is the fraction of light reflected by a conductor with
+// the complex index of refraction eta + ik, for each color channel
+func conductorFresnel(cosThetaI float64, ior ComplexIor) geo.Vec3 {
+	return geo.NewVec3(
+		conductorFresnelChannel(cosThetaI, ior.Eta.X, ior.K.X),
+		conductorFresnelChannel(cosThetaI, ior.Eta.Y, ior.K.Y),
+		conductorFresnelChannel(cosThetaI, ior.Eta.Z, ior.K.Z),
+	)
+}
+
+func conductorFresnelChannel(cosThetaI, eta, k float64) float64 {
+	cosThetaI = math.Max(0, math.Min(cosThetaI, 1))
+	cos2 := cosThetaI * cosThetaI
+	sin2 := 1 - cos2
+	eta2 := eta * eta
+	k2 := k * k
+
+	t0 := eta2 - k2 - sin2
+	a2PlusB2 := math.Sqrt(t0*t0 + 4*eta2*k2)
+	t1 := a2PlusB2 + cos2
+	a := math.Sqrt(math.Max(0, (a2PlusB2+t0)/2))
+	t2 := 2 * cosThetaI * a
+	rs := (t1 - t2) / (t1 + t2)
+
+	t3 := cos2*a2PlusB2 + sin2*sin2
+	t4 := t2 * sin2
+	rp := rs * (t3 - t4) / (t3 + t4)
+
+	return (rp + rs) / 2
+}
+
+// dielectricFresnel is the fraction of unpolarized light reflected at a boundary between dielectrics,
+// where eta is the index of refraction on the other side relative to the side of the incoming light
+func dielectricFresnel(cosThetaI, eta float64) float64 {
+	cosThetaI = math.Max(-1, math.Min(cosThetaI, 1))
+	if cosThetaI < 0 {
+		eta = 1 / eta
+		cosThetaI = -cosThetaI
+	}
+
+	sin2T := (1 - cosThetaI*cosThetaI) / (eta * eta)
+	if sin2T >= 1 {
+		return 1
+	}
+	cosThetaT := math.Sqrt(1 - sin2T)
+
+	rParallel := (eta*cosThetaI - cosThetaT) / (eta*cosThetaI + cosThetaT)
+	rPerpendicular := (cosThetaI - eta*cosThetaT) / (cosThetaI + eta*cosThetaT)
+	return (rParallel*rParallel + rPerpendicular*rPerpendicular) / 2
+}
+
+// dielectricBoundary is the microfacet bsdf of a rough boundary between dielectrics, as described in
+// "Microfacet Models for Refraction through Rough Surfaces" by Walter et al. 2007.
+// Light is both reflected and transmitted, where the transmitted light is tinted.
+type dielectricBoundary struct {
+	distribution microfacetDistribution
+	// eta is the index of refraction on the other side relative to the side of wo
+	eta  float64
+	tint geo.Vec3
+}
+
+// halfVector returns the microfacet normal that scatters wo into wi, facing the side of wo
+func (r dielectricBoundary) halfVector(wo, wi geo.Vec3) (geo.Vec3, bool) {
+	var h geo.Vec3
+	if wi.Z > 0 {
+		h = wo.Add(wi)
+	} else {
+		h = wo.Add(wi.MulS(r.eta))
+	}
+	if h.NearZero() {
+		return geo.Vec3{}, false
+	}
+	h = h.Unit()
+	if h.Z < 0 {
+		h = h.Neg()
+	}
+	// Microfacets seen from the back can not scatter light
+	if wo.Dot(h) <= 0 || (wi.Z > 0 && wi.Dot(h) <= 0) || (wi.Z < 0 && wi.Dot(h) >= 0) {
+		return geo.Vec3{}, false
+	}
+	return h, true
+}
+
+func (r dielectricBoundary) eval(wo, wi geo.Vec3) geo.Vec3 {
+	if wo.Z <= 0 || wi.Z == 0 {
+		return geo.ZeroVector
+	}
+	h, ok := r.halfVector(wo, wi)
+	if !ok {
+		return geo.ZeroVector
+	}
+
+	d := r.distribution.d(h)
+	gv := g(r.distribution, wo, wi)
+	f := dielectricFresnel(wo.Dot(h), r.eta)
+
+	if wi.Z > 0 {
+		v := d * gv * f / (4 * wo.Z)
+		return geo.NewVec3(v, v, v)
+	}
+
+	// The scaling of radiance by eta squared when entering and leaving the medium cancels out, so it is left out
+	denom := wo.Dot(h) + r.eta*wi.Dot(h)
+	v := (1 - f) * d * gv * math.Abs(wi.Dot(h)) * wo.Dot(h) / (wo.Z * denom * denom)
+	return r.tint.MulS(v)
+}
+
+func (r dielectricBoundary) pdf(wo, wi geo.Vec3) float64 {
+	if wo.Z <= 0 || wi.Z == 0 {
+		return 0
+	}
+	h, ok := r.halfVector(wo, wi)
+	if !ok {
+		return 0
+	}
+
+	normalPdf := r.distribution.normalPdf(wo, h)
+	f := dielectricFresnel(wo.Dot(h), r.eta)
+
+	if wi.Z > 0 {
+		return f * normalPdf / (4 * wo.Dot(h))
+	}
+	denom := wo.Dot(h) + r.eta*wi.Dot(h)
+	return (1 - f) * normalPdf * r.eta * r.eta * math.Abs(wi.Dot(h)) / (denom * denom)
+}
+
+// sample returns a reflected or refracted direction, chosen by the fresnel reflectance.
+// Returns the zero vector if the direction ends up on the wrong side of the surface
+func (r dielectricBoundary) sample(wo geo.Vec3, u1, u2, u3 float64) geo.Vec3 {
+	h := r.distribution.sampleNormal(wo, u1, u2)
+	if wo.Dot(h) <= 0 {
+		return geo.ZeroVector
+	}
+
+	wi, ok := refract(wo, h, r.eta)
+	if !ok || u3 < dielectricFresnel(wo.Dot(h), r.eta) {
+		wi = reflect(wo, h)
+		if wi.Z <= 0 {
+			return geo.ZeroVector
+		}
+		return wi
+	}
+
+	if wi.Z >= 0 {
+		return geo.ZeroVector
+	}
+	return wi
+}
@@ -0,0 +1,279 @@
+package material
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// PrincipledConfig is the parameters of a principled material. The parameters are in the range 0 to 1,
+// except for the index of refraction. Each parameter can be given a texture, that is multiplied
+// with the parameter value. The texture of a single valued parameter uses the red channel.
+type PrincipledConfig struct {
+	// BaseColor is the diffuse color of dielectrics and the reflectance of metals, defaults to white
+	BaseColor Texture
+	// Metallic blends between a dielectric and a metal
+	Metallic        float64
+	MetallicTexture Texture
+	// Roughness of the specular reflection and transmission, where 0 is a perfect mirror
+	Roughness        float64
+	RoughnessTexture Texture
+	// Specular is the amount of specular reflection of dielectrics, where 0.5 is
+	// the reflectance of an index of refraction of 1.5
+	Specular        float64
+	SpecularTexture Texture
+	// Clearcoat is a second specular layer on top of the material, like a varnish
+	Clearcoat          float64
+	ClearcoatTexture   Texture
+	ClearcoatRoughness float64
+	// Sheen is an extra reflection at grazing angles, for cloth like materials
+	Sheen        float64
+	SheenTexture Texture
+	// SheenTint blends the sheen color from white to the base color
+	SheenTint float64
+	// Transmission blends between an opaque dielectric and a transparent one
+	Transmission        float64
+	TransmissionTexture Texture
+	// IndexOfRefraction of the transparent part of the material, defaults to 1.5
+	IndexOfRefraction float64
+}
+
+// principled is a material based on the Disney principled BSDF, that combines diffuse,
+// metallic, specular, clearcoat, sheen and transmission in one material
+type principled struct {
+	NonLightEmittingMaterial
+	config PrincipledConfig
+}
+
+// NewPrincipled creates a principled material
+func NewPrincipled(config PrincipledConfig) Material {
+	if config.BaseColor == nil {
+		config.BaseColor = NewSolidColor(1, 1, 1)
+	}
+	if config.IndexOfRefraction <= 0 {
+		config.IndexOfRefraction = 1.5
+	}
+	return principled{config: config}
+}
+
+// Scatter creates the bsdf of the material at the hit point
+func (m principled) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
+	c := m.config
+	baseColor := c.BaseColor.Color(rec)
+	metallic := clamp01(textureValue(c.Metallic, c.MetallicTexture, rec))
+	roughness := clamp01(textureValue(c.Roughness, c.RoughnessTexture, rec))
+	specular := math.Max(0, textureValue(c.Specular, c.SpecularTexture, rec))
+	clearcoat := math.Max(0, textureValue(c.Clearcoat, c.ClearcoatTexture, rec))
+	sheen := math.Max(0, textureValue(c.Sheen, c.SheenTexture, rec))
+	transmission := clamp01(textureValue(c.Transmission, c.TransmissionTexture, rec))
+
+	frame, wo := shadingFrame(rayIn, rec)
+
+	eta := c.IndexOfRefraction
+	if !rec.FrontFace {
+		eta = 1 / eta
+	}
+
+	b := principledBsdf{
+		frame:          frame,
+		wo:             wo,
+		baseColor:      baseColor,
+		roughness:      roughness,
+		specular:       newGgx(roughness),
+		f0:             lerpVec3(geo.NewVec3(1, 1, 1).MulS(.08*specular), baseColor, metallic),
+		sheenColor:     lerpVec3(geo.NewVec3(1, 1, 1), baseColor, c.SheenTint).MulS(sheen),
+		clearcoatAlpha: math.Max(c.ClearcoatRoughness*c.ClearcoatRoughness, minMicrofacetAlpha),
+		clearcoat:      clearcoat,
+		transmission: dielectricBoundary{
+			distribution: newGgx(roughness),
+			eta:          eta,
+			tint:         baseColor,
+		},
+		diffuseWeight:      (1 - metallic) * (1 - transmission),
+		specularWeight:     1 - (1-metallic)*transmission,
+		transmissionWeight: (1 - metallic) * transmission,
+	}
+	b.initSampleWeights()
+
+	return true, ScatterRecord{
+		Attenuation: baseColor,
+		Bsdf:        b,
+	}
+}
+
+// ScatteringPdf is not used, as the scatter record has a bsdf
+func (m principled) ScatteringPdf(rec *HitRecord, scattered geo.Ray) float64 {
+	return 0
+}
+
+// principledBsdf is the principled material evaluated at a hit point.
+// Directions are in the local frame of the normal.
+type principledBsdf struct {
+	frame     geo.Onb
+	wo        geo.Vec3
+	baseColor geo.Vec3
+	roughness float64
+	specular  ggx
+	// f0 is the specular reflectance at normal incidence
+	f0                 geo.Vec3
+	sheenColor         geo.Vec3
+	clearcoat          float64
+	clearcoatAlpha     float64
+	transmission       dielectricBoundary
+	diffuseWeight      float64
+	specularWeight     float64
+	transmissionWeight float64
+	// Probabilities of sampling the diffuse, specular, clearcoat and transmission lobes
+	sampleWeights [4]float64
+}
+
+// Clearcoat uses a fixed roughness for masking, as in the Disney BSDF
+var clearcoatMasking = ggx{alpha: .25}
+
+// initSampleWeights sets the probabilities of sampling each lobe from an estimate of how much light they scatter
+func (b *principledBsdf) initSampleWeights() {
+	weights := [4]float64{
+		b.diffuseWeight,
+		b.specularWeight * math.Max(schlickFresnel(b.f0, b.wo.Z).Luminance(), .05),
+		.25 * b.clearcoat * (.04 + .96*schlickWeight(b.wo.Z)),
+		b.transmissionWeight,
+	}
+
+	sum := 0.
+	for _, w := range weights {
+		sum += w
+	}
+	for i := range weights {
+		b.sampleWeights[i] = weights[i] / sum
+	}
+}
+
+// Eval returns the sum of the lobes for the scattered direction
+func (b principledBsdf) Eval(direction geo.Vec3) geo.Vec3 {
+	wo := b.wo
+	wi := b.frame.Coordinates(direction.Unit())
+
+	ret := geo.ZeroVector
+	if b.transmissionWeight > 0 {
+		ret = b.transmission.eval(wo, wi).MulS(b.transmissionWeight)
+	}
+	if wi.Z <= 0 {
+		return ret
+	}
+
+	h := wo.Add(wi).Unit()
+	cosD := wi.Dot(h)
+
+	if b.diffuseWeight > 0 {
+		// Burley diffuse, with retro reflection at grazing angles for rough surfaces
+		fd90 := .5 + 2*b.roughness*cosD*cosD
+		fd := (1 + (fd90-1)*schlickWeight(wi.Z)) * (1 + (fd90-1)*schlickWeight(wo.Z))
+		diffuse := b.baseColor.MulS(fd / math.Pi)
+		sheen := b.sheenColor.MulS(schlickWeight(cosD))
+		ret = ret.Add(diffuse.Add(sheen).MulS(b.diffuseWeight * wi.Z))
+	}
+
+	if b.specularWeight > 0 {
+		f := schlickFresnel(b.f0, cosD)
+		v := b.specular.d(h) * g(b.specular, wo, wi) / (4 * wo.Z)
+		ret = ret.Add(f.MulS(v * b.specularWeight))
+	}
+
+	if b.clearcoat > 0 {
+		f := .04 + .96*schlickWeight(cosD)
+		v := .25 * b.clearcoat * f * gtr1(h.Z, b.clearcoatAlpha) * g(clearcoatMasking, wo, wi) / (4 * wo.Z)
+		ret = ret.Add(geo.NewVec3(v, v, v))
+	}
+
+	return ret
+}
+
+// Value returns the pdf of sampling the direction, which is the weighted sum of the lobe pdfs
+func (b principledBsdf) Value(direction geo.Vec3) float64 {
+	wo := b.wo
+	wi := b.frame.Coordinates(direction.Unit())
+
+	ret := 0.
+	if b.sampleWeights[3] > 0 {
+		ret += b.sampleWeights[3] * b.transmission.pdf(wo, wi)
+	}
+	if wi.Z <= 0 {
+		return ret
+	}
+
+	h := wo.Add(wi).Unit()
+	ret += b.sampleWeights[0] * wi.Z / math.Pi
+	ret += b.sampleWeights[1] * b.specular.normalPdf(wo, h) / (4 * wo.Dot(h))
+	ret += b.sampleWeights[2] * gtr1(h.Z, b.clearcoatAlpha) * h.Z / (4 * wo.Dot(h))
+	return ret
+}
+
+// Generate samples a direction from one of the lobes
+func (b principledBsdf) Generate(rng *random.Rng) geo.Vec3 {
+	u := rng.NormalFloat()
+	u1 := rng.NormalFloat()
+	u2 := rng.NormalFloat()
+
+	var wi geo.Vec3
+	switch {
+	case u < b.sampleWeights[0]:
+		wi = geo.RandomCosineDirection(rng)
+	case u < b.sampleWeights[0]+b.sampleWeights[1]:
+		wi = reflect(b.wo, b.specular.sampleNormal(b.wo, u1, u2))
+	case u < b.sampleWeights[0]+b.sampleWeights[1]+b.sampleWeights[2]:
+		wi = reflect(b.wo, sampleGtr1(b.clearcoatAlpha, u1, u2))
+	default:
+		wi = b.transmission.sample(b.wo, u1, u2, rng.NormalFloat())
+		if wi == geo.ZeroVector {
+			return wi
+		}
+		return b.frame.Local(wi)
+	}
+
+	if wi.Z <= 0 {
+		return geo.ZeroVector
+	}
+	return b.frame.Local(wi)
+}
+
+// gtr1 is the generalized Trowbridge-Reitz distribution with exponent 1, used for the clearcoat
+func gtr1(cosTheta, alpha float64) float64 {
+	if cosTheta <= 0 {
+		return 0
+	}
+	if alpha >= 1 {
+		return 1 / math.Pi
+	}
+	a2 := alpha * alpha
+	t := 1 + (a2-1)*cosTheta*cosTheta
+	return (a2 - 1) / (math.Pi * math.Log(a2) * t)
+}
+
+// sampleGtr1 samples a normal proportional to gtr1 times the cosine of the normal
+func sampleGtr1(alpha, u1, u2 float64) geo.Vec3 {
+	cosTheta := math.Sqrt(1 - u1)
+	if alpha < 1 {
+		a2 := alpha * alpha
+		cosTheta = math.Sqrt(math.Max(0, (1-math.Pow(a2, 1-u1))/(1-a2)))
+	}
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u2
+	return geo.NewVec3(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta)
+}
+
+// textureValue returns the value multiplied with the red channel of the texture, if there is one
+func textureValue(value float64, tex Texture, rec *HitRecord) float64 {
+	if tex == nil {
+		return value
+	}
+	return value * tex.Color(rec).X
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(v, 1))
+}
+
+func lerpVec3(a, b geo.Vec3, t float64) geo.Vec3 {
+	return a.MulS(1 - t).Add(b.MulS(t))
+}
@@ -0,0 +1,172 @@
+package material
+
+import (
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// ComplexIor is the complex index of refraction eta + ik of a conductor, for each color channel
+type ComplexIor struct {
+	Eta geo.Vec3
+	K   geo.Vec3
+}
+
+// Measured indices of refraction of common metals, at the wavelengths 650, 550 and 450 nm
+var (
+	IorGold      = ComplexIor{Eta: geo.NewVec3(.143, .374, 1.442), K: geo.NewVec3(3.983, 2.385, 1.603)}
+	IorCopper    = ComplexIor{Eta: geo.NewVec3(.200, .924, 1.102), K: geo.NewVec3(3.912, 2.452, 2.142)}
+	IorAluminium = ComplexIor{Eta: geo.NewVec3(1.657, .880, .521), K: geo.NewVec3(9.224, 6.270, 4.837)}
+	IorSilver    = ComplexIor{Eta: geo.NewVec3(.155, .117, .138), K: geo.NewVec3(4.828, 3.122, 2.147)}
+)
+
+// roughConductor is a metal with a microfacet surface
+type roughConductor struct {
+	NonLightEmittingMaterial
+	NonPdfGeneratingMaterial
+	tex          Texture
+	ior          ComplexIor
+	roughness    float64
+	distribution MicrofacetDistribution
+}
+
+// NewRoughConductor creates a metal material with a microfacet surface. The reflectance is given
+// by the complex index of refraction, and multiplied with the texture.
+// A roughness of 0 gives a mirror and 1 a very rough surface.
+func NewRoughConductor(tex Texture, ior ComplexIor, roughness float64, distribution MicrofacetDistribution) Material {
+	return roughConductor{
+		tex:          tex,
+		ior:          ior,
+		roughness:    roughness,
+		distribution: distribution,
+	}
+}
+
+// Scatter creates the bsdf of the conductor at the hit point
+func (m roughConductor) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
+	frame, wo := shadingFrame(rayIn, rec)
+	tint := m.tex.Color(rec)
+
+	return true, ScatterRecord{
+		Attenuation: tint,
+		Bsdf: conductorBsdf{
+			frame:        frame,
+			wo:           wo,
+			tint:         tint,
+			ior:          m.ior,
+			distribution: newMicrofacetDistribution(m.distribution, m.roughness),
+		},
+	}
+}
+
+// conductorBsdf is a rough conductor evaluated at a hit point.
+// Directions are in the local frame of the normal.
+type conductorBsdf struct {
+	frame        geo.Onb
+	wo           geo.Vec3
+	tint         geo.Vec3
+	ior          ComplexIor
+	distribution microfacetDistribution
+}
+
+func (b conductorBsdf) Eval(direction geo.Vec3) geo.Vec3 {
+	wi := b.frame.Coordinates(direction.Unit())
+	if wi.Z <= 0 {
+		return geo.ZeroVector
+	}
+
+	h := b.wo.Add(wi).Unit()
+	f := conductorFresnel(b.wo.Dot(h), b.ior)
+	v := b.distribution.d(h) * g(b.distribution, b.wo, wi) / (4 * b.wo.Z)
+	return f.Mul(b.tint).MulS(v)
+}
+
+func (b conductorBsdf) Value(direction geo.Vec3) float64 {
+	wi := b.frame.Coordinates(direction.Unit())
+	if wi.Z <= 0 {
+		return 0
+	}
+
+	h := b.wo.Add(wi).Unit()
+	if b.wo.Dot(h) <= 0 {
+		return 0
+	}
+	return b.distribution.normalPdf(b.wo, h) / (4 * b.wo.Dot(h))
+}
+
+func (b conductorBsdf) Generate(rng *random.Rng) geo.Vec3 {
+	h := b.distribution.sampleNormal(b.wo, rng.NormalFloat(), rng.NormalFloat())
+	wi := reflect(b.wo, h)
+	if b.wo.Dot(h) <= 0 || wi.Z <= 0 {
+		return geo.ZeroVector
+	}
+	return b.frame.Local(wi)
+}
+
+// roughDielectric is a transparent material with a microfacet surface, like frosted glass
+type roughDielectric struct {
+	NonLightEmittingMaterial
+	NonPdfGeneratingMaterial
+	tex               Texture
+	indexOfRefraction float64
+	roughness         float64
+	distribution      MicrofacetDistribution
+}
+
+// NewRoughDielectric creates a transparent material with a microfacet surface.
+// The transmitted light is tinted by the texture.
+// A roughness of 0 gives a smooth surface and 1 a very rough surface.
+func NewRoughDielectric(tex Texture, indexOfRefraction, roughness float64, distribution MicrofacetDistribution) Material {
+	return roughDielectric{
+		tex:               tex,
+		indexOfRefraction: indexOfRefraction,
+		roughness:         roughness,
+		distribution:      distribution,
+	}
+}
+
+// Scatter creates the bsdf of the dielectric at the hit point
+func (m roughDielectric) Scatter(rayIn geo.Ray, rec *HitRecord, rng *random.Rng) (bool, ScatterRecord) {
+	frame, wo := shadingFrame(rayIn, rec)
+	tint := m.tex.Color(rec)
+
+	eta := m.indexOfRefraction
+	if !rec.FrontFace {
+		eta = 1 / eta
+	}
+
+	return true, ScatterRecord{
+		Attenuation: tint,
+		Bsdf: dielectricBsdf{
+			frame: frame,
+			wo:    wo,
+			boundary: dielectricBoundary{
+				distribution: newMicrofacetDistribution(m.distribution, m.roughness),
+				eta:          eta,
+				tint:         tint,
+			},
+		},
+	}
+}
+
+// dielectricBsdf is a rough dielectric evaluated at a hit point
+type dielectricBsdf struct {
+	frame    geo.Onb
+	wo       geo.Vec3
+	boundary dielectricBoundary
+}
+
+func (b dielectricBsdf) Eval(direction geo.Vec3) geo.Vec3 {
+	return b.boundary.eval(b.wo, b.frame.Coordinates(direction.Unit()))
+}
+
+func (b dielectricBsdf) Value(direction geo.Vec3) float64 {
+	return b.boundary.pdf(b.wo, b.frame.Coordinates(direction.Unit()))
+}
+
+func (b dielectricBsdf) Generate(rng *random.Rng) geo.Vec3 {
+	wi := b.boundary.sample(b.wo, rng.NormalFloat(), rng.NormalFloat(), rng.NormalFloat())
+	if wi == geo.ZeroVector {
+		return wi
+	}
+	return b.frame.Local(wi)
+}
@@ -34,6 +34,19 @@ func (sc SolidColor) Color(rec *HitRecord) geo.Vec3 {
 	return sc.ColorValue
 }
 
+type vertexColorTexture struct{}
+
+// NewVertexColorTexture creates a texture with the colors at the vertices of the hittable,
+// like in meshes with vertex colors. Hittables without vertex colors are black
+func NewVertexColorTexture() Texture {
+	return vertexColorTexture{}
+}
+
+// Color returns the vertex color of the hit record
+func (vc vertexColorTexture) Color(rec *HitRecord) geo.Vec3 {
+	return rec.VertexColor
+}
+
 type imageTexture struct {
 	image      im.Image
 	mirror     bool
@@ -42,6 +55,15 @@ type imageTexture struct {
 
 // LoadImageTexture creates a texture that uses image data for color by loading the image from the path
 func LoadImageTexture(path string) (Texture, error) {
+	image, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageTexture(image, false), nil
+}
+
+// loadImage reads and decodes the image at the path
+func loadImage(path string) (im.Image, error) {
 	f, err := os.Open(path)
 
 	if err != nil {
@@ -53,8 +75,7 @@ func LoadImageTexture(path string) (Texture, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image texture %v. Got error: %v", path, err.Error())
 	}
-
-	return NewImageTexture(image, false), nil
+	return image, nil
 }
 
 // NewImageTexture creates a texture that uses image data for color
@@ -71,15 +92,59 @@ func NewImageTexture(image im.Image, mirror bool) Texture {
 // Color returns the color in the image data that corresponds to the UV coordinate of the hittable
 // If UV coordinates from hit record is <0 or >1 texture wraps
 func (it imageTexture) Color(rec *HitRecord) geo.Vec3 {
+	x, y := it.pixel(rec)
+	r, g, b, _ := it.image.At(x, y).RGBA()
+	return image.RgbToVec3(r, g, b)
+}
+
+// texelSize returns the size of a pixel in texture coordinates
+func (it imageTexture) texelSize() (float64, float64) {
+	return 1 / math.Max(it.maxX, 1), 1 / math.Max(it.maxY, 1)
+}
+
+// pixel returns the pixel of the image at the UV coordinate of the hittable
+func (it imageTexture) pixel(rec *HitRecord) (int, int) {
 	u := math.Mod(math.Abs(rec.U), 1)
 	if it.mirror {
 		u = 1 - u
 	}
 	v := 1 - math.Mod(math.Abs(rec.V), 1)
 
-	x := int(u * it.maxX)
-	y := int(v * it.maxY)
+	return int(u * it.maxX), int(v * it.maxY)
+}
 
-	r, g, b, _ := it.image.At(x, y).RGBA()
-	return image.RgbToVec3(r, g, b)
+// LoadImageAlphaTexture creates a texture from the alpha channel of the image at the path, for use as
+// an alpha texture. Images without transparency, like masks in jpeg files, use the luminance instead.
+// The alpha is returned as a gray color.
+func LoadImageAlphaTexture(path string) (Texture, error) {
+	image, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageAlphaTexture(image), nil
+}
+
+// NewImageAlphaTexture creates a texture from the alpha channel of the image, for use as an alpha texture.
+// Images without transparency use the luminance instead. The alpha is returned as a gray color.
+func NewImageAlphaTexture(image im.Image) Texture {
+	tex := NewImageTexture(image, false).(imageTexture)
+	opaque, ok := image.(interface{ Opaque() bool })
+	return imageAlphaTexture{tex, !ok || !opaque.Opaque()}
+}
+
+type imageAlphaTexture struct {
+	imageTexture
+	useAlpha bool
+}
+
+// Color returns the alpha in the image data that corresponds to the UV coordinate of the hittable
+func (it imageAlphaTexture) Color(rec *HitRecord) geo.Vec3 {
+	if !it.useAlpha {
+		l := it.imageTexture.Color(rec).Luminance()
+		return geo.NewVec3(l, l, l)
+	}
+	x, y := it.pixel(rec)
+	_, _, _, a := it.image.At(x, y).RGBA()
+	alpha := float64(a) / 0xffff
+	return geo.NewVec3(alpha, alpha, alpha)
 }
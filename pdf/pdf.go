@@ -15,7 +15,7 @@ const (
 // Pdf is the common interface for the probability density functions
 type Pdf interface {
 	Value(direction geo.Vec3) float64
-	Generate() geo.Vec3
+	Generate(rng *random.Rng) geo.Vec3
 }
 
 // CosinePdf is a probability density functions with a cosine distribution
@@ -37,8 +37,8 @@ func (p CosinePdf) Value(direction geo.Vec3) float64 {
 }
 
 // Generate random direction for the CosinePdf shape
-func (p CosinePdf) Generate() geo.Vec3 {
-	return p.uvw.Local(geo.RandomCosineDirection())
+func (p CosinePdf) Generate(rng *random.Rng) geo.Vec3 {
+	return p.uvw.Local(geo.RandomCosineDirection(rng))
 }
 
 // SpherePdf is a probability density functions with a sphere distribution
@@ -55,8 +55,8 @@ func (p SpherePdf) Value(direction geo.Vec3) float64 {
 }
 
 // Generate random direction for the SpherePdf shape
-func (p SpherePdf) Generate() geo.Vec3 {
-	return geo.RandomUnitVector()
+func (p SpherePdf) Generate(rng *random.Rng) geo.Vec3 {
+	return geo.RandomUnitVector(rng)
 }
 
 // MixturePdf is for generating a mixture of two different probability density functions
@@ -81,9 +81,9 @@ func (p MixturePdf) Value(direction geo.Vec3) float64 {
 
 // Generate random direction for the MixturePdf shape.
 // Which is randomly chosen between the two base pdfs.
-func (p MixturePdf) Generate() geo.Vec3 {
-	if random.RandomNormalFloat() < .5 {
-		return p.p0.Generate()
+func (p MixturePdf) Generate(rng *random.Rng) geo.Vec3 {
+	if rng.NormalFloat() < .5 {
+		return p.p0.Generate(rng)
 	}
-	return p.p1.Generate()
+	return p.p1.Generate(rng)
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/DanielPettersson/solstrale/geo"
 	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/DanielPettersson/solstrale/tonemap"
 )
 
 type bloomPostProcessor struct {
@@ -41,6 +42,7 @@ func (b bloomPostProcessor) PostProcess(
 	albedoColors []geo.Vec3,
 	normalColors []geo.Vec3,
 	width, height, numSamples int,
+	toneMapper tonemap.ToneMapper,
 ) (image.Image, error) {
 
 	if b.blurRadius < 0 || b.blurRadius > 1 {
@@ -88,7 +90,7 @@ func (b bloomPostProcessor) PostProcess(
 	// Create output
 	ret := make([]color.RGBA, pixelCount)
 	for i := 0; i < pixelCount; i++ {
-		ret[i] = im.ToRgba(pixelColors[i].Add(workColors[i]), numSamples)
+		ret[i] = im.ToDisplayRgba(pixelColors[i].Add(workColors[i]), numSamples, toneMapper)
 	}
 	img := im.RenderImage{
 		ImageWidth:  width,
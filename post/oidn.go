@@ -11,6 +11,7 @@ import (
 	"github.com/DanielPettersson/solstrale/geo"
 	im "github.com/DanielPettersson/solstrale/internal/image"
 	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/tonemap"
 	"github.com/mdouchement/hdr"
 	"github.com/mdouchement/hdr/codec/pfm"
 )
@@ -43,19 +44,20 @@ func (p oidnPostProcessor) PostProcess(
 	albedoColors []geo.Vec3,
 	normalColors []geo.Vec3,
 	width, height, numSamples int,
+	toneMapper tonemap.ToneMapper,
 ) (image.Image, error) {
 
 	ldrFile, _ := ioutil.TempFile("", "*.pfm")
 	defer os.Remove(ldrFile.Name())
-	pfm.Encode(ldrFile, toHdrImage(pixelColors, width, height, numSamples))
+	pfm.Encode(ldrFile, toHdrImage(pixelColors, width, height, numSamples, toneMapper))
 
 	albFile, _ := ioutil.TempFile("", "*.pfm")
 	defer os.Remove(albFile.Name())
-	pfm.Encode(albFile, toHdrImage(albedoColors, width, height, numSamples))
+	pfm.Encode(albFile, toHdrImage(albedoColors, width, height, numSamples, nil))
 
 	nrmFile, _ := ioutil.TempFile("", "*.pfm")
 	defer os.Remove(nrmFile.Name())
-	pfm.Encode(nrmFile, toHdrImage(normalColors, width, height, numSamples))
+	pfm.Encode(nrmFile, toHdrImage(normalColors, width, height, numSamples, nil))
 
 	outFile, _ := ioutil.TempFile("", "*.pfm")
 	defer os.Remove(outFile.Name())
@@ -80,21 +82,10 @@ func (p oidnPostProcessor) PostProcess(
 	return image, nil
 }
 
-func toHdrImage(pixels []geo.Vec3, width, height, numSamples int) hdr.Image {
-	pixelData := make([]float64, len(pixels)*3)
+func toHdrImage(pixels []geo.Vec3, width, height, numSamples int, toneMapper tonemap.ToneMapper) hdr.Image {
+	floatPixels := make([]geo.Vec3, len(pixels))
 	for i := 0; i < len(pixels); i++ {
-		pix := im.ToFloat(pixels[i], numSamples)
-		pixelData[i*3] = pix.X
-		pixelData[i*3+1] = pix.Y
-		pixelData[i*3+2] = pix.Z
-	}
-
-	return &hdr.RGB64{
-		Pix:    pixelData,
-		Stride: 3 * width,
-		Rect: image.Rectangle{
-			Min: image.Point{X: 0, Y: 0},
-			Max: image.Point{X: width, Y: height},
-		},
+		floatPixels[i] = im.ToDisplayFloat(pixels[i], numSamples, toneMapper)
 	}
+	return im.ToHdrImage(floatPixels, width, height)
 }
@@ -5,14 +5,18 @@ import (
 	"image"
 
 	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/tonemap"
 )
 
-// PostProcessor is responsible for taking the rendered image and transforming it
+// PostProcessor is responsible for taking the rendered image and transforming it.
+// The tone mapper should be used when converting the colors to the output image,
+// it can be nil for the default conversion.
 type PostProcessor interface {
 	PostProcess(
 		pixelColors []geo.Vec3,
 		albedoColors []geo.Vec3,
 		normalColors []geo.Vec3,
 		width, height, numSamples int,
+		toneMapper tonemap.ToneMapper,
 	) (image.Image, error)
 }
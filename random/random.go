@@ -1,5 +1,7 @@
-// Package random provides a random number generator to be used by ray tracer.
-// Currently is using https://github.com/valyala/fastrand, for a good enough random that is really fast.
+// Package random provides random number generators to be used by ray tracer.
+// The ray tracer uses the seedable Rng, so that renders are reproducible.
+// The package level functions are using https://github.com/valyala/fastrand,
+// for a good enough random that is really fast, but that can not be seeded.
 package random
 
 import (
@@ -8,6 +10,73 @@ import (
 	"github.com/valyala/fastrand"
 )
 
+const (
+	pcgMultiplier uint64 = 6364136223846793005
+	pcgIncrement  uint64 = 1442695040888963407
+)
+
+// Rng is a seedable pseudo random number generator using the PCG32 algorithm.
+// It is not safe for concurrent use, so each goroutine should have its own Rng.
+type Rng struct {
+	state uint64
+}
+
+// NewRng creates a new random number generator with the given seed
+func NewRng(seed uint64) *Rng {
+	r := &Rng{}
+	r.Seed(seed)
+	return r
+}
+
+// Seed resets the random number generator so that it produces the sequence given by the seed
+func (r *Rng) Seed(seed uint64) {
+	r.state = 0
+	r.Uint32()
+	r.state += seed
+	r.Uint32()
+}
+
+// Uint32 returns a random uint32
+func (r *Rng) Uint32() uint32 {
+	old := r.state
+	r.state = old*pcgMultiplier + pcgIncrement
+	xorShifted := uint32(((old >> 18) ^ old) >> 27)
+	rot := uint32(old >> 59)
+	return (xorShifted >> rot) | (xorShifted << ((-rot) & 31))
+}
+
+// NormalFloat returns a random float 0 to <1
+func (r *Rng) NormalFloat() float64 {
+	return float64(r.Uint32()) / (1 << 32)
+}
+
+// Float returns a random float min to <max
+func (r *Rng) Float(min float64, max float64) float64 {
+	return r.NormalFloat()*(max-min) + min
+}
+
+// Uint32n returns a random uint32 0 to <max
+func (r *Rng) Uint32n(max uint32) uint32 {
+	return uint32((uint64(r.Uint32()) * uint64(max)) >> 32)
+}
+
+// MixSeed combines a seed with the given values into a new well distributed seed.
+// Used for giving each pixel sample its own independent random sequence.
+func MixSeed(seed uint64, values ...uint64) uint64 {
+	h := seed
+	for _, v := range values {
+		h = splitMix64(h ^ splitMix64(v))
+	}
+	return h
+}
+
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
 // RandomNormalFloat returns a random float 0 to <1
 func RandomNormalFloat() float64 {
 	return float64(fastrand.Uint32()) / float64(math.MaxUint32)
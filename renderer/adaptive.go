@@ -0,0 +1,61 @@
+package renderer
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+const (
+	defaultAdaptiveMinSamples     = 16
+	defaultAdaptiveNoiseThreshold = .05
+	// Pixels darker than this use the absolute standard error, as the relative error
+	// of almost black pixels can be large even though the noise is not visible
+	adaptiveMinLuminance = .1
+)
+
+// adaptiveSampler decides when a pixel has converged and can stop taking samples
+type adaptiveSampler struct {
+	minSamples     int
+	noiseThreshold float64
+}
+
+// newAdaptiveSampler creates an adaptive sampler from the config,
+// or returns nil if adaptive sampling is not enabled
+func newAdaptiveSampler(config *AdaptiveConfig) *adaptiveSampler {
+	if config == nil {
+		return nil
+	}
+
+	minSamples := config.MinSamples
+	if minSamples <= 0 {
+		minSamples = defaultAdaptiveMinSamples
+	}
+	// At least two samples are needed to estimate the variance
+	if minSamples < 2 {
+		minSamples = 2
+	}
+	noiseThreshold := config.NoiseThreshold
+	if noiseThreshold <= 0 {
+		noiseThreshold = defaultAdaptiveNoiseThreshold
+	}
+
+	return &adaptiveSampler{
+		minSamples:     minSamples,
+		noiseThreshold: noiseThreshold,
+	}
+}
+
+// isConverged checks if the standard error of the mean luminance of the pixel samples is below the threshold
+func (a *adaptiveSampler) isConverged(colorSum geo.Vec3, luminanceSqSum float64, samples int) bool {
+	if samples < a.minSamples {
+		return false
+	}
+
+	n := float64(samples)
+	mean := colorSum.Luminance() / n
+	variance := math.Max(0, (luminanceSqSum/n-mean*mean)*n/(n-1))
+	standardError := math.Sqrt(variance / n)
+
+	return standardError/math.Max(mean, adaptiveMinLuminance) <= a.noiseThreshold
+}
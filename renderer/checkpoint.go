@@ -0,0 +1,147 @@
+package renderer
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+const (
+	checkpointVersion         = 1
+	defaultCheckpointInterval = 5 * time.Minute
+)
+
+// checkpoint is the state of a render saved to file. Only the sums of the
+// samples are saved, everything else can be recreated from the scene
+type checkpoint struct {
+	Version         int
+	SceneHash       string
+	Seed            uint64
+	Width           int
+	Height          int
+	PixelColors     []geo.Vec3
+	AlbedoColors    []geo.Vec3
+	NormalColors    []geo.Vec3
+	SampleCounts    []int
+	LuminanceSqSums []float64
+}
+
+// isCheckpointDue checks if it is time to save a checkpoint
+func (r *Renderer) isCheckpointDue() bool {
+	c := r.scene.RenderConfig.Checkpoint
+	if c == nil {
+		return false
+	}
+
+	interval := c.Interval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	return time.Since(r.lastCheckpoint) >= interval
+}
+
+// saveCheckpoint saves the frame to the checkpoint file, if checkpoints are enabled.
+// Must only be called when no workers are rendering to the frame.
+func (r *Renderer) saveCheckpoint(f *frame) error {
+	c := r.scene.RenderConfig.Checkpoint
+	if c == nil {
+		return nil
+	}
+	r.lastCheckpoint = time.Now()
+
+	// Write to a temporary file first, so that a crash while saving does not destroy the previous checkpoint
+	tmpPath := c.Path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to save checkpoint: %v", err.Error()))
+	}
+
+	err = gob.NewEncoder(file).Encode(checkpoint{
+		Version:         checkpointVersion,
+		SceneHash:       c.SceneHash,
+		Seed:            r.scene.RenderConfig.Seed,
+		Width:           f.width,
+		Height:          f.height,
+		PixelColors:     f.pixelColors,
+		AlbedoColors:    f.albedoColors,
+		NormalColors:    f.normalColors,
+		SampleCounts:    f.sampleCounts,
+		LuminanceSqSums: f.luminanceSqSums,
+	})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, c.Path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.New(fmt.Sprintf("Failed to save checkpoint: %v", err.Error()))
+	}
+	return nil
+}
+
+// resumeCheckpoint loads the checkpoint file into the frame, if resuming is enabled and the file exists
+func (r *Renderer) resumeCheckpoint(f *frame) error {
+	c := r.scene.RenderConfig.Checkpoint
+	if c == nil || !c.Resume {
+		return nil
+	}
+
+	file, err := os.Open(c.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to read checkpoint: %v", err.Error()))
+	}
+	defer file.Close()
+
+	var cp checkpoint
+	if err := gob.NewDecoder(file).Decode(&cp); err != nil {
+		return errors.New(fmt.Sprintf("Failed to read checkpoint: %v", err.Error()))
+	}
+
+	if cp.Version != checkpointVersion {
+		return errors.New(fmt.Sprintf("Unsupported checkpoint version %v", cp.Version))
+	}
+	if cp.SceneHash != c.SceneHash {
+		return errors.New("Checkpoint is for a different scene")
+	}
+	if cp.Seed != r.scene.RenderConfig.Seed {
+		return errors.New(fmt.Sprintf("Checkpoint has seed %v, but the render has seed %v", cp.Seed, r.scene.RenderConfig.Seed))
+	}
+	if cp.Width != f.width || cp.Height != f.height {
+		return errors.New(fmt.Sprintf("Checkpoint has image size %vx%v, but the render has %vx%v", cp.Width, cp.Height, f.width, f.height))
+	}
+	pixelCount := f.width * f.height
+	for _, n := range []int{len(cp.PixelColors), len(cp.AlbedoColors), len(cp.NormalColors), len(cp.SampleCounts), len(cp.LuminanceSqSums)} {
+		if n != pixelCount {
+			return errors.New(fmt.Sprintf("Checkpoint has %v pixels, expected %v", n, pixelCount))
+		}
+	}
+
+	f.pixelColors = cp.PixelColors
+	f.albedoColors = cp.AlbedoColors
+	f.normalColors = cp.NormalColors
+	f.sampleCounts = cp.SampleCounts
+	f.luminanceSqSums = cp.LuminanceSqSums
+
+	// Convergence depends on the adaptive config of the resumed render, which can differ from the saved one
+	renderedSamples := 0
+	for i, n := range f.sampleCounts {
+		renderedSamples += n
+		if r.adaptive != nil && r.adaptive.isConverged(f.pixelColors[i], f.luminanceSqSums[i], n) {
+			f.converged[i] = true
+			f.convergedCount.Add(1)
+		}
+	}
+	f.renderedSamples.Store(int64(renderedSamples))
+
+	return nil
+}
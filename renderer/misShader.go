@@ -0,0 +1,133 @@
+package renderer
+
+import (
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/pdf"
+	"github.com/DanielPettersson/solstrale/random"
+)
+
+// MisPathTracingShader is a path tracing shader that at each bounce both samples a light with a shadow ray
+// and samples the material, and combines the two with multiple importance sampling. This converges faster
+// than PathTracingShader for small lights and glossy materials.
+type MisPathTracingShader struct {
+	MaxDepth int
+	// MaxSampleValue clamps the color channels of each sample, suppressing
+	// fireflies at the cost of some intensity. Zero gives the default of 3,
+	// a negative value disables the clamping.
+	MaxSampleValue float64
+	// RussianRouletteDepth is the depth from where paths are randomly terminated, with a probability
+	// that increases as less light is carried by the path. Zero disables the termination.
+	RussianRouletteDepth int
+}
+
+// Shade calculates the color by tracing the whole path from the hit
+func (mts MisPathTracingShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, rng *random.Rng) geo.Vec3 {
+	color := geo.ZeroVector
+	throughput := geo.NewVec3(1, 1, 1)
+	// Emission of the first hit is not sampled by any light sample
+	emissionWeight := 1.
+
+	for ; depth < mts.MaxDepth; depth++ {
+		color = color.Add(throughput.Mul(rec.Material.Emitted(rec)).MulS(emissionWeight))
+
+		scatter, scatterRecord := rec.Material.Scatter(ray, rec, rng)
+		if !scatter {
+			break
+		}
+
+		if scatterRecord.SkipPdf {
+			if leaksLight(rec, scatterRecord.SkipPdfRay.Direction) {
+				break
+			}
+			// The material can not be light sampled, so all emission found by the scattered ray is counted
+			throughput = throughput.Mul(scatterRecord.Attenuation)
+			ray = scatterRecord.SkipPdfRay
+			emissionWeight = 1
+		} else {
+			bsdfPdf := materialPdf(scatterRecord)
+			lightPdf := renderer.lightPdf(rec.HitPoint)
+
+			// The lights of the scene can only be found by shadow rays
+			color = color.Add(throughput.Mul(renderer.directLight(rec, scatterRecord, ray.Time, rng)))
+
+			// Light sample, where the emission is found by a shadow ray
+			if lightPdf != nil {
+				color = color.Add(throughput.Mul(mts.sampleLight(renderer, rec, scatterRecord, lightPdf, ray.Time, rng)))
+			}
+
+			// Material sample, that continues the path
+			direction := bsdfPdf.Generate(rng)
+			if direction == geo.ZeroVector {
+				break
+			}
+			scattered := geo.NewRay(rec.HitPoint, direction, ray.Time)
+			bsdfPdfVal := bsdfPdf.Value(direction)
+			if bsdfPdfVal <= 0 {
+				break
+			}
+			throughput = throughput.Mul(scattering(rec, scatterRecord, scattered)).DivS(bsdfPdfVal)
+			ray = scattered
+			emissionWeight = 1
+			if lightPdf != nil {
+				emissionWeight = powerHeuristic(bsdfPdfVal, lightPdf.Value(direction))
+			}
+		}
+
+		if throughput == geo.ZeroVector {
+			break
+		}
+		survive, probability := russianRoulette(mts.RussianRouletteDepth, depth+1, throughput, rng)
+		if !survive {
+			break
+		}
+		throughput = throughput.DivS(probability)
+
+		var hit bool
+		hit, rec = renderer.hit(ray, rng)
+		if !hit {
+			color = color.Add(throughput.Mul(renderer.background(ray)).MulS(emissionWeight))
+			break
+		}
+	}
+
+	return filterInvalidColorValues(color, maxSampleValue(mts.MaxSampleValue))
+}
+
+// sampleLight returns the emission found by a shadow ray in a direction sampled from the light pdf,
+// that is scattered at the hit towards the incoming ray
+func (mts MisPathTracingShader) sampleLight(renderer *Renderer, rec *material.HitRecord, scatterRecord material.ScatterRecord, lightPdf pdf.Pdf, time float64, rng *random.Rng) geo.Vec3 {
+	direction := lightPdf.Generate(rng)
+	if direction == geo.ZeroVector {
+		return geo.ZeroVector
+	}
+	lightPdfVal := lightPdf.Value(direction)
+	if lightPdfVal <= 0 {
+		return geo.ZeroVector
+	}
+
+	lightRay := geo.NewRay(rec.HitPoint, direction, time)
+	emitted := geo.ZeroVector
+	if hit, lightRec := renderer.hit(lightRay, rng); hit {
+		emitted = lightRec.Material.Emitted(lightRec)
+	} else if renderer.scene.Environment != nil {
+		emitted = renderer.scene.Environment.Color(direction)
+	}
+	if emitted == geo.ZeroVector {
+		return geo.ZeroVector
+	}
+
+	weight := powerHeuristic(lightPdfVal, materialPdf(scatterRecord).Value(direction))
+	return scattering(rec, scatterRecord, lightRay).Mul(emitted).MulS(weight / lightPdfVal)
+}
+
+// powerHeuristic is the weight of a sample from a technique with pdf value f,
+// when combined with a technique with pdf value g
+func powerHeuristic(f, g float64) float64 {
+	f2 := f * f
+	g2 := g * g
+	if f2+g2 == 0 {
+		return 0
+	}
+	return f2 / (f2 + g2)
+}
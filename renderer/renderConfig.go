@@ -2,31 +2,159 @@ package renderer
 
 import (
 	"image"
+	"time"
 
 	"github.com/DanielPettersson/solstrale/camera"
+	"github.com/DanielPettersson/solstrale/environment"
 	"github.com/DanielPettersson/solstrale/geo"
 	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/light"
 	"github.com/DanielPettersson/solstrale/post"
+	"github.com/DanielPettersson/solstrale/tonemap"
 )
 
 // RenderConfig is input to the ray tracer for how the image should be rendered
 type RenderConfig struct {
+	// SamplesPerPixel is the number of samples rendered for each pixel.
+	// With adaptive sampling it is the max number of samples for a pixel
 	SamplesPerPixel int
 	Shader          Shader
 	PostProcessor   post.PostProcessor
+	// Seed for the random numbers used by the ray tracer.
+	// Rendering the same scene with the same seed gives identical output
+	Seed uint64
+	// SampleOffset is added to the number of each sample when seeding its random numbers.
+	// Renders with the same seed and non overlapping sample ranges give independent samples
+	// of the same image, that can be merged into one image with more samples
+	SampleOffset int
+	// ToneMapper converts the linear colors of the render to the output image.
+	// If nil, colors are clamped and gamma corrected with gamma 2
+	ToneMapper tonemap.ToneMapper
+	// Tiles enables rendering of the image in tiles, with progress reported for each tile.
+	// If nil, the whole image is rendered line by line, one sample at a time
+	Tiles *TileConfig
+	// Adaptive enables adaptive sampling, where pixels stop taking samples when they have converged.
+	// If nil, all pixels take SamplesPerPixel samples
+	Adaptive *AdaptiveConfig
+	// Checkpoint enables periodic saving of the render state to file, so that the render can be resumed.
+	// If nil, no checkpoints are saved
+	Checkpoint *CheckpointConfig
+	// LightSampling decides how the light to sample is chosen, when the world has several lights
+	LightSampling LightSampling
 }
 
+// LightSampling decides how the light to sample directions towards is chosen among the lights in the world
+type LightSampling int
+
+const (
+	// LightSamplingUniform chooses all lights with the same probability
+	LightSamplingUniform LightSampling = iota
+	// LightSamplingPower chooses lights in proportion to how much light they emit,
+	// so that dim lights do not get as many samples as the bright lights
+	LightSamplingPower
+	// LightSamplingTree chooses lights with a tree of the lights, where lights that emit much light
+	// close to the hit are chosen more often. Suited for scenes with many lights
+	LightSamplingTree
+)
+
 // Scene contains all information needed to render an image
 type Scene struct {
 	World           hittable.Hittable
 	Camera          camera.CameraConfig
 	BackgroundColor geo.Vec3
-	RenderConfig    RenderConfig
+	// Environment is the light from directions where rays do not hit anything, and is sampled as a light.
+	// If nil, rays that do not hit anything get the BackgroundColor
+	Environment environment.Environment
+	// Lights are light sources that are not part of the world, and are only found by sampling them
+	Lights       []light.Light
+	RenderConfig RenderConfig
 }
 
 // RenderProgress is progress reported back to the caller of the raytrace function
 type RenderProgress struct {
 	Progress    float64
 	RenderImage image.Image
-	Error       error
+	// Tile is set instead of RenderImage for the progress of tile rendering.
+	// When all tiles are done the complete image is reported in RenderImage
+	Tile *TileUpdate
+	// Buffers is only set on the final progress of a completed render
+	Buffers *RenderBuffers
+	Error   error
+}
+
+// RenderBuffers contains the linear scene values of a rendered image, averaged over the samples
+// without any clamping, gamma correction or post processing.
+// Pixels are stored row by row starting with the top left pixel.
+type RenderBuffers struct {
+	Width  int
+	Height int
+	Color  []geo.Vec3
+	// Albedo is the color of the first surface hit by the camera rays
+	Albedo []geo.Vec3
+	// Normal is the normal of the first surface hit by the camera rays
+	Normal []geo.Vec3
+	// SampleCounts is the number of samples rendered for each pixel
+	SampleCounts []int
+}
+
+// CheckpointConfig configures saving of the render state to a checkpoint file. A checkpoint is saved
+// periodically while rendering, when the render is aborted and when all samples are rendered.
+// A resumed render gives the same result as a render that was never interrupted, and can be
+// given more samples per pixel than the render that saved the checkpoint.
+type CheckpointConfig struct {
+	// Path of the checkpoint file
+	Path string
+	// Interval is the min time between saving checkpoints while rendering, defaults to 5 minutes
+	Interval time.Duration
+	// Resume continues the render from the checkpoint file, if it exists
+	Resume bool
+	// SceneHash identifies the scene, as a checkpoint can only be resumed for the scene that saved it.
+	// It is decided by the caller, e.g. a hash of the scene file
+	SceneHash string
+}
+
+// AdaptiveConfig configures adaptive sampling. The noise of a pixel is estimated from the
+// variance of the luminance of its samples, and when it is below the threshold the pixel
+// is converged and takes no more samples.
+type AdaptiveConfig struct {
+	// MinSamples is the number of samples a pixel takes before it can be converged, defaults to 16
+	MinSamples int
+	// NoiseThreshold is the max relative standard error of the luminance of a converged pixel, defaults to 0.05.
+	// Dark pixels use an absolute error, so that they do not need an unbounded number of samples
+	NoiseThreshold float64
+}
+
+// TileOrder decides in which order the tiles of the image are rendered
+type TileOrder int
+
+const (
+	// TileOrderScanline renders tiles row by row from the top left
+	TileOrderScanline TileOrder = iota
+	// TileOrderSpiral renders tiles in a spiral starting in the center of the image
+	TileOrderSpiral
+	// TileOrderHilbert renders tiles along a Hilbert curve, where consecutive tiles are mostly neighbours
+	TileOrderHilbert
+)
+
+// TileConfig configures rendering of the image in square tiles instead of whole lines
+type TileConfig struct {
+	// Size is the width and height of the tiles in pixels, defaults to 32
+	Size  int
+	Order TileOrder
+	// SamplesPerPass is the number of samples per pixel rendered for a tile before moving on to
+	// the next one. The tiles are rendered in passes until all samples are done.
+	// Zero renders each tile to completion in one pass.
+	SamplesPerPass int
+}
+
+// TileUpdate is a part of the image that has been updated by rendering a tile
+type TileUpdate struct {
+	// X and Y is the position of the upper left pixel of the tile in the image
+	X int
+	Y int
+	// Image contains only the pixels of the tile
+	Image image.Image
+	// Samples is the number of samples per pixel rendered for the tile so far.
+	// With adaptive sampling it is the max, as converged pixels take no more samples
+	Samples int
 }
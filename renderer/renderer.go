@@ -4,6 +4,7 @@ import (
 	"errors"
 	"image/color"
 	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/DanielPettersson/solstrale/camera"
@@ -11,7 +12,10 @@ import (
 	"github.com/DanielPettersson/solstrale/hittable"
 	im "github.com/DanielPettersson/solstrale/internal/image"
 	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/pdf"
 	"github.com/DanielPettersson/solstrale/random"
+	"github.com/DanielPettersson/solstrale/tonemap"
 )
 
 // Renderer is a central part of the raytracer responsible for controlling the
@@ -19,131 +23,348 @@ import (
 type Renderer struct {
 	scene                          *Scene
 	lights                         *hittable.HittableList
+	lightSampler                   hittable.LightSampler
 	output                         chan<- RenderProgress
 	abort                          <-chan bool
 	albedoShader                   AlbedoShader
 	normalShader                   NormalShader
+	adaptive                       *adaptiveSampler
 	maxMillisBetweenProgressOutput int64
+	lastCheckpoint                 time.Time
 }
 
+// errAborted is returned when the caller has aborted the render
+var errAborted = errors.New("Render aborted")
+
 // NewRenderer creates a new renderer given a scene and channels for communicating with the caller
 func NewRenderer(scene *Scene, output chan<- RenderProgress, abort <-chan bool) (*Renderer, error) {
 
 	lights := hittable.NewHittableList()
-	findLights(scene.World, &lights)
+	for _, l := range hittable.FindLights(scene.World) {
+		lights.Add(l)
+	}
 
-	if len(lights.List()) == 0 {
+	if len(lights.List()) == 0 && scene.Environment == nil && len(scene.Lights) == 0 {
 		return nil, errors.New("Scene should have at least one light")
 	}
 
 	return &Renderer{
 		scene:                          scene,
 		lights:                         &lights,
+		lightSampler:                   newLightSampler(scene.RenderConfig.LightSampling, &lights),
 		output:                         output,
 		abort:                          abort,
 		albedoShader:                   AlbedoShader{},
 		normalShader:                   NormalShader{},
+		adaptive:                       newAdaptiveSampler(scene.RenderConfig.Adaptive),
 		maxMillisBetweenProgressOutput: 500,
 	}, nil
 }
 
-func (r *Renderer) rayColor(ray geo.Ray, depth int) (geo.Vec3, geo.Vec3, geo.Vec3) {
+// hit finds the closest hit of the ray in the world
+func (r *Renderer) hit(ray geo.Ray, rng *random.Rng) (bool, *material.HitRecord) {
+	return r.scene.World.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, rng)
+}
+
+func (r *Renderer) rayColor(ray geo.Ray, depth int, rng *random.Rng) (geo.Vec3, geo.Vec3, geo.Vec3) {
 
 	s := r.scene
 
-	hit, rec := s.World.Hit(ray, util.Interval{Min: 0.001, Max: util.Infinity})
+	hit, rec := r.hit(ray, rng)
 	if hit {
-		pixelColor := s.RenderConfig.Shader.Shade(r, rec, ray, depth)
+		pixelColor := s.RenderConfig.Shader.Shade(r, rec, ray, depth, rng)
 
 		var albedoColor geo.Vec3
 		var normalColor geo.Vec3
 
-		if r.scene.RenderConfig.PostProcessor != nil && depth == 0 {
-			albedoColor = r.albedoShader.Shade(r, rec, ray, depth)
-			normalColor = r.normalShader.Shade(r, rec, ray, depth)
+		if depth == 0 {
+			albedoColor = r.albedoShader.Shade(r, rec, ray, depth, rng)
+			normalColor = r.normalShader.Shade(r, rec, ray, depth, rng)
 		}
 
 		return pixelColor, albedoColor, normalColor
 	}
 
-	return s.BackgroundColor, s.BackgroundColor, geo.ZeroVector
+	background := r.background(ray)
+	return background, background, geo.ZeroVector
+}
+
+// background returns the color of rays that do not hit anything
+func (r *Renderer) background(ray geo.Ray) geo.Vec3 {
+	if r.scene.Environment != nil {
+		return r.scene.Environment.Color(ray.Direction)
+	}
+	return r.scene.BackgroundColor
+}
+
+// lightPdf returns the pdf that samples directions towards the lights in the world and the environment.
+// Returns nil if there are none, as when the scene is only lit by the lights of the scene
+func (r *Renderer) lightPdf(origin geo.Vec3) pdf.Pdf {
+	hasLights := len(r.lights.List()) > 0
+	switch {
+	case r.scene.Environment == nil && !hasLights:
+		return nil
+	case r.scene.Environment == nil:
+		return r.lightSampler.Pdf(origin)
+	case !hasLights:
+		return r.scene.Environment
+	}
+	return pdf.NewMixturePdf(r.lightSampler.Pdf(origin), r.scene.Environment)
+}
+
+// newLightSampler creates the sampler that chooses among the lights found in the world
+func newLightSampler(sampling LightSampling, lights *hittable.HittableList) hittable.LightSampler {
+	if len(lights.List()) == 0 {
+		return nil
+	}
+	switch sampling {
+	case LightSamplingPower:
+		return hittable.NewPowerLightSampler(lights.List())
+	case LightSamplingTree:
+		return hittable.NewLightTree(lights.List())
+	default:
+		return hittable.NewUniformLightSampler(lights)
+	}
+}
+
+// directLight returns the light from the lights of the scene that is scattered at the hit towards the incoming ray.
+// These lights are not found by scattered rays, so their light is only added here
+func (r *Renderer) directLight(rec *material.HitRecord, scatterRecord material.ScatterRecord, time float64, rng *random.Rng) geo.Vec3 {
+	color := geo.ZeroVector
+	for _, l := range r.scene.Lights {
+		sample := l.Sample(rec.HitPoint, rng)
+		if sample.Color == geo.ZeroVector {
+			continue
+		}
+		shadowRay := geo.NewRay(rec.HitPoint, sample.Direction, time)
+		if hit, _ := r.scene.World.Hit(shadowRay, geo.Interval{Min: 0.001, Max: sample.Distance - 0.001}, rng); hit {
+			continue
+		}
+		color = color.Add(scattering(rec, scatterRecord, shadowRay).Mul(sample.Color))
+	}
+	return color
 }
 
 // Render executes the rendering of the image
 func (r *Renderer) Render(imageWidth, imageHeight int) {
+	defer close(r.output)
 
-	s := r.scene
-	samplesPerPixel := s.RenderConfig.SamplesPerPixel
-	postProcessor := s.RenderConfig.PostProcessor
 	pixelCount := imageWidth * imageHeight
+	f := &frame{
+		width:           imageWidth,
+		height:          imageHeight,
+		camera:          camera.New(imageWidth, imageHeight, r.scene.Camera),
+		pixelColors:     make([]geo.Vec3, pixelCount),
+		albedoColors:    make([]geo.Vec3, pixelCount),
+		normalColors:    make([]geo.Vec3, pixelCount),
+		sampleCounts:    make([]int, pixelCount),
+		luminanceSqSums: make([]float64, pixelCount),
+		converged:       make([]bool, pixelCount),
+	}
 
-	pixelColors := make([]geo.Vec3, pixelCount)
-	albedoColors := make([]geo.Vec3, pixelCount)
-	normalColors := make([]geo.Vec3, pixelCount)
+	r.lastCheckpoint = time.Now()
+	if err := r.resumeCheckpoint(f); err != nil {
+		r.output <- RenderProgress{
+			Error: err,
+		}
+		return
+	}
 
-	workerJobChannel := make(chan int, imageHeight)
-	workerDoneChannel := make(chan bool)
-	aborted := false
+	var err error
+	if r.scene.RenderConfig.Tiles != nil {
+		err = r.renderTiles(f)
+	} else {
+		err = r.renderLines(f)
+	}
 
-	camera := camera.New(imageWidth, imageHeight, r.scene.Camera)
+	// Save the state also when done, so that the render can be resumed with more samples
+	if err == nil || err == errAborted {
+		if checkpointErr := r.saveCheckpoint(f); checkpointErr != nil {
+			err = checkpointErr
+		}
+	}
 
-	// Setup the pool of worker goroutines responsible for rendering lines
+	if err == errAborted {
+		return
+	}
+	if err != nil {
+		r.output <- RenderProgress{
+			Error: err,
+		}
+		return
+	}
 
-	numWorkers := numWorkers()
-	for i := 0; i < numWorkers; i++ {
-		go func() {
+	r.finish(f)
+}
 
-			for y := range workerJobChannel {
+// frame contains the sums of the samples rendered for each pixel of the image
+type frame struct {
+	width        int
+	height       int
+	camera       camera.Camera
+	pixelColors  []geo.Vec3
+	albedoColors []geo.Vec3
+	normalColors []geo.Vec3
+	sampleCounts []int
+	// luminanceSqSums and converged are used by adaptive sampling to find pixels that need no more samples
+	luminanceSqSums []float64
+	converged       []bool
+	convergedCount  atomic.Int64
+	// renderedSamples is the total number of samples rendered for all pixels
+	renderedSamples atomic.Int64
+	aborted         atomic.Bool
+}
 
-				for x := 0; x < imageWidth; x++ {
-					if aborted {
-						break
-					}
+// firstSample returns the first sample that is missing for any pixel, as the
+// frame can have samples already when resuming from a checkpoint
+func (f *frame) firstSample() int {
+	first := 0
+	for i, n := range f.sampleCounts {
+		if !f.converged[i] && (first == 0 || n+1 < first) {
+			first = n + 1
+		}
+	}
+	if first == 0 {
+		return 1
+	}
+	return first
+}
 
-					i := (((imageHeight-1)-y)*imageWidth + x)
+// allConverged checks if no pixel of the frame needs any more samples
+func (f *frame) allConverged() bool {
+	return f.convergedCount.Load() == int64(len(f.converged))
+}
 
-					u := (float64(x) + random.RandomNormalFloat()) / float64(imageWidth-1)
-					v := (float64(y) + random.RandomNormalFloat()) / float64(imageHeight-1)
-					ray := camera.GetRay(u, v)
-					pixelColor, albedoColor, normalColor := r.rayColor(ray, 0)
+// displayRgba converts the average of the samples of a pixel to a displayable color
+func (f *frame) displayRgba(i int, toneMapper tonemap.ToneMapper) color.RGBA {
+	samples := f.sampleCounts[i]
+	if samples == 0 {
+		samples = 1
+	}
+	return im.ToDisplayRgba(f.pixelColors[i], samples, toneMapper)
+}
 
-					pixelColors[i] = pixelColors[i].Add(pixelColor)
+// renderJob is a job for a worker to render a range of samples for a rectangle of pixels.
+// Coordinates are in pixels with origin in the upper left corner of the image, and the
+// end of both the rectangle and the sample range are excluded.
+type renderJob struct {
+	x0, y0, x1, y1 int
+	sampleStart    int
+	sampleEnd      int
+}
 
-					if postProcessor != nil {
-						albedoColors[i] = albedoColors[i].Add(albedoColor)
-						normalColors[i] = normalColors[i].Add(normalColor)
-					}
+// startWorkers sets up the pool of worker goroutines responsible for rendering jobs.
+// Each finished job is sent on the returned done channel.
+func (r *Renderer) startWorkers(f *frame, jobs <-chan renderJob) <-chan renderJob {
+	done := make(chan renderJob)
 
+	numWorkers := numWorkers()
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			rng := random.NewRng(0)
+
+			for job := range jobs {
+				renderedSamples := 0
+				for y := job.y0; y < job.y1; y++ {
+					for x := job.x0; x < job.x1; x++ {
+						if f.aborted.Load() {
+							break
+						}
+
+						// Samples already in the pixel, from a resumed checkpoint, are skipped.
+						// Pixels only converge with adaptive sampling
+						i := y*f.width + x
+						sampleStart := job.sampleStart
+						if f.sampleCounts[i] >= sampleStart {
+							sampleStart = f.sampleCounts[i] + 1
+						}
+						for sample := sampleStart; sample < job.sampleEnd && !f.converged[i]; sample++ {
+							r.renderPixelSample(f, rng, x, y, sample)
+							renderedSamples++
+						}
+					}
 				}
-				workerDoneChannel <- true
+				f.renderedSamples.Add(int64(renderedSamples))
+				done <- job
 			}
 		}()
 	}
 
+	return done
+}
+
+// renderPixelSample renders one sample for a pixel and adds it to the frame
+func (r *Renderer) renderPixelSample(f *frame, rng *random.Rng, x, y, sample int) {
+	i := y*f.width + x
+
+	// Each pixel sample has its own random sequence, so that the output
+	// does not depend on which worker that renders the pixel
+	rng.Seed(random.MixSeed(r.scene.RenderConfig.Seed, uint64(i), uint64(r.scene.RenderConfig.SampleOffset+sample)))
+
+	// The camera has its origin in the lower left corner
+	u := (float64(x) + rng.NormalFloat()) / float64(f.width-1)
+	v := (float64(f.height-1-y) + rng.NormalFloat()) / float64(f.height-1)
+	ray := f.camera.GetRay(u, v, rng)
+	pixelColor, albedoColor, normalColor := r.rayColor(ray, 0, rng)
+
+	f.pixelColors[i] = f.pixelColors[i].Add(pixelColor)
+	f.albedoColors[i] = f.albedoColors[i].Add(albedoColor)
+	f.normalColors[i] = f.normalColors[i].Add(normalColor)
+	f.sampleCounts[i]++
+
+	// The luminance is needed also without adaptive sampling, in case the render is resumed with it
+	luminance := pixelColor.Luminance()
+	f.luminanceSqSums[i] += luminance * luminance
+
+	if r.adaptive != nil {
+		if r.adaptive.isConverged(f.pixelColors[i], f.luminanceSqSums[i], f.sampleCounts[i]) {
+			f.converged[i] = true
+			f.convergedCount.Add(1)
+		}
+	}
+}
+
+// isAborted checks if the caller wants to abort the render
+func (r *Renderer) isAborted(f *frame) bool {
+	select {
+	case <-r.abort:
+		f.aborted.Store(true)
+	default:
+	}
+	return f.aborted.Load()
+}
+
+// renderLines renders the image one sample at a time, line by line, reporting the whole image as progress.
+// The final sample is reported by finish. Returns errAborted if the render was aborted.
+func (r *Renderer) renderLines(f *frame) error {
+	samplesPerPixel := r.scene.RenderConfig.SamplesPerPixel
+	toneMapper := r.scene.RenderConfig.ToneMapper
+
+	jobs := make(chan renderJob, f.height)
+	defer close(jobs)
+	done := r.startWorkers(f, jobs)
+
 	var lastProgressTime time.Time
 
-	// Render loop, executes the workers and reports progress
-RenderLoop:
-	for sample := 1; sample <= samplesPerPixel; sample++ {
+	for sample := f.firstSample(); sample <= samplesPerPixel; sample++ {
 
 		lastProgressTime = time.Now()
 
 		// Submit jobs to the workers
 
-		for y := imageHeight - 1; y >= 0; y-- {
-			workerJobChannel <- y
+		for y := 0; y < f.height; y++ {
+			jobs <- renderJob{x0: 0, y0: y, x1: f.width, y1: y + 1, sampleStart: sample, sampleEnd: sample + 1}
 		}
-		for y := 0; y < imageHeight; y++ {
+		for y := 0; y < f.height; y++ {
 
-			<-workerDoneChannel
+			<-done
 
-			// Does caller want to abort the render?
-
-			select {
-			case <-r.abort:
-				aborted = true
-				break RenderLoop
-			default:
+			if r.isAborted(f) {
+				// Wait for the workers to stop before returning
+				for y++; y < f.height; y++ {
+					<-done
+				}
+				return errAborted
 			}
 
 			// If it was sufficiently long ago we last reported progress, do it
@@ -151,46 +372,69 @@ RenderLoop:
 
 			nowTime := time.Now()
 			millisSinceLastProgress := nowTime.Sub(lastProgressTime).Milliseconds()
-			if millisSinceLastProgress > r.maxMillisBetweenProgressOutput && !aborted {
+			if millisSinceLastProgress > r.maxMillisBetweenProgressOutput {
 				lastProgressTime = nowTime
-				createProgress(pixelCount, imageWidth, imageHeight, sample, samplesPerPixel, pixelColors, r.output)
+				createProgress(f, float64(sample)/float64(samplesPerPixel), toneMapper, nil, r.output)
 			}
 		}
 
-		createProgress(pixelCount, imageWidth, imageHeight, sample, samplesPerPixel, pixelColors, r.output)
+		// With adaptive sampling the render is done when all pixels have converged
+		if sample == samplesPerPixel || f.allConverged() {
+			break
+		}
+		createProgress(f, float64(sample)/float64(samplesPerPixel), toneMapper, nil, r.output)
+
+		// The workers are idle between samples, so the frame is not changing while saved
+		if r.isCheckpointDue() {
+			if err := r.saveCheckpoint(f); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Apply post processing if applicable, and report a final progress
+	return nil
+}
 
-	if postProcessor != nil && !aborted {
+// finish reports the final progress with the complete image and the render buffers.
+// Applies post processing if applicable, and reports that as an additional final progress.
+func (r *Renderer) finish(f *frame) {
+	rc := r.scene.RenderConfig
 
-		img, err := postProcessor.PostProcess(
-			pixelColors,
-			albedoColors,
-			normalColors,
-			imageWidth,
-			imageHeight,
-			samplesPerPixel,
-		)
+	buffers := createBuffers(f)
 
-		if err != nil {
-			r.output <- RenderProgress{
-				Error: err,
-			}
-		} else {
+	if rc.PostProcessor == nil {
+		createProgress(f, 1, rc.ToneMapper, buffers, r.output)
+		return
+	}
+	createProgress(f, 1, rc.ToneMapper, nil, r.output)
+
+	// The pixels can have different number of samples, so the post processor gets the averages
+	img, err := rc.PostProcessor.PostProcess(
+		buffers.Color,
+		buffers.Albedo,
+		buffers.Normal,
+		f.width,
+		f.height,
+		1,
+		rc.ToneMapper,
+	)
+
+	if err != nil {
+		r.output <- RenderProgress{
+			Error: err,
+		}
+	} else {
 
-			r.output <- RenderProgress{
-				Progress:    1,
-				RenderImage: img,
-			}
+		r.output <- RenderProgress{
+			Progress:    1,
+			RenderImage: img,
+			Buffers:     buffers,
 		}
 	}
-
-	close(r.output)
 }
 
 func numWorkers() int {
-	numWorkers := runtime.NumCPU()
+	numWorkers := runtime.GOMAXPROCS(0)
 	if numWorkers < 1 {
 		numWorkers = 1
 	}
@@ -198,36 +442,48 @@ func numWorkers() int {
 }
 
 func createProgress(
-	pixelCount, imageWidth, imageHeight, sample, samplesPerPixel int,
-	pixelColors []geo.Vec3,
+	f *frame,
+	progress float64,
+	toneMapper tonemap.ToneMapper,
+	buffers *RenderBuffers,
 	output chan<- RenderProgress) {
-	ret := make([]color.RGBA, pixelCount)
-	for i := 0; i < pixelCount; i++ {
-		ret[i] = im.ToRgba(pixelColors[i], sample)
+	ret := make([]color.RGBA, len(f.pixelColors))
+	for i := range ret {
+		ret[i] = f.displayRgba(i, toneMapper)
 	}
 	img := im.RenderImage{
-		ImageWidth:  imageWidth,
-		ImageHeight: imageHeight,
+		ImageWidth:  f.width,
+		ImageHeight: f.height,
 		Data:        ret,
 	}
 
 	output <- RenderProgress{
-		Progress:    float64(sample) / float64(samplesPerPixel),
+		Progress:    progress,
 		RenderImage: img,
+		Buffers:     buffers,
 	}
 }
 
-func findLights(s hittable.Hittable, list *hittable.HittableList) {
+// createBuffers averages the summed up samples into render buffers
+func createBuffers(f *frame) *RenderBuffers {
 
-	switch v := s.(type) {
-	case *hittable.HittableList:
-		for _, child := range v.List() {
-			findLights(child, list)
-		}
-	default:
-		if v.IsLight() {
-			list.Add(v)
+	average := func(sums []geo.Vec3) []geo.Vec3 {
+		ret := make([]geo.Vec3, len(sums))
+		for i, sum := range sums {
+			ret[i] = sum.DivS(float64(f.sampleCounts[i]))
 		}
+		return ret
 	}
 
+	sampleCounts := make([]int, len(f.sampleCounts))
+	copy(sampleCounts, f.sampleCounts)
+
+	return &RenderBuffers{
+		Width:        f.width,
+		Height:       f.height,
+		Color:        average(f.pixelColors),
+		Albedo:       average(f.albedoColors),
+		Normal:       average(f.normalColors),
+		SampleCounts: sampleCounts,
+	}
 }
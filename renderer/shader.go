@@ -4,79 +4,180 @@ import (
 	"math"
 
 	"github.com/DanielPettersson/solstrale/geo"
-	"github.com/DanielPettersson/solstrale/hittable"
 	"github.com/DanielPettersson/solstrale/material"
 	"github.com/DanielPettersson/solstrale/pdf"
+	"github.com/DanielPettersson/solstrale/random"
 )
 
 // Shader calculates the color from a ray hitting a hittable object
 type Shader interface {
-	Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int) geo.Vec3
+	Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, rng *random.Rng) geo.Vec3
 }
 
 // PathTracingShader is the full raytracing shader
 type PathTracingShader struct {
 	MaxDepth int
+	// MaxSampleValue clamps the color channels of each sample, suppressing
+	// fireflies at the cost of some intensity. Zero gives the default of 3,
+	// a negative value disables the clamping.
+	MaxSampleValue float64
+	// RussianRouletteDepth is the depth from where paths are randomly terminated, with a probability
+	// that increases as less light is carried by the path. Zero disables the termination.
+	RussianRouletteDepth int
 }
 
 // Shade calculates the color using path tracing
-func (pts PathTracingShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int) geo.Vec3 {
+func (pts PathTracingShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, rng *random.Rng) geo.Vec3 {
+	return pts.shade(renderer, rec, ray, depth, geo.NewVec3(1, 1, 1), rng)
+}
+
+// shade calculates the color of the hit, where throughput is the fraction of the color that reaches the camera
+func (pts PathTracingShader) shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, throughput geo.Vec3, rng *random.Rng) geo.Vec3 {
 
 	if depth >= pts.MaxDepth {
 		return geo.ZeroVector
 	}
 
 	emittedColor := rec.Material.Emitted(rec)
-	scatter, scatterRecord := rec.Material.Scatter(ray, rec)
+	scatter, scatterRecord := rec.Material.Scatter(ray, rec, rng)
 	if !scatter {
 		return emittedColor
 	}
 
+	var scattered geo.Ray
+	var weight geo.Vec3
 	if scatterRecord.SkipPdf {
-		rc, _, _ := renderer.rayColor(scatterRecord.SkipPdfRay, depth+1)
-		return scatterRecord.Attenuation.Mul(rc)
+		scattered = scatterRecord.SkipPdfRay
+		weight = scatterRecord.Attenuation
+		if leaksLight(rec, scattered.Direction) {
+			return emittedColor
+		}
+	} else {
+		emittedColor = emittedColor.Add(renderer.directLight(rec, scatterRecord, ray.Time, rng))
+
+		scatterPdf := materialPdf(scatterRecord)
+		if lightPdf := renderer.lightPdf(rec.HitPoint); lightPdf != nil {
+			scatterPdf = pdf.NewMixturePdf(lightPdf, scatterPdf)
+		}
+
+		direction := scatterPdf.Generate(rng)
+		if direction == geo.ZeroVector {
+			// The sample was absorbed by the bsdf
+			return filterInvalidColorValues(emittedColor, pts.maxSampleValue())
+		}
+
+		scattered = geo.NewRay(
+			rec.HitPoint,
+			direction,
+			ray.Time,
+		)
+		pdfVal := scatterPdf.Value(scattered.Direction)
+		weight = scattering(rec, scatterRecord, scattered).DivS(pdfVal)
 	}
 
-	lightPdf := hittable.NewHittablePdf(renderer.lights, rec.HitPoint)
-	mixturePdf := pdf.NewMixturePdf(lightPdf, scatterRecord.Pdf)
+	throughput = throughput.Mul(weight)
+	survive, probability := russianRoulette(pts.RussianRouletteDepth, depth+1, throughput, rng)
+	if !survive {
+		return filterInvalidColorValues(emittedColor, pts.maxSampleValue())
+	}
+	weight = weight.DivS(probability)
+	throughput = throughput.DivS(probability)
 
-	scattered := geo.NewRay(
-		rec.HitPoint,
-		mixturePdf.Generate(),
-		ray.Time,
-	)
-	pdfVal := mixturePdf.Value(scattered.Direction)
-	scatteringPdf := rec.Material.ScatteringPdf(rec, scattered)
-	rc, _, _ := renderer.rayColor(scattered, depth+1)
-	scatterColor := scatterRecord.Attenuation.MulS(scatteringPdf).Mul(rc).DivS(pdfVal)
+	rc := renderer.background(scattered)
+	if hit, scatteredRec := renderer.hit(scattered, rng); hit {
+		rc = pts.shade(renderer, scatteredRec, scattered, depth+1, throughput, rng)
+	}
+	scatterColor := weight.Mul(rc)
 
-	return filterInvalidColorValues(emittedColor.Add(scatterColor))
+	if scatterRecord.SkipPdf {
+		return emittedColor.Add(scatterColor)
+	}
+	return filterInvalidColorValues(emittedColor.Add(scatterColor), pts.maxSampleValue())
+}
+
+// russianRoulette randomly terminates paths from the given start depth. The probability of continuing the
+// path is the largest channel of the throughput, so that paths that carry little light are terminated.
+// Returns if the path continues, and the probability it had to continue that the path should be divided by.
+func russianRoulette(startDepth, depth int, throughput geo.Vec3, rng *random.Rng) (bool, float64) {
+	if startDepth <= 0 || depth < startDepth {
+		return true, 1
+	}
+	probability := math.Min(throughput.MaxComponent(), 1)
+	if !(probability > 0) || rng.NormalFloat() >= probability {
+		return false, 0
+	}
+	return true, probability
+}
+
+// materialPdf returns the pdf that the material samples scattered directions from
+func materialPdf(scatterRecord material.ScatterRecord) pdf.Pdf {
+	if scatterRecord.Bsdf != nil {
+		return scatterRecord.Bsdf
+	}
+	return scatterRecord.Pdf
+}
+
+// scattering returns the fraction of light scattered from the scattered ray towards the incoming ray,
+// times the cosine of the angle between the scattered ray and the normal
+func scattering(rec *material.HitRecord, scatterRecord material.ScatterRecord, scattered geo.Ray) geo.Vec3 {
+	if leaksLight(rec, scattered.Direction) {
+		return geo.ZeroVector
+	}
+	if scatterRecord.Bsdf != nil {
+		return scatterRecord.Bsdf.Eval(scattered.Direction)
+	}
+	return scatterRecord.Attenuation.MulS(rec.Material.ScatteringPdf(rec, scattered))
+}
+
+// leaksLight checks if the direction is on one side of the surface, but on the other side of the shading normal.
+// Light scattered in such directions would leak through surfaces where the shading normals are interpolated.
+func leaksLight(rec *material.HitRecord, direction geo.Vec3) bool {
+	if rec.GeometricNormal == geo.ZeroVector {
+		return false
+	}
+	return (direction.Dot(rec.GeometricNormal) > 0) != (direction.Dot(rec.Normal) > 0)
+}
+
+// A subjectively chosen value that is a trade off between
+// color acne and suppressing intensity
+const defaultMaxSampleValue = 3
+
+func (pts PathTracingShader) maxSampleValue() float64 {
+	return maxSampleValue(pts.MaxSampleValue)
+}
+
+func maxSampleValue(configured float64) float64 {
+	if configured == 0 {
+		return defaultMaxSampleValue
+	}
+	if configured < 0 {
+		return math.Inf(1)
+	}
+	return configured
 }
 
-func filterInvalidColorValues(col geo.Vec3) geo.Vec3 {
+func filterInvalidColorValues(col geo.Vec3, maxValue float64) geo.Vec3 {
 	return geo.NewVec3(
-		filterColorValue(col.X),
-		filterColorValue(col.Y),
-		filterColorValue(col.Z),
+		filterColorValue(col.X, maxValue),
+		filterColorValue(col.Y, maxValue),
+		filterColorValue(col.Z, maxValue),
 	)
 }
 
-func filterColorValue(val float64) float64 {
+func filterColorValue(val, maxValue float64) float64 {
 	if math.IsNaN(val) {
 		return 0
 	}
-	// A subjectively chosen value that is a trade off between
-	// color acne and suppressing intensity
-	return math.Min(val, 3)
+	return math.Min(val, maxValue)
 }
 
 // AlbedoShader outputs flat color
 type AlbedoShader struct{}
 
 // Shade calculates the color only attenuation color.
-func (AlbedoShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int) geo.Vec3 {
+func (AlbedoShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, rng *random.Rng) geo.Vec3 {
 	emittedColor := rec.Material.Emitted(rec)
-	scatter, scatterRecord := rec.Material.Scatter(ray, rec)
+	scatter, scatterRecord := rec.Material.Scatter(ray, rec, rng)
 	if !scatter {
 		return emittedColor
 	}
@@ -87,7 +188,7 @@ func (AlbedoShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.R
 type NormalShader struct{}
 
 // Shade calculates the color only using normal.
-func (NormalShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int) geo.Vec3 {
+func (NormalShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, rng *random.Rng) geo.Vec3 {
 	return rec.Normal.Unit()
 }
 
@@ -95,9 +196,9 @@ func (NormalShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.R
 type SimpleShader struct{}
 
 // Shade calculates the color only using normal and attenuation color.
-func (SimpleShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int) geo.Vec3 {
+func (SimpleShader) Shade(renderer *Renderer, rec *material.HitRecord, ray geo.Ray, depth int, rng *random.Rng) geo.Vec3 {
 	emittedColor := rec.Material.Emitted(rec)
-	scatter, scatterRecord := rec.Material.Scatter(ray, rec)
+	scatter, scatterRecord := rec.Material.Scatter(ray, rec, rng)
 	if !scatter {
 		return emittedColor
 	}
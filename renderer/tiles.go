@@ -0,0 +1,229 @@
+package renderer
+
+import (
+	"image/color"
+	"sort"
+
+	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/DanielPettersson/solstrale/tonemap"
+)
+
+const defaultTileSize = 32
+
+// tile is a rectangle of pixels, where the end coordinates are excluded
+type tile struct {
+	x0, y0, x1, y1 int
+}
+
+// renderTiles renders the image in tiles, reporting each rendered tile as progress.
+// Returns errAborted if the render was aborted.
+func (r *Renderer) renderTiles(f *frame) error {
+	rc := r.scene.RenderConfig
+	samplesPerPixel := rc.SamplesPerPixel
+
+	size := rc.Tiles.Size
+	if size <= 0 {
+		size = defaultTileSize
+	}
+	samplesPerPass := rc.Tiles.SamplesPerPass
+	if samplesPerPass <= 0 || samplesPerPass > samplesPerPixel {
+		samplesPerPass = samplesPerPixel
+	}
+	tiles := createTiles(f.width, f.height, size, rc.Tiles.Order)
+
+	// Only a few tiles are queued at a time, so that the workers can be
+	// stopped when a checkpoint is saved
+	maxQueued := 2 * numWorkers()
+	jobs := make(chan renderJob, maxQueued)
+	defer close(jobs)
+	done := r.startWorkers(f, jobs)
+
+	totalSamples := float64(f.width * f.height * samplesPerPixel)
+
+	for sampleStart := f.firstSample(); sampleStart <= samplesPerPixel; sampleStart += samplesPerPass {
+		sampleEnd := sampleStart + samplesPerPass
+		if sampleEnd > samplesPerPixel+1 {
+			sampleEnd = samplesPerPixel + 1
+		}
+
+		next := 0
+		queued := 0
+		for next < len(tiles) || queued > 0 {
+			if queued == 0 && r.isCheckpointDue() {
+				// All workers are idle, as no more tiles were queued when the checkpoint became due
+				if err := r.saveCheckpoint(f); err != nil {
+					return err
+				}
+			}
+			for queued < maxQueued && next < len(tiles) && (queued == 0 || !r.isCheckpointDue()) {
+				t := tiles[next]
+				jobs <- renderJob{x0: t.x0, y0: t.y0, x1: t.x1, y1: t.y1, sampleStart: sampleStart, sampleEnd: sampleEnd}
+				next++
+				queued++
+			}
+
+			job := <-done
+			queued--
+
+			if r.isAborted(f) {
+				// Wait for the workers to stop before returning
+				for ; queued > 0; queued-- {
+					<-done
+				}
+				return errAborted
+			}
+
+			r.output <- RenderProgress{
+				Progress: float64(f.renderedSamples.Load()) / totalSamples,
+				Tile:     createTileUpdate(f, job, r.scene.RenderConfig.ToneMapper),
+			}
+		}
+
+		// With adaptive sampling the render is done when all pixels have converged
+		if f.allConverged() {
+			break
+		}
+	}
+
+	return nil
+}
+
+// createTileUpdate creates an image of the pixels rendered by a job
+func createTileUpdate(f *frame, job renderJob, toneMapper tonemap.ToneMapper) *TileUpdate {
+	width := job.x1 - job.x0
+	height := job.y1 - job.y0
+	samples := job.sampleEnd - 1
+
+	ret := make([]color.RGBA, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ret[y*width+x] = f.displayRgba((job.y0+y)*f.width+job.x0+x, toneMapper)
+		}
+	}
+
+	return &TileUpdate{
+		X: job.x0,
+		Y: job.y0,
+		Image: im.RenderImage{
+			ImageWidth:  width,
+			ImageHeight: height,
+			Data:        ret,
+		},
+		Samples: samples,
+	}
+}
+
+// createTiles divides the image into tiles of the given size, sorted in the given order
+func createTiles(width, height, size int, order TileOrder) []tile {
+	cols := (width + size - 1) / size
+	rows := (height + size - 1) / size
+
+	var positions [][2]int
+	switch order {
+	case TileOrderSpiral:
+		positions = spiralPositions(cols, rows)
+	case TileOrderHilbert:
+		positions = hilbertPositions(cols, rows)
+	default:
+		positions = scanlinePositions(cols, rows)
+	}
+
+	tiles := make([]tile, len(positions))
+	for i, p := range positions {
+		x0 := p[0] * size
+		y0 := p[1] * size
+		tiles[i] = tile{
+			x0: x0,
+			y0: y0,
+			x1: minInt(x0+size, width),
+			y1: minInt(y0+size, height),
+		}
+	}
+	return tiles
+}
+
+func scanlinePositions(cols, rows int) [][2]int {
+	positions := make([][2]int, 0, cols*rows)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			positions = append(positions, [2]int{x, y})
+		}
+	}
+	return positions
+}
+
+// spiralPositions walks in a square spiral from the center tile, skipping positions outside of the image
+func spiralPositions(cols, rows int) [][2]int {
+	positions := make([][2]int, 0, cols*rows)
+	x := (cols - 1) / 2
+	y := (rows - 1) / 2
+	directions := [4][2]int{{1, 0}, {0, 1}, {-1, 0}, {0, -1}}
+
+	add := func() {
+		if x >= 0 && x < cols && y >= 0 && y < rows {
+			positions = append(positions, [2]int{x, y})
+		}
+	}
+	add()
+
+	// The length of the straight parts of the spiral increases every second turn
+	for steps, direction := 1, 0; len(positions) < cols*rows; direction++ {
+		d := directions[direction%4]
+		for i := 0; i < steps; i++ {
+			x += d[0]
+			y += d[1]
+			add()
+		}
+		if direction%2 == 1 {
+			steps++
+		}
+	}
+	return positions
+}
+
+// hilbertPositions sorts the tiles by their distance along a Hilbert curve covering the image
+func hilbertPositions(cols, rows int) [][2]int {
+	n := 1
+	for n < cols || n < rows {
+		n *= 2
+	}
+
+	positions := scanlinePositions(cols, rows)
+	sort.Slice(positions, func(i, j int) bool {
+		return hilbertIndex(n, positions[i][0], positions[i][1]) < hilbertIndex(n, positions[j][0], positions[j][1])
+	})
+	return positions
+}
+
+// hilbertIndex returns the distance along a Hilbert curve filling a n by n square for the given position
+func hilbertIndex(n, x, y int) int {
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx := 0
+		if x&s > 0 {
+			rx = 1
+		}
+		ry := 0
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+
+		// Rotate the quadrant so that the curve is continuous
+		if ry == 0 {
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
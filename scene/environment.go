@@ -0,0 +1,76 @@
+package scene
+
+import (
+	"github.com/DanielPettersson/solstrale/environment"
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+func (l *loader) environment(v value) (environment.Environment, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var env environment.Environment
+	switch t {
+	case "constant":
+		color, err := o.requiredVec3("color")
+		if err != nil {
+			return nil, err
+		}
+		env = environment.NewConstant(color)
+	case "gradient":
+		zenith, err := o.requiredVec3("zenith")
+		if err != nil {
+			return nil, err
+		}
+		horizon, err := o.requiredVec3("horizon")
+		if err != nil {
+			return nil, err
+		}
+		ground, err := o.vec3("ground", geo.ZeroVector)
+		if err != nil {
+			return nil, err
+		}
+		env = environment.NewGradient(zenith, horizon, ground)
+	case "image":
+		path, err := o.requiredString("path")
+		if err != nil {
+			return nil, err
+		}
+		intensity, err := o.float("intensity", 1)
+		if err != nil {
+			return nil, err
+		}
+		rotation, err := o.float("rotation", 0)
+		if err != nil {
+			return nil, err
+		}
+		if env, err = environment.LoadImage(l.path(path), intensity, rotation); err != nil {
+			return nil, o.errorf("%v", err.Error())
+		}
+	case "sky":
+		sunDirection, err := o.requiredVec3("sunDirection")
+		if err != nil {
+			return nil, err
+		}
+		turbidity, err := o.float("turbidity", 3)
+		if err != nil {
+			return nil, err
+		}
+		intensity, err := o.float("intensity", 1)
+		if err != nil {
+			return nil, err
+		}
+		env = environment.NewSky(sunDirection, turbidity, intensity)
+	default:
+		return nil, o.errorf("unknown environment type '%v'", t)
+	}
+
+	return env, o.checkUnused()
+}
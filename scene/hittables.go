@@ -0,0 +1,476 @@
+package scene
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/gltf"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/material"
+)
+
+func (l *loader) hittableList(v value) (*hittable.HittableList, error) {
+	items, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+
+	list := hittable.NewHittableList()
+	for _, item := range items {
+		h, err := l.hittable(item)
+		if err != nil {
+			return nil, err
+		}
+		list.Add(h)
+	}
+	return &list, nil
+}
+
+func (l *loader) hittable(v value) (hittable.Hittable, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var h hittable.Hittable
+	switch t {
+	case "list":
+		h, err = l.list(o)
+	case "sphere":
+		h, err = l.sphere(o)
+	case "quad":
+		h, err = l.quad(o)
+	case "box":
+		h, err = l.box(o)
+	case "triangle":
+		h, err = l.triangle(o)
+	case "bvh":
+		h, err = l.bvh(o)
+	case "objModel":
+		h, err = l.objModel(o)
+	case "plyModel":
+		h, err = l.meshModel(o, hittable.NewPlyModel)
+	case "stlModel":
+		h, err = l.meshModel(o, hittable.NewStlModel)
+	case "gltf":
+		h, err = l.gltf(o)
+	case "constantMedium":
+		h, err = l.constantMedium(o)
+	case "translation":
+		h, err = l.translation(o)
+	case "rotationY":
+		h, err = l.rotationY(o)
+	case "motionBlur":
+		h, err = l.motionBlur(o)
+	case "transform":
+		h, err = l.transform(o)
+	default:
+		return nil, o.errorf("unknown hittable type '%v'", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return h, o.checkUnused()
+}
+
+func (l *loader) list(o object) (hittable.Hittable, error) {
+	v, err := o.required("objects")
+	if err != nil {
+		return nil, err
+	}
+	return l.hittableList(v)
+}
+
+func (l *loader) sphere(o object) (hittable.Hittable, error) {
+	center, err := o.requiredVec3("center")
+	if err != nil {
+		return nil, err
+	}
+	radius, err := o.requiredFloat("radius")
+	if err != nil {
+		return nil, err
+	}
+	mat, err := l.materialField(o)
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewSphere(center, radius, mat), nil
+}
+
+func (l *loader) quad(o object) (hittable.Hittable, error) {
+	q, err := o.requiredVec3("q")
+	if err != nil {
+		return nil, err
+	}
+	u, err := o.requiredVec3("u")
+	if err != nil {
+		return nil, err
+	}
+	v, err := o.requiredVec3("v")
+	if err != nil {
+		return nil, err
+	}
+	mat, err := l.materialField(o)
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewQuad(q, u, v, mat), nil
+}
+
+func (l *loader) box(o object) (hittable.Hittable, error) {
+	a, err := o.requiredVec3("a")
+	if err != nil {
+		return nil, err
+	}
+	b, err := o.requiredVec3("b")
+	if err != nil {
+		return nil, err
+	}
+	mat, err := l.materialField(o)
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewBox(a, b, mat), nil
+}
+
+func (l *loader) triangle(o object) (hittable.Hittable, error) {
+	t, err := l.concreteTriangle(o)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (l *loader) concreteTriangle(o object) (hittable.Triangle, error) {
+	v0, err := o.requiredVec3("v0")
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	v1, err := o.requiredVec3("v1")
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	v2, err := o.requiredVec3("v2")
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	mat, err := l.materialField(o)
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	if !o.has("n0") && !o.has("n1") && !o.has("n2") {
+		return hittable.NewTriangle(v0, v1, v2, mat), nil
+	}
+
+	n0, err := o.requiredVec3("n0")
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	n1, err := o.requiredVec3("n1")
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	n2, err := o.requiredVec3("n2")
+	if err != nil {
+		return hittable.Triangle{}, err
+	}
+	return hittable.NewTriangleWithNormals(v0, v1, v2, n0, n1, n2, 0, 0, 0, 0, 0, 0, mat), nil
+}
+
+func (l *loader) bvh(o object) (hittable.Hittable, error) {
+	v, err := o.required("objects")
+	if err != nil {
+		return nil, err
+	}
+	items, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, v.errorf("a bvh needs at least one object")
+	}
+
+	objects := make([]hittable.Hittable, len(items))
+	for i, item := range items {
+		if objects[i], err = l.hittable(item); err != nil {
+			return nil, err
+		}
+	}
+
+	splitMethod, err := o.string("splitMethod", "sah")
+	if err != nil {
+		return nil, err
+	}
+	var options hittable.BvhOptions
+	switch splitMethod {
+	case "midpoint":
+		options.SplitMethod = hittable.SplitMidpoint
+	case "sah":
+		options.SplitMethod = hittable.SplitSah
+	default:
+		return nil, o.errorf("unknown split method '%v'", splitMethod)
+	}
+
+	return hittable.NewBoundingVolumeHierarchyWithOptions(objects, options), nil
+}
+
+func (l *loader) objModel(o object) (hittable.Hittable, error) {
+	file, err := o.requiredString("file")
+	if err != nil {
+		return nil, err
+	}
+	scale, err := o.float("scale", 1)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := l.materialField(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var materials map[string]material.Material
+	if v, found := o.get("materials"); found {
+		if materials, err = l.materialOverrides(v); err != nil {
+			return nil, err
+		}
+	}
+
+	path := l.path(file)
+	model, err := hittable.NewObjModelWithOptions(filepath.Dir(path)+"/", filepath.Base(path), hittable.ObjModelOptions{
+		Scale:           scale,
+		DefaultMaterial: mat,
+		Materials:       materials,
+	})
+	if err != nil {
+		return nil, o.errorf("%v", err.Error())
+	}
+	return model, nil
+}
+
+// meshModel reads a model file of a format without materials, with the function that reads the format
+func (l *loader) meshModel(o object, read func(string, hittable.MeshModelOptions) (hittable.Hittable, error)) (hittable.Hittable, error) {
+	file, err := o.requiredString("file")
+	if err != nil {
+		return nil, err
+	}
+	scale, err := o.float("scale", 1)
+	if err != nil {
+		return nil, err
+	}
+	// Without a material, the model gets the default material of its format, with the vertex colors if any
+	var mat material.Material
+	if v, found := o.get("material"); found {
+		if mat, err = l.material(v); err != nil {
+			return nil, err
+		}
+	}
+
+	model, err := read(l.path(file), hittable.MeshModelOptions{Scale: scale, DefaultMaterial: mat})
+	if err != nil {
+		return nil, o.errorf("%v", err.Error())
+	}
+	return model, nil
+}
+
+func (l *loader) gltf(o object) (hittable.Hittable, error) {
+	file, err := o.requiredString("file")
+	if err != nil {
+		return nil, err
+	}
+	model, err := gltf.LoadHittable(l.path(file))
+	if err != nil {
+		return nil, o.errorf("%v", err.Error())
+	}
+	return model, nil
+}
+
+// materialOverrides reads materials by the names of the materials that they replace in a model
+func (l *loader) materialOverrides(v value) (map[string]material.Material, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(o.fields))
+	for name := range o.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	materials := map[string]material.Material{}
+	for _, name := range names {
+		mv, _ := o.get(name)
+		if materials[name], err = l.material(mv); err != nil {
+			return nil, err
+		}
+	}
+	return materials, nil
+}
+
+func (l *loader) constantMedium(o object) (hittable.Hittable, error) {
+	bv, err := o.required("boundary")
+	if err != nil {
+		return nil, err
+	}
+	boundary, err := l.hittable(bv)
+	if err != nil {
+		return nil, err
+	}
+	density, err := o.requiredFloat("density")
+	if err != nil {
+		return nil, err
+	}
+	color, err := o.requiredVec3("color")
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewConstantMedium(boundary, density, color), nil
+}
+
+func (l *loader) translation(o object) (hittable.Hittable, error) {
+	object, err := l.wrappedObject(o)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := o.requiredVec3("offset")
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewTranslation(object, offset), nil
+}
+
+func (l *loader) rotationY(o object) (hittable.Hittable, error) {
+	object, err := l.wrappedObject(o)
+	if err != nil {
+		return nil, err
+	}
+	angle, err := o.requiredFloat("angle")
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewRotationY(object, angle), nil
+}
+
+func (l *loader) motionBlur(o object) (hittable.Hittable, error) {
+	object, err := l.wrappedObject(o)
+	if err != nil {
+		return nil, err
+	}
+	direction, err := o.requiredVec3("direction")
+	if err != nil {
+		return nil, err
+	}
+	return hittable.NewMotionBlur(object, direction), nil
+}
+
+func (l *loader) transform(o object) (hittable.Hittable, error) {
+	object, err := l.wrappedObject(o)
+	if err != nil {
+		return nil, err
+	}
+	v, err := o.required("transforms")
+	if err != nil {
+		return nil, err
+	}
+	matrix, err := l.transformMatrix(v)
+	if err != nil {
+		return nil, err
+	}
+	h, err := hittable.NewTransform(object, matrix)
+	if err != nil {
+		return nil, v.errorf("%v", err.Error())
+	}
+	return h, nil
+}
+
+// transformMatrix reads a list of transformations that are applied in order into a single matrix
+func (l *loader) transformMatrix(v value) (geo.Matrix4, error) {
+	items, err := v.list()
+	if err != nil {
+		return geo.Matrix4{}, err
+	}
+
+	matrix := geo.IdentityMatrix()
+	for _, item := range items {
+		o, err := item.object()
+		if err != nil {
+			return geo.Matrix4{}, err
+		}
+		t, err := o.requiredString("type")
+		if err != nil {
+			return geo.Matrix4{}, err
+		}
+
+		var m geo.Matrix4
+		switch t {
+		case "translate":
+			offset, err := o.requiredVec3("offset")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			m = geo.TranslationMatrix(offset)
+		case "scale":
+			scale, err := o.requiredVec3("scale")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			m = geo.ScaleMatrix(scale)
+		case "rotate":
+			axis, err := o.requiredVec3("axis")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			angle, err := o.requiredFloat("angle")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			m = geo.RotationMatrix(axis, angle)
+		case "lookAt":
+			from, err := o.requiredVec3("from")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			to, err := o.requiredVec3("to")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			up, err := o.vec3("up", geo.NewVec3(0, 1, 0))
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			m = geo.LookAtMatrix(from, to, up)
+		case "matrix":
+			rows, err := o.required("rows")
+			if err != nil {
+				return geo.Matrix4{}, err
+			}
+			if m, err = rows.matrix4(); err != nil {
+				return geo.Matrix4{}, err
+			}
+		default:
+			return geo.Matrix4{}, o.errorf("unknown transform type '%v'", t)
+		}
+		if err := o.checkUnused(); err != nil {
+			return geo.Matrix4{}, err
+		}
+
+		matrix = m.Mul(matrix)
+	}
+	return matrix, nil
+}
+
+// wrappedObject reads the hittable that is wrapped by a hittable like translation or rotation
+func (l *loader) wrappedObject(o object) (hittable.Hittable, error) {
+	v, err := o.required("object")
+	if err != nil {
+		return nil, err
+	}
+	return l.hittable(v)
+}
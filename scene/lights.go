@@ -0,0 +1,152 @@
+package scene
+
+import (
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/light"
+)
+
+func (l *loader) lightSources(v value) ([]light.Light, error) {
+	items, err := v.list()
+	if err != nil {
+		return nil, err
+	}
+
+	lights := make([]light.Light, 0, len(items))
+	for _, item := range items {
+		li, err := l.lightSource(item)
+		if err != nil {
+			return nil, err
+		}
+		lights = append(lights, li)
+	}
+	return lights, nil
+}
+
+func (l *loader) lightSource(v value) (light.Light, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var li light.Light
+	switch t {
+	case "point":
+		li, err = l.pointLight(o)
+	case "spot":
+		li, err = l.spotLight(o)
+	case "directional":
+		li, err = l.directionalLight(o)
+	case "area":
+		li, err = l.areaLight(o)
+	case "ies":
+		li, err = l.iesLight(o)
+	default:
+		return nil, o.errorf("unknown light type '%v'", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return li, o.checkUnused()
+}
+
+func (l *loader) pointLight(o object) (light.Light, error) {
+	position, err := o.requiredVec3("position")
+	if err != nil {
+		return nil, err
+	}
+	intensity, err := o.requiredVec3("intensity")
+	if err != nil {
+		return nil, err
+	}
+	return light.NewPoint(position, intensity), nil
+}
+
+func (l *loader) spotLight(o object) (light.Light, error) {
+	position, err := o.requiredVec3("position")
+	if err != nil {
+		return nil, err
+	}
+	direction, err := o.requiredVec3("direction")
+	if err != nil {
+		return nil, err
+	}
+	intensity, err := o.requiredVec3("intensity")
+	if err != nil {
+		return nil, err
+	}
+	coneAngle, err := o.requiredFloat("coneAngle")
+	if err != nil {
+		return nil, err
+	}
+	falloff, err := o.float("falloff", 0)
+	if err != nil {
+		return nil, err
+	}
+	return light.NewSpot(position, direction, intensity, coneAngle, falloff), nil
+}
+
+func (l *loader) directionalLight(o object) (light.Light, error) {
+	direction, err := o.requiredVec3("direction")
+	if err != nil {
+		return nil, err
+	}
+	irradiance, err := o.requiredVec3("irradiance")
+	if err != nil {
+		return nil, err
+	}
+	return light.NewDirectional(direction, irradiance), nil
+}
+
+func (l *loader) areaLight(o object) (light.Light, error) {
+	corner, err := o.requiredVec3("corner")
+	if err != nil {
+		return nil, err
+	}
+	u, err := o.requiredVec3("u")
+	if err != nil {
+		return nil, err
+	}
+	v, err := o.requiredVec3("v")
+	if err != nil {
+		return nil, err
+	}
+	radiance, err := o.requiredVec3("radiance")
+	if err != nil {
+		return nil, err
+	}
+	spread, err := o.float("spread", 180)
+	if err != nil {
+		return nil, err
+	}
+	return light.NewArea(corner, u, v, radiance, spread), nil
+}
+
+func (l *loader) iesLight(o object) (light.Light, error) {
+	path, err := o.requiredString("path")
+	if err != nil {
+		return nil, err
+	}
+	position, err := o.requiredVec3("position")
+	if err != nil {
+		return nil, err
+	}
+	direction, err := o.vec3("direction", geo.NewVec3(0, -1, 0))
+	if err != nil {
+		return nil, err
+	}
+	intensity, err := o.requiredVec3("intensity")
+	if err != nil {
+		return nil, err
+	}
+	profile, err := light.LoadIes(l.path(path))
+	if err != nil {
+		return nil, o.errorf("%v", err.Error())
+	}
+	return light.NewIes(position, direction, intensity, profile), nil
+}
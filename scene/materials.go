@@ -0,0 +1,313 @@
+package scene
+
+import (
+	"sort"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/material"
+)
+
+// namedMaterials reads the materials that are defined by name,
+// so that they can be shared by many hittables
+func (l *loader) namedMaterials(v value) error {
+	o, err := v.object()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(o.fields))
+	for name := range o.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		mv, _ := o.get(name)
+		mat, err := l.material(mv)
+		if err != nil {
+			return err
+		}
+		l.materials[name] = mat
+	}
+	return nil
+}
+
+// materialField reads the optional material field of a hittable.
+// If no material is given a white lambertian is used
+func (l *loader) materialField(o object) (material.Material, error) {
+	v, found := o.get("material")
+	if !found {
+		return material.NewLambertian(material.NewSolidColor(1, 1, 1)), nil
+	}
+	return l.material(v)
+}
+
+// material reads either a reference to a named material or a material definition
+func (l *loader) material(v value) (material.Material, error) {
+	if name, ok := v.raw.(string); ok {
+		mat, found := l.materials[name]
+		if !found {
+			return nil, v.errorf("unknown material '%v'", name)
+		}
+		return mat, nil
+	}
+
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var mat material.Material
+	switch t {
+	case "lambertian":
+		mat, err = l.lambertian(o)
+	case "metal":
+		mat, err = l.metal(o)
+	case "dielectric":
+		mat, err = l.dielectric(o)
+	case "roughConductor":
+		mat, err = l.roughConductor(o)
+	case "roughDielectric":
+		mat, err = l.roughDielectric(o)
+	case "principled":
+		mat, err = l.principled(o)
+	case "light":
+		mat, err = l.light(o)
+	default:
+		return nil, o.errorf("unknown material type '%v'", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return mat, o.checkUnused()
+}
+
+func (l *loader) lambertian(o object) (material.Material, error) {
+	tex, err := l.textureField(o)
+	if err != nil {
+		return nil, err
+	}
+	return material.NewLambertian(tex), nil
+}
+
+func (l *loader) metal(o object) (material.Material, error) {
+	tex, err := l.textureField(o)
+	if err != nil {
+		return nil, err
+	}
+	fuzz, err := o.float("fuzz", 0)
+	if err != nil {
+		return nil, err
+	}
+	return material.NewMetal(tex, fuzz), nil
+}
+
+func (l *loader) dielectric(o object) (material.Material, error) {
+	tex, err := l.textureField(o)
+	if err != nil {
+		return nil, err
+	}
+	ior, err := o.requiredFloat("indexOfRefraction")
+	if err != nil {
+		return nil, err
+	}
+	return material.NewDielectric(tex, ior), nil
+}
+
+// conductorIors are the presets that can be given by name as the index of refraction of a rough conductor
+var conductorIors = map[string]material.ComplexIor{
+	"gold":      material.IorGold,
+	"copper":    material.IorCopper,
+	"aluminium": material.IorAluminium,
+	"silver":    material.IorSilver,
+}
+
+func (l *loader) roughConductor(o object) (material.Material, error) {
+	tex, err := l.textureField(o)
+	if err != nil {
+		return nil, err
+	}
+	roughness, err := o.float("roughness", .5)
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := microfacetDistribution(o)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := o.required("ior")
+	if err != nil {
+		return nil, err
+	}
+	var ior material.ComplexIor
+	if name, ok := v.raw.(string); ok {
+		found := false
+		if ior, found = conductorIors[name]; !found {
+			return nil, v.errorf("unknown ior preset '%v'", name)
+		}
+	} else {
+		io, err := v.object()
+		if err != nil {
+			return nil, err
+		}
+		if ior.Eta, err = io.requiredVec3("eta"); err != nil {
+			return nil, err
+		}
+		if ior.K, err = io.requiredVec3("k"); err != nil {
+			return nil, err
+		}
+		if err := io.checkUnused(); err != nil {
+			return nil, err
+		}
+	}
+
+	return material.NewRoughConductor(tex, ior, roughness, distribution), nil
+}
+
+func (l *loader) roughDielectric(o object) (material.Material, error) {
+	tex, err := l.textureField(o)
+	if err != nil {
+		return nil, err
+	}
+	ior, err := o.requiredFloat("indexOfRefraction")
+	if err != nil {
+		return nil, err
+	}
+	roughness, err := o.float("roughness", .5)
+	if err != nil {
+		return nil, err
+	}
+	distribution, err := microfacetDistribution(o)
+	if err != nil {
+		return nil, err
+	}
+	return material.NewRoughDielectric(tex, ior, roughness, distribution), nil
+}
+
+func microfacetDistribution(o object) (material.MicrofacetDistribution, error) {
+	d, err := o.string("distribution", "ggx")
+	if err != nil {
+		return 0, err
+	}
+	switch d {
+	case "ggx":
+		return material.Ggx, nil
+	case "beckmann":
+		return material.Beckmann, nil
+	default:
+		return 0, o.errorf("unknown microfacet distribution '%v'", d)
+	}
+}
+
+func (l *loader) principled(o object) (material.Material, error) {
+	baseColor, err := l.textureField(o)
+	if err != nil {
+		return nil, err
+	}
+	config := material.PrincipledConfig{BaseColor: baseColor}
+
+	// Parameters that can be given a texture, in the field with the parameter name followed by Texture
+	params := []struct {
+		key          string
+		defaultValue float64
+		value        *float64
+		texture      *material.Texture
+	}{
+		{"metallic", 0, &config.Metallic, &config.MetallicTexture},
+		{"roughness", .5, &config.Roughness, &config.RoughnessTexture},
+		{"specular", .5, &config.Specular, &config.SpecularTexture},
+		{"clearcoat", 0, &config.Clearcoat, &config.ClearcoatTexture},
+		{"sheen", 0, &config.Sheen, &config.SheenTexture},
+		{"transmission", 0, &config.Transmission, &config.TransmissionTexture},
+	}
+	for _, p := range params {
+		if *p.value, err = o.float(p.key, p.defaultValue); err != nil {
+			return nil, err
+		}
+		if v, found := o.get(p.key + "Texture"); found {
+			if *p.texture, err = l.texture(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.ClearcoatRoughness, err = o.float("clearcoatRoughness", 0); err != nil {
+		return nil, err
+	}
+	if config.SheenTint, err = o.float("sheenTint", 0); err != nil {
+		return nil, err
+	}
+	if config.IndexOfRefraction, err = o.float("indexOfRefraction", 1.5); err != nil {
+		return nil, err
+	}
+	return material.NewPrincipled(config), nil
+}
+
+func (l *loader) light(o object) (material.Material, error) {
+	color, err := o.requiredVec3("color")
+	if err != nil {
+		return nil, err
+	}
+	return material.NewLight(color.X, color.Y, color.Z), nil
+}
+
+// textureField reads the texture of a material. Either given as a texture definition
+// in the texture field, or as a solid color in the color field. Defaults to white
+func (l *loader) textureField(o object) (material.Texture, error) {
+	if o.has("texture") && o.has("color") {
+		return nil, o.errorf("only one of 'texture' and 'color' can be given")
+	}
+
+	if v, found := o.get("texture"); found {
+		return l.texture(v)
+	}
+
+	color, err := o.vec3("color", geo.NewVec3(1, 1, 1))
+	if err != nil {
+		return nil, err
+	}
+	return material.SolidColor{ColorValue: color}, nil
+}
+
+func (l *loader) texture(v value) (material.Texture, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var tex material.Texture
+	switch t {
+	case "solid":
+		color, err := o.requiredVec3("color")
+		if err != nil {
+			return nil, err
+		}
+		tex = material.SolidColor{ColorValue: color}
+	case "image":
+		path, err := o.requiredString("path")
+		if err != nil {
+			return nil, err
+		}
+		if tex, err = material.LoadImageTexture(l.path(path)); err != nil {
+			return nil, o.errorf("%v", err.Error())
+		}
+	case "vertexColor":
+		tex = material.NewVertexColorTexture()
+	default:
+		return nil, o.errorf("unknown texture type '%v'", t)
+	}
+
+	return tex, o.checkUnused()
+}
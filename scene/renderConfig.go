@@ -0,0 +1,286 @@
+package scene
+
+import (
+	"github.com/DanielPettersson/solstrale/post"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/tonemap"
+)
+
+func (l *loader) renderConfig(v value) (renderer.RenderConfig, error) {
+	o, err := v.object()
+	if err != nil {
+		return renderer.RenderConfig{}, err
+	}
+
+	samples, err := o.int("samplesPerPixel", 1)
+	if err != nil {
+		return renderer.RenderConfig{}, err
+	}
+	if samples < 1 {
+		return renderer.RenderConfig{}, o.errorf("samplesPerPixel must be at least 1")
+	}
+
+	seed, err := o.int("seed", 0)
+	if err != nil {
+		return renderer.RenderConfig{}, err
+	}
+	if seed < 0 {
+		return renderer.RenderConfig{}, o.errorf("seed must not be negative")
+	}
+
+	var shader renderer.Shader = renderer.PathTracingShader{MaxDepth: 50}
+	if sv, found := o.get("shader"); found {
+		if shader, err = l.shader(sv); err != nil {
+			return renderer.RenderConfig{}, err
+		}
+	}
+
+	var postProcessor post.PostProcessor
+	if pv, found := o.get("postProcessor"); found {
+		if postProcessor, err = l.postProcessor(pv); err != nil {
+			return renderer.RenderConfig{}, err
+		}
+	}
+
+	var toneMapper tonemap.ToneMapper
+	if tv, found := o.get("toneMapper"); found {
+		if toneMapper, err = l.toneMapper(tv); err != nil {
+			return renderer.RenderConfig{}, err
+		}
+	}
+
+	var tiles *renderer.TileConfig
+	if tv, found := o.get("tiles"); found {
+		if tiles, err = l.tiles(tv); err != nil {
+			return renderer.RenderConfig{}, err
+		}
+	}
+
+	var adaptive *renderer.AdaptiveConfig
+	if av, found := o.get("adaptive"); found {
+		if adaptive, err = l.adaptive(av); err != nil {
+			return renderer.RenderConfig{}, err
+		}
+	}
+
+	lightSampling := renderer.LightSamplingUniform
+	if lv, found := o.get("lightSampling"); found {
+		if lightSampling, err = l.lightSampling(lv); err != nil {
+			return renderer.RenderConfig{}, err
+		}
+	}
+
+	return renderer.RenderConfig{
+		SamplesPerPixel: samples,
+		Shader:          shader,
+		PostProcessor:   postProcessor,
+		Seed:            uint64(seed),
+		ToneMapper:      toneMapper,
+		Tiles:           tiles,
+		Adaptive:        adaptive,
+		LightSampling:   lightSampling,
+	}, o.checkUnused()
+}
+
+func (l *loader) lightSampling(v value) (renderer.LightSampling, error) {
+	s, err := v.string()
+	if err != nil {
+		return 0, err
+	}
+	switch s {
+	case "power":
+		return renderer.LightSamplingPower, nil
+	case "uniform":
+		return renderer.LightSamplingUniform, nil
+	case "tree":
+		return renderer.LightSamplingTree, nil
+	}
+	return 0, v.errorf("unknown light sampling '%v'", s)
+}
+
+func (l *loader) shader(v value) (renderer.Shader, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var shader renderer.Shader
+	switch t {
+	case "pathTracing", "misPathTracing":
+		maxDepth, err := o.int("maxDepth", 50)
+		if err != nil {
+			return nil, err
+		}
+		maxSampleValue, err := o.float("maxSampleValue", 0)
+		if err != nil {
+			return nil, err
+		}
+		rouletteDepth, err := o.int("russianRouletteDepth", 0)
+		if err != nil {
+			return nil, err
+		}
+		if t == "misPathTracing" {
+			shader = renderer.MisPathTracingShader{MaxDepth: maxDepth, MaxSampleValue: maxSampleValue, RussianRouletteDepth: rouletteDepth}
+		} else {
+			shader = renderer.PathTracingShader{MaxDepth: maxDepth, MaxSampleValue: maxSampleValue, RussianRouletteDepth: rouletteDepth}
+		}
+	case "simple":
+		shader = renderer.SimpleShader{}
+	case "albedo":
+		shader = renderer.AlbedoShader{}
+	case "normal":
+		shader = renderer.NormalShader{}
+	default:
+		return nil, o.errorf("unknown shader type '%v'", t)
+	}
+
+	return shader, o.checkUnused()
+}
+
+func (l *loader) postProcessor(v value) (post.PostProcessor, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+
+	var postProcessor post.PostProcessor
+	switch t {
+	case "bloom":
+		blurRadius, err := o.requiredFloat("blurRadius")
+		if err != nil {
+			return nil, err
+		}
+		bloomMultiplier, err := o.requiredFloat("bloomMultiplier")
+		if err != nil {
+			return nil, err
+		}
+		postProcessor = post.NewBloom(blurRadius, bloomMultiplier)
+	case "oidn":
+		path, err := o.requiredString("path")
+		if err != nil {
+			return nil, err
+		}
+		if postProcessor, err = post.NewOidn(l.path(path)); err != nil {
+			return nil, o.errorf("%v", err.Error())
+		}
+	default:
+		return nil, o.errorf("unknown post processor type '%v'", t)
+	}
+
+	return postProcessor, o.checkUnused()
+}
+
+func (l *loader) toneMapper(v value) (tonemap.ToneMapper, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := o.requiredString("type")
+	if err != nil {
+		return nil, err
+	}
+	exposure, err := o.float("exposure", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var toneMapper tonemap.ToneMapper
+	switch t {
+	case "clamp":
+		toneMapper = tonemap.NewClamp(exposure)
+	case "reinhard":
+		whitePoint, err := o.float("whitePoint", 0)
+		if err != nil {
+			return nil, err
+		}
+		toneMapper = tonemap.NewReinhard(exposure, whitePoint)
+	case "acesFilmic":
+		toneMapper = tonemap.NewAcesFilmic(exposure)
+	default:
+		return nil, o.errorf("unknown tone mapper type '%v'", t)
+	}
+
+	return toneMapper, o.checkUnused()
+}
+
+func (l *loader) tiles(v value) (*renderer.TileConfig, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := o.int("size", 32)
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		return nil, o.errorf("size must be at least 1")
+	}
+	samplesPerPass, err := o.int("samplesPerPass", 0)
+	if err != nil {
+		return nil, err
+	}
+	if samplesPerPass < 0 {
+		return nil, o.errorf("samplesPerPass must not be negative")
+	}
+
+	t, err := o.string("order", "scanline")
+	if err != nil {
+		return nil, err
+	}
+	var order renderer.TileOrder
+	switch t {
+	case "scanline":
+		order = renderer.TileOrderScanline
+	case "spiral":
+		order = renderer.TileOrderSpiral
+	case "hilbert":
+		order = renderer.TileOrderHilbert
+	default:
+		return nil, o.errorf("unknown tile order '%v'", t)
+	}
+
+	return &renderer.TileConfig{
+		Size:           size,
+		Order:          order,
+		SamplesPerPass: samplesPerPass,
+	}, o.checkUnused()
+}
+
+func (l *loader) adaptive(v value) (*renderer.AdaptiveConfig, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	minSamples, err := o.int("minSamples", 16)
+	if err != nil {
+		return nil, err
+	}
+	if minSamples < 2 {
+		return nil, o.errorf("minSamples must be at least 2")
+	}
+	noiseThreshold, err := o.float("noiseThreshold", .05)
+	if err != nil {
+		return nil, err
+	}
+	if noiseThreshold <= 0 {
+		return nil, o.errorf("noiseThreshold must be positive")
+	}
+
+	return &renderer.AdaptiveConfig{
+		MinSamples:     minSamples,
+		NoiseThreshold: noiseThreshold,
+	}, o.checkUnused()
+}
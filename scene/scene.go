@@ -0,0 +1,226 @@
+// Package scene provides loading of scenes from declarative scene description files.
+// Scene descriptions can be written in either JSON or YAML and contains the camera,
+// the hittable objects of the world with their materials, the lights, the background or environment and the render config.
+// Paths to external files, like obj, ply, stl and glTF models and image textures, are relative to the scene file.
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DanielPettersson/solstrale/camera"
+	"github.com/DanielPettersson/solstrale/environment"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/light"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the file format of a scene description
+type Format int
+
+const (
+	// FormatJson is a scene description written in JSON
+	FormatJson Format = iota
+	// FormatYaml is a scene description written in YAML
+	FormatYaml
+)
+
+// loader holds the state needed while building a scene from a description
+type loader struct {
+	baseDir string
+	// confined keeps all paths inside the baseDir
+	confined  bool
+	materials map[string]material.Material
+}
+
+// Load reads a scene description file and creates a scene from it.
+// The format of the file is decided by the file extension, .json, .yaml or .yml
+func Load(path string) (*renderer.Scene, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scene file: %v", err.Error())
+	}
+
+	return Parse(data, format, filepath.Dir(path))
+}
+
+// FormatFromPath returns the scene description format given by the file extension of the path
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJson, nil
+	case ".yaml", ".yml":
+		return FormatYaml, nil
+	default:
+		return 0, fmt.Errorf("unsupported scene file extension: %v", path)
+	}
+}
+
+// Parse creates a scene from scene description data in the given format.
+// Relative paths to files in the description are resolved from the baseDir
+func Parse(data []byte, format Format, baseDir string) (*renderer.Scene, error) {
+	return parse(data, format, loader{baseDir: baseDir})
+}
+
+// ParseInRoot creates a scene from scene description data in the given format, where all paths
+// to files in the description are inside the rootDir. Paths are resolved from the rootDir,
+// also absolute paths, and paths with .. can not go above the rootDir.
+// Used for scene descriptions from untrusted sources.
+func ParseInRoot(data []byte, format Format, rootDir string) (*renderer.Scene, error) {
+	return parse(data, format, loader{baseDir: rootDir, confined: true})
+}
+
+func parse(data []byte, format Format, l loader) (*renderer.Scene, error) {
+	var raw interface{}
+
+	switch format {
+	case FormatJson:
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse scene json: %v", err.Error())
+		}
+	case FormatYaml:
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse scene yaml: %v", err.Error())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scene format: %v", format)
+	}
+
+	l.materials = map[string]material.Material{}
+	return l.scene(value{raw: raw})
+}
+
+func (l *loader) scene(v value) (*renderer.Scene, error) {
+	o, err := v.object()
+	if err != nil {
+		return nil, err
+	}
+
+	// Named materials are read first, so that they can be referred to from the world
+	if mv, found := o.get("materials"); found {
+		if err := l.namedMaterials(mv); err != nil {
+			return nil, err
+		}
+	}
+
+	cv, err := o.required("camera")
+	if err != nil {
+		return nil, err
+	}
+	cameraConfig, err := l.camera(cv)
+	if err != nil {
+		return nil, err
+	}
+
+	wv, err := o.required("world")
+	if err != nil {
+		return nil, err
+	}
+	world, err := l.hittableList(wv)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.has("background") && o.has("environment") {
+		return nil, o.errorf("only one of 'background' and 'environment' can be given")
+	}
+	background, err := o.vec3("background", geo.ZeroVector)
+	if err != nil {
+		return nil, err
+	}
+	var env environment.Environment
+	if ev, found := o.get("environment"); found {
+		if env, err = l.environment(ev); err != nil {
+			return nil, err
+		}
+	}
+
+	var lights []light.Light
+	if lv, found := o.get("lights"); found {
+		if lights, err = l.lightSources(lv); err != nil {
+			return nil, err
+		}
+	}
+
+	renderConfig := renderer.RenderConfig{
+		SamplesPerPixel: 1,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}
+	if rv, found := o.get("renderConfig"); found {
+		if renderConfig, err = l.renderConfig(rv); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.checkUnused(); err != nil {
+		return nil, err
+	}
+
+	return &renderer.Scene{
+		World:           world,
+		Camera:          cameraConfig,
+		BackgroundColor: background,
+		Environment:     env,
+		Lights:          lights,
+		RenderConfig:    renderConfig,
+	}, nil
+}
+
+func (l *loader) camera(v value) (camera.CameraConfig, error) {
+	o, err := v.object()
+	if err != nil {
+		return camera.CameraConfig{}, err
+	}
+
+	fov, err := o.requiredFloat("verticalFovDegrees")
+	if err != nil {
+		return camera.CameraConfig{}, err
+	}
+	lookFrom, err := o.requiredVec3("lookFrom")
+	if err != nil {
+		return camera.CameraConfig{}, err
+	}
+	lookAt, err := o.requiredVec3("lookAt")
+	if err != nil {
+		return camera.CameraConfig{}, err
+	}
+	aperture, err := o.float("apertureSize", 0)
+	if err != nil {
+		return camera.CameraConfig{}, err
+	}
+	// Default to having focus where the camera is looking
+	focusDistance, err := o.float("focusDistance", lookFrom.Sub(lookAt).Length())
+	if err != nil {
+		return camera.CameraConfig{}, err
+	}
+
+	return camera.CameraConfig{
+		VerticalFovDegrees: fov,
+		ApertureSize:       aperture,
+		FocusDistance:      focusDistance,
+		LookFrom:           lookFrom,
+		LookAt:             lookAt,
+	}, o.checkUnused()
+}
+
+// path resolves a path in the scene description relative to the scene file
+func (l *loader) path(p string) string {
+	if l.confined {
+		// Cleaning the path as if it was absolute removes all .. that would go above the root
+		return filepath.Join(l.baseDir, filepath.Clean(string(filepath.Separator)+p))
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(l.baseDir, p)
+}
@@ -0,0 +1,260 @@
+package scene
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+// value is a decoded part of a scene description together with its path in the document.
+// The path is used to give errors that point out where in the document the problem is
+type value struct {
+	path string
+	raw  interface{}
+}
+
+// object is a decoded map in a scene description.
+// Keeps track of which fields have been read, so that unknown fields can be reported
+type object struct {
+	path   string
+	fields map[string]interface{}
+	used   map[string]bool
+}
+
+func childPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (v value) errorf(format string, a ...interface{}) error {
+	if v.path == "" {
+		return fmt.Errorf(format, a...)
+	}
+	return fmt.Errorf("%v: %v", v.path, fmt.Sprintf(format, a...))
+}
+
+func (v value) object() (object, error) {
+	fields := map[string]interface{}{}
+
+	switch m := v.raw.(type) {
+	case map[string]interface{}:
+		fields = m
+	case map[interface{}]interface{}:
+		for k, f := range m {
+			fields[fmt.Sprint(k)] = f
+		}
+	default:
+		return object{}, v.errorf("expected an object")
+	}
+
+	return object{
+		path:   v.path,
+		fields: fields,
+		used:   map[string]bool{},
+	}, nil
+}
+
+func (v value) float() (float64, error) {
+	switch n := v.raw.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	default:
+		return 0, v.errorf("expected a number")
+	}
+}
+
+func (v value) int() (int, error) {
+	f, err := v.float()
+	if err != nil {
+		return 0, err
+	}
+	if f != float64(int(f)) {
+		return 0, v.errorf("expected an integer")
+	}
+	return int(f), nil
+}
+
+func (v value) string() (string, error) {
+	s, ok := v.raw.(string)
+	if !ok {
+		return "", v.errorf("expected a string")
+	}
+	return s, nil
+}
+
+func (v value) bool() (bool, error) {
+	b, ok := v.raw.(bool)
+	if !ok {
+		return false, v.errorf("expected a boolean")
+	}
+	return b, nil
+}
+
+func (v value) list() ([]value, error) {
+	l, ok := v.raw.([]interface{})
+	if !ok {
+		return nil, v.errorf("expected a list")
+	}
+
+	ret := make([]value, len(l))
+	for i, item := range l {
+		ret[i] = value{
+			path: fmt.Sprintf("%v[%v]", v.path, i),
+			raw:  item,
+		}
+	}
+	return ret, nil
+}
+
+func (v value) vec3() (geo.Vec3, error) {
+	l, err := v.list()
+	if err != nil || len(l) != 3 {
+		return geo.Vec3{}, v.errorf("expected a list of 3 numbers")
+	}
+
+	var xyz [3]float64
+	for i, item := range l {
+		if xyz[i], err = item.float(); err != nil {
+			return geo.Vec3{}, err
+		}
+	}
+	return geo.NewVec3(xyz[0], xyz[1], xyz[2]), nil
+}
+
+func (v value) matrix4() (geo.Matrix4, error) {
+	rows, err := v.list()
+	if err != nil || len(rows) != 4 {
+		return geo.Matrix4{}, v.errorf("expected a list of 4 rows with 4 numbers each")
+	}
+
+	var m geo.Matrix4
+	for i, row := range rows {
+		l, err := row.list()
+		if err != nil || len(l) != 4 {
+			return geo.Matrix4{}, row.errorf("expected a list of 4 numbers")
+		}
+		for j, item := range l {
+			if m[i][j], err = item.float(); err != nil {
+				return geo.Matrix4{}, err
+			}
+		}
+	}
+	return m, nil
+}
+
+func (o object) errorf(format string, a ...interface{}) error {
+	return value{path: o.path}.errorf(format, a...)
+}
+
+func (o object) has(key string) bool {
+	_, found := o.fields[key]
+	return found
+}
+
+func (o object) get(key string) (value, bool) {
+	raw, found := o.fields[key]
+	if found {
+		o.used[key] = true
+	}
+	return value{
+		path: childPath(o.path, key),
+		raw:  raw,
+	}, found
+}
+
+func (o object) required(key string) (value, error) {
+	v, found := o.get(key)
+	if !found {
+		return v, o.errorf("missing required field '%v'", key)
+	}
+	return v, nil
+}
+
+func (o object) requiredFloat(key string) (float64, error) {
+	v, err := o.required(key)
+	if err != nil {
+		return 0, err
+	}
+	return v.float()
+}
+
+func (o object) requiredString(key string) (string, error) {
+	v, err := o.required(key)
+	if err != nil {
+		return "", err
+	}
+	return v.string()
+}
+
+func (o object) requiredVec3(key string) (geo.Vec3, error) {
+	v, err := o.required(key)
+	if err != nil {
+		return geo.Vec3{}, err
+	}
+	return v.vec3()
+}
+
+func (o object) float(key string, defaultValue float64) (float64, error) {
+	v, found := o.get(key)
+	if !found {
+		return defaultValue, nil
+	}
+	return v.float()
+}
+
+func (o object) int(key string, defaultValue int) (int, error) {
+	v, found := o.get(key)
+	if !found {
+		return defaultValue, nil
+	}
+	return v.int()
+}
+
+func (o object) string(key string, defaultValue string) (string, error) {
+	v, found := o.get(key)
+	if !found {
+		return defaultValue, nil
+	}
+	return v.string()
+}
+
+func (o object) bool(key string, defaultValue bool) (bool, error) {
+	v, found := o.get(key)
+	if !found {
+		return defaultValue, nil
+	}
+	return v.bool()
+}
+
+func (o object) vec3(key string, defaultValue geo.Vec3) (geo.Vec3, error) {
+	v, found := o.get(key)
+	if !found {
+		return defaultValue, nil
+	}
+	return v.vec3()
+}
+
+// checkUnused returns an error if the object has fields that have not been read.
+// This catches misspelled field names that would otherwise be silently ignored
+func (o object) checkUnused() error {
+	unused := []string{}
+	for key := range o.fields {
+		if !o.used[key] {
+			unused = append(unused, key)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	sort.Strings(unused)
+	return o.errorf("unknown field '%v'", unused[0])
+}
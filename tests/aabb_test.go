@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAabbFromPoints(t *testing.T) {
+	b := hittable.NewAabbFromPoints(geo.NewVec3(1, -2, 3), geo.NewVec3(-1, 2, 0), geo.NewVec3(0, 0, 5))
+	assert.Equal(t, hittable.NewAabb(
+		geo.Interval{Min: -1, Max: 1},
+		geo.Interval{Min: -2, Max: 2},
+		geo.Interval{Min: 0, Max: 5},
+	), b)
+	assert.False(t, b.IsEmpty())
+
+	assert.True(t, hittable.NewAabbFromPoints().IsEmpty())
+	assert.Equal(t, hittable.EmptyAabb, hittable.NewAabbFromPoints())
+}
+
+func TestCombineAabbs(t *testing.T) {
+	a := hittable.NewAabbFromPoints(geo.NewVec3(0, 0, 0), geo.NewVec3(1, 1, 1))
+	b := hittable.NewAabbFromPoints(geo.NewVec3(2, -1, 0), geo.NewVec3(3, 0, 1))
+	assert.Equal(t, hittable.NewAabbFromPoints(geo.NewVec3(0, -1, 0), geo.NewVec3(3, 1, 1)), hittable.CombineAabbs(a, b))
+	assert.Equal(t, a, hittable.CombineAabbs(a, hittable.EmptyAabb))
+}
+
+func TestAabbAddAndExpand(t *testing.T) {
+	b := hittable.NewAabbFromPoints(geo.NewVec3(0, 0, 0), geo.NewVec3(1, 2, 3))
+	assert.Equal(t, hittable.NewAabbFromPoints(geo.NewVec3(1, 1, 1), geo.NewVec3(2, 3, 4)), b.Add(geo.NewVec3(1, 1, 1)))
+	assert.Equal(t, hittable.NewAabbFromPoints(geo.NewVec3(-1, -1, -1), geo.NewVec3(2, 3, 4)), b.Expand(2))
+	assertVec3InDelta(t, geo.NewVec3(.5, 1, 1.5), b.Center())
+	assert.Equal(t, 22., b.SurfaceArea())
+}
+
+func TestAabbPadIfNeeded(t *testing.T) {
+	b := hittable.NewAabbFromPoints(geo.NewVec3(0, 1, 0), geo.NewVec3(1, 1, 1)).PadIfNeeded()
+	assert.Equal(t, geo.Interval{Min: 0, Max: 1}, b.X)
+	assert.Greater(t, b.Y.Size(), 0.)
+	assert.Equal(t, 1., (b.Y.Min+b.Y.Max)/2)
+}
+
+func TestAabbTransform(t *testing.T) {
+	b := hittable.NewAabbFromPoints(geo.NewVec3(0, 0, 0), geo.NewVec3(2, 1, 1))
+
+	rotated := b.Transform(geo.RotationMatrix(geo.NewVec3(0, 0, 1), 90))
+	assert.InDelta(t, -1, rotated.X.Min, 1e-9)
+	assert.InDelta(t, 0, rotated.X.Max, 1e-9)
+	assert.InDelta(t, 0, rotated.Y.Min, 1e-9)
+	assert.InDelta(t, 2, rotated.Y.Max, 1e-9)
+	assert.Equal(t, b.Z, rotated.Z)
+
+	// Rotated 45 degrees, the box must grow to contain the corners
+	diagonal := b.Transform(geo.RotationMatrix(geo.NewVec3(0, 1, 0), 45))
+	assert.InDelta(t, 3/math.Sqrt2, diagonal.X.Size(), 1e-9)
+	assert.InDelta(t, 3/math.Sqrt2, diagonal.Z.Size(), 1e-9)
+
+	assert.Equal(t, hittable.EmptyAabb, hittable.EmptyAabb.Transform(geo.ScaleMatrix(geo.NewVec3(2, 2, 2))))
+}
+
+func TestAabbHit(t *testing.T) {
+	b := hittable.NewAabbFromPoints(geo.NewVec3(-1, -1, -1), geo.NewVec3(1, 1, 1))
+	rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+	assert.True(t, b.Hit(geo.NewRay(geo.NewVec3(0, 0, -5), geo.NewVec3(0, 0, 1), 0), rayLength))
+	assert.True(t, b.Hit(geo.NewRay(geo.NewVec3(0, 0, 0), geo.NewVec3(1, 1, 0), 0), rayLength))
+	assert.False(t, b.Hit(geo.NewRay(geo.NewVec3(0, 0, -5), geo.NewVec3(0, 0, -1), 0), rayLength))
+	assert.False(t, b.Hit(geo.NewRay(geo.NewVec3(0, 2, -5), geo.NewVec3(0, 0, 1), 0), rayLength))
+	assert.False(t, b.Hit(geo.NewRay(geo.NewVec3(0, 0, -5), geo.NewVec3(0, 0, 1), 0), geo.Interval{Min: 0.001, Max: 3}))
+}
+
+// disc is a hittable implemented outside of the hittable package.
+// It is a horizontal disc centered around the Y axis.
+type disc struct {
+	hittable.NonPdfLightHittable
+	height float64
+	radius float64
+	mat    material.Material
+}
+
+func (d disc) Hit(r geo.Ray, rayLength geo.Interval, rng *random.Rng) (bool, *material.HitRecord) {
+	if math.Abs(r.Direction.Y) < util.AlmostZero {
+		return false, nil
+	}
+	t := (d.height - r.Origin.Y) / r.Direction.Y
+	if !rayLength.Contains(t) {
+		return false, nil
+	}
+	p := r.At(t)
+	if p.X*p.X+p.Z*p.Z > d.radius*d.radius {
+		return false, nil
+	}
+	normal := geo.NewVec3(0, 1, 0)
+	frontFace := r.Direction.Dot(normal) < 0
+	if !frontFace {
+		normal = normal.Neg()
+	}
+	return true, &material.HitRecord{
+		HitPoint:  p,
+		Normal:    normal,
+		Material:  d.mat,
+		RayLength: t,
+		FrontFace: frontFace,
+	}
+}
+
+func (d disc) BoundingBox() hittable.Aabb {
+	return hittable.NewAabb(
+		geo.Interval{Min: -d.radius, Max: d.radius},
+		geo.Interval{Min: d.height, Max: d.height},
+		geo.Interval{Min: -d.radius, Max: d.radius},
+	).PadIfNeeded()
+}
+
+func (d disc) IsLight() bool {
+	return false
+}
+
+func TestCustomHittable(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	bvh := hittable.NewBoundingVolumeHierarchy([]hittable.Hittable{
+		disc{height: 0, radius: 1, mat: mat},
+		disc{height: 2, radius: .5, mat: mat},
+		hittable.NewSphere(geo.NewVec3(5, 0, 0), 1, mat),
+	})
+	translated := hittable.NewTranslation(bvh, geo.NewVec3(0, 1, 0))
+	rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+	hit, rec := translated.Hit(geo.NewRay(geo.NewVec3(.7, 10, 0), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	assert.True(t, hit)
+	assertVec3InDelta(t, geo.NewVec3(.7, 1, 0), rec.HitPoint)
+
+	hit, rec = translated.Hit(geo.NewRay(geo.NewVec3(.2, 10, 0), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	assert.True(t, hit)
+	assertVec3InDelta(t, geo.NewVec3(.2, 3, 0), rec.HitPoint)
+
+	hit, _ = translated.Hit(geo.NewRay(geo.NewVec3(1.5, 10, 0), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	assert.False(t, hit)
+}
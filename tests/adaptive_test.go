@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleCountsWithoutAdaptiveSampling(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 3,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}
+	buffers := renderBuffers(createSimpleTestScene(traceSpec, true), 20, 10)
+
+	for _, n := range buffers.SampleCounts {
+		assert.Equal(t, 3, n)
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 200,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Adaptive:        &renderer.AdaptiveConfig{MinSamples: 8, NoiseThreshold: .02},
+	}
+	buffers := renderBuffers(createSimpleTestScene(traceSpec, true), 20, 10)
+
+	total := 0
+	for _, n := range buffers.SampleCounts {
+		assert.GreaterOrEqual(t, n, 8)
+		assert.LessOrEqual(t, n, 200)
+		total += n
+	}
+
+	// The background has no noise and converges at min samples,
+	// while the noisy lit sphere needs more samples
+	assert.Equal(t, 8, buffers.SampleCounts[0])
+	assert.Greater(t, buffers.SampleCounts[110], 8)
+	assert.Less(t, total, 200*200)
+}
+
+func TestAdaptiveSamplingStopsWhenAllConverged(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 1000,
+		Shader:          renderer.AlbedoShader{},
+		Adaptive:        &renderer.AdaptiveConfig{MinSamples: 4, NoiseThreshold: 1},
+	}
+	buffers := renderBuffers(createSimpleTestScene(traceSpec, true), 20, 10)
+
+	for _, n := range buffers.SampleCounts {
+		assert.Less(t, n, 1000)
+	}
+}
+
+func TestAdaptiveSamplingIsReproducible(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 50,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Adaptive:        &renderer.AdaptiveConfig{MinSamples: 4, NoiseThreshold: .1},
+		Seed:            5,
+	}
+	expected := renderBuffers(createTestScene(traceSpec), 20, 10)
+
+	// Output does not depend on whether the image is rendered in lines or tiles
+	traceSpec.Tiles = &renderer.TileConfig{Size: 4, Order: renderer.TileOrderSpiral, SamplesPerPass: 7}
+	actual := renderBuffers(createTestScene(traceSpec), 20, 10)
+
+	assert.Equal(t, expected, actual)
+}
@@ -3,12 +3,122 @@ package tests
 import (
 	"testing"
 
+	"github.com/DanielPettersson/solstrale/geo"
 	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestBvhWithEmptyList(t *testing.T) {
 	assert.Panics(t, func() {
-		hittable.NewBoundingVolumeHierarchy([]hittable.Triangle{})
+		hittable.NewBoundingVolumeHierarchy([]hittable.Hittable{})
 	})
 }
+
+func TestBvhWithMixedHittables(t *testing.T) {
+	for name, splitMethod := range bvhSplitMethods {
+		t.Run(name, func(t *testing.T) {
+			testBvhWithMixedHittables(t, splitMethod)
+		})
+	}
+}
+
+var bvhSplitMethods = map[string]hittable.SplitMethod{
+	"midpoint": hittable.SplitMidpoint,
+	"sah":      hittable.SplitSah,
+}
+
+func testBvhWithMixedHittables(t *testing.T, splitMethod hittable.SplitMethod) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+
+	objects := []hittable.Hittable{}
+	list := hittable.NewHittableList()
+	for i := 0; i < 200; i++ {
+		var h hittable.Hittable
+		p := geo.RandomVec3(testRng, -10, 10)
+		// Some objects are clustered, to get an uneven distribution
+		if i%3 == 0 {
+			p = p.MulS(.1)
+		}
+		switch i % 4 {
+		case 0:
+			h = hittable.NewSphere(p, .5, mat)
+		case 1:
+			h = hittable.NewQuad(p, geo.NewVec3(1, 0, 0), geo.NewVec3(0, 1, 1), mat)
+		case 2:
+			h = hittable.NewTriangle(p, p.Add(geo.NewVec3(1, 0, 0)), p.Add(geo.NewVec3(0, 1, 0)), mat)
+		case 3:
+			h = hittable.NewRotationY(hittable.NewBox(p, p.Add(geo.NewVec3(.5, .5, .5)), mat), 30)
+		}
+		objects = append(objects, h)
+		list.Add(h)
+	}
+	bvh := hittable.NewBoundingVolumeHierarchyWithOptions(objects, hittable.BvhOptions{SplitMethod: splitMethod})
+
+	// The hierarchy should give the same hits as testing all objects
+	for i := 0; i < 1000; i++ {
+		ray := geo.NewRay(geo.RandomVec3(testRng, -12, 12), geo.RandomUnitVector(testRng), 0)
+		rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+		listHit, listRec := list.Hit(ray, rayLength, nil)
+		bvhHit, bvhRec := bvh.Hit(ray, rayLength, nil)
+
+		assert.Equal(t, listHit, bvhHit)
+		if listHit {
+			assert.Equal(t, listRec.RayLength, bvhRec.RayLength)
+		}
+	}
+}
+
+func TestSahBvhWithObjectsAtSamePosition(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+
+	objects := []hittable.Hittable{}
+	for i := 0; i < 20; i++ {
+		objects = append(objects, hittable.NewSphere(geo.ZeroVector, float64(i+1)*.1, mat))
+	}
+	bvh := hittable.NewBoundingVolumeHierarchyWithOptions(objects, hittable.BvhOptions{SplitMethod: hittable.SplitSah})
+
+	ray := geo.NewRay(geo.NewVec3(0, 0, 5), geo.NewVec3(0, 0, -1), 0)
+	hit, rec := bvh.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
+	assert.True(t, hit)
+	assert.InDelta(t, 3, rec.RayLength, 1e-9)
+
+	// Ray length is respected
+	hit, _ = bvh.Hit(ray, geo.Interval{Min: 0.001, Max: 2.9}, nil)
+	assert.False(t, hit)
+}
+
+func TestSahBvhWithManyObjects(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+
+	// Enough objects to build the hierarchy in parallel
+	objects := []hittable.Hittable{}
+	for i := 0; i < 25000; i++ {
+		p := geo.RandomVec3(testRng, -10, 10)
+		objects = append(objects, hittable.NewTriangle(p, p.Add(geo.NewVec3(.1, 0, 0)), p.Add(geo.NewVec3(0, .1, 0)), mat))
+	}
+	midpoint := hittable.NewBoundingVolumeHierarchy(objects)
+	sah := hittable.NewBoundingVolumeHierarchyWithOptions(objects, hittable.BvhOptions{SplitMethod: hittable.SplitSah})
+
+	for i := 0; i < 1000; i++ {
+		ray := geo.NewRay(geo.RandomVec3(testRng, -12, 12), geo.RandomUnitVector(testRng), 0)
+		rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+		midpointHit, midpointRec := midpoint.Hit(ray, rayLength, nil)
+		sahHit, sahRec := sah.Hit(ray, rayLength, nil)
+
+		assert.Equal(t, midpointHit, sahHit)
+		if midpointHit {
+			assert.Equal(t, midpointRec.RayLength, sahRec.RayLength)
+		}
+	}
+}
+
+func TestBvhWithSingleObject(t *testing.T) {
+	sphere := hittable.NewSphere(geo.ZeroVector, 1, material.NewLight(1, 1, 1))
+	bvh := hittable.NewBoundingVolumeHierarchy([]hittable.Hittable{sphere})
+
+	assert.Equal(t, sphere, bvh)
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DanielPettersson/solstrale"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+func renderError(scene *renderer.Scene, imageWidth, imageHeight int) error {
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go solstrale.RayTrace(imageWidth, imageHeight, scene, renderProgress, make(chan bool))
+
+	var err error
+	for p := range renderProgress {
+		if p.Error != nil {
+			err = p.Error
+		}
+	}
+	return err
+}
+
+func TestResumeCheckpointWithMoreSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "render.checkpoint")
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 8,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Seed:            2,
+	}
+	expected := renderBuffers(createTestScene(traceSpec), 20, 10)
+
+	traceSpec.SamplesPerPixel = 3
+	traceSpec.Checkpoint = &renderer.CheckpointConfig{Path: path, SceneHash: "test"}
+	renderBuffers(createTestScene(traceSpec), 20, 10)
+	assert.FileExists(t, path)
+
+	traceSpec.SamplesPerPixel = 8
+	traceSpec.Checkpoint.Resume = true
+	actual := renderBuffers(createTestScene(traceSpec), 20, 10)
+
+	assert.Equal(t, expected, actual)
+	assert.NoFileExists(t, path+".tmp")
+}
+
+func TestResumeAbortedRender(t *testing.T) {
+	for _, tiles := range []*renderer.TileConfig{nil, {Size: 3, SamplesPerPass: 2}} {
+		path := filepath.Join(t.TempDir(), "render.checkpoint")
+
+		traceSpec := renderer.RenderConfig{
+			SamplesPerPixel: 20,
+			Shader:          renderer.PathTracingShader{MaxDepth: 50},
+			Tiles:           tiles,
+		}
+		expected := renderBuffers(createTestScene(traceSpec), 10, 10)
+
+		traceSpec.Checkpoint = &renderer.CheckpointConfig{Path: path, Resume: true}
+
+		renderProgress := make(chan renderer.RenderProgress, 1)
+		abort := make(chan bool, 1)
+		go solstrale.RayTrace(10, 10, createTestScene(traceSpec), renderProgress, abort)
+		for p := range renderProgress {
+			assert.Nil(t, p.Buffers)
+			select {
+			case abort <- true:
+			default:
+			}
+		}
+		assert.FileExists(t, path)
+
+		actual := renderBuffers(createTestScene(traceSpec), 10, 10)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestCheckpointWhileRenderingTiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "render.checkpoint")
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 5,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Tiles:           &renderer.TileConfig{Size: 4},
+	}
+	expected := renderBuffers(createTestScene(traceSpec), 20, 10)
+
+	// Workers are stopped for saving a checkpoint after every tile
+	traceSpec.Checkpoint = &renderer.CheckpointConfig{Path: path, Interval: time.Nanosecond}
+	actual := renderBuffers(createTestScene(traceSpec), 20, 10)
+
+	assert.Equal(t, expected, actual)
+	assert.FileExists(t, path)
+}
+
+func TestResumeCheckpointErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "render.checkpoint")
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 1,
+		Shader:          renderer.SimpleShader{},
+		Checkpoint:      &renderer.CheckpointConfig{Path: path, SceneHash: "a"},
+	}
+	assert.Nil(t, renderError(createTestScene(traceSpec), 10, 10))
+
+	traceSpec.Checkpoint = &renderer.CheckpointConfig{Path: path, SceneHash: "b", Resume: true}
+	assert.EqualError(t, renderError(createTestScene(traceSpec), 10, 10), "Checkpoint is for a different scene")
+
+	traceSpec.Checkpoint.SceneHash = "a"
+	assert.EqualError(t, renderError(createTestScene(traceSpec), 20, 10), "Checkpoint has image size 10x10, but the render has 20x10")
+
+	traceSpec.Seed = 1
+	assert.EqualError(t, renderError(createTestScene(traceSpec), 10, 10), "Checkpoint has seed 0, but the render has seed 1")
+
+	os.WriteFile(path, []byte("not a checkpoint"), 0644)
+	err := renderError(createTestScene(traceSpec), 10, 10)
+	assert.Contains(t, err.Error(), "Failed to read checkpoint")
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/distributed"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadSceneDescription(t *testing.T, path string) (distributed.SceneDescription, *renderer.Scene) {
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	description := distributed.SceneDescription{Data: data, Format: scene.FormatYaml}
+
+	s, err := scene.Parse(description.Data, description.Format, "scenes")
+	assert.Nil(t, err)
+	return description, s
+}
+
+func renderDistributed(workers []string, description distributed.SceneDescription, s *renderer.Scene, abort <-chan bool) []renderer.RenderProgress {
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go distributed.RayTrace(workers, description, 20, 10, s, renderProgress, abort)
+
+	var progresses []renderer.RenderProgress
+	for p := range renderProgress {
+		progresses = append(progresses, p)
+	}
+	return progresses
+}
+
+func assertBuffersInDelta(t *testing.T, expected, actual *renderer.RenderBuffers) {
+	assert.Equal(t, expected.SampleCounts, actual.SampleCounts)
+	for i := range expected.Color {
+		assertVec3InDelta(t, expected.Color[i], actual.Color[i])
+		assertVec3InDelta(t, expected.Albedo[i], actual.Albedo[i])
+		assertVec3InDelta(t, expected.Normal[i], actual.Normal[i])
+	}
+}
+
+func TestDistributedRenderGivesSameImageAsLocal(t *testing.T) {
+	description, s := loadSceneDescription(t, "scenes/simple.yaml")
+	expected := renderBuffers(s, 20, 10)
+
+	worker1 := httptest.NewServer(distributed.NewWorker("scenes"))
+	defer worker1.Close()
+	worker2 := httptest.NewServer(distributed.NewWorker("scenes"))
+	defer worker2.Close()
+
+	progresses := renderDistributed([]string{worker1.URL, worker2.Listener.Addr().String()}, description, s, make(chan bool))
+
+	for _, p := range progresses {
+		assert.Nil(t, p.Error)
+		assert.NotNil(t, p.RenderImage)
+	}
+	last := progresses[len(progresses)-1]
+	assert.Equal(t, 1., last.Progress)
+	assertBuffersInDelta(t, expected, last.Buffers)
+}
+
+func TestDistributedRenderRetriesFailedJobs(t *testing.T) {
+	description, s := loadSceneDescription(t, "scenes/simple.yaml")
+	expected := renderBuffers(s, 20, 10)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Out of memory", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	worker := httptest.NewServer(distributed.NewWorker("scenes"))
+	defer worker.Close()
+
+	progresses := renderDistributed([]string{failing.URL, worker.URL}, description, s, make(chan bool))
+
+	last := progresses[len(progresses)-1]
+	assert.Nil(t, last.Error)
+	assertBuffersInDelta(t, expected, last.Buffers)
+}
+
+func TestDistributedRenderFailsWhenAllWorkersFail(t *testing.T) {
+	description, s := loadSceneDescription(t, "scenes/simple.yaml")
+	worker := httptest.NewServer(distributed.NewWorker("scenes"))
+	defer worker.Close()
+
+	// The scene is valid for the coordinator, but not for the worker
+	description.Data = []byte("camera: {}")
+	progresses := renderDistributed([]string{worker.URL}, description, s, make(chan bool))
+
+	assert.Len(t, progresses, 1)
+	assert.EqualError(t, progresses[0].Error, "All workers failed. Last error: Worker "+worker.URL+" failed: camera: missing required field 'verticalFovDegrees'")
+}
+
+func TestDistributedRenderWithoutWorkers(t *testing.T) {
+	description, s := loadSceneDescription(t, "scenes/simple.yaml")
+	progresses := renderDistributed(nil, description, s, make(chan bool))
+
+	assert.Len(t, progresses, 1)
+	assert.EqualError(t, progresses[0].Error, "No workers to render on")
+}
+
+func TestAbortDistributedRender(t *testing.T) {
+	description, s := loadSceneDescription(t, "scenes/simple.yaml")
+	s.RenderConfig.SamplesPerPixel = 100000
+	worker := httptest.NewServer(distributed.NewWorker("scenes"))
+	defer worker.Close()
+
+	abort := make(chan bool, 1)
+	abort <- true
+	progresses := renderDistributed([]string{worker.URL}, description, s, abort)
+
+	assert.Len(t, progresses, 0)
+}
+
+func TestDistributedWorkerRejectsTooLargeJobs(t *testing.T) {
+	description, _ := loadSceneDescription(t, "scenes/simple.yaml")
+	worker := httptest.NewServer(distributed.NewWorker("scenes"))
+	defer worker.Close()
+
+	post := func(body []byte) (int, string) {
+		res, err := http.Post(worker.URL+"/render", "application/octet-stream", bytes.NewReader(body))
+		assert.Nil(t, err)
+		defer res.Body.Close()
+		message, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		return res.StatusCode, strings.TrimSpace(string(message))
+	}
+	postJob := func(job distributed.Job) (int, string) {
+		var body bytes.Buffer
+		assert.Nil(t, gob.NewEncoder(&body).Encode(job))
+		return post(body.Bytes())
+	}
+
+	status, message := postJob(distributed.Job{Scene: description, Width: 100000, Height: 100000, SampleStart: 1, SampleEnd: 2})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Image size 100000x100000 is more than 67108864 pixels", message)
+
+	status, message = postJob(distributed.Job{Scene: description, Width: 20, Height: 10, SampleStart: 1, SampleEnd: 1 << 30})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Sample range 1 to 1073741824 is more than 1048576 samples", message)
+
+	description.Data = make([]byte, 17<<20)
+	status, message = postJob(distributed.Job{Scene: description, Width: 20, Height: 10, SampleStart: 1, SampleEnd: 2})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, message, "request body too large")
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/environment"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hdrimage"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadExr(t *testing.T) {
+	var b bytes.Buffer
+	err := hdrimage.WriteExr(&b, 3, 2, hdrimage.Layer{Pixels: hdrTestPixels})
+	assert.Nil(t, err)
+
+	img, err := hdrimage.ReadExr(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, hdrimage.Image{Width: 3, Height: 2, Pixels: hdrTestPixels}, img)
+}
+
+func TestReadZipCompressedHalfExr(t *testing.T) {
+	img, err := hdrimage.Load("textures/zipHalf.exr")
+	assert.Nil(t, err)
+
+	// The image spans two chunks of 16 scanlines, with pixel values given by the position
+	assert.Equal(t, 5, img.Width)
+	assert.Equal(t, 20, img.Height)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			assert.Equal(t, geo.NewVec3(float64(x)/4, float64(y)/2, 1), img.Pixels[y*img.Width+x])
+		}
+	}
+}
+
+func TestReadPfmAndHdr(t *testing.T) {
+	var b bytes.Buffer
+	assert.Nil(t, hdrimage.WritePfm(&b, 3, 2, hdrTestPixels))
+	img, err := hdrimage.ReadPfm(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, hdrimage.Image{Width: 3, Height: 2, Pixels: hdrTestPixels}, img)
+
+	b.Reset()
+	assert.Nil(t, hdrimage.WriteHdr(&b, 3, 2, hdrTestPixels))
+	img, err = hdrimage.ReadHdr(&b)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, img.Width)
+	assert.Equal(t, 2, img.Height)
+	assert.InDelta(t, 100, img.Pixels[3].Z, .5)
+}
+
+func TestLoadHdrImageErrors(t *testing.T) {
+	_, err := hdrimage.Load("textures/tex.jpg")
+	assert.EqualError(t, err, "Unsupported hdr image extension: textures/tex.jpg")
+
+	_, err = hdrimage.Load("textures/missing.exr")
+	assert.EqualError(t, err, "Failed to open hdr image: open textures/missing.exr: no such file or directory")
+
+	_, err = hdrimage.ReadExr(bytes.NewReader([]byte("not an exr image")))
+	assert.EqualError(t, err, "Not an OpenEXR image")
+}
+
+func createTestEnvironments(t *testing.T) map[string]environment.Environment {
+	sky, err := environment.LoadImage("textures/sky.hdr", 2, 70)
+	assert.Nil(t, err)
+
+	return map[string]environment.Environment{
+		"constant": environment.NewConstant(geo.NewVec3(.5, .6, .7)),
+		"gradient": environment.NewGradient(geo.NewVec3(.2, .4, 1), geo.NewVec3(.8, .9, 1), geo.NewVec3(.1, .1, .1)),
+		"image":    sky,
+	}
+}
+
+func TestEnvironmentSamplingMatchesPdf(t *testing.T) {
+	const n = 200000
+	rng := random.NewRng(1)
+
+	for name, env := range createTestEnvironments(t) {
+		sampled := geo.ZeroVector
+		uniform := geo.ZeroVector
+		for i := 0; i < n; i++ {
+			dir := env.Generate(rng)
+			sampled = sampled.Add(env.Color(dir).DivS(env.Value(dir)))
+
+			dir = geo.RandomUnitVector(rng)
+			uniform = uniform.Add(env.Color(dir).MulS(4 * math.Pi))
+		}
+		sampled = sampled.DivS(n)
+		uniform = uniform.DivS(n)
+
+		// The pdf is integrated over a fine grid of equal solid angle cells,
+		// as random directions rarely hit the small bright parts of the image
+		const rows, columns = 1000, 2000
+		pdfIntegral := 0.
+		for i := 0; i < rows; i++ {
+			y := 1 - 2*(float64(i)+.5)/rows
+			r := math.Sqrt(1 - y*y)
+			for j := 0; j < columns; j++ {
+				phi := 2 * math.Pi * (float64(j) + .5) / columns
+				pdfIntegral += env.Value(geo.NewVec3(r*math.Cos(phi), y, r*math.Sin(phi)))
+			}
+		}
+		pdfIntegral *= 4 * math.Pi / (rows * columns)
+
+		assert.InDelta(t, 1, pdfIntegral, .01, name)
+		assert.InEpsilon(t, uniform.X, sampled.X, .05, name)
+		assert.InEpsilon(t, uniform.Y, sampled.Y, .05, name)
+		assert.InEpsilon(t, uniform.Z, sampled.Z, .05, name)
+	}
+}
+
+func TestImageEnvironmentSamplesBrightPixels(t *testing.T) {
+	sky, err := environment.LoadImage("textures/sky.hdr", 1, 0)
+	assert.Nil(t, err)
+	rng := random.NewRng(1)
+
+	// The four sun pixels give more light than the rest of the sky, though they cover a tiny part of it
+	sunSamples := 0
+	for i := 0; i < 1000; i++ {
+		if sky.Color(sky.Generate(rng)).X > 100 {
+			sunSamples++
+		}
+	}
+	assert.Greater(t, sunSamples, 500)
+}
+
+func TestImageEnvironmentRotationAndIntensity(t *testing.T) {
+	sky, err := environment.LoadImage("textures/sky.hdr", 1, 0)
+	assert.Nil(t, err)
+	rotated, err := environment.LoadImage("textures/sky.hdr", 3, 90)
+	assert.Nil(t, err)
+
+	// The center of the image is in the negative z direction
+	direction := geo.NewVec3(.3, .2, -1)
+	rotatedDirection := geo.NewVec3(-1, .2, -.3)
+	assertVec3InDelta(t, sky.Color(direction).MulS(3), rotated.Color(rotatedDirection))
+	assert.InDelta(t, sky.Value(direction), rotated.Value(rotatedDirection), 1e-9)
+}
+
+func TestRenderEnvironment(t *testing.T) {
+	sky, err := environment.LoadImage("textures/sky.hdr", 1, 30)
+	assert.Nil(t, err)
+
+	scene := createMaterialScene(renderer.RenderConfig{
+		SamplesPerPixel: 20,
+		Shader:          renderer.MisPathTracingShader{MaxDepth: 50},
+	}, []material.Material{
+		material.NewLambertian(material.NewSolidColor(.8, .8, .8)),
+		material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorAluminium, .3, material.Ggx),
+		material.NewDielectric(material.NewSolidColor(1, 1, 1), 1.5),
+	})
+	scene.Environment = sky
+
+	renderAndCompareOutput(t, scene, "environment", 200, 100)
+}
+
+func TestRenderEnvironmentWithoutLights(t *testing.T) {
+	scene := createSimpleTestScene(renderer.RenderConfig{
+		SamplesPerPixel: 5,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}, false)
+	scene.Environment = environment.NewGradient(geo.NewVec3(.2, .4, 1), geo.NewVec3(.8, .9, 1), geo.NewVec3(.1, .1, .1))
+
+	buffers := renderBuffers(scene, 20, 10)
+	assert.NotNil(t, buffers)
+}
+
+func TestParseSceneEnvironment(t *testing.T) {
+	cam := `"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0]}`
+
+	s, err := scene.Parse([]byte(`{`+cam+`, "world": [], "environment": {"type": "image", "path": "textures/sky.hdr", "intensity": 2, "rotation": 45}}`), scene.FormatJson, ".")
+	assert.Nil(t, err)
+	expected, _ := environment.LoadImage("textures/sky.hdr", 2, 45)
+	assert.Equal(t, expected, s.Environment)
+
+	s, err = scene.Parse([]byte(`{`+cam+`, "world": [], "environment": {"type": "gradient", "zenith": [0, 0, 1], "horizon": [1, 1, 1]}}`), scene.FormatJson, "")
+	assert.Nil(t, err)
+	assert.Equal(t, environment.NewGradient(geo.NewVec3(0, 0, 1), geo.NewVec3(1, 1, 1), geo.ZeroVector), s.Environment)
+
+	errors := map[string]string{
+		`"background": [1, 1, 1], "environment": {"type": "constant", "color": [1, 1, 1]}`: "only one of 'background' and 'environment' can be given",
+		`"environment": {"type": "sun"}`:                          "environment: unknown environment type 'sun'",
+		`"environment": {"type": "image", "path": "missing.hdr"}`: "environment: Failed to open hdr image: open missing.hdr: no such file or directory",
+	}
+	for environment, expectedError := range errors {
+		_, err := scene.Parse([]byte(`{`+cam+`, "world": [], `+environment+`}`), scene.FormatJson, "")
+		assert.EqualError(t, err, expectedError)
+	}
+}
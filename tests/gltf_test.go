@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/gltf"
+	"github.com/DanielPettersson/solstrale/hittable"
+	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/light"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGltfHittable(t *testing.T) {
+	h, err := gltf.LoadHittable("gltf/scene.gltf")
+	assert.Nil(t, err)
+
+	red := material.NewPrincipled(material.PrincipledConfig{
+		BaseColor: material.NewSolidColor(.8, .2, .2),
+		Roughness: .5,
+		Specular:  .5,
+	})
+	rec := hitFromAbove(t, h, .5, .5)
+	assert.Equal(t, red, rec.Material)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+
+	// The same mesh in a child node, that is translated by its parent and scaled
+	rec = hitFromAbove(t, h, 6.5, 1.5)
+	assert.Equal(t, red, rec.Material)
+	assertVec3InDelta(t, geo.NewVec3(6.5, 0, 1.5), rec.HitPoint)
+
+	rec = hitFromAbove(t, h, 10.5, .5)
+	assert.Equal(t, material.NewEmissive(
+		material.NewPrincipled(material.PrincipledConfig{Roughness: 1, Specular: .5}),
+		material.NewSolidColor(4, 2, 1),
+	), rec.Material)
+
+	ior := 1.33
+	r0 := (ior - 1) / (ior + 1)
+	rec = hitFromAbove(t, h, 15.5, .5)
+	assert.Equal(t, material.NewPrincipled(material.PrincipledConfig{
+		Specular:          r0 * r0 / .08,
+		Transmission:      1,
+		IndexOfRefraction: ior,
+	}), rec.Material)
+
+	// Rotated half a turn around the Y axis, and with the default material
+	rec = hitFromAbove(t, h, 19.5, -.5)
+	assert.Equal(t, material.NewPrincipled(material.PrincipledConfig{Metallic: 1, Roughness: 1, Specular: .5}), rec.Material)
+	assert.True(t, rec.FrontFace)
+
+	lights := hittable.FindLights(h)
+	assert.Equal(t, 2, len(lights))
+}
+
+func TestLoadGltfScene(t *testing.T) {
+	s, err := gltf.Load("gltf/scene.gltf")
+	assert.Nil(t, err)
+
+	assert.InDelta(t, .6*180/math.Pi, s.Camera.VerticalFovDegrees, 1e-9)
+	assertVec3InDelta(t, geo.NewVec3(0, 2, 10), s.Camera.LookFrom)
+	assertVec3InDelta(t, geo.NewVec3(0, 0, -1), s.Camera.LookAt.Sub(s.Camera.LookFrom).Unit())
+	assert.InDelta(t, s.Camera.FocusDistance, s.Camera.LookAt.Sub(s.Camera.LookFrom).Length(), 1e-9)
+	assert.Equal(t, renderer.PathTracingShader{MaxDepth: 50}, s.RenderConfig.Shader)
+
+	assert.Equal(t, 3, len(s.Lights))
+	assert.Equal(t, light.NewPoint(geo.NewVec3(0, 3, 0), geo.NewVec3(10, 5, 5)), s.Lights[0])
+
+	// The spot light shines down, in a cone with half the angle 0.4 radians
+	sample := s.Lights[1].Sample(geo.ZeroVector, testRng)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), sample.Direction)
+	assertVec3InDelta(t, geo.NewVec3(.8, .8, .8), sample.Color)
+	assert.Equal(t, geo.ZeroVector, s.Lights[1].Sample(geo.NewVec3(3, 0, 0), testRng).Color)
+
+	sample = s.Lights[2].Sample(geo.NewVec3(1, 2, 3), testRng)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), sample.Direction)
+	assertVec3InDelta(t, geo.NewVec3(2, 2, 1.8), sample.Color)
+}
+
+func TestLoadGlb(t *testing.T) {
+	h, err := gltf.LoadHittable("gltf/model.glb")
+	assert.Nil(t, err)
+	rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+	// The color of the texture is found by the diffuse reflection straight up
+	colorAt := func(x, z float64) geo.Vec3 {
+		rec := hitFromAbove(t, h, x, z)
+		assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+		ray := geo.NewRay(geo.NewVec3(x, 10, z), geo.NewVec3(0, -1, 0), 0)
+		_, scatterRecord := rec.Material.Scatter(ray, rec, testRng)
+		return scatterRecord.Bsdf.Eval(geo.NewVec3(1, 1, 0).Unit())
+	}
+
+	red := colorAt(.25, .25)
+	assert.Greater(t, red.X, red.Y)
+	assert.Greater(t, red.X, red.Z)
+	blue := colorAt(.25, .75)
+	assert.Greater(t, blue.Z, blue.X)
+	assert.Greater(t, blue.Z, blue.Y)
+	white := colorAt(.75, .75)
+	assert.InDelta(t, white.X, white.Z, 1e-9)
+
+	// The green part of the texture is transparent
+	hit, _ := h.Hit(geo.NewRay(geo.NewVec3(.75, 10, .25), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	assert.False(t, hit)
+
+	// The triangle with sparse positions
+	rec := hitFromAbove(t, h, 2.2, .2)
+	assertVec3InDelta(t, geo.NewVec3(2.2, 0, .2), rec.HitPoint)
+	hit, _ = h.Hit(geo.NewRay(geo.NewVec3(2.8, 10, .8), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	assert.False(t, hit)
+}
+
+func TestLoadGltfMaskWithOpaqueTexture(t *testing.T) {
+	h, err := gltf.LoadHittable("gltf/opaqueMask.gltf")
+	assert.Nil(t, err)
+
+	// The texture has no alpha channel, so nothing is cut away, not even the black texels.
+	// The texture is also used for emission, that is decoded from sRGB
+	rec := hitFromAbove(t, h, .25, .25)
+	assertVec3InDelta(t, geo.ZeroVector, rec.Material.Emitted(rec))
+	rec = hitFromAbove(t, h, .75, .25)
+	gray := im.SrgbToLinear(128. / 255)
+	assert.InDelta(t, .2158605, gray, 1e-6)
+	assertVec3InDelta(t, geo.NewVec3(gray, gray, gray), rec.Material.Emitted(rec))
+	rec = hitFromAbove(t, h, .25, .75)
+	assertVec3InDelta(t, geo.NewVec3(1, 1, 1), rec.Material.Emitted(rec))
+	rec = hitFromAbove(t, h, .75, .75)
+	assertVec3InDelta(t, geo.ZeroVector, rec.Material.Emitted(rec))
+}
+
+func TestLoadGltfErrors(t *testing.T) {
+	dir := t.TempDir()
+	quad := `"meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}],
+		"accessors": [{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}],
+		"bufferViews": [{"buffer": 0, "byteLength": 36}],
+		"buffers": [{"uri": "data:application/octet-stream;base64,AAAA", "byteLength": 3}]`
+
+	asset := `"asset": {"version": "2.0"}`
+	tests := []struct {
+		data          string
+		expectedError string
+	}{
+		{`{"asset": {"version": "1.0"}}`, "Unsupported glTF version: 1.0"},
+		{`{` + asset + `, "extensionsRequired": ["KHR_draco_mesh_compression"]}`, "Unsupported glTF extension: KHR_draco_mesh_compression"},
+		{`{` + asset + `, "nodes": [{"mesh": 0}], "meshes": [{"primitives": [{"attributes": {"POSITION": 3}}]}]}`, "Invalid accessor index: 3"},
+		{`{` + asset + `, "scenes": [{"nodes": [0]}], "nodes": [{"children": [1]}, {"children": [0]}]}`, "Node 0 is its own ancestor"},
+		{`{` + asset + `, "nodes": [{"mesh": 0}], ` + quad + `}`, "Buffer view 0 is outside of its buffer"},
+		{`{` + asset + `, "nodes": [{"camera": 0}]}`, "Invalid camera index: 0"},
+		{
+			`{` + asset + `, "nodes": [{"extensions": {"KHR_lights_punctual": {"light": 0}}}], "extensions": {"KHR_lights_punctual": {"lights": [{"type": "area"}]}}}`,
+			"Unknown light type: area",
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, "test.gltf")
+		assert.Nil(t, os.WriteFile(path, []byte(test.data), 0644))
+		_, err := gltf.LoadHittable(path)
+		assert.EqualError(t, err, test.expectedError)
+	}
+
+	path := filepath.Join(dir, "empty.gltf")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"asset": {"version": "2.0"}}`), 0644))
+	_, err := gltf.Load(path)
+	assert.EqualError(t, err, "No meshes in glTF file "+path)
+
+	_, err = gltf.Load("gltf/missing.gltf")
+	assert.EqualError(t, err, "Failed to read glTF file: open gltf/missing.gltf: no such file or directory")
+}
+
+func TestRenderGltfScene(t *testing.T) {
+	s, err := gltf.Load("gltf/scene.gltf")
+	assert.Nil(t, err)
+	s.RenderConfig.SamplesPerPixel = 4
+
+	buffers := renderBuffers(s, 20, 10)
+	mean, _ := meanAndError(buffers, buffers)
+	assert.Greater(t, mean, 0.)
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hdrimage"
+	"github.com/mdouchement/hdr"
+	"github.com/mdouchement/hdr/codec/pfm"
+	"github.com/mdouchement/hdr/codec/rgbe"
+	"github.com/stretchr/testify/assert"
+)
+
+var hdrTestPixels = []geo.Vec3{
+	geo.NewVec3(0, .5, 1),
+	geo.NewVec3(2, 4, 8),
+	geo.NewVec3(16, 32, 64),
+	geo.NewVec3(.25, .125, 100),
+	geo.NewVec3(1, 1, 1),
+	geo.NewVec3(3, 2, 1),
+}
+
+func TestWritePfm(t *testing.T) {
+	var b bytes.Buffer
+	err := hdrimage.WritePfm(&b, 3, 2, hdrTestPixels)
+	assert.Nil(t, err)
+
+	img, err := pfm.Decode(&b)
+	assert.Nil(t, err)
+	assertHdrImage(t, img.(hdr.Image), 0)
+}
+
+func TestWriteHdr(t *testing.T) {
+	var b bytes.Buffer
+	err := hdrimage.WriteHdr(&b, 3, 2, hdrTestPixels)
+	assert.Nil(t, err)
+
+	img, err := rgbe.Decode(&b)
+	assert.Nil(t, err)
+	// RGBE has a shared exponent for all channels, so it loses precision
+	// for small components in pixels with a large component
+	assertHdrImage(t, img.(hdr.Image), .5)
+}
+
+func assertHdrImage(t *testing.T, img hdr.Image, delta float64) {
+	assert.Equal(t, 3, img.Bounds().Dx())
+	assert.Equal(t, 2, img.Bounds().Dy())
+	for i, expected := range hdrTestPixels {
+		r, g, b, _ := img.HDRAt(i%3, i/3).HDRRGBA()
+		assert.InDelta(t, expected.X, r, delta)
+		assert.InDelta(t, expected.Y, g, delta)
+		assert.InDelta(t, expected.Z, b, delta)
+	}
+}
+
+func TestWriteExr(t *testing.T) {
+	normals := make([]geo.Vec3, len(hdrTestPixels))
+	for i := range normals {
+		normals[i] = geo.NewVec3(0, 1, 0)
+	}
+
+	var b bytes.Buffer
+	err := hdrimage.WriteExr(&b, 3, 2, hdrimage.Layer{Pixels: hdrTestPixels}, hdrimage.Layer{Name: "normal", Pixels: normals})
+	assert.Nil(t, err)
+	data := b.Bytes()
+
+	assert.Equal(t, uint32(20000630), binary.LittleEndian.Uint32(data))
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[4:]))
+	assert.True(t, bytes.Contains(data, []byte("B\x00\x02\x00\x00\x00")))
+	assert.True(t, bytes.Contains(data, []byte("normal.G\x00\x02\x00\x00\x00")))
+
+	// Read the channels in alphabetical order B, G, R, normal.B, normal.G, normal.R
+	// from the scanlines pointed to by the offset table. The last header attribute is followed
+	// by its size, a float value and the end of header byte
+	lastAttribute := []byte("screenWindowWidth\x00float\x00")
+	headerEnd := bytes.Index(data, lastAttribute) + len(lastAttribute) + 4 + 4 + 1
+	for y := 0; y < 2; y++ {
+		offset := binary.LittleEndian.Uint64(data[headerEnd+y*8:])
+		line := data[offset:]
+		assert.Equal(t, uint32(y), binary.LittleEndian.Uint32(line))
+		assert.Equal(t, uint32(6*3*4), binary.LittleEndian.Uint32(line[4:]))
+
+		values := func(channel int) []float64 {
+			var ret []float64
+			for x := 0; x < 3; x++ {
+				bits := binary.LittleEndian.Uint32(line[8+(channel*3+x)*4:])
+				ret = append(ret, float64(math.Float32frombits(bits)))
+			}
+			return ret
+		}
+		for x := 0; x < 3; x++ {
+			p := hdrTestPixels[y*3+x]
+			assert.Equal(t, p.Z, values(0)[x])
+			assert.Equal(t, p.Y, values(1)[x])
+			assert.Equal(t, p.X, values(2)[x])
+			assert.Equal(t, 0., values(3)[x])
+			assert.Equal(t, 1., values(4)[x])
+			assert.Equal(t, 0., values(5)[x])
+		}
+	}
+	assert.Equal(t, headerEnd+2*8+2*(8+6*3*4), len(data))
+}
+
+func TestWriteHdrImageErrors(t *testing.T) {
+	var b bytes.Buffer
+	assert.EqualError(t, hdrimage.WritePfm(&b, 2, 2, hdrTestPixels), "Expected 4 pixels for image size 2x2, got 6")
+	assert.EqualError(t, hdrimage.WriteHdr(&b, 0, 2, hdrTestPixels), "Invalid image size 0x2")
+	assert.EqualError(t,
+		hdrimage.WriteExr(&b, 3, 2, hdrimage.Layer{Pixels: hdrTestPixels}, hdrimage.Layer{Pixels: hdrTestPixels}),
+		"Duplicate layer name: ''",
+	)
+	assert.EqualError(t, hdrimage.Save("out.tiff", 3, 2, hdrimage.Layer{Pixels: hdrTestPixels}), "Unsupported hdr image extension: out.tiff")
+	assert.EqualError(t, hdrimage.Save("out.exr", 3, 2), "No layers to save")
+}
+
+func TestSaveHdrImage(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"out.exr", "out.pfm", "out.hdr"} {
+		path := filepath.Join(dir, name)
+		assert.True(t, hdrimage.IsSupported(path))
+		assert.Nil(t, hdrimage.Save(path, 3, 2, hdrimage.Layer{Pixels: hdrTestPixels}))
+
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Greater(t, info.Size(), int64(0))
+	}
+	assert.False(t, hdrimage.IsSupported("out.png"))
+}
@@ -1,10 +1,13 @@
 package tests
 
 import (
+	"math"
 	"testing"
 
 	"github.com/DanielPettersson/solstrale/geo"
 	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,10 +16,181 @@ func TestNonPdfUsingHittable(t *testing.T) {
 	h := hittable.NonPdfLightHittable{}
 
 	assert.Panics(t, func() {
-		h.PdfValue(geo.RandomVec3(-1, 1), geo.RandomVec3(-1, 1))
+		h.PdfValue(geo.RandomVec3(testRng, -1, 1), geo.RandomVec3(testRng, -1, 1))
 	})
 
 	assert.Panics(t, func() {
-		h.RandomDirection(geo.RandomVec3(-1, 1))
+		h.RandomDirection(geo.RandomVec3(testRng, -1, 1), testRng)
 	})
 }
+
+func TestTransformLikeTranslationAndRotation(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	box := hittable.NewBox(geo.NewVec3(-1, -1, -1), geo.NewVec3(1, 2, 1), mat)
+
+	translation := hittable.NewTranslation(hittable.NewRotationY(box, 30), geo.NewVec3(1, 2, 3))
+	transform, err := hittable.NewTransform(box, geo.TranslationMatrix(geo.NewVec3(1, 2, 3)).Mul(geo.RotationMatrix(geo.NewVec3(0, 1, 0), 30)))
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		ray := geo.NewRay(geo.RandomVec3(testRng, -10, 10), geo.RandomUnitVector(testRng), 0)
+		rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+		hit1, rec1 := translation.Hit(ray, rayLength, nil)
+		hit2, rec2 := transform.Hit(ray, rayLength, nil)
+
+		assert.Equal(t, hit1, hit2)
+		if hit1 {
+			assertVec3InDelta(t, rec1.HitPoint, rec2.HitPoint)
+			assertVec3InDelta(t, rec1.Normal, rec2.Normal)
+			assert.InDelta(t, rec1.RayLength, rec2.RayLength, 1e-9)
+			assert.Equal(t, rec1.FrontFace, rec2.FrontFace)
+		}
+	}
+}
+
+func TestTransformWithScale(t *testing.T) {
+	light := material.NewLight(1, 1, 1)
+	sphere := hittable.NewSphere(geo.ZeroVector, 1, light)
+
+	transform, err := hittable.NewTransform(sphere, geo.TranslationMatrix(geo.NewVec3(0, 0, -5)).Mul(geo.ScaleMatrix(geo.NewVec3(2, 2, 2))))
+	assert.Nil(t, err)
+	scaledSphere := hittable.NewSphere(geo.NewVec3(0, 0, -5), 2, light)
+
+	ray := geo.NewRay(geo.ZeroVector, geo.NewVec3(0, 0, -1), 0)
+	hit, rec := transform.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
+	assert.True(t, hit)
+	assert.InDelta(t, 3, rec.RayLength, 1e-9)
+	assertVec3InDelta(t, geo.NewVec3(0, 0, -3), rec.HitPoint)
+	assertVec3InDelta(t, geo.NewVec3(0, 0, 1), rec.Normal)
+
+	// Ray length interval is respected
+	hit, _ = transform.Hit(ray, geo.Interval{Min: 0.001, Max: 2.9}, nil)
+	assert.False(t, hit)
+
+	// Pdf is the same as for the scaled sphere
+	for i := 0; i < 10; i++ {
+		origin := geo.RandomVec3(testRng, -1, 1)
+		direction := transform.RandomDirection(origin, testRng)
+		assert.InDelta(t, scaledSphere.PdfValue(origin, direction), transform.PdfValue(origin, direction), 1e-6)
+	}
+
+	assert.True(t, transform.IsLight())
+}
+
+func TestTransformNotInvertible(t *testing.T) {
+	sphere := hittable.NewSphere(geo.ZeroVector, 1, material.NewLight(1, 1, 1))
+	_, err := hittable.NewTransform(sphere, geo.ScaleMatrix(geo.NewVec3(1, 1, 0)))
+	assert.EqualError(t, err, "Transform matrix is not invertible")
+}
+
+func TestTransformPdfIntegratesToOne(t *testing.T) {
+	sphere := hittable.NewSphere(geo.ZeroVector, 1, material.NewLight(1, 1, 1))
+	ellipsoid, err := hittable.NewTransform(sphere, geo.TranslationMatrix(geo.NewVec3(1, 0, -4)).Mul(geo.ScaleMatrix(geo.NewVec3(1, 2, .5))))
+	assert.Nil(t, err)
+
+	// Monte Carlo integration of the pdf over all directions
+	n := 200000
+	sum := 0.
+	for i := 0; i < n; i++ {
+		sum += ellipsoid.PdfValue(geo.ZeroVector, geo.RandomUnitVector(testRng))
+	}
+	assert.InDelta(t, 1, sum/float64(n)*4*math.Pi, .05)
+}
+
+func TestTransformInstancesOfBvh(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	bvh := hittable.NewBoundingVolumeHierarchy([]hittable.Hittable{
+		hittable.NewTriangle(geo.NewVec3(-1, -1, 0), geo.NewVec3(1, -1, 0), geo.NewVec3(0, 1, 0), mat),
+		hittable.NewTriangle(geo.NewVec3(-1, -1, -1), geo.NewVec3(1, -1, -1), geo.NewVec3(0, 1, -1), mat),
+	})
+
+	world := hittable.NewHittableList()
+	for i := 0; i < 3; i++ {
+		instance, err := hittable.NewTransform(bvh, geo.TranslationMatrix(geo.NewVec3(float64(i*3), 0, 0)).Mul(geo.RotationMatrix(geo.NewVec3(0, 1, 0), 180)))
+		assert.Nil(t, err)
+		world.Add(instance)
+	}
+
+	for i := 0; i < 3; i++ {
+		ray := geo.NewRay(geo.NewVec3(float64(i*3), 0, 5), geo.NewVec3(0, 0, -1), 0)
+		hit, rec := world.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
+		assert.True(t, hit)
+		// Rotated half a turn, so the triangle at z=-1 is now closest
+		assertVec3InDelta(t, geo.NewVec3(float64(i*3), 0, 1), rec.HitPoint)
+	}
+
+	ray := geo.NewRay(geo.NewVec3(1.5, 0, 5), geo.NewVec3(0, 0, -1), 0)
+	hit, _ := world.Hit(ray, geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
+	assert.False(t, hit)
+}
+
+func TestFindLightsInContainersAndWrappers(t *testing.T) {
+	light := material.NewLight(1, 1, 1)
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	triangles := []hittable.Hittable{
+		hittable.NewTriangle(geo.NewVec3(-1, 0, 0), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 1, 0), light),
+		hittable.NewTriangle(geo.NewVec3(-1, 0, 1), geo.NewVec3(1, 0, 1), geo.NewVec3(0, 1, 1), mat),
+		hittable.NewTriangle(geo.NewVec3(-1, 0, 2), geo.NewVec3(1, 0, 2), geo.NewVec3(0, 1, 2), light),
+	}
+	sphere := hittable.NewSphere(geo.ZeroVector, 1, light)
+	transformed, err := hittable.NewTransform(hittable.NewBoundingVolumeHierarchy(triangles), geo.ScaleMatrix(geo.NewVec3(2, 2, 2)))
+	assert.Nil(t, err)
+
+	world := hittable.NewHittableList()
+	world.Add(hittable.NewSphere(geo.ZeroVector, 1, mat))
+	world.Add(hittable.NewBoundingVolumeHierarchy(triangles))
+	world.Add(hittable.NewBoundingVolumeHierarchyWithOptions(triangles, hittable.BvhOptions{SplitMethod: hittable.SplitSah}))
+	world.Add(hittable.NewTranslation(sphere, geo.NewVec3(1, 2, 3)))
+	world.Add(hittable.NewRotationY(hittable.NewTranslation(sphere, geo.NewVec3(1, 2, 3)), 90))
+	world.Add(hittable.NewMotionBlur(sphere, geo.NewVec3(1, 0, 0)))
+	world.Add(transformed)
+	world.Add(hittable.NewConstantMedium(hittable.NewSphere(geo.ZeroVector, 1, mat), .1, geo.NewVec3(1, 1, 1)))
+
+	lights := hittable.FindLights(&world)
+	assert.Equal(t, 9, len(lights))
+	for _, l := range lights {
+		assert.True(t, l.IsLight())
+	}
+
+	// The wrapped lights are placed as in the world
+	assert.True(t, hitsLightAt(lights[4], geo.NewVec3(1, 2, 3)))
+	assert.True(t, hitsLightAt(lights[5], geo.NewVec3(3, 2, -1)))
+	assert.False(t, hitsLightAt(lights[5], geo.NewVec3(1, 2, 3)))
+	assert.True(t, hitsLightAt(lights[7], geo.NewVec3(0, 1, 0)))
+}
+
+// hitsLightAt returns if a ray from far away hits the light at the point
+func hitsLightAt(l hittable.Hittable, point geo.Vec3) bool {
+	origin := point.Add(geo.NewVec3(.1, .2, -10))
+	hit, _ := l.Hit(geo.NewRay(origin, point.Sub(origin), 0), geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
+	return hit
+}
+
+func TestWrappedLightPdfs(t *testing.T) {
+	light := material.NewLight(1, 1, 1)
+	origin := geo.NewVec3(.5, -1, .2)
+
+	wrapped := map[string]struct {
+		wrapped hittable.Hittable
+		placed  hittable.Hittable
+	}{
+		"translation": {
+			hittable.NewTranslation(hittable.NewSphere(geo.ZeroVector, .5, light), geo.NewVec3(1, 2, 3)),
+			hittable.NewSphere(geo.NewVec3(1, 2, 3), .5, light),
+		},
+		"rotationY": {
+			hittable.NewRotationY(hittable.NewQuad(geo.NewVec3(1, 2, 0), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, 1), light), 90),
+			hittable.NewQuad(geo.NewVec3(0, 2, -1), geo.NewVec3(0, 0, -1), geo.NewVec3(1, 0, 0), light),
+		},
+	}
+
+	for name, w := range wrapped {
+		for i := 0; i < 100; i++ {
+			direction := w.wrapped.RandomDirection(origin, testRng)
+			pdf := w.placed.PdfValue(origin, direction)
+			assert.Greater(t, pdf, 0., name)
+			assert.InEpsilon(t, pdf, w.wrapped.PdfValue(origin, direction), 1e-6, name)
+		}
+	}
+}
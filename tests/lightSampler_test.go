@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestLights creates a row of lights, where only the first light is bright
+func createTestLights() *hittable.HittableList {
+	lights := hittable.NewHittableList()
+	lights.Add(hittable.NewSphere(geo.NewVec3(-4, 3, 0), .5, material.NewLight(50, 50, 50)))
+	for i := 1; i < 9; i++ {
+		lights.Add(hittable.NewSphere(geo.NewVec3(float64(i)-4, 3, 0), .3, material.NewLight(1, 1, 1)))
+	}
+	lights.Add(hittable.NewQuad(geo.NewVec3(5, 3, 0), geo.NewVec3(0, 0, 1), geo.NewVec3(1, 0, 0), material.NewLight(2, 2, 2)))
+	return &lights
+}
+
+func createTestLightSamplers(lights *hittable.HittableList) map[string]hittable.LightSampler {
+	return map[string]hittable.LightSampler{
+		"uniform": hittable.NewUniformLightSampler(lights),
+		"power":   hittable.NewPowerLightSampler(lights.List()),
+		"tree":    hittable.NewLightTree(lights.List()),
+	}
+}
+
+// emittedInDirection returns the luminance of the light hit in the direction
+func emittedInDirection(lights *hittable.HittableList, origin, direction geo.Vec3) float64 {
+	hit, rec := lights.Hit(geo.NewRay(origin, direction, 0), geo.Interval{Min: 0.001, Max: util.Infinity}, nil)
+	if !hit {
+		return 0
+	}
+	return rec.Material.Emitted(rec).Luminance()
+}
+
+func TestLightSamplersEstimateSameLight(t *testing.T) {
+	lights := createTestLights()
+	origin := geo.NewVec3(-1, 0, 1)
+
+	estimates := map[string]float64{}
+	for name, sampler := range createTestLightSamplers(lights) {
+		rng := random.NewRng(1)
+		p := sampler.Pdf(origin)
+		const n = 100000
+		sum := 0.
+		for i := 0; i < n; i++ {
+			direction := p.Generate(rng)
+			sum += emittedInDirection(lights, origin, direction) / p.Value(direction)
+		}
+		estimates[name] = sum / n
+	}
+
+	assert.InEpsilon(t, estimates["uniform"], estimates["power"], .02)
+	assert.InEpsilon(t, estimates["uniform"], estimates["tree"], .02)
+}
+
+func TestLightSamplersChooseBrightLights(t *testing.T) {
+	lights := createTestLights()
+	origin := geo.NewVec3(0, 0, 0)
+	brightLight := lights.List()[0]
+
+	for name, expectedShare := range map[string]float64{"uniform": .15, "power": .7, "tree": .5} {
+		p := createTestLightSamplers(lights)[name].Pdf(origin)
+		rng := random.NewRng(1)
+		bright := 0
+		const n = 10000
+		for i := 0; i < n; i++ {
+			direction := p.Generate(rng)
+			if hit, _ := brightLight.Hit(geo.NewRay(origin, direction, 0), geo.Interval{Min: 0.001, Max: util.Infinity}, nil); hit {
+				bright++
+			}
+		}
+		if name == "uniform" {
+			assert.Less(t, float64(bright)/n, expectedShare, name)
+		} else {
+			assert.Greater(t, float64(bright)/n, expectedShare, name)
+		}
+	}
+}
+
+func TestLightTreeChoosesCloseLights(t *testing.T) {
+	lights := hittable.NewHittableList()
+	for x := 0; x < 10; x++ {
+		for z := 0; z < 10; z++ {
+			lights.Add(hittable.NewSphere(geo.NewVec3(float64(x)*2, 2, float64(z)*2), .2, material.NewLight(5, 5, 5)))
+		}
+	}
+	closeLight := lights.List()[0]
+	origin := geo.NewVec3(0, 1.5, 0)
+
+	// With 100 equal lights, the closest light gets many more samples than the one in a hundred of uniform sampling
+	p := hittable.NewLightTree(lights.List()).Pdf(origin)
+	rng := random.NewRng(1)
+	closeSamples := 0
+	for i := 0; i < 1000; i++ {
+		direction := p.Generate(rng)
+		if hit, _ := closeLight.Hit(geo.NewRay(origin, direction, 0), geo.Interval{Min: 0.001, Max: util.Infinity}, nil); hit {
+			closeSamples++
+		}
+	}
+	assert.Greater(t, closeSamples, 100)
+}
+
+// unknownPowerLight is a light implemented outside of the hittable package, so that its power can not be estimated
+type unknownPowerLight struct {
+	hittable.Hittable
+}
+
+func TestPowerLightSamplerWithWrappedLightOfUnknownPower(t *testing.T) {
+	light := unknownPowerLight{hittable.NewSphere(geo.NewVec3(-2, 3, 0), .5, material.NewLight(1, 1, 1))}
+	transformed, err := hittable.NewTransform(light, geo.IdentityMatrix())
+	assert.Nil(t, err)
+	wrappers := map[string]hittable.Hittable{
+		"none":        light,
+		"translation": hittable.NewTranslation(light, geo.ZeroVector),
+		"rotationY":   hittable.NewRotationY(light, 0),
+		"motionBlur":  hittable.NewMotionBlur(light, geo.ZeroVector),
+		"transform":   transformed,
+	}
+	origin := geo.NewVec3(0, 0, 0)
+
+	for name, wrapped := range wrappers {
+		// The light of unknown power gets the average power of the other lights, the same as the equal light
+		lights := []hittable.Hittable{wrapped, hittable.NewSphere(geo.NewVec3(2, 3, 0), .5, material.NewLight(1, 1, 1))}
+		p := hittable.NewPowerLightSampler(lights).Pdf(origin)
+		rng := random.NewRng(1)
+		samples := 0
+		const n = 10000
+		for i := 0; i < n; i++ {
+			direction := p.Generate(rng)
+			if hit, _ := wrapped.Hit(geo.NewRay(origin, direction, 0), geo.Interval{Min: 0.001, Max: util.Infinity}, nil); hit {
+				samples++
+			}
+		}
+		assert.InDelta(t, .5, float64(samples)/n, .05, name)
+	}
+}
+
+// createManyLightsScene creates a scene lit by one bright light and many dim lights
+func createManyLightsScene(lightSampling renderer.LightSampling, samples int) *renderer.Scene {
+	scene := createMaterialScene(renderer.RenderConfig{
+		SamplesPerPixel: samples,
+		Shader:          renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1},
+		LightSampling:   lightSampling,
+	}, []material.Material{
+		material.NewLambertian(material.NewSolidColor(.8, .5, .2)),
+		material.NewLambertian(material.NewSolidColor(.2, .5, .8)),
+	})
+	world := scene.World.(*hittable.HittableList)
+	for i := 0; i < 40; i++ {
+		x := float64(i%8) - 3.5
+		z := float64(i/8) - 6
+		world.Add(hittable.NewSphere(geo.NewVec3(x, 2, z), .05, material.NewLight(2, 2, 2)))
+	}
+	scene.BackgroundColor = geo.ZeroVector
+	return scene
+}
+
+func TestLightSamplingConvergesToSameResult(t *testing.T) {
+	uniform := renderBuffers(createManyLightsScene(renderer.LightSamplingUniform, 200), 40, 20)
+	uniformMean, _ := meanAndError(uniform, uniform)
+
+	for _, sampling := range []renderer.LightSampling{renderer.LightSamplingPower, renderer.LightSamplingTree} {
+		buffers := renderBuffers(createManyLightsScene(sampling, 200), 40, 20)
+		mean, _ := meanAndError(buffers, uniform)
+		assert.InEpsilon(t, uniformMean, mean, .03)
+	}
+}
+
+func TestPowerLightSamplingHasLessNoise(t *testing.T) {
+	reference := renderBuffers(createManyLightsScene(renderer.LightSamplingPower, 1000), 40, 20)
+	uniform := renderBuffers(createManyLightsScene(renderer.LightSamplingUniform, 16), 40, 20)
+	power := renderBuffers(createManyLightsScene(renderer.LightSamplingPower, 16), 40, 20)
+
+	_, uniformError := meanAndError(uniform, reference)
+	_, powerError := meanAndError(power, reference)
+	assert.Less(t, powerError, uniformError)
+}
+
+func TestParseSceneLightSampling(t *testing.T) {
+	cam := `"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0]}`
+
+	s, err := scene.Parse([]byte(`{`+cam+`, "world": [], "renderConfig": {"lightSampling": "tree"}}`), scene.FormatJson, "")
+	assert.Nil(t, err)
+	assert.Equal(t, renderer.LightSamplingTree, s.RenderConfig.LightSampling)
+
+	_, err = scene.Parse([]byte(`{`+cam+`, "world": [], "renderConfig": {"lightSampling": "random"}}`), scene.FormatJson, "")
+	assert.EqualError(t, err, "renderConfig.lightSampling: unknown light sampling 'random'")
+}
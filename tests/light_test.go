@@ -0,0 +1,277 @@
+package tests
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/environment"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/light"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPointLight(t *testing.T) {
+	l := light.NewPoint(geo.NewVec3(0, 2, 0), geo.NewVec3(4, 8, 12))
+
+	sample := l.Sample(geo.ZeroVector, testRng)
+	assert.Equal(t, geo.NewVec3(0, 1, 0), sample.Direction)
+	assert.Equal(t, 2., sample.Distance)
+	assert.Equal(t, geo.NewVec3(1, 2, 3), sample.Color)
+}
+
+func TestSpotLight(t *testing.T) {
+	l := light.NewSpot(geo.NewVec3(0, 2, 0), geo.NewVec3(0, -1, 0), geo.NewVec3(4, 4, 4), 60, 10)
+
+	// A point on the ground at the angle from straight below the light
+	atAngle := func(degrees float64) light.Sample {
+		return l.Sample(geo.NewVec3(2*math.Tan(util.DegreesToRadians(degrees)), 0, 0), testRng)
+	}
+
+	assert.Equal(t, geo.NewVec3(1, 1, 1), atAngle(0).Color)
+	assert.Equal(t, geo.ZeroVector, atAngle(35).Color)
+
+	// Full intensity until the falloff starts, and then falling off towards the edge of the cone
+	full := atAngle(19)
+	assertVec3InDelta(t, geo.NewVec3(4, 4, 4).DivS(full.Distance*full.Distance), full.Color)
+	partial := atAngle(25)
+	assert.Greater(t, partial.Color.X, 0.)
+	assert.Less(t, partial.Color.X, 4/(partial.Distance*partial.Distance))
+	assert.Greater(t, partial.Color.X, atAngle(28).Color.X)
+}
+
+func TestDirectionalLight(t *testing.T) {
+	l := light.NewDirectional(geo.NewVec3(1, -1, 0), geo.NewVec3(2, 2, 2))
+
+	sample := l.Sample(geo.NewVec3(5, 5, 5), testRng)
+	assertVec3InDelta(t, geo.NewVec3(-1, 1, 0).Unit(), sample.Direction)
+	assert.Equal(t, util.Infinity, sample.Distance)
+	assert.Equal(t, geo.NewVec3(2, 2, 2), sample.Color)
+}
+
+func TestAreaLightIrradiance(t *testing.T) {
+	corner := geo.NewVec3(-1, 2, -1)
+	u := geo.NewVec3(2, 0, 0)
+	v := geo.NewVec3(0, 0, 2)
+	// The light shines downwards
+	l := light.NewArea(corner, u, v, geo.NewVec3(3, 3, 3), 180)
+	point := geo.NewVec3(.5, 0, .2)
+	normal := geo.NewVec3(0, 1, 0)
+
+	// The irradiance is integrated over a fine grid on the light
+	const steps = 400
+	expected := 0.
+	for i := 0; i < steps; i++ {
+		for j := 0; j < steps; j++ {
+			onLight := corner.Add(u.MulS((float64(i) + .5) / steps)).Add(v.MulS((float64(j) + .5) / steps))
+			toLight := onLight.Sub(point)
+			d2 := toLight.LengthSquared()
+			cos := toLight.Unit().Y
+			expected += 3 * cos * cos / d2 * 4 / (steps * steps)
+		}
+	}
+
+	rng := random.NewRng(1)
+	const n = 100000
+	irradiance := 0.
+	for i := 0; i < n; i++ {
+		sample := l.Sample(point, rng)
+		irradiance += sample.Color.X * sample.Direction.Dot(normal)
+	}
+	assert.InEpsilon(t, expected, irradiance/n, .01)
+
+	// Nothing shines from the back of the light
+	assert.Equal(t, geo.ZeroVector, l.Sample(geo.NewVec3(0, 3, 0), rng).Color)
+}
+
+func TestAreaLightSpread(t *testing.T) {
+	l := light.NewArea(geo.NewVec3(-.1, 2, -.1), geo.NewVec3(.2, 0, 0), geo.NewVec3(0, 0, .2), geo.NewVec3(1, 1, 1), 60)
+
+	assert.NotEqual(t, geo.ZeroVector, l.Sample(geo.NewVec3(.5, 0, 0), testRng).Color)
+	assert.Equal(t, geo.ZeroVector, l.Sample(geo.NewVec3(2, 0, 0), testRng).Color)
+}
+
+func TestIesProfile(t *testing.T) {
+	profile, err := light.LoadIes("textures/downlight.ies")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []float64{0, 22.5, 45, 67.5, 90}, profile.VerticalAngles)
+	assert.Equal(t, 1., profile.Intensity(0, 0))
+	assert.InDelta(t, .7, profile.Intensity(33.75, 0), 1e-9)
+	assert.InDelta(t, .7, profile.Intensity(33.75, 123), 1e-9)
+	assert.Equal(t, 0., profile.Intensity(120, 0))
+
+	// A light pointing straight down is brightest below it
+	l := light.NewIes(geo.NewVec3(0, 1, 0), geo.NewVec3(0, -1, 0), geo.NewVec3(2, 2, 2), profile)
+	assert.Equal(t, geo.NewVec3(2, 2, 2), l.Sample(geo.ZeroVector, testRng).Color)
+	assert.Equal(t, geo.ZeroVector, l.Sample(geo.NewVec3(0, 2, 0), testRng).Color)
+}
+
+func TestIesProfileSymmetry(t *testing.T) {
+	// A lamp with quadrant symmetry, that is brighter towards 90 degrees than 0 degrees
+	profile, err := light.ParseIes(strings.NewReader(`IESNA91
+TILT=INCLUDE
+1
+2
+0 90
+1 1
+1 -1 1 2 2 1 1 0 0 0
+1 1 0
+0, 90
+0, 90
+50, 0
+100, 0`))
+	assert.Nil(t, err)
+
+	assert.Equal(t, .5, profile.Intensity(0, 0))
+	assert.Equal(t, .75, profile.Intensity(0, 45))
+	assert.Equal(t, 1., profile.Intensity(0, 90))
+	assert.Equal(t, .75, profile.Intensity(0, 135))
+	assert.Equal(t, .5, profile.Intensity(0, 180))
+	assert.Equal(t, 1., profile.Intensity(0, 270))
+	assert.Equal(t, 1., profile.Intensity(0, -90))
+	assert.Equal(t, .5, profile.Intensity(45, 90))
+}
+
+func TestIesProfileErrors(t *testing.T) {
+	_, err := light.LoadIes("textures/missing.ies")
+	assert.EqualError(t, err, "Failed to open ies profile: open textures/missing.ies: no such file or directory")
+
+	_, err = light.ParseIes(strings.NewReader("IESNA91\n1 1 1"))
+	assert.EqualError(t, err, "Missing TILT line")
+
+	_, err = light.ParseIes(strings.NewReader("TILT=lamp.tlt\n"))
+	assert.EqualError(t, err, "Unsupported TILT: lamp.tlt")
+
+	_, err = light.ParseIes(strings.NewReader("TILT=NONE\n1 1000 1 2 1 1 1 0 0 0 1 1 1\n0 90\n0\n100"))
+	assert.EqualError(t, err, "Unexpected end of data")
+}
+
+func TestSky(t *testing.T) {
+	sunDirection := geo.NewVec3(1, 1, 0)
+	sky := environment.NewSky(sunDirection, 3, 1)
+
+	// The integral of the cosine over the sky is pi
+	rng := random.NewRng(1)
+	const n = 100000
+	integral := 0.
+	for i := 0; i < n; i++ {
+		dir := sky.Generate(rng)
+		integral += math.Max(0, dir.Unit().Y) / sky.Value(dir)
+	}
+	assert.InEpsilon(t, math.Pi, integral/n, .02)
+
+	// The sun is much brighter than the sky, that is blue and brighter towards the sun
+	sun := sky.Color(sunDirection)
+	nearSun := sky.Color(geo.NewVec3(1, 1.3, 0))
+	awayFromSun := sky.Color(geo.NewVec3(-1, 1.3, 0))
+	assert.Greater(t, sun.Luminance(), 1000*nearSun.Luminance())
+	assert.Greater(t, nearSun.Luminance(), awayFromSun.Luminance())
+	assert.Greater(t, awayFromSun.Z, awayFromSun.X)
+	assert.Equal(t, geo.ZeroVector, sky.Color(geo.NewVec3(0, -1, 0)))
+
+	// The sun is redder when it is low
+	lowSunDirection := geo.NewVec3(1, .1, 0)
+	lowSun := environment.NewSky(lowSunDirection, 3, 1).Color(lowSunDirection)
+	assert.Greater(t, lowSun.X/lowSun.Z, sun.X/sun.Z)
+	assert.Less(t, lowSun.Luminance(), sun.Luminance())
+}
+
+// createLightsScene creates a scene that is only lit by the lights of the scene
+func createLightsScene(shader renderer.Shader, samples int) *renderer.Scene {
+	scene := createMaterialScene(renderer.RenderConfig{SamplesPerPixel: samples, Shader: shader}, []material.Material{
+		material.NewLambertian(material.NewSolidColor(.8, .5, .2)),
+		material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorGold, .3, material.Ggx),
+		material.NewLambertian(material.NewSolidColor(.2, .5, .8)),
+	})
+
+	// The emitting sphere of the material scene is removed
+	objects := scene.World.(*hittable.HittableList).List()
+	world := hittable.NewHittableList()
+	for _, h := range objects[:len(objects)-1] {
+		world.Add(h)
+	}
+	scene.World = &world
+	scene.BackgroundColor = geo.ZeroVector
+
+	profile, _ := light.LoadIes("textures/downlight.ies")
+	scene.Lights = []light.Light{
+		light.NewPoint(geo.NewVec3(-2, 2, 2), geo.NewVec3(3, 3, 3)),
+		light.NewSpot(geo.NewVec3(0, 4, 0), geo.NewVec3(0, -1, 0), geo.NewVec3(20, 18, 15), 30, 5),
+		light.NewArea(geo.NewVec3(1.5, 2, -1), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, 1), geo.NewVec3(2, 2, 4), 90),
+		light.NewIes(geo.NewVec3(-2, 1.5, -1), geo.NewVec3(0, -1, 0), geo.NewVec3(2, 4, 2), profile),
+		light.NewDirectional(geo.NewVec3(0, -1, -1), geo.NewVec3(.1, .1, .1)),
+	}
+	return scene
+}
+
+func TestLightsConvergeToSameResultForBothShaders(t *testing.T) {
+	pathTracing := renderBuffers(createLightsScene(renderer.PathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 200), 40, 20)
+	mis := renderBuffers(createLightsScene(renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 200), 40, 20)
+
+	pathTracingMean, _ := meanAndError(pathTracing, pathTracing)
+	misMean, _ := meanAndError(mis, pathTracing)
+	assert.InEpsilon(t, pathTracingMean, misMean, .03)
+}
+
+func TestRenderLights(t *testing.T) {
+	scene := createLightsScene(renderer.MisPathTracingShader{MaxDepth: 50}, 20)
+	renderAndCompareOutput(t, scene, "lights", 200, 100)
+}
+
+func TestRenderSky(t *testing.T) {
+	scene := createMaterialScene(renderer.RenderConfig{
+		SamplesPerPixel: 20,
+		Shader:          renderer.MisPathTracingShader{MaxDepth: 50},
+	}, []material.Material{
+		material.NewLambertian(material.NewSolidColor(.8, .8, .8)),
+		material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorCopper, .3, material.Ggx),
+		material.NewDielectric(material.NewSolidColor(1, 1, 1), 1.5),
+	})
+	scene.Environment = environment.NewSky(geo.NewVec3(-1, .4, .5), 3, .5)
+
+	renderAndCompareOutput(t, scene, "sky", 200, 100)
+}
+
+func TestParseSceneLights(t *testing.T) {
+	cam := `"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0]}`
+
+	s, err := scene.Parse([]byte(`{`+cam+`, "world": [], "lights": [
+		{"type": "point", "position": [0, 1, 0], "intensity": [1, 2, 3]},
+		{"type": "spot", "position": [0, 1, 0], "direction": [0, -1, 0], "intensity": [1, 1, 1], "coneAngle": 40, "falloff": 5},
+		{"type": "directional", "direction": [0, -1, 0], "irradiance": [1, 1, 1]},
+		{"type": "area", "corner": [0, 1, 0], "u": [1, 0, 0], "v": [0, 0, 1], "radiance": [1, 1, 1], "spread": 90},
+		{"type": "ies", "path": "textures/downlight.ies", "position": [0, 1, 0], "intensity": [1, 1, 1]}
+	], "environment": {"type": "sky", "sunDirection": [1, 1, 0]}}`), scene.FormatJson, ".")
+	assert.Nil(t, err)
+
+	profile, _ := light.LoadIes("textures/downlight.ies")
+	assert.Equal(t, []light.Light{
+		light.NewPoint(geo.NewVec3(0, 1, 0), geo.NewVec3(1, 2, 3)),
+		light.NewSpot(geo.NewVec3(0, 1, 0), geo.NewVec3(0, -1, 0), geo.NewVec3(1, 1, 1), 40, 5),
+		light.NewDirectional(geo.NewVec3(0, -1, 0), geo.NewVec3(1, 1, 1)),
+		light.NewArea(geo.NewVec3(0, 1, 0), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, 1), geo.NewVec3(1, 1, 1), 90),
+		light.NewIes(geo.NewVec3(0, 1, 0), geo.NewVec3(0, -1, 0), geo.NewVec3(1, 1, 1), profile),
+	}, s.Lights)
+	assert.Equal(t, environment.NewSky(geo.NewVec3(1, 1, 0), 3, 1), s.Environment)
+
+	// A scene with only lights of the scene can be rendered
+	s.RenderConfig.SamplesPerPixel = 1
+	assert.NotNil(t, renderBuffers(s, 4, 4))
+
+	errors := map[string]string{
+		`"lights": [{"type": "laser"}]`:                                                                     "lights[0]: unknown light type 'laser'",
+		`"lights": [{"type": "point", "position": [0, 0, 0]}]`:                                              "lights[0]: missing required field 'intensity'",
+		`"lights": [{"type": "ies", "path": "missing.ies", "position": [0, 0, 0], "intensity": [1, 1, 1]}]`: "lights[0]: Failed to open ies profile: open missing.ies: no such file or directory",
+	}
+	for lights, expectedError := range errors {
+		_, err := scene.Parse([]byte(`{`+cam+`, "world": [], `+lights+`}`), scene.FormatJson, "")
+		assert.EqualError(t, err, expectedError)
+	}
+}
@@ -11,8 +11,8 @@ import (
 func TestNonPdfGeneratingMaterial(t *testing.T) {
 	m := material.NonPdfGeneratingMaterial{}
 	r := geo.NewRay(
-		geo.RandomVec3(-1, 1),
-		geo.RandomVec3(-1, 1),
+		geo.RandomVec3(testRng, -1, 1),
+		geo.RandomVec3(testRng, -1, 1),
 		0,
 	)
 
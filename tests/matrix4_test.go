@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/stretchr/testify/assert"
+)
+
+func assertVec3InDelta(t *testing.T, expected, actual geo.Vec3) {
+	assert.InDelta(t, expected.X, actual.X, 1e-9)
+	assert.InDelta(t, expected.Y, actual.Y, 1e-9)
+	assert.InDelta(t, expected.Z, actual.Z, 1e-9)
+}
+
+func TestTranslationMatrix(t *testing.T) {
+	m := geo.TranslationMatrix(geo.NewVec3(1, 2, 3))
+
+	assert.Equal(t, geo.NewVec3(2, 3, 4), m.TransformPoint(geo.NewVec3(1, 1, 1)))
+	assert.Equal(t, geo.NewVec3(1, 1, 1), m.TransformVector(geo.NewVec3(1, 1, 1)))
+}
+
+func TestScaleMatrix(t *testing.T) {
+	m := geo.ScaleMatrix(geo.NewVec3(1, 2, 3))
+
+	assert.Equal(t, geo.NewVec3(1, 2, 3), m.TransformPoint(geo.NewVec3(1, 1, 1)))
+	assert.Equal(t, 6., m.Determinant3())
+}
+
+func TestRotationMatrix(t *testing.T) {
+	m := geo.RotationMatrix(geo.NewVec3(0, 0, 2), 90)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), m.TransformPoint(geo.NewVec3(1, 0, 0)))
+
+	m = geo.RotationMatrix(geo.NewVec3(1, 0, 0), 90)
+	assertVec3InDelta(t, geo.NewVec3(0, 0, 1), m.TransformPoint(geo.NewVec3(0, 1, 0)))
+
+	m = geo.RotationMatrix(geo.NewVec3(0, 1, 0), 90)
+	assertVec3InDelta(t, geo.NewVec3(1, 0, 0), m.TransformPoint(geo.NewVec3(0, 0, 1)))
+
+	// Rotating around a diagonal axis cycles the axes
+	m = geo.RotationMatrix(geo.NewVec3(1, 1, 1), 120)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), m.TransformPoint(geo.NewVec3(1, 0, 0)))
+	assert.InDelta(t, 1, m.Determinant3(), 1e-9)
+}
+
+func TestLookAtMatrix(t *testing.T) {
+	m := geo.LookAtMatrix(geo.NewVec3(1, 2, 3), geo.NewVec3(1, 2, -10), geo.NewVec3(0, 1, 0))
+	assertVec3InDelta(t, geo.NewVec3(1, 2, 3), m.TransformPoint(geo.ZeroVector))
+	assertVec3InDelta(t, geo.NewVec3(0, 0, -1), m.TransformVector(geo.NewVec3(0, 0, -1)))
+
+	m = geo.LookAtMatrix(geo.ZeroVector, geo.NewVec3(1, 0, 0), geo.NewVec3(0, 1, 0))
+	assertVec3InDelta(t, geo.NewVec3(1, 0, 0), m.TransformVector(geo.NewVec3(0, 0, -1)))
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), m.TransformVector(geo.NewVec3(0, 1, 0)))
+}
+
+func TestMatrixMulAndInverse(t *testing.T) {
+	translate := geo.TranslationMatrix(geo.NewVec3(1, 2, 3))
+	scale := geo.ScaleMatrix(geo.NewVec3(2, 2, 2))
+
+	// Scaling is applied first
+	m := translate.Mul(scale)
+	assert.Equal(t, geo.NewVec3(3, 4, 5), m.TransformPoint(geo.NewVec3(1, 1, 1)))
+
+	m = m.Mul(geo.RotationMatrix(geo.NewVec3(1, 2, 3), 33))
+	inv, ok := m.Inverse()
+	assert.True(t, ok)
+
+	identity := m.Mul(inv)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			assert.InDelta(t, geo.IdentityMatrix()[i][j], identity[i][j], 1e-9)
+		}
+	}
+
+	p := geo.NewVec3(3, -2, 7)
+	assertVec3InDelta(t, p, inv.TransformPoint(m.TransformPoint(p)))
+
+	_, ok = geo.ScaleMatrix(geo.NewVec3(1, 0, 1)).Inverse()
+	assert.False(t, ok)
+}
+
+func TestMatrixTranspose(t *testing.T) {
+	m := geo.TranslationMatrix(geo.NewVec3(1, 2, 3)).Transpose()
+	assert.Equal(t, 3., m[3][2])
+	assert.Equal(t, 0., m[2][3])
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+// createMisTestScene creates a scene lit by a small bright light, that is hard to hit without light sampling
+func createMisTestScene(shader renderer.Shader, samples int) *renderer.Scene {
+	scene := createMaterialScene(renderer.RenderConfig{SamplesPerPixel: samples, Shader: shader}, []material.Material{
+		material.NewLambertian(material.NewSolidColor(.8, .5, .2)),
+		material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorGold, .2, material.Ggx),
+		material.NewDielectric(material.NewSolidColor(1, 1, 1), 1.5),
+		material.NewPrincipled(material.PrincipledConfig{Roughness: .5, Specular: .5}),
+	})
+	scene.World.(*hittable.HittableList).Add(hittable.NewSphere(geo.NewVec3(1, 3, 2), .2, material.NewLight(200, 200, 200)))
+	scene.BackgroundColor = geo.ZeroVector
+	return scene
+}
+
+// meanAndError returns the mean luminance of the pixels, and the root mean square error of the pixels against a reference
+func meanAndError(buffers, reference *renderer.RenderBuffers) (float64, float64) {
+	mean := 0.
+	sqError := 0.
+	for i, c := range buffers.Color {
+		mean += c.Luminance()
+		d := c.Luminance() - reference.Color[i].Luminance()
+		sqError += d * d
+	}
+	n := float64(len(buffers.Color))
+	return mean / n, math.Sqrt(sqError / n)
+}
+
+func TestMisConvergesToSameResultAsPathTracing(t *testing.T) {
+	pathTracing := renderBuffers(createMisTestScene(renderer.PathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 400), 40, 20)
+	mis := renderBuffers(createMisTestScene(renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 400), 40, 20)
+
+	pathTracingMean, _ := meanAndError(pathTracing, pathTracing)
+	misMean, _ := meanAndError(mis, pathTracing)
+	assert.InEpsilon(t, pathTracingMean, misMean, .03)
+}
+
+func TestMisHasLessNoiseThanPathTracing(t *testing.T) {
+	reference := renderBuffers(createMisTestScene(renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 1000), 40, 20)
+	pathTracing := renderBuffers(createMisTestScene(renderer.PathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 16), 40, 20)
+	mis := renderBuffers(createMisTestScene(renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1}, 16), 40, 20)
+
+	_, pathTracingError := meanAndError(pathTracing, reference)
+	_, misError := meanAndError(mis, reference)
+	assert.Less(t, misError, pathTracingError/2)
+}
+
+func TestRenderMisPathTracing(t *testing.T) {
+	scene := createMisTestScene(renderer.MisPathTracingShader{MaxDepth: 50}, 20)
+	renderAndCompareOutput(t, scene, "mis", 200, 100)
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/stretchr/testify/assert"
+)
+
+// The squares of materials.obj, in the order of their materials
+const (
+	matteSquare = iota
+	plasticSquare
+	metalSquare
+	glassSquare
+	frostedSquare
+	lampSquare
+	cutoutSquare
+	ghostSquare
+	bumpySquare
+	replacedSquare
+	missingSquare
+)
+
+// hitSquare hits a square of materials.obj from above at the texture coordinate
+func hitSquare(t *testing.T, model hittable.Hittable, square int, u, v float64) *material.HitRecord {
+	return hitFromAbove(t, model, float64(2*square)+u, v)
+}
+
+func loadMaterialsModel(t *testing.T, options hittable.ObjModelOptions) hittable.Hittable {
+	model, err := hittable.NewObjModelWithOptions("obj/", "materials.obj", options)
+	assert.Nil(t, err)
+	return model
+}
+
+func TestObjModelMapsMtlMaterials(t *testing.T) {
+	model := loadMaterialsModel(t, hittable.ObjModelOptions{})
+
+	assert.Equal(t, material.NewLambertian(material.NewSolidColor(.8, .2, .2)), hitSquare(t, model, matteSquare, .5, .5).Material)
+	assert.Equal(t, material.NewPrincipled(material.PrincipledConfig{
+		BaseColor: material.NewSolidColor(.1, .2, .3),
+		Specular:  geo.NewVec3(.5, .5, .5).Luminance(),
+		Roughness: .5,
+	}), hitSquare(t, model, plasticSquare, .5, .5).Material)
+	assert.Equal(t, material.NewRoughConductor(material.NewSolidColor(.9, .8, .7), material.IorSilver, 0, material.Ggx), hitSquare(t, model, metalSquare, .5, .5).Material)
+	assert.Equal(t, material.NewDielectric(material.NewSolidColor(.9, 1, .9), 1.33), hitSquare(t, model, glassSquare, .5, .5).Material)
+	assert.Equal(t, material.NewRoughDielectric(material.NewSolidColor(1, 1, 1), 1.5, .5, material.Ggx), hitSquare(t, model, frostedSquare, .5, .5).Material)
+	assert.Equal(t, material.NewLight(5, 4, 3), hitSquare(t, model, lampSquare, .5, .5).Material)
+	assert.Equal(t, material.NewLambertian(material.NewSolidColor(0, 1, 0)), hitSquare(t, model, replacedSquare, .5, .5).Material)
+	assert.Equal(t, material.NewLambertian(material.NewSolidColor(1, 1, 1)), hitSquare(t, model, missingSquare, .5, .5).Material)
+}
+
+func TestObjModelFindsMtlLights(t *testing.T) {
+	model := loadMaterialsModel(t, hittable.ObjModelOptions{})
+
+	lights := hittable.FindLights(model)
+	assert.Equal(t, 2, len(lights))
+	for _, light := range lights {
+		assert.True(t, light.IsLight())
+		assert.InDelta(t, 2*lampSquare+.5, light.BoundingBox().Center().X, 1e-9)
+	}
+}
+
+func TestObjModelMaterialOptions(t *testing.T) {
+	replaced := material.NewMetal(material.NewSolidColor(1, 1, 1), 0)
+	defaultMaterial := material.NewLambertian(material.NewSolidColor(0, 0, 1))
+	model := loadMaterialsModel(t, hittable.ObjModelOptions{
+		Scale:           2,
+		DefaultMaterial: defaultMaterial,
+		Materials:       map[string]material.Material{"replaced": replaced},
+	})
+
+	assert.Equal(t, replaced, hitFromAbove(t, model, 2*(2*replacedSquare+.5), 1).Material)
+	assert.Equal(t, defaultMaterial, hitFromAbove(t, model, 2*(2*missingSquare+.5), 1).Material)
+	assert.Equal(t, material.NewLambertian(material.NewSolidColor(.8, .2, .2)), hitFromAbove(t, model, 2*(2*matteSquare+.5), 1).Material)
+}
+
+func TestObjModelCutsAwayTransparentParts(t *testing.T) {
+	model := loadMaterialsModel(t, hittable.ObjModelOptions{})
+	rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+	missesSquare := func(square int, u float64) bool {
+		hit, _ := model.Hit(geo.NewRay(geo.NewVec3(float64(2*square)+u, 10, .5), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+		return !hit
+	}
+
+	// The left half of the alpha texture is opaque, and the right half transparent
+	rec := hitSquare(t, model, cutoutSquare, .2, .5)
+	assert.Implements(t, (*material.Cutout)(nil), rec.Material)
+	assert.False(t, material.IsCutAway(rec))
+	assert.True(t, missesSquare(cutoutSquare, .9))
+
+	// The ghost has dissolve 0.3, so it is hit by about 30% of the rays
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		if !missesSquare(ghostSquare, (float64(i)+.5)/1000) {
+			hits++
+		}
+	}
+	assert.InDelta(t, 300, hits, 50)
+}
+
+func TestObjModelBumpMap(t *testing.T) {
+	model := loadMaterialsModel(t, hittable.ObjModelOptions{})
+	rec := hitSquare(t, model, bumpySquare, .5, .5)
+
+	// The height rises by 4/255 for each of the 63 pixel steps in U, times the bump strength
+	slope := .5 * 63 * 4 / 255.
+	normal := geo.NewVec3(-slope, 1, 0).Unit()
+	assert.InDelta(t, 1/math.Pi, rec.Material.ScatteringPdf(rec, geo.NewRay(rec.HitPoint, normal, 0)), 1e-9)
+	assert.InDelta(t, normal.Y/math.Pi, rec.Material.ScatteringPdf(rec, geo.NewRay(rec.HitPoint, geo.NewVec3(0, 1, 0), 0)), 1e-9)
+}
+
+// heightU is a height texture that rises with the U coordinate
+type heightU struct{}
+
+func (heightU) Color(rec *material.HitRecord) geo.Vec3 {
+	return geo.NewVec3(rec.U, rec.U, rec.U)
+}
+
+func TestBumpMap(t *testing.T) {
+	lambertian := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	quad := hittable.NewQuad(geo.NewVec3(0, 0, 1), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, -1), material.NewBumpMap(lambertian, heightU{}, 1))
+	rec := hitFromAbove(t, quad, .5, .5)
+
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+	tilted := geo.NewVec3(-1, 1, 0).Unit()
+	assert.InDelta(t, 1/math.Pi, rec.Material.ScatteringPdf(rec, geo.NewRay(rec.HitPoint, tilted, 0)), 1e-6)
+
+	// Spheres have no texture coordinate derivatives, so are not bumped
+	sphere := hittable.NewSphere(geo.ZeroVector, 1, material.NewBumpMap(lambertian, heightU{}, 1))
+	rec = hitFromAbove(t, sphere, 0, 0)
+	assert.InDelta(t, 1/math.Pi, rec.Material.ScatteringPdf(rec, geo.NewRay(rec.HitPoint, geo.NewVec3(0, 1, 0), 0)), 1e-9)
+}
+
+func TestAlphaCutout(t *testing.T) {
+	lambertian := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	cutout := material.NewAlphaCutout(lambertian, heightU{})
+	quad := hittable.NewQuad(geo.NewVec3(0, 0, 1), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, -1), cutout)
+	rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+
+	hit, _ := quad.Hit(geo.NewRay(geo.NewVec3(.2, 10, .5), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	assert.False(t, hit)
+	rec := hitFromAbove(t, quad, .8, .5)
+	assert.Equal(t, cutout, rec.Material)
+	assert.False(t, material.IsCutAway(rec))
+}
+
+func TestStochasticCutout(t *testing.T) {
+	lambertian := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	quad := hittable.NewQuad(geo.NewVec3(0, 0, 1), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, -1), material.NewStochasticCutout(lambertian, heightU{}))
+	rayLength := geo.Interval{Min: 0.001, Max: util.Infinity}
+	hitsAt := func(u float64) int {
+		hits := 0
+		for i := 0; i < 1000; i++ {
+			ray := geo.NewRay(geo.NewVec3(u+float64(i)*1e-6, 10, (float64(i)+.5)/1000), geo.NewVec3(0, -1, 0), 0)
+			if hit, _ := quad.Hit(ray, rayLength, testRng); hit {
+				hits++
+			}
+		}
+		return hits
+	}
+
+	// The alpha is the U coordinate, so the surface is there at that fraction of the hits
+	assert.InDelta(t, 200, hitsAt(.2), 50)
+	assert.InDelta(t, 800, hitsAt(.8), 50)
+
+	// A hit that is kept stays kept each time it is checked
+	var rec *material.HitRecord
+	for hit, z := false, 0.; !hit; z += .01 {
+		hit, rec = quad.Hit(geo.NewRay(geo.NewVec3(.5, 10, z), geo.NewVec3(0, -1, 0), 0), rayLength, testRng)
+	}
+	for i := 0; i < 10; i++ {
+		assert.False(t, material.IsCutAway(rec))
+	}
+}
+
+func TestInvalidMtlFile(t *testing.T) {
+	o, err := hittable.NewObjModel("obj/", "invalidMtl.obj", 1)
+
+	assert.Equal(t, nil, o)
+	assert.Contains(t, err.Error(), "Failed to read material file obj/invalidMtl.mtl on line 3")
+}
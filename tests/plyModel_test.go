@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlyModelAscii(t *testing.T) {
+	model, err := hittable.NewPlyModel("ply/quad.ply", hittable.MeshModelOptions{})
+	assert.Nil(t, err)
+
+	// The square face is split into two triangles, that both get the colors of their vertices
+	rec := hitFromAbove(t, model, .25, .75)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+	assertVec3InDelta(t, geo.NewVec3(.25, .5, .25), rec.VertexColor)
+	assert.Equal(t, material.NewLambertian(material.NewVertexColorTexture()), rec.Material)
+
+	rec = hitFromAbove(t, model, .75, .25)
+	assertVec3InDelta(t, geo.NewVec3(.75, .5, .75), rec.VertexColor)
+}
+
+func TestPlyModelBinary(t *testing.T) {
+	for _, file := range []string{"ply/binaryLittleEndian.ply", "ply/binaryBigEndian.ply"} {
+		model, err := hittable.NewPlyModel(file, hittable.MeshModelOptions{Scale: 2})
+		assert.Nil(t, err)
+
+		rec := hitFromAbove(t, model, .5, 1.5)
+		assertVec3InDelta(t, geo.NewVec3(.5, 0, 1.5), rec.HitPoint)
+		assertVec3InDelta(t, geo.NewVec3(1, 1, 0).Unit(), rec.Normal)
+		assertVec3InDelta(t, geo.NewVec3(.25, .5, .25), rec.VertexColor)
+		assert.InDelta(t, .25, rec.U, 1e-9)
+		assert.InDelta(t, .75, rec.V, 1e-9)
+	}
+}
+
+func TestPlyModelDefaultMaterial(t *testing.T) {
+	red := material.NewLambertian(material.NewSolidColor(1, 0, 0))
+	model, err := hittable.NewPlyModel("ply/quad.ply", hittable.MeshModelOptions{DefaultMaterial: red})
+	assert.Nil(t, err)
+
+	rec := hitFromAbove(t, model, .5, .5)
+	assert.Equal(t, red, rec.Material)
+	assertVec3InDelta(t, geo.NewVec3(.5, 0, .5), rec.VertexColor)
+}
+
+func TestPlyModelErrors(t *testing.T) {
+	dir := t.TempDir()
+	vertices := "element vertex 3\nproperty float x\nproperty float y\nproperty float z\n"
+	face := "element face 1\nproperty list uchar int vertex_indices\n"
+
+	tests := []struct {
+		data          string
+		expectedError string
+	}{
+		{"solid\n", "Missing ply header"},
+		{"ply\nformat ascii 1.0\n", "Missing end of header"},
+		{"ply\nformat binary_middle_endian 1.0\nend_header\n", "Unsupported format: binary_middle_endian"},
+		{"ply\nformat ascii 1.0\nelement vertex 1\nproperty half x\nend_header\n", "Unknown property type: half"},
+		{"ply\nformat ascii 1.0\n" + vertices + face + "end_header\n0 0 0\n1 0 0\n0 0 1\n3 0 1 3\n", "Invalid vertex index: 3"},
+		{"ply\nformat ascii 1.0\n" + vertices + face + "end_header\n0 0 0\n1 0 0\n0 0 x\n", "Invalid value: x"},
+		{"ply\nformat ascii 1.0\n" + vertices + face + "end_header\n0 0 0\n1 0 0\n", "unexpected EOF"},
+		{"ply\nformat binary_little_endian 1.0\n" + vertices + "end_header\n\x00\x00", "unexpected EOF"},
+	}
+
+	path := filepath.Join(dir, "test.ply")
+	for _, test := range tests {
+		assert.Nil(t, os.WriteFile(path, []byte(test.data), 0644))
+		_, err := hittable.NewPlyModel(path, hittable.MeshModelOptions{})
+		assert.EqualError(t, err, "Failed to parse ply file "+path+": "+test.expectedError)
+	}
+
+	assert.Nil(t, os.WriteFile(path, []byte("ply\nformat ascii 1.0\n"+vertices+"end_header\n0 0 0\n1 0 0\n0 0 1\n"), 0644))
+	_, err := hittable.NewPlyModel(path, hittable.MeshModelOptions{})
+	assert.EqualError(t, err, "No faces in ply file "+path)
+
+	_, err = hittable.NewPlyModel("ply/missing.ply", hittable.MeshModelOptions{})
+	assert.EqualError(t, err, "Failed to read ply file: open ply/missing.ply: no such file or directory")
+}
+
+func TestVertexColorTexture(t *testing.T) {
+	tex := material.NewVertexColorTexture()
+	assert.Equal(t, geo.NewVec3(.1, .2, .3), tex.Color(&material.HitRecord{VertexColor: geo.NewVec3(.1, .2, .3)}))
+
+	// Hittables without vertex colors are black
+	triangle := hittable.NewTriangle(geo.NewVec3(0, 0, 0), geo.NewVec3(0, 0, 1), geo.NewVec3(1, 0, 0), material.NewLambertian(tex))
+	rec := hitFromAbove(t, triangle, .25, .25)
+	assert.Equal(t, geo.ZeroVector, tex.Color(rec))
+
+	colored := triangle.WithVertexColors(geo.NewVec3(1, 0, 0), geo.NewVec3(0, 1, 0), geo.NewVec3(0, 0, math.Pi))
+	rec = hitFromAbove(t, colored, .25, .25)
+	assertVec3InDelta(t, geo.NewVec3(.5, .25, .25*math.Pi), tex.Color(rec))
+}
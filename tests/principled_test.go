@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/random"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+var principledConfigs = map[string]material.PrincipledConfig{
+	"diffuse":      {BaseColor: material.NewSolidColor(.8, .5, .2), Roughness: .5, Specular: .5},
+	"metal":        {BaseColor: material.NewSolidColor(.9, .6, .3), Metallic: 1, Roughness: .4},
+	"clearcoat":    {BaseColor: material.NewSolidColor(.2, .2, .8), Roughness: .6, Specular: .5, Clearcoat: 1, ClearcoatRoughness: .3},
+	"sheen":        {BaseColor: material.NewSolidColor(.5, .5, .5), Roughness: 1, Sheen: 1, SheenTint: .5},
+	"transmission": {BaseColor: material.NewSolidColor(1, 1, 1), Roughness: .5, Transmission: 1, IndexOfRefraction: 1.5},
+	"mixed":        {BaseColor: material.NewSolidColor(.7, .7, .7), Metallic: .3, Roughness: .7, Specular: .5, Transmission: .5, Clearcoat: .5, ClearcoatRoughness: .5},
+}
+
+func scatterBsdf(mat material.Material, direction geo.Vec3, frontFace bool) (material.ScatterRecord, *material.HitRecord) {
+	rec := &material.HitRecord{
+		HitPoint:  geo.ZeroVector,
+		Normal:    geo.NewVec3(0, 0, 1),
+		Material:  mat,
+		FrontFace: frontFace,
+	}
+	_, scatterRecord := mat.Scatter(geo.NewRay(direction.Neg(), direction, 0), rec, testRng)
+	return scatterRecord, rec
+}
+
+// albedoEstimates returns the amount of light scattered by the bsdf, estimated
+// both by sampling the bsdf and by uniformly sampling the sphere. The integral
+// of the pdf over the sphere is also estimated, which is one unless samples are absorbed.
+func albedoEstimates(bsdf material.Bsdf) (geo.Vec3, geo.Vec3, float64) {
+	const n = 200000
+
+	// A separate rng makes the estimates independent of which tests have been run before
+	rng := random.NewRng(1)
+	sampled := geo.ZeroVector
+	uniform := geo.ZeroVector
+	pdfIntegral := 0.
+	for i := 0; i < n; i++ {
+		// Absorbed samples do not contribute
+		if dir := bsdf.Generate(rng); dir != geo.ZeroVector {
+			sampled = sampled.Add(bsdf.Eval(dir).DivS(bsdf.Value(dir)))
+		}
+
+		dir := geo.RandomUnitVector(rng)
+		uniform = uniform.Add(bsdf.Eval(dir).MulS(4 * math.Pi))
+		pdfIntegral += bsdf.Value(dir) * 4 * math.Pi
+	}
+	return sampled.DivS(n), uniform.DivS(n), pdfIntegral / n
+}
+
+// assertAlbedoEstimatesMatch checks the albedo estimates with a tolerance relative to the albedo,
+// as light leaving a dielectric can have an albedo above one
+func assertAlbedoEstimatesMatch(t *testing.T, uniform, sampled geo.Vec3, name string) {
+	for axis := 0; axis < 3; axis++ {
+		delta := .05 * math.Max(1, uniform.Axis(axis))
+		assert.InDelta(t, uniform.Axis(axis), sampled.Axis(axis), delta, name)
+	}
+}
+
+func TestPrincipledSamplingMatchesPdf(t *testing.T) {
+	for name, config := range principledConfigs {
+		for _, frontFace := range []bool{true, false} {
+			scatterRecord, _ := scatterBsdf(material.NewPrincipled(config), geo.NewVec3(.3, .1, -1).Unit(), frontFace)
+			assert.NotNil(t, scatterRecord.Bsdf, name)
+
+			sampled, uniform, pdfIntegral := albedoEstimates(scatterRecord.Bsdf)
+
+			// Rough transmission absorbs the samples that end up on the wrong side of the surface
+			assert.LessOrEqual(t, pdfIntegral, 1.05, name)
+			assert.Greater(t, pdfIntegral, .8, name)
+			assertAlbedoEstimatesMatch(t, uniform, sampled, name)
+		}
+	}
+}
+
+func TestPrincipledDoesNotCreateEnergy(t *testing.T) {
+	// Diffuse is added on top of the specular reflection, as in the Disney model,
+	// so only configurations without diffuse are checked
+	configs := []material.PrincipledConfig{
+		{BaseColor: material.NewSolidColor(1, 1, 1), Metallic: 1, Roughness: .3},
+		{BaseColor: material.NewSolidColor(0, 0, 0), Specular: 1, Roughness: .3, Clearcoat: 1, ClearcoatRoughness: .3},
+	}
+
+	for _, config := range configs {
+		for _, direction := range []geo.Vec3{geo.NewVec3(0, 0, -1), geo.NewVec3(1, 0, -1).Unit(), geo.NewVec3(1, 0, -.2).Unit()} {
+			scatterRecord, _ := scatterBsdf(material.NewPrincipled(config), direction, true)
+			albedo, _, _ := albedoEstimates(scatterRecord.Bsdf)
+
+			assert.LessOrEqual(t, albedo.X, 1.02)
+			assert.Greater(t, albedo.X, .05)
+		}
+	}
+}
+
+func TestPrincipledTransmissionScalesRadiance(t *testing.T) {
+	// Radiance is compressed by the index of refraction squared when entering glass, and expanded when leaving
+	config := material.PrincipledConfig{Transmission: 1, Roughness: .3, IndexOfRefraction: 1.5}
+	fresnel := .04
+
+	scatterRecord, _ := scatterBsdf(material.NewPrincipled(config), geo.NewVec3(0, 0, -1), true)
+	albedo, _, _ := albedoEstimates(scatterRecord.Bsdf)
+	assert.InDelta(t, fresnel+(1-fresnel)/(1.5*1.5), albedo.X, .02)
+}
+
+func TestPrincipledAttenuationIsBaseColor(t *testing.T) {
+	mat := material.NewPrincipled(material.PrincipledConfig{BaseColor: material.NewSolidColor(.1, .2, .3), Metallic: 1})
+	scatterRecord, rec := scatterBsdf(mat, geo.NewVec3(0, 0, -1), true)
+
+	assert.Equal(t, geo.NewVec3(.1, .2, .3), scatterRecord.Attenuation)
+	assert.Equal(t, geo.ZeroVector, mat.Emitted(rec))
+	assert.False(t, mat.IsLight())
+}
+
+func TestPrincipledTextureMultipliesValue(t *testing.T) {
+	// A metallic texture of zero makes the material a dielectric, with a diffuse reflection
+	metal := material.PrincipledConfig{BaseColor: material.NewSolidColor(1, 1, 1), Metallic: 1, Roughness: .1}
+	scatterRecord, _ := scatterBsdf(material.NewPrincipled(metal), geo.NewVec3(0, 0, -1), true)
+	assert.Less(t, scatterRecord.Bsdf.Eval(geo.NewVec3(1, 0, 1)).X, .01)
+
+	metal.MetallicTexture = material.NewSolidColor(0, 1, 1)
+	scatterRecord, _ = scatterBsdf(material.NewPrincipled(metal), geo.NewVec3(0, 0, -1), true)
+	assert.Greater(t, scatterRecord.Bsdf.Eval(geo.NewVec3(1, 0, 1)).X, .1)
+}
+
+func TestRenderPrincipledMaterials(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 50,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}
+	materials := []material.Material{}
+	for _, name := range []string{"diffuse", "metal", "clearcoat", "sheen", "transmission", "mixed"} {
+		materials = append(materials, material.NewPrincipled(principledConfigs[name]))
+	}
+	scene := createMaterialScene(traceSpec, materials)
+
+	renderAndCompareOutput(t, scene, "principled", 200, 100)
+}
@@ -20,3 +20,51 @@ func TestRandomFloat(t *testing.T) {
 		assert.True(t, r >= -2 && r < 2)
 	}
 }
+
+var testRng = random.NewRng(42)
+
+func TestRngNormalFloat(t *testing.T) {
+	rng := random.NewRng(1)
+	for i := 0; i < 100; i++ {
+		r := rng.NormalFloat()
+		assert.True(t, r >= 0 && r < 1)
+	}
+}
+
+func TestRngFloat(t *testing.T) {
+	rng := random.NewRng(1)
+	for i := 0; i < 100; i++ {
+		r := rng.Float(-2, 2)
+		assert.True(t, r >= -2 && r < 2)
+	}
+}
+
+func TestRngUint32n(t *testing.T) {
+	rng := random.NewRng(1)
+	for i := 0; i < 100; i++ {
+		assert.Less(t, rng.Uint32n(3), uint32(3))
+	}
+}
+
+func TestRngSameSeedGivesSameSequence(t *testing.T) {
+	rng1 := random.NewRng(123)
+	rng2 := random.NewRng(123)
+	rng3 := random.NewRng(124)
+
+	same := true
+	for i := 0; i < 100; i++ {
+		r1 := rng1.Uint32()
+		assert.Equal(t, r1, rng2.Uint32())
+		same = same && r1 == rng3.Uint32()
+	}
+	assert.False(t, same)
+
+	rng1.Seed(123)
+	assert.Equal(t, random.NewRng(123).Uint32(), rng1.Uint32())
+}
+
+func TestMixSeed(t *testing.T) {
+	assert.Equal(t, random.MixSeed(1, 2, 3), random.MixSeed(1, 2, 3))
+	assert.NotEqual(t, random.MixSeed(1, 2, 3), random.MixSeed(1, 3, 2))
+	assert.NotEqual(t, random.MixSeed(1, 2, 3), random.MixSeed(2, 2, 3))
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+var roughMaterials = map[string]material.Material{
+	"ggxGold":            material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorGold, .3, material.Ggx),
+	"beckmannCopper":     material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorCopper, .3, material.Beckmann),
+	"ggxAluminium":       material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorAluminium, .7, material.Ggx),
+	"ggxDielectric":      material.NewRoughDielectric(material.NewSolidColor(1, 1, 1), 1.5, .6, material.Ggx),
+	"beckmannDielectric": material.NewRoughDielectric(material.NewSolidColor(1, 1, 1), 1.5, .6, material.Beckmann),
+}
+
+func TestRoughMaterialsSamplingMatchesPdf(t *testing.T) {
+	for name, mat := range roughMaterials {
+		for _, frontFace := range []bool{true, false} {
+			scatterRecord, _ := scatterBsdf(mat, geo.NewVec3(.3, .1, -1).Unit(), frontFace)
+			assert.NotNil(t, scatterRecord.Bsdf, name)
+
+			sampled, uniform, pdfIntegral := albedoEstimates(scatterRecord.Bsdf)
+
+			assert.LessOrEqual(t, pdfIntegral, 1.05, name)
+			assert.Greater(t, pdfIntegral, .8, name)
+			assertAlbedoEstimatesMatch(t, uniform, sampled, name)
+		}
+	}
+}
+
+func TestRoughConductorReflectance(t *testing.T) {
+	// At normal incidence the fresnel reflectance of a conductor is ((n-1)^2 + k^2) / ((n+1)^2 + k^2)
+	ior := material.IorGold
+	expected := func(n, k float64) float64 {
+		return ((n-1)*(n-1) + k*k) / ((n+1)*(n+1) + k*k)
+	}
+
+	mat := material.NewRoughConductor(material.NewSolidColor(1, 1, 1), ior, .2, material.Ggx)
+	scatterRecord, _ := scatterBsdf(mat, geo.NewVec3(0, 0, -1), true)
+	albedo, _, _ := albedoEstimates(scatterRecord.Bsdf)
+
+	// Some light is lost, as the masking of microfacets does not account for multiple scattering
+	assert.InDelta(t, expected(ior.Eta.X, ior.K.X), albedo.X, .03)
+	assert.InDelta(t, expected(ior.Eta.Y, ior.K.Y), albedo.Y, .03)
+	assert.InDelta(t, expected(ior.Eta.Z, ior.K.Z), albedo.Z, .03)
+}
+
+func TestRoughConductorTint(t *testing.T) {
+	white := material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorSilver, .3, material.Ggx)
+	tinted := material.NewRoughConductor(material.NewSolidColor(.5, .25, 0), material.IorSilver, .3, material.Ggx)
+
+	whiteRecord, _ := scatterBsdf(white, geo.NewVec3(0, 0, -1), true)
+	tintedRecord, _ := scatterBsdf(tinted, geo.NewVec3(0, 0, -1), true)
+
+	direction := geo.NewVec3(.1, 0, 1)
+	assertVec3InDelta(t, whiteRecord.Bsdf.Eval(direction).Mul(geo.NewVec3(.5, .25, 0)), tintedRecord.Bsdf.Eval(direction))
+	assert.Equal(t, whiteRecord.Bsdf.Value(direction), tintedRecord.Bsdf.Value(direction))
+}
+
+func TestRenderRoughMaterials(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 50,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}
+	materials := []material.Material{}
+	for _, name := range []string{"ggxGold", "beckmannCopper", "ggxAluminium", "ggxDielectric", "beckmannDielectric"} {
+		materials = append(materials, roughMaterials[name])
+	}
+	scene := createMaterialScene(traceSpec, materials)
+
+	renderAndCompareOutput(t, scene, "rough", 200, 100)
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+func createRouletteTestScene(shader renderer.Shader) *renderer.Scene {
+	return createMaterialScene(renderer.RenderConfig{SamplesPerPixel: 400, Shader: shader}, []material.Material{
+		material.NewLambertian(material.NewSolidColor(.8, .8, .8)),
+		material.NewRoughConductor(material.NewSolidColor(1, 1, 1), material.IorSilver, .3, material.Ggx),
+		material.NewDielectric(material.NewSolidColor(1, 1, 1), 1.5),
+	})
+}
+
+func TestRussianRouletteDoesNotChangeMeanColor(t *testing.T) {
+	tests := map[string][2]renderer.Shader{
+		"pathTracing": {
+			renderer.PathTracingShader{MaxDepth: 50, MaxSampleValue: -1},
+			renderer.PathTracingShader{MaxDepth: 50, MaxSampleValue: -1, RussianRouletteDepth: 1},
+		},
+		"misPathTracing": {
+			renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1},
+			renderer.MisPathTracingShader{MaxDepth: 50, MaxSampleValue: -1, RussianRouletteDepth: 1},
+		},
+	}
+
+	for name, shaders := range tests {
+		expected := renderBuffers(createRouletteTestScene(shaders[0]), 40, 20)
+		actual := renderBuffers(createRouletteTestScene(shaders[1]), 40, 20)
+
+		expectedMean, _ := meanAndError(expected, expected)
+		actualMean, _ := meanAndError(actual, expected)
+		assert.InEpsilon(t, expectedMean, actualMean, .02, name)
+	}
+}
+
+func TestRussianRouletteRendersDeepPaths(t *testing.T) {
+	shader := renderer.MisPathTracingShader{MaxDepth: 1000, RussianRouletteDepth: 3}
+	scene := createMisTestScene(shader, 20)
+
+	renderAndCompareOutput(t, scene, "russianRoulette", 200, 100)
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/DanielPettersson/solstrale"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/scene"
+	"github.com/DanielPettersson/solstrale/tonemap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadYamlScene(t *testing.T) {
+	s, err := scene.Load("scenes/simple.yaml")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 20., s.Camera.VerticalFovDegrees)
+	assert.Equal(t, .1, s.Camera.ApertureSize)
+	assert.Equal(t, 10., s.Camera.FocusDistance)
+	assert.Equal(t, geo.NewVec3(0, 0, 4), s.Camera.LookFrom)
+	assert.Equal(t, geo.NewVec3(.2, .3, .5), s.BackgroundColor)
+	assert.Equal(t, 10, s.RenderConfig.SamplesPerPixel)
+	assert.Equal(t, uint64(1), s.RenderConfig.Seed)
+	assert.Equal(t, renderer.PathTracingShader{MaxDepth: 50}, s.RenderConfig.Shader)
+
+	renderAndCompareOutput(t, s, "scene", 200, 100)
+}
+
+func TestLoadJsonSceneWithAllTypes(t *testing.T) {
+	s, err := scene.Load("scenes/all.json")
+	assert.Nil(t, err)
+
+	// Focus distance defaults to distance between look from and look at
+	assert.Equal(t, geo.NewVec3(-5, 3, 6).Sub(geo.NewVec3(.25, 1, 0)).Length(), s.Camera.FocusDistance)
+	assert.Equal(t, renderer.SimpleShader{}, s.RenderConfig.Shader)
+	assert.NotNil(t, s.RenderConfig.PostProcessor)
+	assert.Equal(t, tonemap.NewReinhard(1, 4), s.RenderConfig.ToneMapper)
+	assert.Equal(t, &renderer.TileConfig{Size: 4, Order: renderer.TileOrderSpiral, SamplesPerPass: 1}, s.RenderConfig.Tiles)
+	assert.Equal(t, &renderer.AdaptiveConfig{MinSamples: 2, NoiseThreshold: .1}, s.RenderConfig.Adaptive)
+
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go solstrale.RayTrace(10, 10, s, renderProgress, make(chan bool))
+	for p := range renderProgress {
+		assert.Nil(t, p.Error)
+	}
+}
+
+func TestParseMisPathTracingShader(t *testing.T) {
+	data := `{
+		"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0]},
+		"world": [],
+		"renderConfig": {"shader": {"type": "misPathTracing", "maxDepth": 10, "maxSampleValue": 5, "russianRouletteDepth": 3}}
+	}`
+	s, err := scene.Parse([]byte(data), scene.FormatJson, "")
+	assert.Nil(t, err)
+	assert.Equal(t, renderer.MisPathTracingShader{MaxDepth: 10, MaxSampleValue: 5, RussianRouletteDepth: 3}, s.RenderConfig.Shader)
+}
+
+func TestLoadSceneErrors(t *testing.T) {
+	tests := map[string]string{
+		"scenes/missing.yaml": "failed to read scene file: open scenes/missing.yaml: no such file or directory",
+		"scenes/simple.txt":   "unsupported scene file extension: scenes/simple.txt",
+		"scenes/invalid.yaml": "world[1].object.center: expected a list of 3 numbers",
+	}
+
+	for path, expectedError := range tests {
+		_, err := scene.Load(path)
+		assert.EqualError(t, err, expectedError)
+	}
+}
+
+func TestParseSceneInRoot(t *testing.T) {
+	cam := `"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 4], "lookAt": [0, 0, 0]}`
+	model := func(file string) []byte {
+		return []byte(`{` + cam + `, "world": [{"type": "gltf", "file": "` + file + `"}]}`)
+	}
+
+	_, err := scene.Parse(model("../gltf/model.glb"), scene.FormatJson, "scenes")
+	assert.Nil(t, err)
+
+	// Paths can not go outside of the root
+	_, err = scene.ParseInRoot(model("../gltf/model.glb"), scene.FormatJson, "scenes")
+	assert.EqualError(t, err, "world[0]: Failed to read glTF file: open scenes/gltf/model.glb: no such file or directory")
+	_, err = scene.ParseInRoot(model("/etc/model.glb"), scene.FormatJson, "scenes")
+	assert.EqualError(t, err, "world[0]: Failed to read glTF file: open scenes/etc/model.glb: no such file or directory")
+
+	_, err = scene.ParseInRoot(model("gltf/model.glb"), scene.FormatJson, ".")
+	assert.Nil(t, err)
+}
+
+func TestParseSceneErrors(t *testing.T) {
+	cam := `"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0]}`
+	box := `"type": "box", "a": [0, 0, 0], "b": [1, 1, 1]`
+
+	tests := []struct {
+		data          string
+		expectedError string
+	}{
+		{`[]`, "expected an object"},
+		{`{"world": []}`, "missing required field 'camera'"},
+		{`{` + cam + `}`, "missing required field 'world'"},
+		{`{"camera": {"verticalFovDegrees": 20, "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0], "fov": 1}, "world": []}`, "camera: unknown field 'fov'"},
+		{`{"camera": {"verticalFovDegrees": "a", "lookFrom": [0, 0, 1], "lookAt": [0, 0, 0]}, "world": []}`, "camera.verticalFovDegrees: expected a number"},
+		{`{` + cam + `, "world": [{"type": "cone"}]}`, "world[0]: unknown hittable type 'cone'"},
+		{`{` + cam + `, "world": [{"type": "sphere", "center": [0, 0, 0]}]}`, "world[0]: missing required field 'radius'"},
+		{`{` + cam + `, "world": [{` + box + `, "material": "gold"}]}`, "world[0].material: unknown material 'gold'"},
+		{
+			`{` + cam + `, "world": [{` + box + `, "material": {"type": "lambertian", "texture": {"type": "image", "path": "missing.jpg"}}}]}`,
+			"world[0].material.texture: failed to load image texture missing.jpg. Got error: open missing.jpg: no such file or directory",
+		},
+		{`{` + cam + `, "world": [], "renderConfig": {"shader": {"type": "fancy"}}}`, "renderConfig.shader: unknown shader type 'fancy'"},
+		{
+			`{` + cam + `, "world": [{` + box + `, "material": {"type": "principled", "metallicTexture": {"type": "noise"}}}]}`,
+			"world[0].material.metallicTexture: unknown texture type 'noise'",
+		},
+		{`{` + cam + `, "world": [{` + box + `, "material": {"type": "roughConductor", "ior": "tin"}}]}`, "world[0].material.ior: unknown ior preset 'tin'"},
+		{
+			`{` + cam + `, "world": [{` + box + `, "material": {"type": "roughDielectric", "indexOfRefraction": 1.5, "distribution": "phong"}}]}`,
+			"world[0].material: unknown microfacet distribution 'phong'",
+		},
+		{
+			`{` + cam + `, "world": [{"type": "triangle", "v0": [0, 0, 0], "v1": [1, 0, 0], "v2": [0, 1, 0], "n0": [0, 0, 1]}]}`,
+			"world[0]: missing required field 'n1'",
+		},
+		{
+			`{` + cam + `, "world": [{"type": "objModel", "file": "obj/box.obj", "materials": {"Default": "chrome"}}]}`,
+			"world[0].materials.Default: unknown material 'chrome'",
+		},
+		{
+			`{` + cam + `, "world": [{"type": "gltf", "file": "gltf/missing.gltf"}]}`,
+			"world[0]: Failed to read glTF file: open gltf/missing.gltf: no such file or directory",
+		},
+		{
+			`{` + cam + `, "world": [{"type": "stlModel", "file": "stl/missing.stl"}]}`,
+			"world[0]: Failed to read stl file: open stl/missing.stl: no such file or directory",
+		},
+		{`{` + cam + `, "world": [{"type": "bvh", "splitMethod": "best", "objects": [{` + box + `}]}]}`, "world[0]: unknown split method 'best'"},
+		{`{` + cam + `, "world": [{"type": "transform", "object": {` + box + `}, "transforms": [{"type": "shear"}]}]}`, "world[0].transforms[0]: unknown transform type 'shear'"},
+		{
+			`{` + cam + `, "world": [{"type": "transform", "object": {` + box + `}, "transforms": [{"type": "scale", "scale": [0, 1, 1]}]}]}`,
+			"world[0].transforms: Transform matrix is not invertible",
+		},
+		{
+			`{` + cam + `, "world": [{"type": "transform", "object": {` + box + `}, "transforms": [{"type": "matrix", "rows": [[1, 0, 0]]}]}]}`,
+			"world[0].transforms[0].rows: expected a list of 4 rows with 4 numbers each",
+		},
+		{`{` + cam + `, "world": [], "renderConfig": {"toneMapper": {"type": "filmic"}}}`, "renderConfig.toneMapper: unknown tone mapper type 'filmic'"},
+		{`{` + cam + `, "world": [], "renderConfig": {"toneMapper": {"type": "clamp", "whitePoint": 1}}}`, "renderConfig.toneMapper: unknown field 'whitePoint'"},
+		{`{` + cam + `, "world": [], "renderConfig": {"tiles": {"order": "random"}}}`, "renderConfig.tiles: unknown tile order 'random'"},
+		{`{` + cam + `, "world": [], "renderConfig": {"tiles": {"size": 0}}}`, "renderConfig.tiles: size must be at least 1"},
+		{`{` + cam + `, "world": [], "renderConfig": {"adaptive": {"noiseThreshold": 0}}}`, "renderConfig.adaptive: noiseThreshold must be positive"},
+	}
+
+	for _, test := range tests {
+		_, err := scene.Parse([]byte(test.data), scene.FormatJson, "")
+		assert.EqualError(t, err, test.expectedError)
+	}
+}
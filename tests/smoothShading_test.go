@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/camera"
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/internal/util"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+// hitFromAbove returns the hit record of a ray straight down at the x and z coordinates
+func hitFromAbove(t *testing.T, h hittable.Hittable, x, z float64) *material.HitRecord {
+	hit, rec := h.Hit(geo.NewRay(geo.NewVec3(x, 10, z), geo.NewVec3(0, -1, 0), 0), geo.Interval{Min: 0.001, Max: util.Infinity}, testRng)
+	assert.True(t, hit)
+	return rec
+}
+
+func TestTriangleWithNormalsInterpolatesNormals(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	triangle := hittable.NewTriangleWithNormals(
+		geo.NewVec3(0, 0, 0), geo.NewVec3(0, 0, 1), geo.NewVec3(1, 0, 0),
+		geo.NewVec3(0, 1, 0), geo.NewVec3(0, 1, 1), geo.NewVec3(1, 1, 0),
+		0, 0, 0, 0, 0, 0, mat,
+	)
+
+	rec := hitFromAbove(t, triangle, .001, .001)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.GeometricNormal)
+	assert.InDelta(t, 0, rec.Normal.Sub(geo.NewVec3(0, 1, 0)).Length(), .01)
+
+	rec = hitFromAbove(t, triangle, .5, .5)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.GeometricNormal)
+	assertVec3InDelta(t, geo.NewVec3(1, 2, 1).Unit(), rec.Normal)
+	assert.True(t, rec.FrontFace)
+
+	// From below, both normals face the ray
+	hit, rec := triangle.Hit(geo.NewRay(geo.NewVec3(.5, -10, .5), geo.NewVec3(0, 1, 0), 0), geo.Interval{Min: 0.001, Max: util.Infinity}, testRng)
+	assert.True(t, hit)
+	assert.False(t, rec.FrontFace)
+	assertVec3InDelta(t, geo.NewVec3(0, -1, 0), rec.GeometricNormal)
+	assertVec3InDelta(t, geo.NewVec3(-1, -2, -1).Unit(), rec.Normal)
+}
+
+func TestTriangleWithNormalsDecideOutside(t *testing.T) {
+	mat := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+
+	// Clockwise winding seen from above, but the normals point up
+	triangle := hittable.NewTriangleWithNormals(
+		geo.NewVec3(0, 0, 0), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, 1),
+		geo.NewVec3(0, 1, 0), geo.NewVec3(0, 1, 0), geo.NewVec3(0, 1, 0),
+		0, 0, 0, 0, 0, 0, mat,
+	)
+	rec := hitFromAbove(t, triangle, .2, .2)
+	assert.True(t, rec.FrontFace)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+
+	// Zero normals are replaced by the normal of the triangle
+	triangle = hittable.NewTriangleWithNormals(
+		geo.NewVec3(0, 0, 0), geo.NewVec3(1, 0, 0), geo.NewVec3(0, 0, 1),
+		geo.ZeroVector, geo.ZeroVector, geo.ZeroVector,
+		0, 0, 0, 0, 0, 0, mat,
+	)
+	rec = hitFromAbove(t, triangle, .2, .2)
+	assert.False(t, rec.FrontFace)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.GeometricNormal)
+}
+
+func TestObjModelReadsVertexNormals(t *testing.T) {
+	model, err := hittable.NewObjModel("obj/", "smoothNormals.obj", 1)
+	assert.Nil(t, err)
+
+	rec := hitFromAbove(t, model, 0, 0)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+
+	rec = hitFromAbove(t, model, .999, .999)
+	assert.InDelta(t, 0, rec.Normal.Sub(geo.NewVec3(1, 2, 1).Unit()).Length(), .01)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.GeometricNormal)
+
+	rec = hitFromAbove(t, model, -.5, 0)
+	assert.Less(t, rec.Normal.X, 0.)
+}
+
+func TestObjModelComputesVertexNormals(t *testing.T) {
+	model, err := hittable.NewObjModel("obj/", "ridge.obj", 1)
+	assert.Nil(t, err)
+	leftNormal := geo.NewVec3(-math.Sin(util.DegreesToRadians(20)), math.Cos(util.DegreesToRadians(20)), 0)
+
+	// At the ridge the normals of the two slopes are averaged
+	rec := hitFromAbove(t, model, -.0001, .3)
+	assert.InDelta(t, 0, rec.Normal.Sub(geo.NewVec3(0, 1, 0)).Length(), .001)
+	assert.InDelta(t, 0, rec.GeometricNormal.Sub(leftNormal).Length(), 1e-4)
+
+	rec = hitFromAbove(t, model, -.5, .3)
+	assert.Less(t, rec.Normal.X, 0.)
+	assert.Greater(t, rec.Normal.X, leftNormal.X)
+
+	rec = hitFromAbove(t, model, -.9999, .3)
+	assert.InDelta(t, 0, rec.Normal.Sub(leftNormal).Length(), .001)
+}
+
+func TestObjModelKeepsSharpEdges(t *testing.T) {
+	model, err := hittable.NewObjModel("obj/", "box.obj", 1)
+	assert.Nil(t, err)
+
+	for _, p := range [][2]float64{{0, 0}, {.499, .499}, {-.499, .2}} {
+		rec := hitFromAbove(t, model, p[0], p[1])
+		assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+	}
+}
+
+// createLeakScene creates a floor with normals that lean far from the floor, lit only from below
+func createLeakScene(shader renderer.Shader) *renderer.Scene {
+	camera := camera.CameraConfig{
+		VerticalFovDegrees: 40,
+		FocusDistance:      5,
+		LookFrom:           geo.NewVec3(0, 5, 1),
+		LookAt:             geo.NewVec3(0, 0, 0),
+	}
+
+	world := hittable.NewHittableList()
+	floor := material.NewLambertian(material.NewSolidColor(1, 1, 1))
+	n := geo.NewVec3(1, 1, 0)
+	a := geo.NewVec3(-100, 0, -100)
+	b := geo.NewVec3(-100, 0, 100)
+	c := geo.NewVec3(100, 0, 100)
+	d := geo.NewVec3(100, 0, -100)
+	world.Add(hittable.NewTriangleWithNormals(a, b, c, n, n, n, 0, 0, 0, 0, 0, 0, floor))
+	world.Add(hittable.NewTriangleWithNormals(a, c, d, n, n, n, 0, 0, 0, 0, 0, 0, floor))
+	world.Add(hittable.NewSphere(geo.NewVec3(2, -2, 0), 1, material.NewLight(20, 20, 20)))
+
+	return &renderer.Scene{
+		World:           &world,
+		Camera:          camera,
+		BackgroundColor: geo.ZeroVector,
+		RenderConfig:    renderer.RenderConfig{SamplesPerPixel: 20, Shader: shader},
+	}
+}
+
+func TestInterpolatedNormalsDoNotLeakLight(t *testing.T) {
+	for _, shader := range []renderer.Shader{
+		renderer.PathTracingShader{MaxDepth: 10},
+		renderer.MisPathTracingShader{MaxDepth: 10},
+	} {
+		buffers := renderBuffers(createLeakScene(shader), 20, 20)
+		mean, _ := meanAndError(buffers, buffers)
+		assert.Equal(t, 0., mean)
+	}
+}
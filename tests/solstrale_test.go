@@ -5,7 +5,9 @@ import (
 	"image"
 	"image/jpeg"
 	"log"
+	"math"
 	"os"
+	"runtime"
 	"testing"
 
 	"github.com/DanielPettersson/solstrale"
@@ -14,6 +16,7 @@ import (
 	"github.com/DanielPettersson/solstrale/hittable"
 	"github.com/DanielPettersson/solstrale/material"
 	"github.com/DanielPettersson/solstrale/post"
+	"github.com/DanielPettersson/solstrale/random"
 	"github.com/DanielPettersson/solstrale/renderer"
 	"github.com/stretchr/testify/assert"
 	"github.com/vitali-fedulov/images3"
@@ -62,7 +65,7 @@ func createTestScene(renderConfig renderer.RenderConfig) *renderer.Scene {
 		geo.NewVec3(0, 1, 0),
 	))
 
-	balls := []hittable.Triangle{}
+	balls := []hittable.Hittable{}
 	for i := 0.; i < 1; i += .2 {
 		for j := 0.; j < 1; j += .2 {
 			for k := 0.; k < 1; k += .2 {
@@ -97,7 +100,40 @@ func createTestScene(renderConfig renderer.RenderConfig) *renderer.Scene {
 
 }
 
-func createBvhTestScene(renderConfig renderer.RenderConfig, useBvh bool, numSpheres int) *renderer.Scene {
+// createBvhTestScene creates a scene with a row of triangles of the same size
+func createBvhTestScene(renderConfig renderer.RenderConfig, bvhOptions *hittable.BvhOptions, numSpheres int) *renderer.Scene {
+	yellow := material.NewLambertian(material.NewSolidColor(1, 1, 0))
+
+	triangles := []hittable.Hittable{}
+	for x := 0.; x < float64(numSpheres); x += 1 {
+		cx := x - float64(numSpheres)/2
+		triangles = append(triangles, hittable.NewTriangle(geo.NewVec3(cx, -.5, 0), geo.NewVec3(cx+1, -.5, 0), geo.NewVec3(cx+.5, .5, 0), yellow))
+	}
+
+	return createHittablesTestScene(renderConfig, bvhOptions, triangles)
+}
+
+// createUnevenBvhTestScene creates a scene with spheres of very different sizes, where half of them are
+// in a small cluster. Gives an uneven distribution that is hard for the midpoint split method
+func createUnevenBvhTestScene(renderConfig renderer.RenderConfig, bvhOptions *hittable.BvhOptions, numSpheres int) *renderer.Scene {
+	yellow := material.NewLambertian(material.NewSolidColor(1, 1, 0))
+
+	rng := random.NewRng(1)
+	spheres := []hittable.Hittable{}
+	for i := 0; i < numSpheres; i++ {
+		center := geo.NewVec3(rng.Float(-2, 1), rng.Float(-.7, .7), rng.Float(-1, 0))
+		if i%2 == 0 {
+			center = geo.NewVec3(rng.Float(-.2, 0), rng.Float(-.1, .1), rng.Float(-.1, 0))
+		}
+		radius := .005 * math.Pow(100, math.Pow(rng.NormalFloat(), 4))
+		spheres = append(spheres, hittable.NewSphere(center, radius, yellow))
+	}
+
+	return createHittablesTestScene(renderConfig, bvhOptions, spheres)
+}
+
+// createHittablesTestScene creates a scene of the hittables and a light, with the hittables in a bvh if there are bvh options
+func createHittablesTestScene(renderConfig renderer.RenderConfig, bvhOptions *hittable.BvhOptions, hittables []hittable.Hittable) *renderer.Scene {
 	camera := camera.CameraConfig{
 		VerticalFovDegrees: 20,
 		ApertureSize:       .1,
@@ -107,25 +143,17 @@ func createBvhTestScene(renderConfig renderer.RenderConfig, useBvh bool, numSphe
 	}
 
 	world := hittable.NewHittableList()
-	yellow := material.NewLambertian(material.NewSolidColor(1, 1, 0))
 	light := material.NewLight(10, 10, 10)
 	world.Add(hittable.NewSphere(geo.NewVec3(0, 4, 10), 4, light))
 
-	triangles := []hittable.Triangle{}
-	for x := 0.; x < float64(numSpheres); x += 1 {
-		cx := x - float64(numSpheres)/2
-		s := hittable.NewTriangle(geo.NewVec3(cx, -.5, 0), geo.NewVec3(cx+1, -.5, 0), geo.NewVec3(cx+.5, .5, 0), yellow)
-		if useBvh {
-			triangles = append(triangles, s)
-		} else {
-			world.Add(s)
+	if bvhOptions != nil {
+		world.Add(hittable.NewBoundingVolumeHierarchyWithOptions(hittables, *bvhOptions))
+	} else {
+		for _, h := range hittables {
+			world.Add(h)
 		}
 	}
 
-	if useBvh {
-		world.Add(hittable.NewBoundingVolumeHierarchy(triangles))
-	}
-
 	return &renderer.Scene{
 		World:           &world,
 		Camera:          camera,
@@ -159,6 +187,34 @@ func createSimpleTestScene(renderConfig renderer.RenderConfig, addLight bool) *r
 	}
 }
 
+// createMaterialScene creates a row of spheres, one for each material
+func createMaterialScene(renderConfig renderer.RenderConfig, materials []material.Material) *renderer.Scene {
+	camera := camera.CameraConfig{
+		VerticalFovDegrees: 30,
+		LookFrom:           geo.NewVec3(0, 2, 8),
+		LookAt:             geo.NewVec3(0, .5, 0),
+	}
+	camera.FocusDistance = camera.LookFrom.Sub(camera.LookAt).Length()
+
+	world := hittable.NewHittableList()
+	world.Add(hittable.NewQuad(
+		geo.NewVec3(-20, 0, -20), geo.NewVec3(40, 0, 0), geo.NewVec3(0, 0, 40),
+		material.NewLambertian(material.NewSolidColor(.5, .5, .5)),
+	))
+	for i, mat := range materials {
+		x := (float64(i) - float64(len(materials)-1)/2) * 1.1
+		world.Add(hittable.NewSphere(geo.NewVec3(x, .5, 0), .5, mat))
+	}
+	world.Add(hittable.NewSphere(geo.NewVec3(-5, 10, 5), 3, material.NewLight(10, 10, 10)))
+
+	return &renderer.Scene{
+		World:           &world,
+		Camera:          camera,
+		BackgroundColor: geo.NewVec3(.2, .3, .5),
+		RenderConfig:    renderConfig,
+	}
+}
+
 func createUvScene(renderConfig renderer.RenderConfig) *renderer.Scene {
 	camera := camera.CameraConfig{
 		VerticalFovDegrees: 20,
@@ -417,31 +473,120 @@ func TestRenderSceneWithoutLight(t *testing.T) {
 
 }
 
+func TestRenderSceneWithLightInBvh(t *testing.T) {
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 2,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}
+	scene := createSimpleTestScene(traceSpec, false)
+	light := material.NewLight(10, 10, 10)
+	scene.World.(*hittable.HittableList).Add(hittable.NewBoundingVolumeHierarchy([]hittable.Hittable{
+		hittable.NewTriangle(geo.NewVec3(-1, 2, -1), geo.NewVec3(1, 2, -1), geo.NewVec3(0, 2, 1), light),
+		hittable.NewTriangle(geo.NewVec3(-1, 3, -1), geo.NewVec3(1, 3, -1), geo.NewVec3(0, 3, 1), light),
+	}))
+
+	renderProgress := make(chan renderer.RenderProgress)
+	go solstrale.RayTrace(10, 10, scene, renderProgress, make(chan bool))
+
+	for p := range renderProgress {
+		assert.Nil(t, p.Error)
+	}
+}
+
+func TestRenderIsReproducible(t *testing.T) {
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 3,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Seed:            7,
+	}
+
+	img1 := renderImage(createTestScene(traceSpec), 40, 20)
+
+	// Output should not depend on the number of workers
+	prevProcs := runtime.GOMAXPROCS(1)
+	img2 := renderImage(createTestScene(traceSpec), 40, 20)
+	runtime.GOMAXPROCS(prevProcs)
+
+	assert.Equal(t, img1, img2)
+
+	traceSpec.Seed = 8
+	img3 := renderImage(createTestScene(traceSpec), 40, 20)
+
+	assert.NotEqual(t, img1, img3)
+}
+
+func TestRenderBuffersOnFinalProgress(t *testing.T) {
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 2,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+	}
+	scene := createSimpleTestScene(traceSpec, true)
+
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go solstrale.RayTrace(20, 10, scene, renderProgress, make(chan bool))
+
+	var progresses []renderer.RenderProgress
+	for p := range renderProgress {
+		progresses = append(progresses, p)
+	}
+
+	for _, p := range progresses[:len(progresses)-1] {
+		assert.Nil(t, p.Buffers)
+	}
+	buffers := progresses[len(progresses)-1].Buffers
+	assert.NotNil(t, buffers)
+	assert.Equal(t, 20, buffers.Width)
+	assert.Equal(t, 10, buffers.Height)
+	assert.Len(t, buffers.Color, 200)
+	assert.Len(t, buffers.Albedo, 200)
+	assert.Len(t, buffers.Normal, 200)
+
+	center := 110
+	// The center pixel is the yellow sphere, facing the camera
+	assert.Equal(t, geo.NewVec3(1, 1, 0), buffers.Albedo[center])
+	assert.InDelta(t, 1., buffers.Normal[center].Z, .05)
+
+	// Top left pixel is the background
+	assert.Equal(t, geo.NewVec3(.2, .3, .5), buffers.Color[0])
+}
+
 func BenchmarkBvh(b *testing.B) {
-	bvh := map[string]bool{
-		"with bvh":    true,
-		"without bvh": false,
+	bvh := map[string]*hittable.BvhOptions{
+		"with midpoint bvh": {SplitMethod: hittable.SplitMidpoint},
+		"with sah bvh":      {SplitMethod: hittable.SplitSah},
+		"without bvh":       nil,
+	}
+
+	// The row of triangles keeps the name of the original benchmark, so that results can be compared
+	layouts := map[string]func(renderer.RenderConfig, *hittable.BvhOptions, int) *renderer.Scene{
+		"spheres":        createBvhTestScene,
+		"uneven spheres": createUnevenBvhTestScene,
 	}
 
 	spheres := []int{10, 100, 1000, 10000}
 
-	for bhvLabel, useBvh := range bvh {
-		for _, numSpheres := range spheres {
-
-			b.Run(fmt.Sprintf("%v spheres %v", numSpheres, bhvLabel), func(b *testing.B) {
-				b.StopTimer()
-				traceSpec := renderer.RenderConfig{
-					SamplesPerPixel: b.N,
-					Shader:          renderer.PathTracingShader{MaxDepth: 50},
-				}
-				scene := createBvhTestScene(traceSpec, useBvh, numSpheres)
-				b.StartTimer()
-
-				renderProgress := make(chan renderer.RenderProgress)
-				go solstrale.RayTrace(20, 10, scene, renderProgress, make(chan bool))
-				for range renderProgress {
-				}
-			})
+	for layoutLabel, createScene := range layouts {
+		for bhvLabel, bvhOptions := range bvh {
+			for _, numSpheres := range spheres {
+
+				b.Run(fmt.Sprintf("%v %v %v", numSpheres, layoutLabel, bhvLabel), func(b *testing.B) {
+					b.StopTimer()
+					traceSpec := renderer.RenderConfig{
+						SamplesPerPixel: b.N,
+						Shader:          renderer.PathTracingShader{MaxDepth: 50},
+					}
+					scene := createScene(traceSpec, bvhOptions, numSpheres)
+					b.StartTimer()
+
+					renderProgress := make(chan renderer.RenderProgress)
+					go solstrale.RayTrace(20, 10, scene, renderProgress, make(chan bool))
+					for range renderProgress {
+					}
+				})
+			}
 		}
 	}
 }
@@ -461,7 +606,7 @@ func BenchmarkScene(b *testing.B) {
 	}
 }
 
-func renderAndCompareOutput(t *testing.T, scene *renderer.Scene, name string, imageWidth, imageHeight int) {
+func renderImage(scene *renderer.Scene, imageWidth, imageHeight int) image.Image {
 	renderProgress := make(chan renderer.RenderProgress, 1)
 	go solstrale.RayTrace(imageWidth, imageHeight, scene, renderProgress, make(chan bool))
 
@@ -469,6 +614,24 @@ func renderAndCompareOutput(t *testing.T, scene *renderer.Scene, name string, im
 	for p := range renderProgress {
 		im = p.RenderImage
 	}
+	return im
+}
+
+func renderBuffers(scene *renderer.Scene, imageWidth, imageHeight int) *renderer.RenderBuffers {
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go solstrale.RayTrace(imageWidth, imageHeight, scene, renderProgress, make(chan bool))
+
+	var buffers *renderer.RenderBuffers
+	for p := range renderProgress {
+		if p.Buffers != nil {
+			buffers = p.Buffers
+		}
+	}
+	return buffers
+}
+
+func renderAndCompareOutput(t *testing.T, scene *renderer.Scene, name string, imageWidth, imageHeight int) {
+	im := renderImage(scene, imageWidth, imageHeight)
 
 	actualFileName := fmt.Sprintf("output/out_actual_%v.png", name)
 	expectedFileName := fmt.Sprintf("output/out_expected_%v.png", name)
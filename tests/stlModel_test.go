@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	"github.com/DanielPettersson/solstrale/hittable"
+	"github.com/DanielPettersson/solstrale/material"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStlModelAscii(t *testing.T) {
+	model, err := hittable.NewStlModel("stl/ascii.stl", hittable.MeshModelOptions{})
+	assert.Nil(t, err)
+
+	// The ridge is sharper than the crease angle, so the sides stay flat
+	rec := hitFromAbove(t, model, .5, .5)
+	assertVec3InDelta(t, geo.NewVec3(.5, .5, .5), rec.HitPoint)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 1).Unit(), rec.Normal)
+	assert.Equal(t, material.NewLambertian(material.NewSolidColor(1, 1, 1)), rec.Material)
+
+	rec = hitFromAbove(t, model, .25, -.25)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, -1).Unit(), rec.Normal)
+
+	// The loop of four vertices is split into two triangles
+	rec = hitFromAbove(t, model, .1, .9)
+	assertVec3InDelta(t, geo.NewVec3(.1, .1, .9), rec.HitPoint)
+}
+
+func TestStlModelBinary(t *testing.T) {
+	red := material.NewLambertian(material.NewSolidColor(1, 0, 0))
+	model, err := hittable.NewStlModel("stl/binary.stl", hittable.MeshModelOptions{Scale: 3, DefaultMaterial: red})
+	assert.Nil(t, err)
+
+	rec := hitFromAbove(t, model, 2.5, .5)
+	assertVec3InDelta(t, geo.NewVec3(2.5, 0, .5), rec.HitPoint)
+	assertVec3InDelta(t, geo.NewVec3(0, 1, 0), rec.Normal)
+	assert.Equal(t, red, rec.Material)
+}
+
+func TestStlModelErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.stl")
+
+	assert.Nil(t, os.WriteFile(path, []byte("solid\nfacet normal 0 1 0\nouter loop\nvertex 0 0 x\n"), 0644))
+	_, err := hittable.NewStlModel(path, hittable.MeshModelOptions{})
+	assert.EqualError(t, err, "Failed to parse stl file "+path+": Invalid vertex coordinate: x")
+
+	header := make([]byte, 84)
+	header[80] = 2
+	assert.Nil(t, os.WriteFile(path, header, 0644))
+	_, err = hittable.NewStlModel(path, hittable.MeshModelOptions{})
+	assert.EqualError(t, err, "Failed to parse stl file "+path+": File is too short for 2 triangles")
+
+	assert.Nil(t, os.WriteFile(path, []byte("solid empty\nendsolid empty\n"), 0644))
+	_, err = hittable.NewStlModel(path, hittable.MeshModelOptions{})
+	assert.EqualError(t, err, "No facets in stl file "+path)
+
+	_, err = hittable.NewStlModel("stl/missing.stl", hittable.MeshModelOptions{})
+	assert.EqualError(t, err, "Failed to read stl file: open stl/missing.stl: no such file or directory")
+}
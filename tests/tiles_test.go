@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"image"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/stretchr/testify/assert"
+)
+
+func renderTileUpdates(scene *renderer.Scene, imageWidth, imageHeight int) ([]renderer.TileUpdate, image.Image) {
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go solstrale.RayTrace(imageWidth, imageHeight, scene, renderProgress, make(chan bool))
+
+	var tiles []renderer.TileUpdate
+	var im image.Image
+	for p := range renderProgress {
+		if p.Tile != nil {
+			tiles = append(tiles, *p.Tile)
+		}
+		if p.RenderImage != nil {
+			im = p.RenderImage
+		}
+	}
+	return tiles, im
+}
+
+func TestTileRenderingGivesSameImageAsLines(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 4,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Seed:            3,
+	}
+	expected := renderImage(createTestScene(traceSpec), 40, 20)
+
+	for _, order := range []renderer.TileOrder{renderer.TileOrderScanline, renderer.TileOrderSpiral, renderer.TileOrderHilbert} {
+		for _, samplesPerPass := range []int{0, 3} {
+			traceSpec.Tiles = &renderer.TileConfig{Size: 7, Order: order, SamplesPerPass: samplesPerPass}
+			_, actual := renderTileUpdates(createTestScene(traceSpec), 40, 20)
+			assert.Equal(t, expected, actual)
+		}
+	}
+}
+
+func TestTileUpdatesCoverImage(t *testing.T) {
+	tests := map[renderer.TileOrder]image.Point{
+		renderer.TileOrderScanline: {0, 0},
+		renderer.TileOrderSpiral:   {16, 8},
+		renderer.TileOrderHilbert:  {0, 0},
+	}
+
+	for order, firstTile := range tests {
+		traceSpec := renderer.RenderConfig{
+			SamplesPerPixel: 3,
+			Shader:          renderer.SimpleShader{},
+			Tiles:           &renderer.TileConfig{Size: 8, Order: order, SamplesPerPass: 2},
+		}
+		tiles, im := renderTileUpdates(createTestScene(traceSpec), 45, 20)
+
+		// 6x3 tiles rendered in two passes
+		assert.Len(t, tiles, 36)
+		assert.Equal(t, firstTile, image.Pt(tiles[0].X, tiles[0].Y))
+
+		pixelSamples := make([]int, 45*20)
+		for _, tile := range tiles {
+			bounds := tile.Image.Bounds()
+			assert.LessOrEqual(t, bounds.Dx(), 8)
+			assert.LessOrEqual(t, bounds.Dy(), 8)
+
+			for y := 0; y < bounds.Dy(); y++ {
+				for x := 0; x < bounds.Dx(); x++ {
+					pixelSamples[(tile.Y+y)*45+tile.X+x] += 1
+					if tile.Samples == 3 {
+						assert.Equal(t, im.At(tile.X+x, tile.Y+y), tile.Image.At(x, y))
+					}
+				}
+			}
+		}
+		for _, n := range pixelSamples {
+			assert.Equal(t, 2, n)
+		}
+	}
+}
+
+func TestTileProgressIncreases(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 2,
+		Shader:          renderer.SimpleShader{},
+		Tiles:           &renderer.TileConfig{Size: 4, Order: renderer.TileOrderHilbert},
+	}
+
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	go solstrale.RayTrace(10, 10, createTestScene(traceSpec), renderProgress, make(chan bool))
+
+	prev := 0.
+	for p := range renderProgress {
+		assert.GreaterOrEqual(t, p.Progress, prev)
+		prev = p.Progress
+	}
+	assert.Equal(t, 1., prev)
+}
+
+func TestAbortTileRendering(t *testing.T) {
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 100,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		Tiles:           &renderer.TileConfig{Size: 2},
+	}
+
+	renderProgress := make(chan renderer.RenderProgress, 1)
+	abort := make(chan bool, 1)
+	go solstrale.RayTrace(10, 10, createTestScene(traceSpec), renderProgress, abort)
+
+	progressCount := 0
+	for p := range renderProgress {
+		progressCount++
+		assert.NotNil(t, p.Tile)
+		select {
+		case abort <- true:
+		default:
+		}
+	}
+
+	// Tiles that were already done when aborting may still be reported,
+	// but far from all of the 25 tiles
+	assert.Less(t, progressCount, 5)
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/DanielPettersson/solstrale/geo"
+	im "github.com/DanielPettersson/solstrale/internal/image"
+	"github.com/DanielPettersson/solstrale/renderer"
+	"github.com/DanielPettersson/solstrale/tonemap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClampToneMapper(t *testing.T) {
+	tm := tonemap.NewClamp(0)
+	assert.Equal(t, geo.NewVec3(0, .5, 1), tm.ToneMap(geo.NewVec3(-1, .5, 3)))
+
+	tm = tonemap.NewClamp(1)
+	assert.Equal(t, geo.NewVec3(.5, 1, 1), tm.ToneMap(geo.NewVec3(.25, .5, 3)))
+
+	tm = tonemap.NewClamp(-2)
+	assert.Equal(t, geo.NewVec3(.25, .5, 1), tm.ToneMap(geo.NewVec3(1, 2, 8)))
+}
+
+func TestReinhardToneMapper(t *testing.T) {
+	tm := tonemap.NewReinhard(0, 0)
+	assert.Equal(t, geo.NewVec3(0, .5, .75), tm.ToneMap(geo.NewVec3(0, 1, 3)))
+
+	// Values at the white point are mapped to white
+	tm = tonemap.NewReinhard(0, 4)
+	c := tm.ToneMap(geo.NewVec3(4, 8, 1))
+	assert.InDelta(t, 1, c.X, 1e-9)
+	assert.Equal(t, 1., c.Y)
+	assert.InDelta(t, .53125, c.Z, 1e-9)
+}
+
+func TestAcesFilmicToneMapper(t *testing.T) {
+	tm := tonemap.NewAcesFilmic(0)
+
+	black := tm.ToneMap(geo.ZeroVector)
+	assert.InDelta(t, 0, black.Length(), 1e-3)
+
+	white := tm.ToneMap(geo.NewVec3(100, 100, 100))
+	assert.InDelta(t, 1, white.X, 1e-2)
+	assert.InDelta(t, 1, white.Y, 1e-2)
+	assert.InDelta(t, 1, white.Z, 1e-2)
+
+	// Grey stays grey and increases monotonically
+	prev := 0.
+	for _, v := range []float64{.01, .1, .18, .5, 1, 2, 5} {
+		c := tm.ToneMap(geo.NewVec3(v, v, v))
+		assert.InDelta(t, c.X, c.Y, 1e-3)
+		assert.InDelta(t, c.Y, c.Z, 1e-3)
+		assert.Greater(t, c.Y, prev)
+		prev = c.Y
+	}
+
+	// Exposure of one stop equals doubling the color
+	assert.Equal(t, tm.ToneMap(geo.NewVec3(.4, .2, .1)), tonemap.NewAcesFilmic(1).ToneMap(geo.NewVec3(.2, .1, .05)))
+}
+
+func TestLinearToSrgb(t *testing.T) {
+	assert.Equal(t, 0., im.LinearToSrgb(-1))
+	assert.InDelta(t, .01292, im.LinearToSrgb(.001), 1e-9)
+	assert.InDelta(t, .7353569, im.LinearToSrgb(.5), 1e-6)
+	assert.Equal(t, 1., im.LinearToSrgb(1))
+	assert.Equal(t, 1., im.LinearToSrgb(5))
+}
+
+func TestSrgbToLinear(t *testing.T) {
+	assert.Equal(t, 0., im.SrgbToLinear(-1))
+	assert.InDelta(t, .001, im.SrgbToLinear(.01292), 1e-9)
+	assert.InDelta(t, .5, im.SrgbToLinear(.7353569), 1e-6)
+	assert.Equal(t, 1., im.SrgbToLinear(1))
+	assert.Equal(t, 1., im.SrgbToLinear(5))
+	for _, v := range []float64{.002, .1, .3, .9} {
+		assert.InDelta(t, v, im.SrgbToLinear(im.LinearToSrgb(v)), 1e-9)
+	}
+}
+
+func TestToDisplayRgba(t *testing.T) {
+	// Without tone mapper gamma 2 is used
+	assert.Equal(t, im.ToRgba(geo.NewVec3(0, 0.3, 1), 2), im.ToDisplayRgba(geo.NewVec3(0, 0.3, 1), 2, nil))
+
+	rgba := im.ToDisplayRgba(geo.NewVec3(0, 1, 4), 2, tonemap.NewClamp(0))
+	assert.Equal(t, color.RGBA{R: 0x0, G: 0xbc, B: 0xff, A: 0xff}, rgba)
+}
+
+func TestRenderSceneWithToneMapper(t *testing.T) {
+
+	traceSpec := renderer.RenderConfig{
+		SamplesPerPixel: 25,
+		Shader:          renderer.PathTracingShader{MaxDepth: 50},
+		ToneMapper:      tonemap.NewAcesFilmic(0),
+	}
+	scene := createTestScene(traceSpec)
+
+	renderAndCompareOutput(t, scene, "toneMapped", 200, 100)
+}
+
+func TestMaxSampleValue(t *testing.T) {
+	render := func(maxSampleValue float64) []geo.Vec3 {
+		traceSpec := renderer.RenderConfig{
+			SamplesPerPixel: 2,
+			Shader:          renderer.PathTracingShader{MaxDepth: 50, MaxSampleValue: maxSampleValue},
+		}
+		return renderBuffers(createTestScene(traceSpec), 20, 10).Color
+	}
+
+	sum := func(pixels []geo.Vec3) float64 {
+		ret := 0.
+		for _, p := range pixels {
+			ret += p.X + p.Y + p.Z
+		}
+		return ret
+	}
+
+	assert.Equal(t, render(0), render(3))
+	assert.Greater(t, sum(render(3)), sum(render(1)))
+	assert.Greater(t, sum(render(-1)), sum(render(3)))
+}
@@ -24,10 +24,10 @@ func TestNewVec3(t *testing.T) {
 }
 
 func TestRandomVec3(t *testing.T) {
-	interval := util.Interval{Min: -2, Max: 2}
+	interval := geo.Interval{Min: -2, Max: 2}
 
 	for i := 0; i < 100; i++ {
-		vec := geo.RandomVec3(interval.Min, interval.Max)
+		vec := geo.RandomVec3(testRng, interval.Min, interval.Max)
 
 		assert.True(t, interval.Contains(vec.X))
 		assert.True(t, interval.Contains(vec.Y))
@@ -37,7 +37,7 @@ func TestRandomVec3(t *testing.T) {
 
 func TestRandomInUnitSphere(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		vec := geo.RandomInUnitSphere()
+		vec := geo.RandomInUnitSphere(testRng)
 
 		assert.True(t, vec.Length() <= 1)
 	}
@@ -45,7 +45,7 @@ func TestRandomInUnitSphere(t *testing.T) {
 
 func TestRandomUnitVector(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		vec := geo.RandomUnitVector()
+		vec := geo.RandomUnitVector(testRng)
 
 		assert.True(t, math.Abs(vec.Length()-1) < util.AlmostZero)
 	}
@@ -53,7 +53,7 @@ func TestRandomUnitVector(t *testing.T) {
 
 func TestRandomCosineDirection(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		vec := geo.RandomCosineDirection()
+		vec := geo.RandomCosineDirection(testRng)
 
 		assert.True(t, math.Abs(vec.Length()-1) < util.AlmostZero)
 	}
@@ -61,8 +61,8 @@ func TestRandomCosineDirection(t *testing.T) {
 
 func TestRandomInHemisphere(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		normal := geo.RandomUnitVector()
-		vec := geo.RandomInHemisphere(normal)
+		normal := geo.RandomUnitVector(testRng)
+		vec := geo.RandomInHemisphere(testRng, normal)
 
 		assert.True(
 			t, vec.Length() <= 1,
@@ -78,7 +78,7 @@ func TestRandomInHemisphere(t *testing.T) {
 func TestRandomInUnitDisc(t *testing.T) {
 
 	for i := 0; i < 100; i++ {
-		vec := geo.RandomInUnitDisc()
+		vec := geo.RandomInUnitDisc(testRng)
 
 		assert.True(
 			t, vec.Length() <= 1,
@@ -90,7 +90,7 @@ func TestRandomInUnitDisc(t *testing.T) {
 }
 
 func TestNeg(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
 	negVec := vec.Neg()
 
 	assert.Equal(t, -vec.X, negVec.X)
@@ -99,8 +99,8 @@ func TestNeg(t *testing.T) {
 }
 
 func TestAdd(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
-	addVec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
+	addVec := geo.RandomInUnitSphere(testRng)
 	resVec := vec.Add(addVec)
 
 	assert.Equal(t, vec.X+addVec.X, resVec.X)
@@ -109,8 +109,8 @@ func TestAdd(t *testing.T) {
 }
 
 func TestSub(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
-	subVec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
+	subVec := geo.RandomInUnitSphere(testRng)
 	resVec := vec.Sub(subVec)
 
 	assert.Equal(t, vec.X-subVec.X, resVec.X)
@@ -119,8 +119,8 @@ func TestSub(t *testing.T) {
 }
 
 func TestMul(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
-	mulVec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
+	mulVec := geo.RandomInUnitSphere(testRng)
 	resVec := vec.Mul(mulVec)
 
 	assert.Equal(t, vec.X*mulVec.X, resVec.X)
@@ -129,7 +129,7 @@ func TestMul(t *testing.T) {
 }
 
 func TestMulS(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
 	mul := random.RandomFloat(-1, 1)
 	resVec := vec.MulS(mul)
 
@@ -139,7 +139,7 @@ func TestMulS(t *testing.T) {
 }
 
 func TestDivS(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
 	div := random.RandomFloat(0.5, 1)
 	resVec := vec.DivS(div)
 
@@ -165,7 +165,7 @@ func TestCross(t *testing.T) {
 }
 
 func TestLengthSquared(t *testing.T) {
-	vec := geo.RandomInUnitSphere()
+	vec := geo.RandomInUnitSphere(testRng)
 	assert.True(t, math.Abs(vec.LengthSquared()-math.Pow(vec.Length(), 2)) < util.AlmostZero)
 }
 
@@ -174,8 +174,13 @@ func TestLength(t *testing.T) {
 	assert.Equal(t, float64(5), len)
 }
 
+func TestLuminance(t *testing.T) {
+	assert.InDelta(t, 1., geo.NewVec3(1, 1, 1).Luminance(), 1e-9)
+	assert.InDelta(t, .7152, geo.NewVec3(0, 1, 0).Luminance(), 1e-9)
+}
+
 func TestUnit(t *testing.T) {
-	vec := geo.RandomVec3(-10, 10)
+	vec := geo.RandomVec3(testRng, -10, 10)
 	unitVec := vec.Unit()
 
 	assert.True(t, math.Abs(unitVec.Length()-1) < util.AlmostZero)
@@ -184,7 +189,7 @@ func TestUnit(t *testing.T) {
 
 func TestNearZero(t *testing.T) {
 	assert.True(t, geo.ZeroVector.NearZero())
-	assert.False(t, geo.RandomVec3(1, 2).NearZero())
+	assert.False(t, geo.RandomVec3(testRng, 1, 2).NearZero())
 }
 
 func TestReflect(t *testing.T) {
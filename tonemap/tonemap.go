@@ -0,0 +1,121 @@
+// Package tonemap provides tone mappers that compress the linear scene values
+// of a rendered image into the displayable range 0 to 1
+package tonemap
+
+import (
+	"math"
+
+	"github.com/DanielPettersson/solstrale/geo"
+)
+
+// ToneMapper maps a linear scene color to a linear display color in the range 0 to 1.
+// The display encoding, e.g. sRGB, is applied after tone mapping.
+type ToneMapper interface {
+	ToneMap(col geo.Vec3) geo.Vec3
+}
+
+// exposureScale converts an exposure given in stops to a multiplier of the color
+func exposureScale(exposure float64) float64 {
+	return math.Pow(2, exposure)
+}
+
+func clamp(col geo.Vec3) geo.Vec3 {
+	return geo.NewVec3(
+		math.Max(0, math.Min(col.X, 1)),
+		math.Max(0, math.Min(col.Y, 1)),
+		math.Max(0, math.Min(col.Z, 1)),
+	)
+}
+
+type clampToneMapper struct {
+	scale float64
+}
+
+// NewClamp creates a tone mapper that only applies exposure and clamps the colors.
+// Exposure is given in stops, where each stop doubles the brightness.
+func NewClamp(exposure float64) ToneMapper {
+	return clampToneMapper{scale: exposureScale(exposure)}
+}
+
+// ToneMap applies exposure and clamps the color
+func (t clampToneMapper) ToneMap(col geo.Vec3) geo.Vec3 {
+	return clamp(col.MulS(t.scale))
+}
+
+type reinhardToneMapper struct {
+	scale         float64
+	invWhitePoint float64
+}
+
+// NewReinhard creates a tone mapper using the extended Reinhard operator.
+// Exposure is given in stops, where each stop doubles the brightness.
+// Values at the white point and above are mapped to white. A white point of
+// 0 gives the basic Reinhard operator where only infinite values are white.
+func NewReinhard(exposure, whitePoint float64) ToneMapper {
+	invWhitePoint := 0.
+	if whitePoint > 0 {
+		invWhitePoint = 1 / whitePoint
+	}
+	return reinhardToneMapper{
+		scale:         exposureScale(exposure),
+		invWhitePoint: invWhitePoint,
+	}
+}
+
+// ToneMap applies exposure and the Reinhard operator to each color channel
+func (t reinhardToneMapper) ToneMap(col geo.Vec3) geo.Vec3 {
+	c := col.MulS(t.scale)
+	return clamp(geo.NewVec3(
+		t.reinhard(c.X),
+		t.reinhard(c.Y),
+		t.reinhard(c.Z),
+	))
+}
+
+func (t reinhardToneMapper) reinhard(v float64) float64 {
+	w := t.invWhitePoint
+	return v * (1 + v*w*w) / (1 + v)
+}
+
+type acesFilmicToneMapper struct {
+	scale float64
+}
+
+// NewAcesFilmic creates a tone mapper with a fitted approximation of the
+// ACES reference rendering and output transforms, giving a filmic look.
+// Exposure is given in stops, where each stop doubles the brightness.
+func NewAcesFilmic(exposure float64) ToneMapper {
+	return acesFilmicToneMapper{scale: exposureScale(exposure)}
+}
+
+// Matrices converting between linear sRGB and the ACES working space,
+// from the fit by Stephen Hill
+var (
+	acesInput = [3]geo.Vec3{
+		{X: 0.59719, Y: 0.35458, Z: 0.04823},
+		{X: 0.07600, Y: 0.90834, Z: 0.01566},
+		{X: 0.02840, Y: 0.13383, Z: 0.83777},
+	}
+	acesOutput = [3]geo.Vec3{
+		{X: 1.60475, Y: -0.53108, Z: -0.07367},
+		{X: -0.10208, Y: 1.10813, Z: -0.00605},
+		{X: -0.00327, Y: -0.07276, Z: 1.07602},
+	}
+)
+
+// ToneMap applies exposure and the ACES filmic curve
+func (t acesFilmicToneMapper) ToneMap(col geo.Vec3) geo.Vec3 {
+	c := mulMatrix(acesInput, col.MulS(t.scale))
+	c = geo.NewVec3(rrtAndOdtFit(c.X), rrtAndOdtFit(c.Y), rrtAndOdtFit(c.Z))
+	return clamp(mulMatrix(acesOutput, c))
+}
+
+func rrtAndOdtFit(v float64) float64 {
+	a := v*(v+0.0245786) - 0.000090537
+	b := v*(0.983729*v+0.4329510) + 0.238081
+	return a / b
+}
+
+func mulMatrix(m [3]geo.Vec3, v geo.Vec3) geo.Vec3 {
+	return geo.NewVec3(m[0].Dot(v), m[1].Dot(v), m[2].Dot(v))
+}